@@ -350,6 +350,10 @@ func (s *Server) handleEquityHistory(c *gin.Context) {
 	for _, record := range records {
 		// TotalBalance字段实际存储的是TotalEquity
 		totalEquity := record.AccountState.TotalBalance
+		// 跳过没有账户快照的周期（风控暂停中或构建上下文失败）
+		if totalEquity == 0 && !record.Success {
+			continue
+		}
 		// TotalUnrealizedProfit字段实际存储的是TotalPnL（相对初始余额）
 		totalPnL := record.AccountState.TotalUnrealizedProfit
 
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"nofx/api"
+	"nofx/backtest"
+	"nofx/config"
+	"nofx/manager"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runBacktest 回测子命令：nofx backtest -trader <id> -start <时间> -end <时间> [选项]
+func runBacktest(args []string) {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	configFile := fs.String("config", "config.json", "配置文件路径")
+	traderID := fs.String("trader", "", "要回测的trader ID（默认使用配置中的第一个trader）")
+	startStr := fs.String("start", "", "回测开始时间（UTC），格式 2006-01-02 或 2006-01-02T15:04")
+	endStr := fs.String("end", "", "回测结束时间（UTC），格式同上，默认为当前时间")
+	symbolsStr := fs.String("symbols", "", "候选币种，逗号分隔（默认使用配置中的default_coins）")
+	interval := fs.Duration("interval", 0, "决策周期间隔（默认使用trader的scan_interval_minutes）")
+	feeRate := fs.Float64("fee", -1, "吃单手续费率（默认使用trader的paper_taker_fee_rate，未配置则为0.0004）")
+	makerFeeRate := fs.Float64("maker-fee", -1, "挂单手续费率（默认使用trader的paper_maker_fee_rate，未配置则为0.0002）")
+	slippage := fs.Float64("slippage", -1, "成交滑点比例（默认使用trader的paper_slippage，未配置则为0.0005）")
+	dataDir := fs.String("data-dir", "backtest_data", "历史K线缓存目录")
+	serve := fs.Bool("serve", false, "回测结束后启动API服务器，在Web界面查看回测结果")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatalf("❌ 加载配置失败: %v", err)
+	}
+
+	// 选择要回测的trader
+	var traderCfg *config.TraderConfig
+	for i := range cfg.Traders {
+		if *traderID == "" || cfg.Traders[i].ID == *traderID {
+			traderCfg = &cfg.Traders[i]
+			break
+		}
+	}
+	if traderCfg == nil {
+		log.Fatalf("❌ 配置中找不到trader: %s", *traderID)
+	}
+
+	startTime, err := parseBacktestTime(*startStr)
+	if err != nil {
+		log.Fatalf("❌ 回测开始时间无效: %v", err)
+	}
+	endTime := time.Now().UTC().Truncate(time.Minute)
+	if *endStr != "" {
+		endTime, err = parseBacktestTime(*endStr)
+		if err != nil {
+			log.Fatalf("❌ 回测结束时间无效: %v", err)
+		}
+	}
+
+	symbols := cfg.DefaultCoins
+	if *symbolsStr != "" {
+		symbols = strings.Split(*symbolsStr, ",")
+	}
+
+	// 回测结果以独立的trader ID保存，不覆盖实盘数据
+	btCfg := *traderCfg
+	btCfg.ID = "backtest_" + traderCfg.ID
+	btCfg.Name = traderCfg.Name + " (回测)"
+	btCfg.Exchange = "paper"
+	if *feeRate >= 0 {
+		btCfg.PaperTakerFeeRate = *feeRate
+	} else if traderCfg.Exchange != "paper" {
+		btCfg.PaperTakerFeeRate = 0.0004
+	}
+	if *makerFeeRate >= 0 {
+		btCfg.PaperMakerFeeRate = *makerFeeRate
+	} else if traderCfg.Exchange != "paper" {
+		btCfg.PaperMakerFeeRate = 0.0002
+	}
+	if *slippage >= 0 {
+		btCfg.PaperSlippage = *slippage
+	} else if traderCfg.Exchange != "paper" {
+		btCfg.PaperSlippage = 0.0005
+	}
+
+	autoTraderCfg := manager.BuildAutoTraderConfig(btCfg, "", cfg.MaxDailyLoss, cfg.MaxDrawdown, cfg.StopTradingMinutes, cfg.RiskBreachAction, cfg.Leverage, cfg.Risk, cfg.AIPricing)
+	if *interval > 0 {
+		autoTraderCfg.ScanInterval = *interval
+	}
+
+	engine, err := backtest.NewEngine(backtest.Config{
+		Trader:    autoTraderCfg,
+		Symbols:   symbols,
+		StartTime: startTime,
+		EndTime:   endTime,
+		DataDir:   *dataDir,
+	})
+	if err != nil {
+		log.Fatalf("❌ 初始化回测失败: %v", err)
+	}
+
+	result, err := engine.Run()
+	if err != nil {
+		log.Fatalf("❌ 回测失败: %v", err)
+	}
+
+	fmt.Println()
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Printf("📊 回测结果 - %s\n", btCfg.Name)
+	fmt.Println(strings.Repeat("=", 60))
+	fmt.Print(result.Format())
+	fmt.Println(strings.Repeat("=", 60))
+
+	if !*serve {
+		return
+	}
+
+	// 以冻结的回测账户展示结果（不启动交易循环，价格停在回测结束时，不写入磁盘），复用Web界面
+	traderManager := manager.NewTraderManager()
+	if err := traderManager.AddAutoTrader(btCfg.ID, engine.Trader()); err != nil {
+		log.Fatalf("❌ 加载回测结果失败: %v", err)
+	}
+
+	apiServer := api.NewServer(traderManager, cfg.APIServerPort)
+	go func() {
+		if err := apiServer.Start(); err != nil {
+			log.Printf("❌ API服务器错误: %v", err)
+		}
+	}()
+
+	fmt.Println("按 Ctrl+C 退出")
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	<-sigChan
+}
+
+// parseBacktestTime 解析回测时间参数（UTC）
+func parseBacktestTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("时间不能为空")
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间 %q", s)
+}
@@ -0,0 +1,127 @@
+package backtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"nofx/market"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	intradayLookback = 40 // 3分钟K线回看数量（与market.Get一致）
+	longerLookback   = 60 // 4小时K线回看数量（与market.Get一致）
+)
+
+// symbolKlines 单个币种的历史K线
+type symbolKlines struct {
+	klines3m []market.Kline
+	klines4h []market.Kline
+	extra    map[string][]market.Kline // 自定义K线周期 interval -> K线
+}
+
+// loadKlines 加载历史K线（优先读取本地缓存，没有则从Binance下载并缓存）
+func loadKlines(dataDir, symbol, interval string, startTime, endTime time.Time) ([]market.Kline, error) {
+	startMs := startTime.UnixMilli()
+	endMs := endTime.UnixMilli()
+	cacheFile := filepath.Join(dataDir, fmt.Sprintf("%s_%s_%d_%d.json", symbol, interval, startMs, endMs))
+
+	if data, err := ioutil.ReadFile(cacheFile); err == nil {
+		var klines []market.Kline
+		if err := json.Unmarshal(data, &klines); err != nil {
+			return nil, fmt.Errorf("解析K线缓存失败 %s: %w", cacheFile, err)
+		}
+		log.Printf("📂 读取K线缓存: %s %s (%d根)", symbol, interval, len(klines))
+		return klines, nil
+	}
+
+	log.Printf("⬇️  下载历史K线: %s %s %s ~ %s", symbol, interval,
+		startTime.Format("2006-01-02 15:04"), endTime.Format("2006-01-02 15:04"))
+	klines, err := market.GetKlinesRange(symbol, interval, startMs, endMs)
+	if err != nil {
+		return nil, fmt.Errorf("下载%s %s K线失败: %w", symbol, interval, err)
+	}
+	if len(klines) == 0 {
+		return nil, fmt.Errorf("%s %s 在指定时间范围内没有K线数据", symbol, interval)
+	}
+
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		log.Printf("⚠ 创建K线缓存目录失败: %v", err)
+		return klines, nil
+	}
+	data, err := json.Marshal(klines)
+	if err == nil {
+		if err := ioutil.WriteFile(cacheFile, data, 0644); err != nil {
+			log.Printf("⚠ 写入K线缓存失败: %v", err)
+		}
+	}
+
+	return klines, nil
+}
+
+// closedBefore 返回在指定时间之前已收盘的K线（最多保留最近limit根）
+func closedBefore(klines []market.Kline, t time.Time, limit int) []market.Kline {
+	ts := t.UnixMilli()
+	// 第一根尚未收盘的K线位置
+	n := sort.Search(len(klines), func(i int) bool {
+		return klines[i].CloseTime >= ts
+	})
+	start := n - limit
+	if start < 0 {
+		start = 0
+	}
+	return klines[start:n]
+}
+
+// dataAt 使用截止到指定时间的历史K线构建市场数据（与实盘指标计算完全一致）
+func (k *symbolKlines) dataAt(symbol string, t time.Time, timeframes []market.TimeframeSpec) (*market.Data, error) {
+	klines3m := closedBefore(k.klines3m, t, intradayLookback)
+	klines4h := closedBefore(k.klines4h, t, longerLookback)
+	if len(klines3m) == 0 {
+		return nil, fmt.Errorf("%s 在 %s 之前没有历史K线", symbol, t.Format("2006-01-02 15:04"))
+	}
+
+	// 历史OI和资金费率不可得，OpenInterest为空时决策引擎不做流动性过滤
+	data, err := market.BuildData(symbol, klines3m, klines4h)
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range timeframes {
+		klines := closedBefore(k.extra[spec.Interval], t, spec.Lookback)
+		data.Timeframes = append(data.Timeframes, market.BuildTimeframe(spec, klines))
+	}
+	return data, nil
+}
+
+// candlePath 单根K线内的模拟价格路径（开→高/低→低/高→收）
+type candlePath struct {
+	openTime int64
+	prices   [4]float64
+}
+
+// pathsBetween 返回在[from, to)区间内收盘的3分钟K线价格路径
+// 用于在两个决策周期之间检查止损止盈和强平
+func (k *symbolKlines) pathsBetween(from, to time.Time) []candlePath {
+	fromMs := from.UnixMilli()
+	toMs := to.UnixMilli()
+
+	var paths []candlePath
+	for _, kline := range k.klines3m {
+		if kline.CloseTime < fromMs || kline.CloseTime >= toMs {
+			continue
+		}
+		// 阳线假设先探低再冲高，阴线反之
+		path := candlePath{openTime: kline.OpenTime}
+		if kline.Close >= kline.Open {
+			path.prices = [4]float64{kline.Open, kline.Low, kline.High, kline.Close}
+		} else {
+			path.prices = [4]float64{kline.Open, kline.High, kline.Low, kline.Close}
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
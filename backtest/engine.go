@@ -0,0 +1,411 @@
+package backtest
+
+import (
+	"fmt"
+	"log"
+	"nofx/instrument"
+	"nofx/logger"
+	"nofx/market"
+	"nofx/trader"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config 回测配置
+type Config struct {
+	// Trader 被回测的trader配置（AI模型、杠杆、初始资金、扫描间隔、手续费和滑点、风控）
+	// 决策日志写入 decision_logs/<ID>，模拟账户写入 paper_trading/<ID>.json，开始前会清空
+	Trader trader.AutoTraderConfig
+
+	Symbols   []string  // 候选币种
+	StartTime time.Time // 回测开始时间
+	EndTime   time.Time // 回测结束时间
+	DataDir   string    // 历史K线缓存目录（默认backtest_data）
+}
+
+// Result 回测结果汇总
+type Result struct {
+	TraderID       string                      `json:"trader_id"`
+	StartTime      time.Time                   `json:"start_time"`
+	EndTime        time.Time                   `json:"end_time"`
+	Cycles         int                         `json:"cycles"`
+	InitialBalance float64                     `json:"initial_balance"`
+	FinalEquity    float64                     `json:"final_equity"`
+	ReturnPct      float64                     `json:"return_pct"`
+	MaxDrawdownPct float64                     `json:"max_drawdown_pct"`
+	Performance    *logger.PerformanceAnalysis `json:"performance"`
+}
+
+// Engine 回测引擎
+// 按模拟时间逐周期驱动AutoTrader（与实盘相同的决策、执行和日志流程），
+// 市场数据由截止到模拟时刻的历史K线构建，订单在模拟盘账户中成交
+type Engine struct {
+	config     Config
+	klines     map[string]*symbolKlines // symbol -> 历史K线
+	timeframes []market.TimeframeSpec   // 自定义K线周期和指标
+	now        time.Time                // 当前模拟时间
+	tickPrices map[string]float64       // 周期间回放K线时的模拟价格
+	paper      *trader.PaperTrader
+	autoTrader *trader.AutoTrader
+}
+
+// NewEngine 创建回测引擎（下载或读取历史K线，并初始化模拟账户）
+func NewEngine(cfg Config) (*Engine, error) {
+	if !cfg.EndTime.After(cfg.StartTime) {
+		return nil, fmt.Errorf("回测结束时间必须晚于开始时间")
+	}
+	if len(cfg.Symbols) == 0 {
+		return nil, fmt.Errorf("回测币种不能为空")
+	}
+	if cfg.Trader.InitialBalance <= 0 {
+		return nil, fmt.Errorf("初始金额必须大于0")
+	}
+	if cfg.Trader.ScanInterval <= 0 {
+		cfg.Trader.ScanInterval = 3 * time.Minute
+	}
+	if cfg.DataDir == "" {
+		cfg.DataDir = "backtest_data"
+	}
+
+	symbols := make([]string, 0, len(cfg.Symbols))
+	for _, symbol := range cfg.Symbols {
+		symbols = append(symbols, instrument.Canonical(symbol))
+	}
+	cfg.Symbols = symbols
+
+	timeframes, err := market.ParseTimeframes(cfg.Trader.Timeframes)
+	if err != nil {
+		return nil, fmt.Errorf("K线周期配置错误: %w", err)
+	}
+
+	e := &Engine{
+		config:     cfg,
+		timeframes: timeframes,
+		klines:     make(map[string]*symbolKlines),
+		now:        cfg.StartTime,
+		tickPrices: make(map[string]float64),
+	}
+
+	// 自定义K线周期（同一周期取最大回看数量）
+	lookbacks := make(map[string]int)
+	for _, spec := range timeframes {
+		if spec.Lookback > lookbacks[spec.Interval] {
+			lookbacks[spec.Interval] = spec.Lookback
+		}
+	}
+
+	// 1. 加载历史K线（开始时间前额外加载指标计算所需的回看数据）
+	for _, symbol := range cfg.Symbols {
+		klines3m, err := loadKlines(cfg.DataDir, symbol, "3m",
+			cfg.StartTime.Add(-intradayLookback*3*time.Minute), cfg.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		klines4h, err := loadKlines(cfg.DataDir, symbol, "4h",
+			cfg.StartTime.Add(-longerLookback*4*time.Hour), cfg.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		sk := &symbolKlines{klines3m: klines3m, klines4h: klines4h, extra: make(map[string][]market.Kline)}
+		for interval, lookback := range lookbacks {
+			warmup := time.Duration(lookback) * market.IntervalDuration(interval)
+			klines, err := loadKlines(cfg.DataDir, symbol, interval, cfg.StartTime.Add(-warmup), cfg.EndTime)
+			if err != nil {
+				return nil, err
+			}
+			sk.extra[interval] = klines
+		}
+		e.klines[symbol] = sk
+	}
+
+	// 2. 清空上次回测结果（与实盘trader使用相同的目录结构，方便Web界面查看）
+	logDir := fmt.Sprintf("decision_logs/%s", cfg.Trader.ID)
+	stateFile := fmt.Sprintf("paper_trading/%s.json", cfg.Trader.ID)
+	if err := os.RemoveAll(logDir); err != nil {
+		return nil, fmt.Errorf("清空回测日志目录失败: %w", err)
+	}
+	for _, file := range []string{stateFile, fmt.Sprintf("trader_state/%s.json", cfg.Trader.ID)} {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("清空上次回测状态失败: %w", err)
+		}
+	}
+
+	// 3. 创建模拟账户和AutoTrader（注入模拟时钟和历史行情）
+	paper, err := trader.NewPaperTrader(cfg.Trader.InitialBalance, cfg.Trader.PaperTakerFeeRate, cfg.Trader.PaperSlippage, stateFile)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Trader.PaperMakerFeeRate > 0 {
+		paper.SetMakerFeeRate(cfg.Trader.PaperMakerFeeRate)
+	}
+	paper.SetClock(e.clock)
+	paper.SetPriceSource(e.price)
+
+	cfg.Trader.Exchange = "paper"
+	autoTrader, err := trader.NewAutoTraderWithTrader(cfg.Trader, paper)
+	if err != nil {
+		return nil, err
+	}
+	autoTrader.SetClock(e.clock)
+	autoTrader.SetMarketDataSource(e.marketData)
+	autoTrader.SetCandidateSymbols(cfg.Symbols)
+
+	e.paper = paper
+	e.autoTrader = autoTrader
+	return e, nil
+}
+
+// Trader 返回回测使用的AutoTrader，并冻结模拟账户（回测结束后用于Web界面只读展示，查询不会改写回测结果）
+func (e *Engine) Trader() *trader.AutoTrader {
+	e.paper.Freeze()
+	return e.autoTrader
+}
+
+// clock 返回当前模拟时间
+func (e *Engine) clock() time.Time {
+	return e.now
+}
+
+// marketData 返回截止到当前模拟时间的市场数据
+func (e *Engine) marketData(symbol string) (*market.Data, error) {
+	symbol = instrument.Canonical(symbol)
+	k, ok := e.klines[symbol]
+	if !ok {
+		return nil, fmt.Errorf("%s 不在回测币种列表中", symbol)
+	}
+	return k.dataAt(symbol, e.now, e.timeframes)
+}
+
+// price 返回当前模拟价格（回放K线时使用路径价格，否则使用最近收盘价）
+func (e *Engine) price(symbol string) (float64, error) {
+	symbol = instrument.Canonical(symbol)
+	if price, ok := e.tickPrices[symbol]; ok {
+		return price, nil
+	}
+	k, ok := e.klines[symbol]
+	if !ok {
+		return 0, fmt.Errorf("%s 不在回测币种列表中", symbol)
+	}
+	closed := closedBefore(k.klines3m, e.now, 1)
+	if len(closed) == 0 {
+		return 0, fmt.Errorf("%s 在 %s 之前没有历史K线", symbol, e.now.Format("2006-01-02 15:04"))
+	}
+	return closed[0].Close, nil
+}
+
+// Run 执行回测
+func (e *Engine) Run() (*Result, error) {
+	cfg := e.config
+	totalCycles := int(cfg.EndTime.Sub(cfg.StartTime)/cfg.Trader.ScanInterval) + 1
+
+	log.Printf("🔬 开始回测 [%s]: %s ~ %s | 周期间隔 %v | 共 %d 个周期 | 币种 %v",
+		cfg.Trader.Name, cfg.StartTime.Format("2006-01-02 15:04"), cfg.EndTime.Format("2006-01-02 15:04"),
+		cfg.Trader.ScanInterval, totalCycles, cfg.Symbols)
+
+	cycles := 0
+	prev := cfg.StartTime
+	for t := cfg.StartTime; !t.After(cfg.EndTime); t = t.Add(cfg.Trader.ScanInterval) {
+		// 回放两个周期之间的K线，触发止损止盈和强平
+		e.replay(prev, t)
+		e.now = t
+		prev = t
+
+		cycles++
+		log.Printf("🔬 回测进度: %d/%d (%s)", cycles, totalCycles, t.Format("2006-01-02 15:04"))
+		if err := e.autoTrader.RunCycle(); err != nil {
+			log.Printf("❌ 回测周期执行失败: %v", err)
+		}
+	}
+
+	if err := e.closeAllPositions(); err != nil {
+		log.Printf("⚠ 回测结束平仓失败: %v", err)
+	}
+
+	return e.summarize(cycles)
+}
+
+// replay 按时间顺序回放[from, to)内收盘的K线价格路径
+func (e *Engine) replay(from, to time.Time) {
+	// 没有持仓也没有限价挂单时无需回放
+	positions, err := e.paper.GetPositions()
+	if err != nil {
+		return
+	}
+	orders, err := e.paper.GetOpenOrders("")
+	if err != nil || (len(positions) == 0 && len(orders) == 0) {
+		return
+	}
+
+	// 按K线开盘时间合并所有币种的价格路径
+	pathsByTime := make(map[int64]map[string][4]float64)
+	for symbol, k := range e.klines {
+		for _, path := range k.pathsBetween(from, to) {
+			if pathsByTime[path.openTime] == nil {
+				pathsByTime[path.openTime] = make(map[string][4]float64)
+			}
+			pathsByTime[path.openTime][symbol] = path.prices
+		}
+	}
+
+	openTimes := make([]int64, 0, len(pathsByTime))
+	for openTime := range pathsByTime {
+		openTimes = append(openTimes, openTime)
+	}
+	sort.Slice(openTimes, func(i, j int) bool { return openTimes[i] < openTimes[j] })
+
+	for _, openTime := range openTimes {
+		e.now = time.UnixMilli(openTime).Add(3 * time.Minute)
+		for i := 0; i < 4; i++ {
+			for symbol, prices := range pathsByTime[openTime] {
+				e.tickPrices[symbol] = prices[i]
+			}
+			// 查询持仓会按当前价格处理挂单触发（止损止盈和限价单成交）和强平
+			e.paper.GetPositions()
+		}
+	}
+
+	e.tickPrices = make(map[string]float64)
+}
+
+// closeAllPositions 回测结束时按最后价格平掉所有持仓，并写入决策记录（保证交易统计完整）
+func (e *Engine) closeAllPositions() error {
+	positions, err := e.paper.GetPositions()
+	if err != nil {
+		return err
+	}
+	if len(positions) == 0 {
+		return nil
+	}
+
+	record := &logger.DecisionRecord{
+		Timestamp:    e.now,
+		CoTTrace:     "回测结束，按最后价格平掉所有持仓",
+		ExecutionLog: []string{},
+		Success:      true,
+	}
+
+	for _, pos := range positions {
+		symbol := pos.Symbol
+		side := pos.Side
+		quantity := pos.Quantity
+
+		actionRecord := logger.DecisionAction{
+			Action:    "close_" + side,
+			Symbol:    symbol,
+			Quantity:  quantity,
+			Timestamp: e.now,
+		}
+
+		var order *trader.OrderResult
+		if side == "long" {
+			order, err = e.paper.CloseLong(symbol, 0)
+		} else {
+			order, err = e.paper.CloseShort(symbol, 0)
+		}
+		if err != nil {
+			actionRecord.Error = err.Error()
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 失败: %v", symbol, actionRecord.Action, err))
+		} else {
+			actionRecord.Success = true
+			actionRecord.Price = order.AvgPrice
+			actionRecord.Quantity = order.FilledQty
+			actionRecord.OrderID = order.OrderID
+			actionRecord.Fee = order.Fee
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 成功", symbol, actionRecord.Action))
+		}
+		record.Decisions = append(record.Decisions, actionRecord)
+	}
+
+	balance, err := e.paper.GetBalance()
+	if err != nil {
+		return err
+	}
+	wallet := balance.TotalWalletBalance
+	unrealized := balance.TotalUnrealizedProfit
+	available := balance.AvailableBalance
+	record.AccountState = logger.AccountSnapshot{
+		TotalBalance:          wallet + unrealized,
+		AvailableBalance:      available,
+		TotalUnrealizedProfit: wallet + unrealized - e.config.Trader.InitialBalance, // 与实盘一致，存储总盈亏
+	}
+
+	return e.autoTrader.GetDecisionLogger().LogDecision(record)
+}
+
+// summarize 汇总回测结果（交易统计复用AnalyzePerformance）
+func (e *Engine) summarize(cycles int) (*Result, error) {
+	decisionLogger := e.autoTrader.GetDecisionLogger()
+
+	// 多读取一条，包含回测结束时的平仓记录
+	records, err := decisionLogger.GetLatestRecords(cycles + 1)
+	if err != nil {
+		return nil, err
+	}
+	performance, err := decisionLogger.AnalyzePerformance(cycles + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := e.paper.GetBalance()
+	if err != nil {
+		return nil, err
+	}
+	wallet := balance.TotalWalletBalance
+	unrealized := balance.TotalUnrealizedProfit
+
+	result := &Result{
+		TraderID:       e.config.Trader.ID,
+		StartTime:      e.config.StartTime,
+		EndTime:        e.config.EndTime,
+		Cycles:         cycles,
+		InitialBalance: e.config.Trader.InitialBalance,
+		FinalEquity:    wallet + unrealized,
+		Performance:    performance,
+	}
+	result.ReturnPct = (result.FinalEquity - result.InitialBalance) / result.InitialBalance * 100
+
+	// 按每个周期的账户净值计算最大回撤
+	peak := result.InitialBalance
+	for _, record := range records {
+		equity := record.AccountState.TotalBalance
+		if equity <= 0 {
+			continue
+		}
+		if equity > peak {
+			peak = equity
+		}
+		if drawdown := (peak - equity) / peak * 100; drawdown > result.MaxDrawdownPct {
+			result.MaxDrawdownPct = drawdown
+		}
+	}
+
+	return result, nil
+}
+
+// Format 格式化输出回测结果
+func (r *Result) Format() string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("回测区间: %s ~ %s (%d个周期)\n",
+		r.StartTime.Format("2006-01-02 15:04"), r.EndTime.Format("2006-01-02 15:04"), r.Cycles))
+	sb.WriteString(fmt.Sprintf("初始资金: %.2f USDT → 最终净值: %.2f USDT (%+.2f%%)\n",
+		r.InitialBalance, r.FinalEquity, r.ReturnPct))
+	sb.WriteString(fmt.Sprintf("最大回撤: %.2f%%\n", r.MaxDrawdownPct))
+
+	if r.Performance != nil {
+		sb.WriteString(fmt.Sprintf("交易次数: %d (盈利%d / 亏损%d) | 胜率: %.1f%% | 盈亏比: %.2f | 夏普比率: %.2f\n",
+			r.Performance.TotalTrades, r.Performance.WinningTrades, r.Performance.LosingTrades,
+			r.Performance.WinRate, r.Performance.ProfitFactor, r.Performance.SharpeRatio))
+		sb.WriteString(fmt.Sprintf("毛盈亏: %+.2f USDT | 手续费: %.2f USDT | 资金费: %+.2f USDT | 净盈亏: %+.2f USDT\n",
+			r.Performance.GrossPnL, r.Performance.TotalFees, r.Performance.TotalFunding, r.Performance.NetPnL))
+		if r.Performance.BestSymbol != "" {
+			sb.WriteString(fmt.Sprintf("最佳币种: %s | 最差币种: %s\n",
+				r.Performance.BestSymbol, r.Performance.WorstSymbol))
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("决策日志: decision_logs/%s\n", r.TraderID))
+	return sb.String()
+}
@@ -11,11 +11,11 @@ import (
 type TraderConfig struct {
 	ID      string `json:"id"`
 	Name    string `json:"name"`
-	Enabled bool   `json:"enabled"` // 是否启用该trader
-	AIModel string `json:"ai_model"` // "qwen" or "deepseek"
+	Enabled bool   `json:"enabled"`  // 是否启用该trader
+	AIModel string `json:"ai_model"` // "qwen", "deepseek", "custom", "anthropic", "gemini", "ollama" or "llamacpp"
 
 	// 交易平台选择（二选一）
-	Exchange string `json:"exchange"` // "binance" or "hyperliquid"
+	Exchange string `json:"exchange"` // "binance", "hyperliquid", "aster", "okx", "bybit" or "paper"
 
 	// 币安配置
 	BinanceAPIKey    string `json:"binance_api_key,omitempty"`
@@ -31,6 +31,22 @@ type TraderConfig struct {
 	AsterSigner     string `json:"aster_signer,omitempty"`      // Aster API钱包地址
 	AsterPrivateKey string `json:"aster_private_key,omitempty"` // Aster API钱包私钥
 
+	// OKX配置
+	OKXAPIKey     string `json:"okx_api_key,omitempty"`
+	OKXSecretKey  string `json:"okx_secret_key,omitempty"`
+	OKXPassphrase string `json:"okx_passphrase,omitempty"` // 创建API Key时设置的密码
+	OKXTestnet    bool   `json:"okx_testnet,omitempty"`    // 使用模拟盘（需使用模拟盘API Key）
+
+	// Bybit配置
+	BybitAPIKey    string `json:"bybit_api_key,omitempty"`
+	BybitSecretKey string `json:"bybit_secret_key,omitempty"`
+	BybitTestnet   bool   `json:"bybit_testnet,omitempty"`
+
+	// 模拟盘配置（exchange为"paper"时使用）
+	PaperTakerFeeRate float64 `json:"paper_taker_fee_rate,omitempty"` // 吃单手续费率（默认0.0004，即0.04%）
+	PaperMakerFeeRate float64 `json:"paper_maker_fee_rate,omitempty"` // 挂单手续费率（默认0.0002，即0.02%）
+	PaperSlippage     float64 `json:"paper_slippage,omitempty"`       // 成交滑点比例（默认0.0005，即0.05%）
+
 	// AI配置
 	QwenKey     string `json:"qwen_key,omitempty"`
 	DeepSeekKey string `json:"deepseek_key,omitempty"`
@@ -40,8 +56,65 @@ type TraderConfig struct {
 	CustomAPIKey    string `json:"custom_api_key,omitempty"`
 	CustomModelName string `json:"custom_model_name,omitempty"`
 
+	// Anthropic / Gemini / 本地模型配置
+	AnthropicKey string `json:"anthropic_key,omitempty"`
+	GeminiKey    string `json:"gemini_key,omitempty"`
+	OllamaURL    string `json:"ollama_url,omitempty"`    // 默认 http://localhost:11434
+	LlamaCppURL  string `json:"llamacpp_url,omitempty"`  // 默认 http://localhost:8080/v1
+	AIModelName  string `json:"ai_model_name,omitempty"` // 覆盖默认模型（如 deepseek-reasoner），ollama必填
+
+	// 模型参数（所有提供商通用）
+	AITemperature     *float64 `json:"ai_temperature,omitempty"`      // 采样温度（默认0.5）
+	AIMaxTokens       int      `json:"ai_max_tokens,omitempty"`       // 最大输出token数（默认2000）
+	AIReasoningEffort string   `json:"ai_reasoning_effort,omitempty"` // 推理强度: "low", "medium", "high"（默认不开启）
+
+	// AI输出方式: "auto"(默认，优先函数调用，不支持时回退文本), "tools", "json_schema", "text"
+	AIOutputMode string `json:"ai_output_mode,omitempty"`
+	// 使用SSE流式响应（长推理输出不会触发120秒超时）
+	AIStream bool `json:"ai_stream,omitempty"`
+
 	InitialBalance      float64 `json:"initial_balance"`
 	ScanIntervalMinutes int     `json:"scan_interval_minutes"`
+
+	// 保证金模式: "isolated"(默认，逐仓) 或 "cross"(全仓)，AI可在单个开仓决策中覆盖
+	MarginMode string `json:"margin_mode,omitempty"`
+
+	// 行情数据源: "binance", "hyperliquid" 或 "aster"（默认使用下单交易所的行情，OKX/Bybit/模拟盘使用币安）
+	MarketData string `json:"market_data,omitempty"`
+	// 参考价格数据源（可选，输出该交易所的价格及与行情数据源的价差）
+	ReferenceMarket string `json:"reference_market,omitempty"`
+
+	// 自定义K线周期和指标（为空时使用默认的3分钟+4小时数据）
+	Timeframes []TimeframeConfig `json:"timeframes,omitempty"`
+
+	// 持仓期间的止损管理（追踪止损、保本止损）
+	StopManagement StopManagementConfig `json:"stop_management,omitempty"`
+
+	// 同方向加仓（金字塔加仓/摊平），默认不启用
+	PositionScaling PositionScalingConfig `json:"position_scaling,omitempty"`
+}
+
+// PositionScalingConfig 加仓配置（max_adds为0时不允许加仓）
+type PositionScalingConfig struct {
+	MaxAdds        int     `json:"max_adds"`         // 每笔持仓最多加仓次数
+	MaxNotionalUSD float64 `json:"max_notional_usd"` // 加仓后单币种同方向持仓名义价值上限（USDT），超出时缩减加仓金额
+}
+
+// StopManagementConfig 止损管理配置（字段为0时不启用）
+// 止损只会向有利方向移动；追踪止损和保本止损同时启用时取更有利的止损价
+type StopManagementConfig struct {
+	TrailingPct        float64 `json:"trailing_pct"`          // 百分比追踪止损：止损价保持在持仓期间最优价格回撤该百分比处（如2表示2%）
+	TrailingATR        float64 `json:"trailing_atr"`          // ATR追踪止损：止损距离为4小时ATR14的倍数（如2表示2倍ATR）
+	BreakEvenPct       float64 `json:"break_even_pct"`        // 价格相对开仓价的浮盈达到该百分比后，将止损移至开仓价（不含杠杆）
+	BreakEvenOffsetPct float64 `json:"break_even_offset_pct"` // 保本止损在开仓价基础上向有利方向的偏移百分比（覆盖手续费，默认0）
+}
+
+// TimeframeConfig K线周期及指标配置
+type TimeframeConfig struct {
+	Interval     string   `json:"interval"`      // K线周期，如 "15m"、"1h"
+	Lookback     int      `json:"lookback"`      // 回看K线数量（默认100，最大1500）
+	SeriesLength int      `json:"series_length"` // 输出给AI的序列长度（默认10）
+	Indicators   []string `json:"indicators"`    // 指标，如 "ema:20"、"macd"、"rsi:14"、"bb:20:2"、"vwap"、"stochrsi"、"adx:14"、"obv"、"donchian:20"
 }
 
 // LeverageConfig 杠杆配置
@@ -50,18 +123,59 @@ type LeverageConfig struct {
 	AltcoinLeverage int `json:"altcoin_leverage"` // 山寨币的杠杆倍数（主账户建议5-20，子账户≤5）
 }
 
+// RiskConfig 开仓前风控规则配置
+// 带默认值的字段未设置(0)时使用默认值，设为负数关闭该规则；无默认值的字段为0时不启用
+type RiskConfig struct {
+	MaxPositions           int     `json:"max_positions"`            // 最大同时持仓数（默认3）
+	MaxGrossExposure       float64 `json:"max_gross_exposure"`       // 多空名义价值总和上限，账户净值倍数（默认不启用）
+	MaxNetExposure         float64 `json:"max_net_exposure"`         // 多空净名义价值上限，账户净值倍数（默认不启用）
+	MaxAltcoinNotional     float64 `json:"max_altcoin_notional"`     // 山寨币单币名义价值上限，账户净值倍数（默认1.5）
+	MaxBTCETHNotional      float64 `json:"max_btc_eth_notional"`     // BTC/ETH单币名义价值上限，账户净值倍数（默认10）
+	MaxCorrelated          int     `json:"max_correlated"`           // 同方向高相关山寨币最多持仓数（默认2）
+	CorrelationThreshold   float64 `json:"correlation_threshold"`    // 高相关阈值，收益率相关系数（默认0.8）
+	CooldownMinutes        int     `json:"cooldown_minutes"`         // 平仓后同币种冷却时间（默认15分钟）
+	MinLiquidationDistance float64 `json:"min_liquidation_distance"` // 入场价距强平价最小距离百分比（默认不启用）
+	MaxSlippageBps         float64 `json:"max_slippage_bps"`         // 市价开仓预计滑点上限（基点，需启用order_book，默认不启用）
+	MinNotional            float64 `json:"min_notional"`             // 缩减后最小下单价值USDT（默认10）
+}
+
 // Config 总配置
 type Config struct {
-	Traders            []TraderConfig `json:"traders"`
-	UseDefaultCoins    bool           `json:"use_default_coins"` // 是否使用默认主流币种列表
-	DefaultCoins       []string       `json:"default_coins"`     // 默认主流币种池
-	CoinPoolAPIURL     string         `json:"coin_pool_api_url"`
-	OITopAPIURL        string         `json:"oi_top_api_url"`
-	APIServerPort      int            `json:"api_server_port"`
-	MaxDailyLoss       float64        `json:"max_daily_loss"`
-	MaxDrawdown        float64        `json:"max_drawdown"`
-	StopTradingMinutes int            `json:"stop_trading_minutes"`
-	Leverage           LeverageConfig `json:"leverage"` // 杠杆配置
+	Traders             []TraderConfig     `json:"traders"`
+	UseDefaultCoins     bool               `json:"use_default_coins"` // 是否使用默认主流币种列表
+	DefaultCoins        []string           `json:"default_coins"`     // 默认主流币种池
+	CoinPoolAPIURL      string             `json:"coin_pool_api_url"`
+	OITopAPIURL         string             `json:"oi_top_api_url"`
+	DisableMarketStream bool               `json:"disable_market_stream"` // 关闭WebSocket行情缓存，每个周期使用REST拉取
+	OpenInterest        OpenInterestConfig `json:"open_interest"`         // 持仓量历史序列配置
+	OrderBook           OrderBookConfig    `json:"order_book"`            // 盘口快照配置
+	APIServerPort       int                `json:"api_server_port"`
+	MaxDailyLoss        float64            `json:"max_daily_loss"`
+	MaxDrawdown         float64            `json:"max_drawdown"`
+	StopTradingMinutes  int                `json:"stop_trading_minutes"`
+	RiskBreachAction    string             `json:"risk_breach_action"` // 触发日亏损/回撤限制后的处理: "close_all" 或 "freeze"
+	Leverage            LeverageConfig     `json:"leverage"`           // 杠杆配置
+	Risk                RiskConfig         `json:"risk"`               // 开仓前风控规则
+	AIPricing           map[string]AIPrice `json:"ai_pricing"`         // 各模型单价（键为模型名，如 "deepseek-chat"），用于估算API费用
+}
+
+// OpenInterestConfig 持仓量历史配置（字段为空时使用默认值；主动买卖量和多空账户比使用相同的period和series_length）
+type OpenInterestConfig struct {
+	Period       string `json:"period"`        // 统计周期: 5m/15m/30m/1h/2h/4h/6h/12h/1d（默认15m）
+	Limit        int    `json:"limit"`         // 拉取的数据点数量，用于计算平均值和1h/4h/24h变化（默认100，最多500）
+	SeriesLength int    `json:"series_length"` // 输出给AI的序列长度（默认10）
+}
+
+// OrderBookConfig 盘口快照配置（启用后每个周期为每个币种拉取一次盘口，计算价差、深度和滑点）
+type OrderBookConfig struct {
+	Enabled bool `json:"enabled"` // 是否获取盘口快照（默认关闭）
+	Limit   int  `json:"limit"`   // 拉取的档位数: 5/10/20/50/100/500/1000（默认100）
+}
+
+// AIPrice 模型单价（美元/百万token）
+type AIPrice struct {
+	InputPerMillion  float64 `json:"input_per_million"`  // 输入（prompt）单价
+	OutputPerMillion float64 `json:"output_per_million"` // 输出（含推理）单价
 }
 
 // LoadConfig 从文件加载配置
@@ -109,8 +223,23 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("至少需要配置一个trader")
 	}
 
+	// 风控触发处理方式（默认冻结：保留持仓和止损止盈，暂停AI交易）
+	if c.RiskBreachAction == "" {
+		c.RiskBreachAction = "freeze"
+	}
+	if c.RiskBreachAction != "close_all" && c.RiskBreachAction != "freeze" {
+		return fmt.Errorf("risk_breach_action必须是 'close_all' 或 'freeze'")
+	}
+
+	for model, price := range c.AIPricing {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 {
+			return fmt.Errorf("ai_pricing[%s]: 单价不能为负数", model)
+		}
+	}
+
 	traderIDs := make(map[string]bool)
-	for i, trader := range c.Traders {
+	for i := range c.Traders {
+		trader := &c.Traders[i]
 		if trader.ID == "" {
 			return fmt.Errorf("trader[%d]: ID不能为空", i)
 		}
@@ -122,16 +251,19 @@ func (c *Config) Validate() error {
 		if trader.Name == "" {
 			return fmt.Errorf("trader[%d]: Name不能为空", i)
 		}
-		if trader.AIModel != "qwen" && trader.AIModel != "deepseek" && trader.AIModel != "custom" {
-			return fmt.Errorf("trader[%d]: ai_model必须是 'qwen', 'deepseek' 或 'custom'", i)
+		switch trader.AIModel {
+		case "qwen", "deepseek", "custom", "anthropic", "gemini", "ollama", "llamacpp":
+		default:
+			return fmt.Errorf("trader[%d]: ai_model必须是 'qwen', 'deepseek', 'custom', 'anthropic', 'gemini', 'ollama' 或 'llamacpp'", i)
 		}
 
 		// 验证交易平台配置
 		if trader.Exchange == "" {
 			trader.Exchange = "binance" // 默认使用币安
 		}
-		if trader.Exchange != "binance" && trader.Exchange != "hyperliquid" && trader.Exchange != "aster" {
-			return fmt.Errorf("trader[%d]: exchange必须是 'binance', 'hyperliquid' 或 'aster'", i)
+		if trader.Exchange != "binance" && trader.Exchange != "hyperliquid" && trader.Exchange != "aster" &&
+			trader.Exchange != "okx" && trader.Exchange != "bybit" && trader.Exchange != "paper" {
+			return fmt.Errorf("trader[%d]: exchange必须是 'binance', 'hyperliquid', 'aster', 'okx', 'bybit' 或 'paper'", i)
 		}
 
 		// 根据平台验证对应的密钥
@@ -147,6 +279,47 @@ func (c *Config) Validate() error {
 			if trader.AsterUser == "" || trader.AsterSigner == "" || trader.AsterPrivateKey == "" {
 				return fmt.Errorf("trader[%d]: 使用Aster时必须配置aster_user, aster_signer和aster_private_key", i)
 			}
+		} else if trader.Exchange == "okx" {
+			if trader.OKXAPIKey == "" || trader.OKXSecretKey == "" || trader.OKXPassphrase == "" {
+				return fmt.Errorf("trader[%d]: 使用OKX时必须配置okx_api_key, okx_secret_key和okx_passphrase", i)
+			}
+		} else if trader.Exchange == "bybit" {
+			if trader.BybitAPIKey == "" || trader.BybitSecretKey == "" {
+				return fmt.Errorf("trader[%d]: 使用Bybit时必须配置bybit_api_key和bybit_secret_key", i)
+			}
+		} else if trader.Exchange == "paper" {
+			// 模拟盘无需密钥，只需设置手续费和滑点默认值
+			if trader.PaperTakerFeeRate < 0 || trader.PaperMakerFeeRate < 0 || trader.PaperSlippage < 0 {
+				return fmt.Errorf("trader[%d]: paper_taker_fee_rate、paper_maker_fee_rate和paper_slippage不能为负数", i)
+			}
+			if trader.PaperTakerFeeRate == 0 {
+				trader.PaperTakerFeeRate = 0.0004 // 默认0.04%（币安普通用户吃单费率）
+			}
+			if trader.PaperMakerFeeRate == 0 {
+				trader.PaperMakerFeeRate = 0.0002 // 默认0.02%（币安普通用户挂单费率）
+			}
+			if trader.PaperSlippage == 0 {
+				trader.PaperSlippage = 0.0005 // 默认0.05%
+			}
+		}
+
+		sm := trader.StopManagement
+		if sm.TrailingPct < 0 || sm.TrailingATR < 0 || sm.BreakEvenPct < 0 || sm.BreakEvenOffsetPct < 0 {
+			return fmt.Errorf("trader[%d]: stop_management的参数不能为负数", i)
+		}
+		if sm.TrailingPct >= 100 {
+			return fmt.Errorf("trader[%d]: stop_management.trailing_pct必须小于100: %.2f", i, sm.TrailingPct)
+		}
+		if sm.BreakEvenOffsetPct > 0 && sm.BreakEvenOffsetPct >= sm.BreakEvenPct {
+			return fmt.Errorf("trader[%d]: stop_management.break_even_offset_pct必须小于break_even_pct", i)
+		}
+
+		ps := trader.PositionScaling
+		if ps.MaxAdds < 0 || ps.MaxNotionalUSD < 0 {
+			return fmt.Errorf("trader[%d]: position_scaling的参数不能为负数", i)
+		}
+		if ps.MaxAdds > 0 && ps.MaxNotionalUSD <= 0 {
+			return fmt.Errorf("trader[%d]: 启用加仓时必须配置position_scaling.max_notional_usd", i)
 		}
 
 		if trader.AIModel == "qwen" && trader.QwenKey == "" {
@@ -166,12 +339,59 @@ func (c *Config) Validate() error {
 				return fmt.Errorf("trader[%d]: 使用自定义API时必须配置custom_model_name", i)
 			}
 		}
+		if trader.AIModel == "anthropic" && trader.AnthropicKey == "" {
+			return fmt.Errorf("trader[%d]: 使用Anthropic时必须配置anthropic_key", i)
+		}
+		if trader.AIModel == "gemini" && trader.GeminiKey == "" {
+			return fmt.Errorf("trader[%d]: 使用Gemini时必须配置gemini_key", i)
+		}
+		if trader.AIModel == "ollama" && trader.AIModelName == "" {
+			return fmt.Errorf("trader[%d]: 使用Ollama时必须配置ai_model_name", i)
+		}
+		if trader.AITemperature != nil && (*trader.AITemperature < 0 || *trader.AITemperature > 2) {
+			return fmt.Errorf("trader[%d]: ai_temperature必须在0-2之间", i)
+		}
+		if trader.AIMaxTokens < 0 {
+			return fmt.Errorf("trader[%d]: ai_max_tokens不能为负数", i)
+		}
+		if trader.AIReasoningEffort != "" && trader.AIReasoningEffort != "low" && trader.AIReasoningEffort != "medium" && trader.AIReasoningEffort != "high" {
+			return fmt.Errorf("trader[%d]: ai_reasoning_effort必须是 'low', 'medium' 或 'high'", i)
+		}
+		if trader.AIOutputMode == "" {
+			trader.AIOutputMode = "auto"
+		}
+		if trader.AIOutputMode != "auto" && trader.AIOutputMode != "tools" && trader.AIOutputMode != "json_schema" && trader.AIOutputMode != "text" {
+			return fmt.Errorf("trader[%d]: ai_output_mode必须是 'auto', 'tools', 'json_schema' 或 'text'", i)
+		}
 		if trader.InitialBalance <= 0 {
 			return fmt.Errorf("trader[%d]: initial_balance必须大于0", i)
 		}
 		if trader.ScanIntervalMinutes <= 0 {
 			trader.ScanIntervalMinutes = 3 // 默认3分钟
 		}
+		if trader.MarginMode == "" {
+			trader.MarginMode = "isolated"
+		}
+		if trader.MarginMode != "isolated" && trader.MarginMode != "cross" {
+			return fmt.Errorf("trader[%d]: margin_mode必须是 'isolated' 或 'cross'", i)
+		}
+		if trader.MarketData == "" {
+			trader.MarketData = "binance"
+			if trader.Exchange == "hyperliquid" || trader.Exchange == "aster" {
+				trader.MarketData = trader.Exchange
+			}
+		}
+		if !isMarketDataSource(trader.MarketData) {
+			return fmt.Errorf("trader[%d]: market_data必须是 'binance', 'hyperliquid' 或 'aster'", i)
+		}
+		if trader.ReferenceMarket != "" {
+			if !isMarketDataSource(trader.ReferenceMarket) {
+				return fmt.Errorf("trader[%d]: reference_market必须是 'binance', 'hyperliquid' 或 'aster'", i)
+			}
+			if trader.ReferenceMarket == trader.MarketData {
+				return fmt.Errorf("trader[%d]: reference_market不能与market_data相同", i)
+			}
+		}
 	}
 
 	if c.APIServerPort <= 0 {
@@ -192,6 +412,29 @@ func (c *Config) Validate() error {
 		fmt.Printf("⚠️  警告: 山寨币杠杆设置为%dx，如果使用子账户可能会失败（子账户限制≤5x）\n", c.Leverage.AltcoinLeverage)
 	}
 
+	// 设置风控规则默认值（与System Prompt中的约束一致）
+	if c.Risk.MaxPositions == 0 {
+		c.Risk.MaxPositions = 3
+	}
+	if c.Risk.MaxAltcoinNotional == 0 {
+		c.Risk.MaxAltcoinNotional = 1.5
+	}
+	if c.Risk.MaxBTCETHNotional == 0 {
+		c.Risk.MaxBTCETHNotional = 10
+	}
+	if c.Risk.MaxCorrelated == 0 {
+		c.Risk.MaxCorrelated = 2
+	}
+	if c.Risk.CorrelationThreshold == 0 {
+		c.Risk.CorrelationThreshold = 0.8
+	}
+	if c.Risk.CooldownMinutes == 0 {
+		c.Risk.CooldownMinutes = 15
+	}
+	if c.Risk.MinNotional == 0 {
+		c.Risk.MinNotional = 10
+	}
+
 	return nil
 }
 
@@ -199,3 +442,8 @@ func (c *Config) Validate() error {
 func (tc *TraderConfig) GetScanInterval() time.Duration {
 	return time.Duration(tc.ScanIntervalMinutes) * time.Minute
 }
+
+// isMarketDataSource 判断是否为支持的行情数据源
+func isMarketDataSource(name string) bool {
+	return name == "binance" || name == "hyperliquid" || name == "aster"
+}
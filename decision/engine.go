@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"nofx/market"
 	"nofx/mcp"
 	"nofx/pool"
@@ -23,7 +24,10 @@ type PositionInfo struct {
 	UnrealizedPnLPct float64 `json:"unrealized_pnl_pct"`
 	LiquidationPrice float64 `json:"liquidation_price"`
 	MarginUsed       float64 `json:"margin_used"`
-	UpdateTime       int64   `json:"update_time"` // 持仓更新时间戳（毫秒）
+	MarginMode       string  `json:"margin_mode,omitempty"` // "isolated" or "cross"（交易所未返回时为空）
+	UpdateTime       int64   `json:"update_time"`           // 持仓更新时间戳（毫秒）
+	StopLoss         float64 `json:"stop_loss,omitempty"`   // 当前止损价（未知时为0）
+	Adds             int     `json:"adds,omitempty"`        // 已加仓次数
 }
 
 // AccountInfo 账户信息
@@ -37,6 +41,19 @@ type AccountInfo struct {
 	PositionCount    int     `json:"position_count"`    // 持仓数量
 }
 
+// PendingOrderInfo 等待成交的限价开仓单
+type PendingOrderInfo struct {
+	Symbol     string  `json:"symbol"`
+	Side       string  `json:"side"`       // "long" or "short"
+	EntryType  string  `json:"entry_type"` // "limit" or "post_only"
+	Price      float64 `json:"price"`
+	Quantity   float64 `json:"quantity"`
+	StopLoss   float64 `json:"stop_loss"`
+	TakeProfit float64 `json:"take_profit"`
+	PlacedAt   int64   `json:"placed_at"` // 挂单时间（毫秒）
+	ExpireAt   int64   `json:"expire_at"` // 过期时间（毫秒）
+}
+
 // CandidateCoin 候选币种（来自币种池）
 type CandidateCoin struct {
 	Symbol  string   `json:"symbol"`
@@ -60,18 +77,26 @@ type Context struct {
 	CallCount       int                     `json:"call_count"`
 	Account         AccountInfo             `json:"account"`
 	Positions       []PositionInfo          `json:"positions"`
+	PendingOrders   []PendingOrderInfo      `json:"pending_orders"` // 等待成交的限价开仓单
 	CandidateCoins  []CandidateCoin         `json:"candidate_coins"`
 	MarketDataMap   map[string]*market.Data `json:"-"` // 不序列化，但内部使用
 	OITopDataMap    map[string]*OITopData   `json:"-"` // OI Top数据映射
 	Performance     interface{}             `json:"-"` // 历史表现分析（logger.PerformanceAnalysis）
 	BTCETHLeverage  int                     `json:"-"` // BTC/ETH杠杆倍数（从配置读取）
 	AltcoinLeverage int                     `json:"-"` // 山寨币杠杆倍数（从配置读取）
+	MaxAdds         int                     `json:"-"` // 每笔持仓最多加仓次数（为0时不允许加仓）
+	ExpectedHolding time.Duration           `json:"-"` // 预期持仓时长（用于估算资金费成本，为0时使用defaultExpectedHolding）
+
+	// MarketDataFetcher 市场数据获取函数（为空时使用 market.Get 实时获取，回测时替换为历史数据）
+	MarketDataFetcher func(symbol string) (*market.Data, error) `json:"-"`
+	// Now 决策时刻（为空时使用当前时间，回测时为模拟时间）
+	Now time.Time `json:"-"`
 }
 
 // Decision AI的交易决策
 type Decision struct {
 	Symbol          string  `json:"symbol"`
-	Action          string  `json:"action"` // "open_long", "open_short", "close_long", "close_short", "hold", "wait"
+	Action          string  `json:"action" enum:"open_long,open_short,add_to_long,add_to_short,close_long,close_short,partial_close,update_stop,hold,wait"`
 	Leverage        int     `json:"leverage,omitempty"`
 	PositionSizeUSD float64 `json:"position_size_usd,omitempty"`
 	StopLoss        float64 `json:"stop_loss,omitempty"`
@@ -79,6 +104,38 @@ type Decision struct {
 	Confidence      int     `json:"confidence,omitempty"` // 信心度 (0-100)
 	RiskUSD         float64 `json:"risk_usd,omitempty"`   // 最大美元风险
 	Reasoning       string  `json:"reasoning"`
+
+	// 入场方式（仅开仓时有效，默认市价）
+	EntryType     string  `json:"entry_type,omitempty" enum:"market,limit,post_only" desc:"入场方式: market市价（默认）, limit限价, post_only只做Maker的限价单"`
+	EntryPrice    float64 `json:"entry_price,omitempty" desc:"限价单挂单价格（entry_type为limit/post_only时必填）"`
+	ExpiryMinutes int     `json:"expiry_minutes,omitempty" desc:"限价单未成交的过期时间（分钟），默认30"`
+
+	// 保证金模式（仅开仓时有效，为空时使用交易员配置；加仓沿用持仓的模式）
+	MarginMode string `json:"margin_mode,omitempty" enum:"isolated,cross" desc:"保证金模式: isolated逐仓, cross全仓，默认使用交易员配置"`
+
+	// 分批止盈阶梯（可选，仅开仓时有效）：剩余仓位在take_profit止盈或由追踪止损管理
+	TakeProfitLevels []TakeProfitLevel `json:"take_profit_levels,omitempty" desc:"分批止盈阶梯，按价格由近到远排列"`
+	// 部分平仓比例（partial_close时必填）
+	ClosePct float64 `json:"close_pct,omitempty" desc:"partial_close时平掉的持仓百分比（1-100）"`
+}
+
+// TakeProfitLevel 分批止盈档位
+type TakeProfitLevel struct {
+	Price   float64 `json:"price"`
+	SizePct float64 `json:"size_pct" desc:"该档平仓数量占开仓数量的百分比"`
+}
+
+// decisionOutput 结构化输出格式（思维链 + 决策列表）
+type decisionOutput struct {
+	ChainOfThought string     `json:"chain_of_thought" desc:"简洁的思维链分析"`
+	Decisions      []Decision `json:"decisions"`
+}
+
+// decisionSchema 提交交易决策的函数/Schema定义（由Decision结构体生成）
+var decisionSchema = &mcp.Schema{
+	Name:        "submit_decisions",
+	Description: "提交思维链分析和本周期的交易决策列表",
+	Parameters:  mcp.SchemaFromStruct(decisionOutput{}),
 }
 
 // FullDecision AI的完整决策（包含思维链）
@@ -86,6 +143,7 @@ type FullDecision struct {
 	UserPrompt string     `json:"user_prompt"` // 发送给AI的输入prompt
 	CoTTrace   string     `json:"cot_trace"`   // 思维链分析（AI输出）
 	Decisions  []Decision `json:"decisions"`   // 具体决策列表
+	Usage      mcp.Usage  `json:"usage"`       // 本次调用的token用量和估算费用
 	Timestamp  time.Time  `json:"timestamp"`
 }
 
@@ -97,26 +155,46 @@ func GetFullDecision(ctx *Context, mcpClient *mcp.Client) (*FullDecision, error)
 	}
 
 	// 2. 构建 System Prompt（固定规则）和 User Prompt（动态数据）
-	systemPrompt := buildSystemPrompt(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	systemPrompt := buildSystemPrompt(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, ctx.MaxAdds)
 	userPrompt := buildUserPrompt(ctx)
 
-	// 3. 调用AI API（使用 system + user prompt）
-	aiResponse, err := mcpClient.CallWithMessages(systemPrompt, userPrompt)
+	// 3. 调用AI API（使用 system + user prompt，优先结构化输出）
+	aiResponse, err := mcpClient.CallStructured(systemPrompt, userPrompt, decisionSchema)
 	if err != nil {
 		return nil, fmt.Errorf("调用AI API失败: %w", err)
 	}
 
 	// 4. 解析AI响应
-	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	decision, err := parseAIResponse(aiResponse, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	decision.Timestamp = ctx.now()
+	decision.UserPrompt = userPrompt // 保存输入prompt
+	decision.Usage = aiResponse.Usage
 	if err != nil {
-		return nil, fmt.Errorf("解析AI响应失败: %w", err)
+		// 解析失败也返回部分结果（思维链、token用量），便于记录和排查
+		return decision, fmt.Errorf("解析AI响应失败: %w", err)
 	}
-
-	decision.Timestamp = time.Now()
-	decision.UserPrompt = userPrompt // 保存输入prompt
 	return decision, nil
 }
 
+// defaultExpectedHolding 没有历史交易时假设的持仓时长
+const defaultExpectedHolding = 4 * time.Hour
+
+// expectedHolding 返回估算资金费成本使用的持仓时长
+func (ctx *Context) expectedHolding() time.Duration {
+	if ctx.ExpectedHolding > 0 {
+		return ctx.ExpectedHolding
+	}
+	return defaultExpectedHolding
+}
+
+// now 返回决策时刻（回测时为模拟时间）
+func (ctx *Context) now() time.Time {
+	if !ctx.Now.IsZero() {
+		return ctx.Now
+	}
+	return time.Now()
+}
+
 // fetchMarketDataForContext 为上下文中的所有币种获取市场数据和OI数据
 func fetchMarketDataForContext(ctx *Context) error {
 	ctx.MarketDataMap = make(map[string]*market.Data)
@@ -146,24 +224,29 @@ func fetchMarketDataForContext(ctx *Context) error {
 		positionSymbols[pos.Symbol] = true
 	}
 
+	fetch := ctx.MarketDataFetcher
+	if fetch == nil {
+		fetch = market.Get
+	}
+
 	for symbol := range symbolSet {
-		data, err := market.Get(symbol)
+		data, err := fetch(symbol)
 		if err != nil {
 			// 单个币种失败不影响整体，只记录错误
 			continue
 		}
 
 		// ⚠️ 流动性过滤：持仓价值低于15M USD的币种不做（多空都不做）
-		// 持仓价值 = 持仓量 × 当前价格
+		// 持仓价值 = 持仓量（历史平均值，无历史数据时取最新值）× 当前价格
 		// 但现有持仓必须保留（需要决策是否平仓）
 		isExistingPosition := positionSymbols[symbol]
 		if !isExistingPosition && data.OpenInterest != nil && data.CurrentPrice > 0 {
 			// 计算持仓价值（USD）= 持仓量 × 当前价格
-			oiValue := data.OpenInterest.Latest * data.CurrentPrice
+			oiValue := data.OpenInterest.Smoothed() * data.CurrentPrice
 			oiValueInMillions := oiValue / 1_000_000 // 转换为百万美元单位
 			if oiValueInMillions < 15 {
 				log.Printf("⚠️  %s 持仓价值过低(%.2fM USD < 15M)，跳过此币种 [持仓量:%.0f × 价格:%.4f]",
-					symbol, oiValueInMillions, data.OpenInterest.Latest, data.CurrentPrice)
+					symbol, oiValueInMillions, data.OpenInterest.Smoothed(), data.CurrentPrice)
 				continue
 			}
 		}
@@ -200,7 +283,7 @@ func calculateMaxCandidates(ctx *Context) int {
 }
 
 // buildSystemPrompt 构建 System Prompt（固定规则，可缓存）
-func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int) string {
+func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage, maxAdds int) string {
 	var sb strings.Builder
 
 	// === 核心使命 ===
@@ -250,7 +333,7 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	sb.WriteString("**你拥有的完整数据**：\n")
 	sb.WriteString("- 📊 **原始序列**：3分钟价格序列(MidPrices数组) + 4小时K线序列\n")
 	sb.WriteString("- 📈 **技术序列**：EMA20序列、MACD序列、RSI7序列、RSI14序列\n")
-	sb.WriteString("- 💰 **资金序列**：成交量序列、持仓量(OI)序列、资金费率\n")
+	sb.WriteString("- 💰 **资金序列**：成交量序列、持仓量(OI)序列、预测资金费率、资金费率历史、距下次结算时间、标记/指数基差、主动买卖量序列、大户/全市场多空账户比序列、盘口价差/深度/滑点估算（如果有）\n")
 	sb.WriteString("- 🎯 **筛选标记**：AI500评分 / OI_Top排名（如果有标注）\n\n")
 	sb.WriteString("**分析方法**（完全由你自主决定）：\n")
 	sb.WriteString("- 自由运用序列数据，你可以做但不限于趋势分析、形态识别、支撑阻力、技术阻力位、斐波那契、波动带计算\n")
@@ -261,7 +344,8 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	sb.WriteString("- 单一维度（只看一个指标）\n")
 	sb.WriteString("- 相互矛盾（涨但量萎缩）\n")
 	sb.WriteString("- 横盘震荡\n")
-	sb.WriteString("- 刚平仓不久（<15分钟）\n\n")
+	sb.WriteString("- 刚平仓不久（<15分钟）\n")
+	sb.WriteString("- 临近资金费结算时开需要付费的拥挤方向（参考每个候选币种的资金费成本估算）\n\n")
 
 	// === 夏普比率自我进化 ===
 	sb.WriteString("# 🧬 夏普比率自我进化\n\n")
@@ -300,9 +384,23 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	sb.WriteString("  {\"symbol\": \"ETHUSDT\", \"action\": \"close_long\", \"reasoning\": \"止盈离场\"}\n")
 	sb.WriteString("]\n```\n\n")
 	sb.WriteString("**字段说明**:\n")
-	sb.WriteString("- `action`: open_long | open_short | close_long | close_short | hold | wait\n")
+	sb.WriteString("- `action`: open_long | open_short | close_long | close_short | partial_close | update_stop | hold | wait\n")
+	sb.WriteString("- `take_profit_levels`: 可选分批止盈阶梯，如 [{\"price\": 95000, \"size_pct\": 50}, {\"price\": 93000, \"size_pct\": 30}]，剩余仓位在take_profit止盈或由追踪止损管理\n")
+	sb.WriteString("- `partial_close`: 部分平仓，必填 close_pct（1-100，平掉当前持仓的百分比）\n")
+	sb.WriteString("- `update_stop`: 移动已有持仓的止损（只替换止损单），必填 stop_loss；多仓止损须低于当前价，空仓须高于当前价\n")
 	sb.WriteString("- `confidence`: 0-100（开仓建议≥75）\n")
-	sb.WriteString("- 开仓时必填: leverage, position_size_usd, stop_loss, take_profit, confidence, risk_usd, reasoning\n\n")
+	sb.WriteString("- 开仓时必填: leverage, position_size_usd, stop_loss, take_profit, confidence, risk_usd, reasoning\n")
+	sb.WriteString("- `entry_type`: market（默认，市价立即成交）| limit（限价挂单）| post_only（只做Maker，会吃单时被拒绝）\n")
+	sb.WriteString("- `entry_price`: entry_type为limit/post_only时必填，须在止损价和止盈价之间\n")
+	sb.WriteString("- `expiry_minutes`: 限价单过期时间（分钟，默认30），到期未成交自动撤单；成交后才会设置止损止盈\n")
+	sb.WriteString("- 对挂单中的币种发出同方向close决策会撤销该挂单\n")
+	sb.WriteString("- `margin_mode`: 可选，isolated（逐仓，亏损以该仓位保证金为限）| cross（全仓，共享账户余额，强平价更远但亏损可波及整个账户），默认使用交易员配置\n")
+	if maxAdds > 0 {
+		sb.WriteString(fmt.Sprintf("- `add_to_long` / `add_to_short`: 对已有同方向持仓市价加仓（每笔持仓最多%d次），参数与开仓相同，stop_loss/take_profit作用于加仓后的全部仓位\n", maxAdds))
+	} else {
+		sb.WriteString("- 已有同方向持仓时不能再次开仓或加仓\n")
+	}
+	sb.WriteString("\n")
 
 	// === 关键提醒 ===
 	sb.WriteString("---\n\n")
@@ -315,6 +413,29 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	return sb.String()
 }
 
+// formatFundingCost 按预期持仓时长估算开多/开空的资金费成本（按当前预测费率，占名义价值）
+func formatFundingCost(f *market.FundingData, now time.Time, holding time.Duration) string {
+	settlements := f.Settlements(now, holding)
+	next := "未知"
+	if f.NextFundingTime > 0 {
+		next = fmt.Sprintf("%d分钟", int(f.TimeToNext(now).Minutes()))
+	}
+	if settlements == 0 {
+		return fmt.Sprintf("**资金费**: 预测费率%.4f%% | 距下次结算%s | 预计持仓%.1f小时内无结算\n\n",
+			f.Rate*100, next, holding.Hours())
+	}
+
+	label := func(cost float64) string {
+		if cost >= 0 {
+			return fmt.Sprintf("付出%.4f%%", cost)
+		}
+		return fmt.Sprintf("收取%.4f%%", -cost)
+	}
+	return fmt.Sprintf("**资金费**: 预测费率%.4f%% | 距下次结算%s | 预计持仓%.1f小时内结算%d次：开多%s，开空%s（占名义价值）\n\n",
+		f.Rate*100, next, holding.Hours(), settlements,
+		label(f.ExpectedCost("long", now, holding)), label(f.ExpectedCost("short", now, holding)))
+}
+
 // buildUserPrompt 构建 User Prompt（动态数据）
 func buildUserPrompt(ctx *Context) string {
 	var sb strings.Builder
@@ -346,7 +467,7 @@ func buildUserPrompt(ctx *Context) string {
 			// 计算持仓时长
 			holdingDuration := ""
 			if pos.UpdateTime > 0 {
-				durationMs := time.Now().UnixMilli() - pos.UpdateTime
+				durationMs := ctx.now().UnixMilli() - pos.UpdateTime
 				durationMin := durationMs / (1000 * 60) // 转换为分钟
 				if durationMin < 60 {
 					holdingDuration = fmt.Sprintf(" | 持仓时长%d分钟", durationMin)
@@ -357,10 +478,26 @@ func buildUserPrompt(ctx *Context) string {
 				}
 			}
 
-			sb.WriteString(fmt.Sprintf("%d. %s %s | 入场价%.4f 当前价%.4f | 盈亏%+.2f%% | 杠杆%dx | 保证金%.0f | 强平价%.4f%s\n\n",
+			stopLoss := ""
+			if pos.StopLoss > 0 {
+				stopLoss = fmt.Sprintf(" | 止损%.4f", pos.StopLoss)
+			}
+			if ctx.MaxAdds > 0 {
+				stopLoss += fmt.Sprintf(" | 已加仓%d/%d次", pos.Adds, ctx.MaxAdds)
+			}
+
+			marginMode := ""
+			switch pos.MarginMode {
+			case "isolated":
+				marginMode = "逐仓"
+			case "cross":
+				marginMode = "全仓"
+			}
+
+			sb.WriteString(fmt.Sprintf("%d. %s %s | 入场价%.4f 当前价%.4f | 盈亏%+.2f%% | 杠杆%dx%s | 保证金%.0f | 强平价%.4f%s%s\n\n",
 				i+1, pos.Symbol, strings.ToUpper(pos.Side),
 				pos.EntryPrice, pos.MarkPrice, pos.UnrealizedPnLPct,
-				pos.Leverage, pos.MarginUsed, pos.LiquidationPrice, holdingDuration))
+				pos.Leverage, marginMode, pos.MarginUsed, pos.LiquidationPrice, stopLoss, holdingDuration))
 
 			// 使用FormatMarketData输出完整市场数据
 			if marketData, ok := ctx.MarketDataMap[pos.Symbol]; ok {
@@ -372,6 +509,18 @@ func buildUserPrompt(ctx *Context) string {
 		sb.WriteString("**当前持仓**: 无\n\n")
 	}
 
+	// 等待成交的限价单
+	if len(ctx.PendingOrders) > 0 {
+		sb.WriteString("## 挂单中（限价开仓，成交后设置止损止盈）\n")
+		for i, order := range ctx.PendingOrders {
+			remaining := (order.ExpireAt - ctx.now().UnixMilli()) / (1000 * 60)
+			sb.WriteString(fmt.Sprintf("%d. %s %s %s | 挂单价%.4f 数量%.4f | 止损%.4f 止盈%.4f | 剩余%d分钟过期\n",
+				i+1, order.Symbol, strings.ToUpper(order.Side), order.EntryType,
+				order.Price, order.Quantity, order.StopLoss, order.TakeProfit, remaining))
+		}
+		sb.WriteString("\n")
+	}
+
 	// 候选币种（完整市场数据）
 	sb.WriteString(fmt.Sprintf("## 候选币种 (%d个)\n\n", len(ctx.MarketDataMap)))
 	displayedCount := 0
@@ -391,6 +540,9 @@ func buildUserPrompt(ctx *Context) string {
 
 		// 使用FormatMarketData输出完整市场数据
 		sb.WriteString(fmt.Sprintf("### %d. %s%s\n\n", displayedCount, coin.Symbol, sourceTags))
+		if marketData.Funding != nil {
+			sb.WriteString(formatFundingCost(marketData.Funding, ctx.now(), ctx.expectedHolding()))
+		}
 		sb.WriteString(market.Format(marketData))
 		sb.WriteString("\n")
 	}
@@ -416,22 +568,59 @@ func buildUserPrompt(ctx *Context) string {
 	return sb.String()
 }
 
-// parseFullDecisionResponse 解析AI的完整决策响应
-func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthLeverage, altcoinLeverage int) (*FullDecision, error) {
-	// 1. 提取思维链
-	cotTrace := extractCoTTrace(aiResponse)
+// parseAIResponse 解析AI响应（结构化输出优先，解析失败时回退到文本提取）
+func parseAIResponse(resp *mcp.Response, btcEthLeverage, altcoinLeverage int) (*FullDecision, error) {
+	if resp.Structured == "" {
+		return parseFullDecisionResponse(resp.Content, btcEthLeverage, altcoinLeverage)
+	}
+
+	var output decisionOutput
+	if err := json.Unmarshal([]byte(fixMissingQuotes(resp.Structured)), &output); err != nil {
+		log.Printf("⚠️  结构化输出解析失败，回退到文本提取: %v", err)
+		return parseFullDecisionResponse(resp.Content+"\n"+resp.Structured, btcEthLeverage, altcoinLeverage)
+	}
+
+	// 部分模型会在content中输出思维链，在函数参数中输出决策（json_schema模式下content即结构化JSON）
+	cotTrace := strings.TrimSpace(output.ChainOfThought)
+	if content := strings.TrimSpace(resp.Content); content != "" && content != strings.TrimSpace(resp.Structured) {
+		if cotTrace == "" {
+			cotTrace = content
+		} else {
+			cotTrace = content + "\n\n" + cotTrace
+		}
+	}
+	if output.Decisions == nil {
+		output.Decisions = []Decision{}
+	}
+
+	if err := validateDecisions(output.Decisions, btcEthLeverage, altcoinLeverage); err != nil {
+		return &FullDecision{
+			CoTTrace:  cotTrace,
+			Decisions: output.Decisions,
+		}, fmt.Errorf("决策验证失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
+	}
 
-	// 2. 提取JSON决策列表
-	decisions, err := extractDecisions(aiResponse)
+	return &FullDecision{
+		CoTTrace:  cotTrace,
+		Decisions: output.Decisions,
+	}, nil
+}
+
+// parseFullDecisionResponse 解析AI的完整决策响应（文本模式）
+func parseFullDecisionResponse(aiResponse string, btcEthLeverage, altcoinLeverage int) (*FullDecision, error) {
+	// 1. 提取JSON决策列表（思维链是决策数组之前的内容）
+	decisions, arrayStart, err := extractDecisions(aiResponse)
 	if err != nil {
+		cotTrace := strings.TrimSpace(aiResponse)
 		return &FullDecision{
 			CoTTrace:  cotTrace,
 			Decisions: []Decision{},
 		}, fmt.Errorf("提取决策失败: %w\n\n=== AI思维链分析 ===\n%s", err, cotTrace)
 	}
+	cotTrace := extractCoTTrace(aiResponse, arrayStart)
 
-	// 3. 验证决策
-	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+	// 2. 验证决策
+	if err := validateDecisions(decisions, btcEthLeverage, altcoinLeverage); err != nil {
 		return &FullDecision{
 			CoTTrace:  cotTrace,
 			Decisions: decisions,
@@ -444,49 +633,52 @@ func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthL
 	}, nil
 }
 
-// extractCoTTrace 提取思维链分析
-func extractCoTTrace(response string) string {
-	// 查找JSON数组的开始位置
-	jsonStart := strings.Index(response, "[")
-
-	if jsonStart > 0 {
-		// 思维链是JSON数组之前的内容
-		return strings.TrimSpace(response[:jsonStart])
-	}
-
-	// 如果找不到JSON，整个响应都是思维链
-	return strings.TrimSpace(response)
+// extractCoTTrace 提取思维链分析（决策数组之前的内容，去掉代码块标记）
+func extractCoTTrace(response string, arrayStart int) string {
+	cot := strings.TrimSpace(response[:arrayStart])
+	cot = strings.TrimSuffix(cot, "```json")
+	cot = strings.TrimSuffix(cot, "```")
+	return strings.TrimSpace(cot)
 }
 
-// extractDecisions 提取JSON决策列表
-func extractDecisions(response string) ([]Decision, error) {
-	// 直接查找JSON数组 - 找第一个完整的JSON数组
-	arrayStart := strings.Index(response, "[")
-	if arrayStart == -1 {
-		return nil, fmt.Errorf("无法找到JSON数组起始")
-	}
-
-	// 从 [ 开始，匹配括号找到对应的 ]
-	arrayEnd := findMatchingBracket(response, arrayStart)
-	if arrayEnd == -1 {
-		return nil, fmt.Errorf("无法找到JSON数组结束")
-	}
-
-	jsonContent := strings.TrimSpace(response[arrayStart : arrayEnd+1])
+// extractDecisions 提取JSON决策列表，返回决策和数组起始位置
+// 思维链中可能出现 [xxx] 之类的方括号，因此依次尝试每个能解析为决策列表的数组，
+// 取最后一个非空的（决策列表约定在输出末尾）
+func extractDecisions(response string) ([]Decision, int, error) {
+	response = fixMissingQuotes(response)
+
+	var (
+		found      []Decision
+		foundStart = -1
+		lastErr    = fmt.Errorf("无法找到JSON数组起始")
+	)
+	for start := 0; start < len(response); start++ {
+		if response[start] != '[' {
+			continue
+		}
+		end := findMatchingBracket(response, start)
+		if end == -1 {
+			lastErr = fmt.Errorf("无法找到JSON数组结束")
+			continue
+		}
 
-	// 🔧 修复常见的JSON格式错误：缺少引号的字段值
-	// 匹配: "reasoning": 内容"}  或  "reasoning": 内容}  (没有引号)
-	// 修复为: "reasoning": "内容"}
-	// 使用简单的字符串扫描而不是正则表达式
-	jsonContent = fixMissingQuotes(jsonContent)
+		jsonContent := response[start : end+1]
+		var decisions []Decision
+		if err := json.Unmarshal([]byte(jsonContent), &decisions); err != nil {
+			lastErr = fmt.Errorf("JSON解析失败: %w\nJSON内容: %s", err, jsonContent)
+			continue
+		}
 
-	// 解析JSON
-	var decisions []Decision
-	if err := json.Unmarshal([]byte(jsonContent), &decisions); err != nil {
-		return nil, fmt.Errorf("JSON解析失败: %w\nJSON内容: %s", err, jsonContent)
+		if len(decisions) > 0 || foundStart == -1 {
+			found, foundStart = decisions, start
+		}
+		start = end // 跳过已解析数组内部的括号
 	}
 
-	return decisions, nil
+	if foundStart == -1 {
+		return nil, 0, lastErr
+	}
+	return found, foundStart, nil
 }
 
 // fixMissingQuotes 替换中文引号为英文引号（避免输入法自动转换）
@@ -499,24 +691,37 @@ func fixMissingQuotes(jsonStr string) string {
 }
 
 // validateDecisions 验证所有决策（需要账户信息和杠杆配置）
-func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+func validateDecisions(decisions []Decision, btcEthLeverage, altcoinLeverage int) error {
 	for i, decision := range decisions {
-		if err := validateDecision(&decision, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+		if err := validateDecision(&decision, btcEthLeverage, altcoinLeverage); err != nil {
 			return fmt.Errorf("决策 #%d 验证失败: %w", i+1, err)
 		}
 	}
 	return nil
 }
 
-// findMatchingBracket 查找匹配的右括号
+// findMatchingBracket 查找匹配的右括号（跳过JSON字符串中的括号）
 func findMatchingBracket(s string, start int) int {
 	if start >= len(s) || s[start] != '[' {
 		return -1
 	}
 
 	depth := 0
+	inString := false
 	for i := start; i < len(s); i++ {
+		if inString {
+			switch s[i] {
+			case '\\':
+				i++ // 跳过转义字符
+			case '"':
+				inString = false
+			}
+			continue
+		}
+
 		switch s[i] {
+		case '"':
+			inString = true
 		case '[':
 			depth++
 		case ']':
@@ -531,29 +736,44 @@ func findMatchingBracket(s string, start int) int {
 }
 
 // validateDecision 验证单个决策的有效性
-func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
+func validateDecision(d *Decision, btcEthLeverage, altcoinLeverage int) error {
 	// 验证action
 	validActions := map[string]bool{
-		"open_long":   true,
-		"open_short":  true,
-		"close_long":  true,
-		"close_short": true,
-		"hold":        true,
-		"wait":        true,
+		"open_long":     true,
+		"open_short":    true,
+		"add_to_long":   true,
+		"add_to_short":  true,
+		"close_long":    true,
+		"close_short":   true,
+		"update_stop":   true,
+		"partial_close": true,
+		"hold":          true,
+		"wait":          true,
 	}
 
 	if !validActions[d.Action] {
 		return fmt.Errorf("无效的action: %s", d.Action)
 	}
 
-	// 开仓操作必须提供完整参数
-	if d.Action == "open_long" || d.Action == "open_short" {
+	// 移动止损必须提供新的止损价（方向由现有持仓决定，执行时校验）
+	if d.Action == "update_stop" && d.StopLoss <= 0 {
+		return fmt.Errorf("update_stop必须提供大于0的stop_loss")
+	}
+
+	// 部分平仓必须提供平仓比例（方向由现有持仓决定，执行时校验）
+	if d.Action == "partial_close" && (d.ClosePct <= 0 || d.ClosePct > 100) {
+		return fmt.Errorf("partial_close的close_pct必须在0-100之间: %.2f", d.ClosePct)
+	}
+
+	// 开仓和加仓操作必须提供完整参数（加仓的止损止盈作用于加仓后的全部仓位）
+	isAdd := d.Action == "add_to_long" || d.Action == "add_to_short"
+	if d.Action == "open_long" || d.Action == "open_short" || isAdd {
+		isLong := d.Action == "open_long" || d.Action == "add_to_long"
 		// 根据币种使用配置的杠杆上限
-		maxLeverage := altcoinLeverage          // 山寨币使用配置的杠杆
-		maxPositionValue := accountEquity * 1.5 // 山寨币最多1.5倍账户净值
+		// 仓位价值上限由执行前的风控引擎检查（超限时缩减而不是整轮失败）
+		maxLeverage := altcoinLeverage // 山寨币使用配置的杠杆
 		if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-			maxLeverage = btcEthLeverage          // BTC和ETH使用配置的杠杆
-			maxPositionValue = accountEquity * 10 // BTC/ETH最多10倍账户净值
+			maxLeverage = btcEthLeverage // BTC和ETH使用配置的杠杆
 		}
 
 		if d.Leverage <= 0 || d.Leverage > maxLeverage {
@@ -562,21 +782,54 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		if d.PositionSizeUSD <= 0 {
 			return fmt.Errorf("仓位大小必须大于0: %.2f", d.PositionSizeUSD)
 		}
-		// 验证仓位价值上限（加1%容差以避免浮点数精度问题）
-		tolerance := maxPositionValue * 0.01 // 1%容差
-		if d.PositionSizeUSD > maxPositionValue+tolerance {
-			if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-				return fmt.Errorf("BTC/ETH单币种仓位价值不能超过%.0f USDT（10倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
-			} else {
-				return fmt.Errorf("山寨币单币种仓位价值不能超过%.0f USDT（1.5倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
-			}
-		}
 		if d.StopLoss <= 0 || d.TakeProfit <= 0 {
 			return fmt.Errorf("止损和止盈必须大于0")
 		}
 
+		// 验证入场方式
+		switch d.EntryType {
+		case "", "market":
+		case "limit", "post_only":
+			if isAdd {
+				return fmt.Errorf("加仓只支持市价入场")
+			}
+			if d.EntryPrice <= 0 {
+				return fmt.Errorf("%s入场必须提供entry_price", d.EntryType)
+			}
+			if d.EntryPrice <= math.Min(d.StopLoss, d.TakeProfit) || d.EntryPrice >= math.Max(d.StopLoss, d.TakeProfit) {
+				return fmt.Errorf("挂单价%.4f必须在止损价%.4f和止盈价%.4f之间", d.EntryPrice, d.StopLoss, d.TakeProfit)
+			}
+		default:
+			return fmt.Errorf("无效的entry_type: %s", d.EntryType)
+		}
+		if d.ExpiryMinutes < 0 {
+			return fmt.Errorf("expiry_minutes不能为负数: %d", d.ExpiryMinutes)
+		}
+		if d.MarginMode != "" && d.MarginMode != "isolated" && d.MarginMode != "cross" {
+			return fmt.Errorf("无效的margin_mode: %s", d.MarginMode)
+		}
+
+		// 验证分批止盈阶梯：价格在止损和止盈之间（可等于止盈价），比例合计不超过100%
+		totalPct := 0.0
+		for i, level := range d.TakeProfitLevels {
+			if level.Price <= 0 || level.SizePct <= 0 {
+				return fmt.Errorf("止盈阶梯第%d档的价格和比例必须大于0", i+1)
+			}
+			if (isLong && (level.Price <= d.StopLoss || level.Price > d.TakeProfit)) ||
+				(!isLong && (level.Price >= d.StopLoss || level.Price < d.TakeProfit)) {
+				return fmt.Errorf("止盈阶梯第%d档价格%.4f必须在止损价%.4f和止盈价%.4f之间", i+1, level.Price, d.StopLoss, d.TakeProfit)
+			}
+			if d.EntryPrice > 0 && ((isLong && level.Price <= d.EntryPrice) || (!isLong && level.Price >= d.EntryPrice)) {
+				return fmt.Errorf("止盈阶梯第%d档价格%.4f必须在挂单价%.4f的盈利方向", i+1, level.Price, d.EntryPrice)
+			}
+			totalPct += level.SizePct
+		}
+		if totalPct > 100 {
+			return fmt.Errorf("止盈阶梯比例合计%.1f%%超过100%%", totalPct)
+		}
+
 		// 验证止损止盈的合理性
-		if d.Action == "open_long" {
+		if isLong {
 			if d.StopLoss >= d.TakeProfit {
 				return fmt.Errorf("做多时止损价必须小于止盈价")
 			}
@@ -587,9 +840,11 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		}
 
 		// 验证风险回报比（必须≥1:3）
-		// 计算入场价（假设当前市价）
+		// 计算入场价（限价单使用挂单价，市价单假设当前市价）
 		var entryPrice float64
-		if d.Action == "open_long" {
+		if d.EntryPrice > 0 && d.EntryType != "" && d.EntryType != "market" {
+			entryPrice = d.EntryPrice
+		} else if isLong {
 			// 做多：入场价在止损和止盈之间
 			entryPrice = d.StopLoss + (d.TakeProfit-d.StopLoss)*0.2 // 假设在20%位置入场
 		} else {
@@ -598,7 +853,7 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 		}
 
 		var riskPercent, rewardPercent, riskRewardRatio float64
-		if d.Action == "open_long" {
+		if isLong {
 			riskPercent = (entryPrice - d.StopLoss) / entryPrice * 100
 			rewardPercent = (d.TakeProfit - entryPrice) / entryPrice * 100
 			if riskPercent > 0 {
@@ -0,0 +1,228 @@
+package instrument
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 上市状态
+const (
+	StatusTrading   = "trading"   // 正常交易
+	StatusSuspended = "suspended" // 暂停交易
+	StatusDelisted  = "delisted"  // 已下架
+)
+
+// ErrUnknownSymbol 交易所不支持该交易对
+var ErrUnknownSymbol = errors.New("交易所不支持该交易对")
+
+// defaultTTL 合约元数据缓存有效期（过期后下次查询时重新加载）
+const defaultTTL = time.Hour
+
+// Instrument 交易品种元数据（数量均按币数量计，张数已按合约乘数换算）
+type Instrument struct {
+	Symbol       string  `json:"symbol"`        // 标准symbol（如BTCUSDT）
+	VenueSymbol  string  `json:"venue_symbol"`  // 交易所symbol（如BTC、BTC-USDT-SWAP）
+	Exchange     string  `json:"exchange"`      // 交易平台
+	TickSize     float64 `json:"tick_size"`     // 价格步进（0表示不限制）
+	StepSize     float64 `json:"step_size"`     // 数量步进
+	MinQty       float64 `json:"min_qty"`       // 最小下单数量
+	MinNotional  float64 `json:"min_notional"`  // 最小下单名义价值（USDT，0表示不限制）
+	MaxLeverage  int     `json:"max_leverage"`  // 最大杠杆（0表示未知）
+	ContractSize float64 `json:"contract_size"` // 合约乘数（每张合约对应的币数量，按币数量下单的交易所为1）
+	Status       string  `json:"status"`        // 上市状态
+}
+
+// Tradable 是否可以开仓
+func (i *Instrument) Tradable() bool {
+	return i.Status == "" || i.Status == StatusTrading
+}
+
+// QuantityPrecision 数量小数位数
+func (i *Instrument) QuantityPrecision() int {
+	return stepPrecision(i.StepSize)
+}
+
+// PricePrecision 价格小数位数
+func (i *Instrument) PricePrecision() int {
+	return stepPrecision(i.TickSize)
+}
+
+// RoundQuantity 将数量向下取整到数量步进（避免超出可用保证金或持仓数量）
+func (i *Instrument) RoundQuantity(quantity float64) float64 {
+	if i.StepSize <= 0 {
+		return quantity
+	}
+	// 加上微小偏移，避免 0.3/0.1=2.9999999 之类的浮点误差
+	return math.Floor(quantity/i.StepSize+1e-9) * i.StepSize
+}
+
+// RoundPrice 将价格四舍五入到价格步进
+func (i *Instrument) RoundPrice(price float64) float64 {
+	if i.TickSize <= 0 {
+		return price
+	}
+	return math.Round(price/i.TickSize) * i.TickSize
+}
+
+// FormatQuantity 按数量步进格式化数量
+func (i *Instrument) FormatQuantity(quantity float64) string {
+	return strconv.FormatFloat(i.RoundQuantity(quantity), 'f', i.QuantityPrecision(), 64)
+}
+
+// FormatPrice 按价格步进格式化价格
+func (i *Instrument) FormatPrice(price float64) string {
+	if i.TickSize <= 0 {
+		return strconv.FormatFloat(price, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(i.RoundPrice(price), 'f', i.PricePrecision(), 64)
+}
+
+// CheckOrder 检查下单数量和名义价值是否满足交易所限制
+func (i *Instrument) CheckOrder(quantity, price float64) error {
+	if !i.Tradable() {
+		return fmt.Errorf("%s 当前状态为%s，不可交易", i.Symbol, i.Status)
+	}
+	if rounded := i.RoundQuantity(quantity); rounded < i.MinQty || rounded <= 0 {
+		return fmt.Errorf("%s 下单数量%.8f小于最小下单量%.8f", i.Symbol, quantity, i.MinQty)
+	}
+	if i.MinNotional > 0 && quantity*price < i.MinNotional {
+		return fmt.Errorf("%s 下单金额%.2f USDT小于最小下单金额%.2f USDT", i.Symbol, quantity*price, i.MinNotional)
+	}
+	return nil
+}
+
+// stepPrecision 由步进值计算小数位数（如0.001 -> 3，容忍面值×张数步进等乘积的浮点误差）
+func stepPrecision(step float64) int {
+	if step <= 0 {
+		return 8
+	}
+	for precision := 0; precision < 12; precision++ {
+		scaled := step * math.Pow10(precision)
+		if math.Abs(scaled-math.Round(scaled)) < 1e-6 {
+			return precision
+		}
+	}
+	return 12
+}
+
+// Loader 从交易所加载全部合约元数据（Symbol需为标准格式）
+type Loader func() ([]Instrument, error)
+
+// Registry 单个交易所的合约元数据注册表（按需加载并缓存）
+type Registry struct {
+	exchange    string
+	loader      Loader
+	ttl         time.Duration
+	instruments map[string]Instrument
+	loadedAt    time.Time
+	mu          sync.RWMutex
+	loadMu      sync.Mutex // 避免并发重复加载
+}
+
+// NewRegistry 创建合约元数据注册表
+func NewRegistry(exchange string, loader Loader) *Registry {
+	return &Registry{
+		exchange:    exchange,
+		loader:      loader,
+		ttl:         defaultTTL,
+		instruments: make(map[string]Instrument),
+	}
+}
+
+// SetTTL 设置缓存有效期（默认1小时）
+func (r *Registry) SetTTL(ttl time.Duration) {
+	r.ttl = ttl
+}
+
+// Exchange 交易平台名称
+func (r *Registry) Exchange() string {
+	return r.exchange
+}
+
+// Load 重新加载全部合约元数据
+func (r *Registry) Load() error {
+	r.loadMu.Lock()
+	defer r.loadMu.Unlock()
+
+	list, err := r.loader()
+	if err != nil {
+		return fmt.Errorf("加载%s合约信息失败: %w", r.exchange, err)
+	}
+
+	instruments := make(map[string]Instrument, len(list))
+	for _, inst := range list {
+		inst.Symbol = Canonical(inst.Symbol)
+		inst.Exchange = r.exchange
+		if inst.VenueSymbol == "" {
+			inst.VenueSymbol = VenueSymbol(r.exchange, inst.Symbol)
+		}
+		if inst.ContractSize == 0 {
+			inst.ContractSize = 1
+		}
+		if inst.Status == "" {
+			inst.Status = StatusTrading
+		}
+		instruments[inst.Symbol] = inst
+	}
+
+	r.mu.Lock()
+	r.instruments = instruments
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+	log.Printf("📐 已加载%s合约信息: %d个交易对", r.exchange, len(instruments))
+	return nil
+}
+
+// ensureLoaded 缓存为空或过期时重新加载（过期后加载失败继续使用旧数据）
+func (r *Registry) ensureLoaded() error {
+	r.mu.RLock()
+	empty := len(r.instruments) == 0
+	expired := time.Since(r.loadedAt) > r.ttl
+	r.mu.RUnlock()
+	if !empty && !expired {
+		return nil
+	}
+
+	if err := r.Load(); err != nil {
+		if empty {
+			return err
+		}
+		log.Printf("⚠️  %v，继续使用缓存", err)
+	}
+	return nil
+}
+
+// Get 获取交易对元数据（symbol可以是标准格式或交易所格式）
+func (r *Registry) Get(symbol string) (*Instrument, error) {
+	if err := r.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	inst, ok := r.instruments[Canonical(symbol)]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%s %s: %w", r.exchange, symbol, ErrUnknownSymbol)
+	}
+	return &inst, nil
+}
+
+// All 返回全部交易对元数据
+func (r *Registry) All() ([]Instrument, error) {
+	if err := r.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Instrument, 0, len(r.instruments))
+	for _, inst := range r.instruments {
+		list = append(list, inst)
+	}
+	return list, nil
+}
@@ -0,0 +1,32 @@
+package instrument
+
+import "strings"
+
+// Canonical 标准化symbol为统一格式（大写USDT交易对，如BTCUSDT）
+// 兼容 "btc"、"BTC/USDT"、"BTC-USDT"、"BTC-USDT-SWAP" 等交易所格式
+func Canonical(symbol string) string {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	symbol = strings.TrimSuffix(symbol, "-SWAP")
+	symbol = strings.NewReplacer("-", "", "/", "", "_", "").Replace(symbol)
+	if strings.HasSuffix(symbol, "USDT") {
+		return symbol
+	}
+	return symbol + "USDT"
+}
+
+// Base 返回标准symbol的基础币种（BTCUSDT -> BTC）
+func Base(symbol string) string {
+	return strings.TrimSuffix(Canonical(symbol), "USDT")
+}
+
+// VenueSymbol 将标准symbol转换为交易所使用的symbol
+// 例如: hyperliquid "BTCUSDT" -> "BTC"，okx "BTCUSDT" -> "BTC-USDT-SWAP"，其余交易所与标准格式相同
+func VenueSymbol(exchange, symbol string) string {
+	switch exchange {
+	case "hyperliquid":
+		return Base(symbol)
+	case "okx":
+		return Base(symbol) + "-USDT-SWAP"
+	}
+	return Canonical(symbol)
+}
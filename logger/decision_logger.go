@@ -7,23 +7,64 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // DecisionRecord 决策记录
 type DecisionRecord struct {
-	Timestamp      time.Time          `json:"timestamp"`       // 决策时间
-	CycleNumber    int                `json:"cycle_number"`    // 周期编号
-	InputPrompt    string             `json:"input_prompt"`    // 发送给AI的输入prompt
-	CoTTrace       string             `json:"cot_trace"`       // AI思维链（输出）
-	DecisionJSON   string             `json:"decision_json"`   // 决策JSON
-	AccountState   AccountSnapshot    `json:"account_state"`   // 账户状态快照
-	Positions      []PositionSnapshot `json:"positions"`       // 持仓快照
-	CandidateCoins []string           `json:"candidate_coins"` // 候选币种列表
-	Decisions      []DecisionAction   `json:"decisions"`       // 执行的决策
-	ExecutionLog   []string           `json:"execution_log"`   // 执行日志
-	Success        bool               `json:"success"`         // 是否成功
-	ErrorMessage   string             `json:"error_message"`   // 错误信息（如果有）
+	Timestamp      time.Time          `json:"timestamp"`            // 决策时间
+	CycleNumber    int                `json:"cycle_number"`         // 周期编号
+	InputPrompt    string             `json:"input_prompt"`         // 发送给AI的输入prompt
+	CoTTrace       string             `json:"cot_trace"`            // AI思维链（输出）
+	DecisionJSON   string             `json:"decision_json"`        // 决策JSON
+	AccountState   AccountSnapshot    `json:"account_state"`        // 账户状态快照
+	Positions      []PositionSnapshot `json:"positions"`            // 持仓快照
+	CandidateCoins []string           `json:"candidate_coins"`      // 候选币种列表
+	Decisions      []DecisionAction   `json:"decisions"`            // 执行的决策
+	ExecutionLog   []string           `json:"execution_log"`        // 执行日志
+	Success        bool               `json:"success"`              // 是否成功
+	ErrorMessage   string             `json:"error_message"`        // 错误信息（如果有）
+	RiskEvent      *RiskEvent         `json:"risk_event,omitempty"` // 风控触发事件（如果有）
+	Usage          *TokenUsage        `json:"usage,omitempty"`      // AI调用的token用量和估算费用
+	Funding        []FundingPayment   `json:"funding,omitempty"`    // 上个周期以来结算的资金费
+}
+
+// FundingPayment 资金费结算记录（绩效分析时计入结算时该币种的持仓）
+type FundingPayment struct {
+	Symbol string    `json:"symbol"`
+	Amount float64   `json:"amount"` // 金额（USDT，正数为收入，负数为支出）
+	Time   time.Time `json:"time"`   // 结算时间
+}
+
+// TokenUsage AI调用的token用量和估算费用
+type TokenUsage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"` // 含推理token
+	ReasoningTokens  int     `json:"reasoning_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"` // 按配置的模型单价估算（未配置单价时为0）
+}
+
+// add 累加用量
+func (u *TokenUsage) add(other *TokenUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.ReasoningTokens += other.ReasoningTokens
+	u.TotalTokens += other.TotalTokens
+	u.CostUSD += other.CostUSD
+}
+
+// RiskEvent 风控触发事件（日亏损或回撤超限）
+type RiskEvent struct {
+	Type      string    `json:"type"`       // "daily_loss" 或 "max_drawdown"
+	Action    string    `json:"action"`     // 处理方式: "close_all" 或 "freeze"
+	Equity    float64   `json:"equity"`     // 触发时账户净值
+	Baseline  float64   `json:"baseline"`   // 基准净值（当日起始净值或最高净值）
+	LossPct   float64   `json:"loss_pct"`   // 亏损/回撤百分比
+	LimitPct  float64   `json:"limit_pct"`  // 配置的阈值百分比
+	StopUntil time.Time `json:"stop_until"` // 暂停交易截止时间
 }
 
 // AccountSnapshot 账户状态快照
@@ -49,15 +90,23 @@ type PositionSnapshot struct {
 
 // DecisionAction 决策动作
 type DecisionAction struct {
-	Action    string    `json:"action"`    // open_long, open_short, close_long, close_short
-	Symbol    string    `json:"symbol"`    // 币种
-	Quantity  float64   `json:"quantity"`  // 数量
-	Leverage  int       `json:"leverage"`  // 杠杆（开仓时）
-	Price     float64   `json:"price"`     // 执行价格
-	OrderID   int64     `json:"order_id"`  // 订单ID
-	Timestamp time.Time `json:"timestamp"` // 执行时间
-	Success   bool      `json:"success"`   // 是否成功
-	Error     string    `json:"error"`     // 错误信息
+	Action    string    `json:"action"`            // open_long, open_short, close_long, close_short
+	Symbol    string    `json:"symbol"`            // 币种
+	Quantity  float64   `json:"quantity"`          // 数量
+	Leverage  int       `json:"leverage"`          // 杠杆（开仓时）
+	Price     float64   `json:"price"`             // 执行价格
+	OrderID   int64     `json:"order_id"`          // 订单ID
+	Fee       float64   `json:"fee"`               // 手续费（USDT）
+	Timestamp time.Time `json:"timestamp"`         // 执行时间
+	Success   bool      `json:"success"`           // 是否成功
+	Error     string    `json:"error"`             // 错误信息
+	Pending   bool      `json:"pending,omitempty"` // 限价单已挂出但尚未成交（成交后另记一条开仓动作）
+	Partial   bool      `json:"partial,omitempty"` // 部分平仓（Quantity为本次平仓数量）
+
+	Reconciled bool `json:"reconciled,omitempty"` // 对账时发现的交易所侧成交（止损止盈触发、强平或手动操作）
+
+	RiskStatus string `json:"risk_status,omitempty"` // 开仓前风控结果: approved, resized, rejected
+	RiskReason string `json:"risk_reason,omitempty"` // 缩减或拒绝原因
 }
 
 // DecisionLogger 决策日志记录器
@@ -77,17 +126,48 @@ func NewDecisionLogger(logDir string) *DecisionLogger {
 		fmt.Printf("⚠ 创建日志目录失败: %v\n", err)
 	}
 
+	// 从已有日志文件恢复周期编号，避免重启后文件名冲突
+	cycleNumber := lastCycleNumber(logDir)
+	if cycleNumber > 0 {
+		fmt.Printf("♻️ 决策日志从周期 #%d 继续\n", cycleNumber+1)
+	}
+
 	return &DecisionLogger{
 		logDir:      logDir,
-		cycleNumber: 0,
+		cycleNumber: cycleNumber,
 	}
 }
 
+// lastCycleNumber 扫描日志目录，返回已记录的最大周期编号
+func lastCycleNumber(logDir string) int {
+	files, err := ioutil.ReadDir(logDir)
+	if err != nil {
+		return 0
+	}
+
+	maxCycle := 0
+	for _, file := range files {
+		name := file.Name()
+		idx := strings.LastIndex(name, "_cycle")
+		if idx < 0 || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		cycle, err := strconv.Atoi(strings.TrimSuffix(name[idx+len("_cycle"):], ".json"))
+		if err == nil && cycle > maxCycle {
+			maxCycle = cycle
+		}
+	}
+	return maxCycle
+}
+
 // LogDecision 记录决策
 func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 	l.cycleNumber++
 	record.CycleNumber = l.cycleNumber
-	record.Timestamp = time.Now()
+	if record.Timestamp.IsZero() {
+		// 回测时由调用方指定模拟时间，实盘使用当前时间
+		record.Timestamp = time.Now()
+	}
 
 	// 生成文件名：decision_YYYYMMDD_HHMMSS_cycleN.json
 	filename := fmt.Sprintf("decision_%s_cycle%d.json",
@@ -217,7 +297,7 @@ func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
 		return nil, fmt.Errorf("读取日志目录失败: %w", err)
 	}
 
-	stats := &Statistics{}
+	stats := &Statistics{UsageByDay: make(map[string]*TokenUsage)}
 
 	for _, file := range files {
 		if file.IsDir() {
@@ -238,12 +318,14 @@ func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
 		stats.TotalCycles++
 
 		for _, action := range record.Decisions {
-			if action.Success {
+			if action.Success && !action.Pending {
 				switch action.Action {
 				case "open_long", "open_short":
 					stats.TotalOpenPositions++
 				case "close_long", "close_short":
-					stats.TotalClosePositions++
+					if !action.Partial { // 分批平仓只统计最终的全部平仓
+						stats.TotalClosePositions++
+					}
 				}
 			}
 		}
@@ -253,6 +335,19 @@ func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
 		} else {
 			stats.FailedCycles++
 		}
+
+		if record.Usage != nil {
+			stats.Usage.add(record.Usage)
+			day := record.Timestamp.UTC().Format("2006-01-02")
+			if stats.UsageByDay[day] == nil {
+				stats.UsageByDay[day] = &TokenUsage{}
+			}
+			stats.UsageByDay[day].add(record.Usage)
+		}
+	}
+
+	if stats.TotalCycles > 0 {
+		stats.AvgCostPerCycle = stats.Usage.CostUSD / float64(stats.TotalCycles)
 	}
 
 	return stats, nil
@@ -265,6 +360,10 @@ type Statistics struct {
 	FailedCycles        int `json:"failed_cycles"`
 	TotalOpenPositions  int `json:"total_open_positions"`
 	TotalClosePositions int `json:"total_close_positions"`
+
+	Usage           TokenUsage             `json:"usage"`              // 累计token用量和费用
+	UsageByDay      map[string]*TokenUsage `json:"usage_by_day"`       // 按UTC日期统计的用量和费用
+	AvgCostPerCycle float64                `json:"avg_cost_per_cycle"` // 平均每周期费用（USD）
 }
 
 // TradeOutcome 单笔交易结果
@@ -277,12 +376,17 @@ type TradeOutcome struct {
 	ClosePrice    float64   `json:"close_price"`    // 平仓价
 	PositionValue float64   `json:"position_value"` // 仓位价值（quantity × openPrice）
 	MarginUsed    float64   `json:"margin_used"`    // 保证金使用（positionValue / leverage）
-	PnL           float64   `json:"pn_l"`           // 盈亏（USDT）
-	PnLPct        float64   `json:"pn_l_pct"`       // 盈亏百分比（相对保证金）
+	PnL           float64   `json:"pn_l"`           // 净盈亏（USDT，已扣除手续费并计入资金费）
+	PnLPct        float64   `json:"pn_l_pct"`       // 净盈亏百分比（相对保证金）
+	GrossPnL      float64   `json:"gross_pnl"`      // 毛盈亏（数量 × 价格差）
+	Fees          float64   `json:"fees"`           // 开平仓手续费合计
+	Funding       float64   `json:"funding"`        // 持仓期间资金费合计（正数为收入）
 	Duration      string    `json:"duration"`       // 持仓时长
 	OpenTime      time.Time `json:"open_time"`      // 开仓时间
 	CloseTime     time.Time `json:"close_time"`     // 平仓时间
 	WasStopLoss   bool      `json:"was_stop_loss"`  // 是否止损
+	Exits         int       `json:"exits"`          // 平仓次数（分批平仓时大于1，平仓价为加权均价）
+	Entries       int       `json:"entries"`        // 开仓次数（加仓时大于1，开仓价为加权均价）
 }
 
 // PerformanceAnalysis 交易表现分析
@@ -295,6 +399,10 @@ type PerformanceAnalysis struct {
 	AvgLoss       float64                       `json:"avg_loss"`       // 平均亏损
 	ProfitFactor  float64                       `json:"profit_factor"`  // 盈亏比
 	SharpeRatio   float64                       `json:"sharpe_ratio"`   // 夏普比率（风险调整后收益）
+	GrossPnL      float64                       `json:"gross_pnl"`      // 毛盈亏合计
+	TotalFees     float64                       `json:"total_fees"`     // 手续费合计
+	TotalFunding  float64                       `json:"total_funding"`  // 资金费合计（正数为收入）
+	NetPnL        float64                       `json:"net_pnl"`        // 净盈亏合计
 	RecentTrades  []TradeOutcome                `json:"recent_trades"`  // 最近N笔交易
 	SymbolStats   map[string]*SymbolPerformance `json:"symbol_stats"`   // 各币种表现
 	BestSymbol    string                        `json:"best_symbol"`    // 表现最好的币种
@@ -308,8 +416,11 @@ type SymbolPerformance struct {
 	WinningTrades int     `json:"winning_trades"` // 盈利次数
 	LosingTrades  int     `json:"losing_trades"`  // 亏损次数
 	WinRate       float64 `json:"win_rate"`       // 胜率
-	TotalPnL      float64 `json:"total_pn_l"`     // 总盈亏
-	AvgPnL        float64 `json:"avg_pn_l"`       // 平均盈亏
+	TotalPnL      float64 `json:"total_pn_l"`     // 总净盈亏
+	AvgPnL        float64 `json:"avg_pn_l"`       // 平均净盈亏
+	GrossPnL      float64 `json:"gross_pnl"`      // 毛盈亏
+	Fees          float64 `json:"fees"`           // 手续费
+	Funding       float64 `json:"funding"`        // 资金费（正数为收入）
 }
 
 // AnalyzePerformance 分析最近N个周期的交易表现
@@ -331,150 +442,72 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 		SymbolStats:  make(map[string]*SymbolPerformance),
 	}
 
-	// 追踪持仓状态：symbol_side -> {side, openPrice, openTime, quantity, leverage}
-	openPositions := make(map[string]map[string]interface{})
+	// 追踪持仓状态：symbol_side -> 未平仓交易（支持分批平仓）
+	openTrades := make(map[string]*openTrade)
 
-	// 为了避免开仓记录在窗口外导致匹配失败，需要先从所有历史记录中找出未平仓的持仓
+	// 为了避免开仓记录在窗口外导致匹配失败，需要先从更早的历史记录中找出未平仓的持仓
 	// 获取更多历史记录来构建完整的持仓状态（使用更大的窗口）
 	allRecords, err := l.GetLatestRecords(lookbackCycles * 3) // 扩大3倍窗口
 	if err == nil && len(allRecords) > len(records) {
-		// 先从扩大的窗口中收集所有开仓记录
-		for _, record := range allRecords {
+		// 只回放分析窗口之前的记录（窗口内的记录在下面统计，避免分批平仓被重复扣减）
+		for _, record := range allRecords[:len(allRecords)-len(records)] {
+			for _, payment := range record.Funding {
+				applyFunding(openTrades, payment)
+			}
 			for _, action := range record.Decisions {
-				if !action.Success {
-					continue
-				}
-
-				symbol := action.Symbol
-				side := ""
-				if action.Action == "open_long" || action.Action == "close_long" {
-					side = "long"
-				} else if action.Action == "open_short" || action.Action == "close_short" {
-					side = "short"
-				}
-				posKey := symbol + "_" + side
-
-				switch action.Action {
-				case "open_long", "open_short":
-					// 记录开仓
-					openPositions[posKey] = map[string]interface{}{
-						"side":      side,
-						"openPrice": action.Price,
-						"openTime":  action.Timestamp,
-						"quantity":  action.Quantity,
-						"leverage":  action.Leverage,
-					}
-				case "close_long", "close_short":
-					// 移除已平仓记录
-					delete(openPositions, posKey)
-				}
+				applyTradeAction(openTrades, action)
 			}
 		}
 	}
 
-	// 遍历分析窗口内的记录，生成交易结果
+	// 遍历分析窗口内的记录，生成交易结果（全部平仓时才算一笔完整交易）
+	// 资金费先于本周期的决策动作计入（结算发生在上个周期与本周期之间）
 	for _, record := range records {
+		for _, payment := range record.Funding {
+			applyFunding(openTrades, payment)
+		}
 		for _, action := range record.Decisions {
-			if !action.Success {
+			outcome := applyTradeAction(openTrades, action)
+			if outcome == nil {
 				continue
 			}
-
-			symbol := action.Symbol
-			side := ""
-			if action.Action == "open_long" || action.Action == "close_long" {
-				side = "long"
-			} else if action.Action == "open_short" || action.Action == "close_short" {
-				side = "short"
+			pnl := outcome.PnL
+
+			analysis.RecentTrades = append(analysis.RecentTrades, *outcome)
+			analysis.TotalTrades++
+			analysis.GrossPnL += outcome.GrossPnL
+			analysis.TotalFees += outcome.Fees
+			analysis.TotalFunding += outcome.Funding
+			analysis.NetPnL += pnl
+
+			// 分类交易：盈利、亏损、持平（避免将pnl=0算入亏损）
+			if pnl > 0 {
+				analysis.WinningTrades++
+				analysis.AvgWin += pnl
+			} else if pnl < 0 {
+				analysis.LosingTrades++
+				analysis.AvgLoss += pnl
 			}
-			posKey := symbol + "_" + side // 使用symbol_side作为key，区分多空持仓
-
-			switch action.Action {
-			case "open_long", "open_short":
-				// 更新开仓记录（可能已经在预填充时记录过了）
-				openPositions[posKey] = map[string]interface{}{
-					"side":      side,
-					"openPrice": action.Price,
-					"openTime":  action.Timestamp,
-					"quantity":  action.Quantity,
-					"leverage":  action.Leverage,
-				}
-
-			case "close_long", "close_short":
-				// 查找对应的开仓记录（可能来自预填充或当前窗口）
-				if openPos, exists := openPositions[posKey]; exists {
-					openPrice := openPos["openPrice"].(float64)
-					openTime := openPos["openTime"].(time.Time)
-					side := openPos["side"].(string)
-					quantity := openPos["quantity"].(float64)
-					leverage := openPos["leverage"].(int)
-
-					// 计算实际盈亏（USDT）
-					// 合约交易 PnL 计算：quantity × 价格差
-					// 注意：杠杆不影响绝对盈亏，只影响保证金需求
-					var pnl float64
-					if side == "long" {
-						pnl = quantity * (action.Price - openPrice)
-					} else {
-						pnl = quantity * (openPrice - action.Price)
-					}
-
-					// 计算盈亏百分比（相对保证金）
-					positionValue := quantity * openPrice
-					marginUsed := positionValue / float64(leverage)
-					pnlPct := 0.0
-					if marginUsed > 0 {
-						pnlPct = (pnl / marginUsed) * 100
-					}
-
-					// 记录交易结果
-					outcome := TradeOutcome{
-						Symbol:        symbol,
-						Side:          side,
-						Quantity:      quantity,
-						Leverage:      leverage,
-						OpenPrice:     openPrice,
-						ClosePrice:    action.Price,
-						PositionValue: positionValue,
-						MarginUsed:    marginUsed,
-						PnL:           pnl,
-						PnLPct:        pnlPct,
-						Duration:      action.Timestamp.Sub(openTime).String(),
-						OpenTime:      openTime,
-						CloseTime:     action.Timestamp,
-					}
-
-					analysis.RecentTrades = append(analysis.RecentTrades, outcome)
-					analysis.TotalTrades++
-
-					// 分类交易：盈利、亏损、持平（避免将pnl=0算入亏损）
-					if pnl > 0 {
-						analysis.WinningTrades++
-						analysis.AvgWin += pnl
-					} else if pnl < 0 {
-						analysis.LosingTrades++
-						analysis.AvgLoss += pnl
-					}
-					// pnl == 0 的交易不计入盈利也不计入亏损，但计入总交易数
-
-					// 更新币种统计
-					if _, exists := analysis.SymbolStats[symbol]; !exists {
-						analysis.SymbolStats[symbol] = &SymbolPerformance{
-							Symbol: symbol,
-						}
-					}
-					stats := analysis.SymbolStats[symbol]
-					stats.TotalTrades++
-					stats.TotalPnL += pnl
-					if pnl > 0 {
-						stats.WinningTrades++
-					} else if pnl < 0 {
-						stats.LosingTrades++
-					}
+			// pnl == 0 的交易不计入盈利也不计入亏损，但计入总交易数
 
-					// 移除已平仓记录
-					delete(openPositions, posKey)
+			// 更新币种统计
+			symbol := outcome.Symbol
+			if _, exists := analysis.SymbolStats[symbol]; !exists {
+				analysis.SymbolStats[symbol] = &SymbolPerformance{
+					Symbol: symbol,
 				}
 			}
+			stats := analysis.SymbolStats[symbol]
+			stats.TotalTrades++
+			stats.TotalPnL += pnl
+			stats.GrossPnL += outcome.GrossPnL
+			stats.Fees += outcome.Fees
+			stats.Funding += outcome.Funding
+			if pnl > 0 {
+				stats.WinningTrades++
+			} else if pnl < 0 {
+				stats.LosingTrades++
+			}
 		}
 	}
 
@@ -542,6 +575,169 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 	return analysis, nil
 }
 
+// openTrade 绩效分析中跟踪的未平仓交易
+type openTrade struct {
+	side        string
+	costPrice   float64 // 剩余仓位的持仓成本（加仓时按数量加权）
+	openTime    time.Time
+	quantity    float64 // 开仓数量（含加仓）
+	openValue   float64 // 开仓成交额（计算开仓均价）
+	marginUsed  float64 // 各次开仓占用的保证金合计
+	remaining   float64 // 剩余未平仓数量
+	leverage    int
+	entries     int     // 开仓次数
+	closedQty   float64 // 已平仓数量（分批平仓累计）
+	closedValue float64 // 已平仓成交额（计算平仓均价）
+	pnl         float64 // 已实现毛盈亏（分批平仓累计）
+	exits       int     // 平仓次数
+	fees        float64 // 开平仓手续费累计
+	funding     float64 // 资金费累计（正数为收入）
+}
+
+// applyFunding 将资金费计入该币种的未平仓交易（同时持有多空仓位时按剩余数量分摊）
+func applyFunding(openTrades map[string]*openTrade, payment FundingPayment) {
+	var trades []*openTrade
+	total := 0.0
+	for _, side := range []string{"long", "short"} {
+		if trade, ok := openTrades[payment.Symbol+"_"+side]; ok && trade.remaining > 0 {
+			trades = append(trades, trade)
+			total += trade.remaining
+		}
+	}
+	for _, trade := range trades {
+		trade.funding += payment.Amount * trade.remaining / total
+	}
+}
+
+// applyTradeAction 按决策动作更新未平仓交易，全部平仓时返回完整的交易结果
+// 加仓按数量加权更新持仓成本，部分平仓（Partial）只扣减对应数量并累计盈亏，普通平仓平掉剩余全部数量
+func applyTradeAction(openTrades map[string]*openTrade, action DecisionAction) *TradeOutcome {
+	if !action.Success || action.Pending {
+		return nil
+	}
+
+	side := ""
+	switch action.Action {
+	case "open_long", "add_to_long", "close_long":
+		side = "long"
+	case "open_short", "add_to_short", "close_short":
+		side = "short"
+	}
+	posKey := action.Symbol + "_" + side // 使用symbol_side作为key，区分多空持仓
+
+	switch action.Action {
+	case "open_long", "open_short", "add_to_long", "add_to_short":
+		margin := 0.0
+		if action.Leverage > 0 {
+			margin = action.Quantity * action.Price / float64(action.Leverage)
+		}
+
+		trade, exists := openTrades[posKey]
+		if !exists || action.Action == "open_long" || action.Action == "open_short" {
+			// 新开仓（加仓记录的开仓在窗口外时按新开仓处理）
+			openTrades[posKey] = &openTrade{
+				side:       side,
+				costPrice:  action.Price,
+				openTime:   action.Timestamp,
+				quantity:   action.Quantity,
+				openValue:  action.Quantity * action.Price,
+				marginUsed: margin,
+				remaining:  action.Quantity,
+				leverage:   action.Leverage,
+				entries:    1,
+				fees:       action.Fee,
+			}
+			return nil
+		}
+
+		// 加仓：剩余仓位与新仓位按数量加权计算持仓成本
+		if total := trade.remaining + action.Quantity; total > 0 {
+			trade.costPrice = (trade.costPrice*trade.remaining + action.Price*action.Quantity) / total
+		}
+		trade.remaining += action.Quantity
+		trade.quantity += action.Quantity
+		trade.openValue += action.Quantity * action.Price
+		trade.marginUsed += margin
+		trade.fees += action.Fee
+		if action.Leverage > 0 {
+			trade.leverage = action.Leverage
+		}
+		trade.entries++
+		return nil
+
+	case "close_long", "close_short":
+		trade, exists := openTrades[posKey]
+		if !exists {
+			return nil
+		}
+
+		closeQty := trade.remaining
+		if action.Partial && action.Quantity > 0 && action.Quantity < trade.remaining {
+			closeQty = action.Quantity
+		}
+
+		// 合约交易 PnL 计算：quantity × 价格差
+		// 注意：杠杆不影响绝对盈亏，只影响保证金需求
+		if side == "long" {
+			trade.pnl += closeQty * (action.Price - trade.costPrice)
+		} else {
+			trade.pnl += closeQty * (trade.costPrice - action.Price)
+		}
+		trade.closedQty += closeQty
+		trade.closedValue += closeQty * action.Price
+		trade.remaining -= closeQty
+		trade.exits++
+		trade.fees += action.Fee
+
+		// 仍有剩余仓位：等待后续平仓
+		if trade.remaining > trade.quantity*1e-6 {
+			return nil
+		}
+		delete(openTrades, posKey)
+
+		closePrice := action.Price
+		if trade.closedQty > 0 {
+			closePrice = trade.closedValue / trade.closedQty
+		}
+
+		openPrice := trade.costPrice
+		if trade.quantity > 0 {
+			openPrice = trade.openValue / trade.quantity
+		}
+
+		// 净盈亏 = 毛盈亏 - 手续费 + 资金费，盈亏百分比相对各次开仓占用的保证金
+		netPnL := trade.pnl - trade.fees + trade.funding
+		positionValue := trade.openValue
+		marginUsed := trade.marginUsed
+		pnlPct := 0.0
+		if marginUsed > 0 {
+			pnlPct = (netPnL / marginUsed) * 100
+		}
+
+		return &TradeOutcome{
+			Symbol:        action.Symbol,
+			Side:          side,
+			Quantity:      trade.quantity,
+			Leverage:      trade.leverage,
+			OpenPrice:     openPrice,
+			ClosePrice:    closePrice,
+			PositionValue: positionValue,
+			MarginUsed:    marginUsed,
+			PnL:           netPnL,
+			PnLPct:        pnlPct,
+			GrossPnL:      trade.pnl,
+			Fees:          trade.fees,
+			Funding:       trade.funding,
+			Duration:      action.Timestamp.Sub(trade.openTime).String(),
+			OpenTime:      trade.openTime,
+			CloseTime:     action.Timestamp,
+			Exits:         trade.exits,
+			Entries:       trade.entries,
+		}
+	}
+	return nil
+}
+
 // calculateSharpeRatio 计算夏普比率
 // 基于账户净值的变化计算风险调整后收益
 func (l *DecisionLogger) calculateSharpeRatio(records []*DecisionRecord) float64 {
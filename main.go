@@ -6,6 +6,7 @@ import (
 	"nofx/api"
 	"nofx/config"
 	"nofx/manager"
+	"nofx/market"
 	"nofx/pool"
 	"os"
 	"os/signal"
@@ -14,6 +15,12 @@ import (
 )
 
 func main() {
+	// 回测子命令
+	if len(os.Args) > 1 && os.Args[1] == "backtest" {
+		runBacktest(os.Args[2:])
+		return
+	}
+
 	fmt.Println("╔════════════════════════════════════════════════════════════╗")
 	fmt.Println("║    🏆 AI模型交易竞赛系统 - Qwen vs DeepSeek               ║")
 	fmt.Println("╚════════════════════════════════════════════════════════════╝")
@@ -53,6 +60,53 @@ func main() {
 		log.Printf("✓ 已配置OI Top API")
 	}
 
+	// 持仓量历史序列（统计周期和长度）
+	if err := market.SetOIConfig(market.OIConfig{
+		Period:       cfg.OpenInterest.Period,
+		Limit:        cfg.OpenInterest.Limit,
+		SeriesLength: cfg.OpenInterest.SeriesLength,
+	}); err != nil {
+		log.Fatalf("❌ open_interest配置错误: %v", err)
+	}
+
+	// 盘口快照（价差、深度和滑点估算）
+	if err := market.SetOrderBookConfig(market.OrderBookConfig{
+		Enabled: cfg.OrderBook.Enabled,
+		Limit:   cfg.OrderBook.Limit,
+	}); err != nil {
+		log.Fatalf("❌ order_book配置错误: %v", err)
+	}
+	if cfg.Risk.MaxSlippageBps > 0 && !cfg.OrderBook.Enabled {
+		log.Printf("⚠️  已配置risk.max_slippage_bps但未启用order_book，滑点规则不会生效")
+	}
+
+	// 启动WebSocket行情服务（K线和资金费率常驻内存，避免每个周期REST轮询）
+	// 只缓存币安行情，没有trader使用币安行情或参考价格时不启动
+	if !cfg.DisableMarketStream {
+		var timeframes []market.TimeframeSpec
+		useBinance := false
+		for _, traderCfg := range cfg.Traders {
+			if !traderCfg.Enabled {
+				continue
+			}
+			if traderCfg.ReferenceMarket == market.ProviderBinance {
+				useBinance = true
+			}
+			if traderCfg.MarketData != market.ProviderBinance {
+				continue
+			}
+			useBinance = true
+			specs, err := market.ParseTimeframes(manager.MarketTimeframes(traderCfg))
+			if err != nil {
+				log.Fatalf("❌ %s K线周期配置错误: %v", traderCfg.Name, err)
+			}
+			timeframes = append(timeframes, specs...)
+		}
+		if useBinance {
+			market.StartStream(cfg.DefaultCoins, timeframes)
+		}
+	}
+
 	// 创建TraderManager
 	traderManager := manager.NewTraderManager()
 
@@ -75,7 +129,10 @@ func main() {
 			cfg.MaxDailyLoss,
 			cfg.MaxDrawdown,
 			cfg.StopTradingMinutes,
+			cfg.RiskBreachAction,
 			cfg.Leverage, // 传递杠杆配置
+			cfg.Risk,     // 传递风控规则配置
+			cfg.AIPricing,
 		)
 		if err != nil {
 			log.Fatalf("❌ 初始化trader失败: %v", err)
@@ -133,6 +190,7 @@ func main() {
 	fmt.Println()
 	log.Println("📛 收到退出信号，正在停止所有trader...")
 	traderManager.StopAll()
+	market.StopStream()
 
 	fmt.Println()
 	fmt.Println("👋 感谢使用AI交易竞赛系统！")
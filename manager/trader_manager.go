@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"log"
 	"nofx/config"
+	"nofx/market"
+	"nofx/mcp"
+	"nofx/risk"
 	"nofx/trader"
 	"sync"
 	"time"
@@ -23,7 +26,7 @@ func NewTraderManager() *TraderManager {
 }
 
 // AddTrader 添加一个trader
-func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, leverage config.LeverageConfig) error {
+func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, riskBreachAction string, leverage config.LeverageConfig, riskCfg config.RiskConfig, aiPricing map[string]config.AIPrice) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -32,7 +35,34 @@ func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string,
 	}
 
 	// 构建AutoTraderConfig
-	traderConfig := trader.AutoTraderConfig{
+	traderConfig := BuildAutoTraderConfig(cfg, coinPoolURL, maxDailyLoss, maxDrawdown, stopTradingMinutes, riskBreachAction, leverage, riskCfg, aiPricing)
+
+	// 创建trader实例
+	at, err := trader.NewAutoTrader(traderConfig)
+	if err != nil {
+		return fmt.Errorf("创建trader失败: %w", err)
+	}
+
+	tm.traders[cfg.ID] = at
+	log.Printf("✓ Trader '%s' (%s) 已添加", cfg.Name, cfg.AIModel)
+	return nil
+}
+
+// AddAutoTrader 添加已创建的trader实例（回测结果展示使用）
+func (tm *TraderManager) AddAutoTrader(id string, at *trader.AutoTrader) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, exists := tm.traders[id]; exists {
+		return fmt.Errorf("trader ID '%s' 已存在", id)
+	}
+	tm.traders[id] = at
+	return nil
+}
+
+// BuildAutoTraderConfig 由配置文件中的trader配置构建AutoTraderConfig（实盘和回测共用）
+func BuildAutoTraderConfig(cfg config.TraderConfig, coinPoolURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, riskBreachAction string, leverage config.LeverageConfig, riskCfg config.RiskConfig, aiPricing map[string]config.AIPrice) trader.AutoTraderConfig {
+	return trader.AutoTraderConfig{
 		ID:                    cfg.ID,
 		Name:                  cfg.Name,
 		AIModel:               cfg.AIModel,
@@ -45,6 +75,16 @@ func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string,
 		AsterUser:             cfg.AsterUser,
 		AsterSigner:           cfg.AsterSigner,
 		AsterPrivateKey:       cfg.AsterPrivateKey,
+		OKXAPIKey:             cfg.OKXAPIKey,
+		OKXSecretKey:          cfg.OKXSecretKey,
+		OKXPassphrase:         cfg.OKXPassphrase,
+		OKXTestnet:            cfg.OKXTestnet,
+		BybitAPIKey:           cfg.BybitAPIKey,
+		BybitSecretKey:        cfg.BybitSecretKey,
+		BybitTestnet:          cfg.BybitTestnet,
+		PaperTakerFeeRate:     cfg.PaperTakerFeeRate,
+		PaperMakerFeeRate:     cfg.PaperMakerFeeRate,
+		PaperSlippage:         cfg.PaperSlippage,
 		CoinPoolAPIURL:        coinPoolURL,
 		UseQwen:               cfg.AIModel == "qwen",
 		DeepSeekKey:           cfg.DeepSeekKey,
@@ -52,24 +92,76 @@ func (tm *TraderManager) AddTrader(cfg config.TraderConfig, coinPoolURL string,
 		CustomAPIURL:          cfg.CustomAPIURL,
 		CustomAPIKey:          cfg.CustomAPIKey,
 		CustomModelName:       cfg.CustomModelName,
+		AnthropicKey:          cfg.AnthropicKey,
+		GeminiKey:             cfg.GeminiKey,
+		OllamaURL:             cfg.OllamaURL,
+		LlamaCppURL:           cfg.LlamaCppURL,
+		AIModelName:           cfg.AIModelName,
+		AITemperature:         cfg.AITemperature,
+		AIMaxTokens:           cfg.AIMaxTokens,
+		AIReasoningEffort:     cfg.AIReasoningEffort,
+		AIOutputMode:          cfg.AIOutputMode,
+		AIStream:              cfg.AIStream,
+		AIPricing:             AIPricing(aiPricing),
 		ScanInterval:          cfg.GetScanInterval(),
 		InitialBalance:        cfg.InitialBalance,
+		MarginMode:            cfg.MarginMode,
+		MarketData:            cfg.MarketData,
+		ReferenceMarket:       cfg.ReferenceMarket,
 		BTCETHLeverage:        leverage.BTCETHLeverage,  // 使用配置的杠杆倍数
 		AltcoinLeverage:       leverage.AltcoinLeverage, // 使用配置的杠杆倍数
 		MaxDailyLoss:          maxDailyLoss,
 		MaxDrawdown:           maxDrawdown,
 		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
+		RiskBreachAction:      riskBreachAction,
+		Timeframes:            MarketTimeframes(cfg),
+		StopManagement: trader.StopManagementConfig{
+			TrailingPct:        cfg.StopManagement.TrailingPct,
+			TrailingATR:        cfg.StopManagement.TrailingATR,
+			BreakEvenPct:       cfg.StopManagement.BreakEvenPct,
+			BreakEvenOffsetPct: cfg.StopManagement.BreakEvenOffsetPct,
+		},
+		PositionScaling: trader.PositionScalingConfig{
+			MaxAdds:        cfg.PositionScaling.MaxAdds,
+			MaxNotionalUSD: cfg.PositionScaling.MaxNotionalUSD,
+		},
+		RiskRules: risk.Config{
+			MaxPositions:           riskCfg.MaxPositions,
+			MaxGrossExposure:       riskCfg.MaxGrossExposure,
+			MaxNetExposure:         riskCfg.MaxNetExposure,
+			MaxAltcoinNotional:     riskCfg.MaxAltcoinNotional,
+			MaxBTCETHNotional:      riskCfg.MaxBTCETHNotional,
+			MaxCorrelated:          riskCfg.MaxCorrelated,
+			CorrelationThreshold:   riskCfg.CorrelationThreshold,
+			Cooldown:               time.Duration(riskCfg.CooldownMinutes) * time.Minute,
+			MinLiquidationDistance: riskCfg.MinLiquidationDistance,
+			MaxSlippageBps:         riskCfg.MaxSlippageBps,
+			MinNotional:            riskCfg.MinNotional,
+		},
 	}
+}
 
-	// 创建trader实例
-	at, err := trader.NewAutoTrader(traderConfig)
-	if err != nil {
-		return fmt.Errorf("创建trader失败: %w", err)
+// AIPricing 将配置中的模型单价转换为mcp包的单价
+func AIPricing(pricing map[string]config.AIPrice) map[string]mcp.Price {
+	prices := make(map[string]mcp.Price, len(pricing))
+	for model, price := range pricing {
+		prices[model] = mcp.Price{InputPerMillion: price.InputPerMillion, OutputPerMillion: price.OutputPerMillion}
 	}
+	return prices
+}
 
-	tm.traders[cfg.ID] = at
-	log.Printf("✓ Trader '%s' (%s) 已添加", cfg.Name, cfg.AIModel)
-	return nil
+// MarketTimeframes 将trader的K线周期配置转换为market包的配置
+func MarketTimeframes(cfg config.TraderConfig) []market.TimeframeConfig {
+	var timeframes []market.TimeframeConfig
+	for _, tf := range cfg.Timeframes {
+		timeframes = append(timeframes, market.TimeframeConfig{
+			Interval:     tf.Interval,
+			Lookback:     tf.Lookback,
+			SeriesLength: tf.SeriesLength,
+			Indicators:   tf.Indicators,
+		})
+	}
+	return timeframes
 }
 
 // GetTrader 获取指定ID的trader
@@ -8,11 +8,13 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Data 市场数据结构
 type Data struct {
 	Symbol            string
+	Venue             string // 行情数据源（回测等直接由K线构建时为空）
 	CurrentPrice      float64
 	PriceChange1h     float64 // 1小时价格变化百分比
 	PriceChange4h     float64 // 4小时价格变化百分比
@@ -20,15 +22,14 @@ type Data struct {
 	CurrentMACD       float64
 	CurrentRSI7       float64
 	OpenInterest      *OIData
-	FundingRate       float64
+	FundingRate       float64          // 预测资金费率（同Funding.Rate）
+	Funding           *FundingData     // 资金费率详情（预测费率、下次结算、基差、历史；不可得时为空）
+	OrderBook         *OrderBook       // 盘口快照（未启用或获取失败时为空）
+	Positioning       *PositioningData // 主动买卖量和多空账户比序列（不可得时为空）
+	Reference         *ReferencePrice  // 其他交易所的参考价格（未配置或不可得时为空）
 	IntradaySeries    *IntradayData
 	LongerTermContext *LongerTermData
-}
-
-// OIData Open Interest数据
-type OIData struct {
-	Latest  float64
-	Average float64
+	Timeframes        []*TimeframeData // 按配置计算的K线周期和指标（为空时输出默认的3分钟和4小时数据）
 }
 
 // IntradayData 日内数据(3分钟间隔)
@@ -63,21 +64,16 @@ type Kline struct {
 	CloseTime int64
 }
 
-// Get 获取指定代币的市场数据
+// Get 从币安获取指定代币的市场数据（优先使用WebSocket行情缓存）
 func Get(symbol string) (*Data, error) {
-	// 标准化symbol
-	symbol = Normalize(symbol)
-
-	// 获取3分钟K线数据 (最近10个)
-	klines3m, err := getKlines(symbol, "3m", 40) // 多获取一些用于计算
-	if err != nil {
-		return nil, fmt.Errorf("获取3分钟K线失败: %v", err)
-	}
+	return GetFrom(binanceProvider, symbol)
+}
 
-	// 获取4小时K线数据 (最近10个)
-	klines4h, err := getKlines(symbol, "4h", 60) // 多获取用于计算指标
-	if err != nil {
-		return nil, fmt.Errorf("获取4小时K线失败: %v", err)
+// BuildData 根据K线计算市场数据（不含OI和资金费率）
+// 回测时使用历史K线调用，保证指标计算与实盘完全一致
+func BuildData(symbol string, klines3m, klines4h []Kline) (*Data, error) {
+	if len(klines3m) == 0 {
+		return nil, fmt.Errorf("%s 3分钟K线为空", symbol)
 	}
 
 	// 计算当前指标 (基于3分钟最新数据)
@@ -105,16 +101,6 @@ func Get(symbol string) (*Data, error) {
 		}
 	}
 
-	// 获取OI数据
-	oiData, err := getOpenInterestData(symbol)
-	if err != nil {
-		// OI失败不影响整体,使用默认值
-		oiData = &OIData{Latest: 0, Average: 0}
-	}
-
-	// 获取Funding Rate
-	fundingRate, _ := getFundingRate(symbol)
-
 	// 计算日内系列数据
 	intradayData := calculateIntradaySeries(klines3m)
 
@@ -129,17 +115,15 @@ func Get(symbol string) (*Data, error) {
 		CurrentEMA20:      currentEMA20,
 		CurrentMACD:       currentMACD,
 		CurrentRSI7:       currentRSI7,
-		OpenInterest:      oiData,
-		FundingRate:       fundingRate,
 		IntradaySeries:    intradayData,
 		LongerTermContext: longerTermData,
 	}, nil
 }
 
-// getKlines 从Binance获取K线数据
-func getKlines(symbol, interval string, limit int) ([]Kline, error) {
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/klines?symbol=%s&interval=%s&limit=%d",
-		symbol, interval, limit)
+// getKlines 从Binance兼容接口获取K线数据
+func getKlines(baseURL, symbol, interval string, limit int) ([]Kline, error) {
+	url := fmt.Sprintf("%s/fapi/v1/klines?symbol=%s&interval=%s&limit=%d",
+		baseURL, symbol, interval, limit)
 
 	resp, err := http.Get(url)
 	if err != nil {
@@ -152,9 +136,42 @@ func getKlines(symbol, interval string, limit int) ([]Kline, error) {
 		return nil, err
 	}
 
+	return parseKlines(body)
+}
+
+// getTickerPrice 从Binance兼容接口获取最新成交价
+func getTickerPrice(baseURL, symbol string) (float64, error) {
+	url := fmt.Sprintf("%s/fapi/v1/ticker/price?symbol=%s", baseURL, symbol)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Price string `json:"price"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, fmt.Errorf("解析最新价格失败: %w, body: %s", err, string(body))
+	}
+	price, err := strconv.ParseFloat(result.Price, 64)
+	if err != nil || price <= 0 {
+		return 0, fmt.Errorf("%s 最新价格无效: %s", symbol, string(body))
+	}
+	return price, nil
+}
+
+// parseKlines 解析Binance K线接口返回的数组格式
+func parseKlines(body []byte) ([]Kline, error) {
 	var rawData [][]interface{}
 	if err := json.Unmarshal(body, &rawData); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("解析K线数据失败: %w, body: %s", err, string(body))
 	}
 
 	klines := make([]Kline, len(rawData))
@@ -386,89 +403,57 @@ func calculateLongerTermData(klines []Kline) *LongerTermData {
 	return data
 }
 
-// getOpenInterestData 获取OI数据
-func getOpenInterestData(symbol string) (*OIData, error) {
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/openInterest?symbol=%s", symbol)
+// Format 格式化输出市场数据
+func Format(data *Data) string {
+	var sb strings.Builder
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
+	if len(data.Timeframes) > 0 {
+		sb.WriteString(fmt.Sprintf("current_price = %.2f, price_change_1h = %.2f%%, price_change_4h = %.2f%%\n\n",
+			data.CurrentPrice, data.PriceChange1h, data.PriceChange4h))
+	} else {
+		sb.WriteString(fmt.Sprintf("current_price = %.2f, current_ema20 = %.3f, current_macd = %.3f, current_rsi (7 period) = %.3f\n\n",
+			data.CurrentPrice, data.CurrentEMA20, data.CurrentMACD, data.CurrentRSI7))
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if data.Reference != nil && data.Reference.Price > 0 {
+		sb.WriteString(fmt.Sprintf("Reference price on %s: %.4f (%s price %+.3f%% vs. reference)\n\n",
+			data.Reference.Venue, data.Reference.Price, data.Venue,
+			(data.CurrentPrice-data.Reference.Price)/data.Reference.Price*100))
 	}
 
-	var result struct {
-		OpenInterest string `json:"openInterest"`
-		Symbol       string `json:"symbol"`
-		Time         int64  `json:"time"`
+	venue := ""
+	if data.Venue != "" {
+		venue = " on " + data.Venue
 	}
+	sb.WriteString(fmt.Sprintf("In addition, here is the latest %s open interest, funding rate and positioning for perps%s:\n\n",
+		data.Symbol, venue))
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	oi, _ := strconv.ParseFloat(result.OpenInterest, 64)
-
-	return &OIData{
-		Latest:  oi,
-		Average: oi * 0.999, // 近似平均值
-	}, nil
-}
-
-// getFundingRate 获取资金费率
-func getFundingRate(symbol string) (float64, error) {
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/premiumIndex?symbol=%s", symbol)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return 0, err
+	if data.OpenInterest != nil {
+		formatOpenInterest(&sb, data.OpenInterest)
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return 0, err
+	if data.Funding != nil {
+		formatFunding(&sb, data.Funding)
+	} else {
+		sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", data.FundingRate))
 	}
 
-	var result struct {
-		Symbol          string `json:"symbol"`
-		MarkPrice       string `json:"markPrice"`
-		IndexPrice      string `json:"indexPrice"`
-		LastFundingRate string `json:"lastFundingRate"`
-		NextFundingTime int64  `json:"nextFundingTime"`
-		InterestRate    string `json:"interestRate"`
-		Time            int64  `json:"time"`
+	if data.Positioning != nil {
+		formatPositioning(&sb, data.Positioning)
 	}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return 0, err
+	if data.OrderBook != nil {
+		formatOrderBook(&sb, data.OrderBook)
 	}
 
-	rate, _ := strconv.ParseFloat(result.LastFundingRate, 64)
-	return rate, nil
-}
-
-// Format 格式化输出市场数据
-func Format(data *Data) string {
-	var sb strings.Builder
-
-	sb.WriteString(fmt.Sprintf("current_price = %.2f, current_ema20 = %.3f, current_macd = %.3f, current_rsi (7 period) = %.3f\n\n",
-		data.CurrentPrice, data.CurrentEMA20, data.CurrentMACD, data.CurrentRSI7))
-
-	sb.WriteString(fmt.Sprintf("In addition, here is the latest %s open interest and funding rate for perps:\n\n",
-		data.Symbol))
-
-	if data.OpenInterest != nil {
-		sb.WriteString(fmt.Sprintf("Open Interest: Latest: %.2f Average: %.2f\n\n",
-			data.OpenInterest.Latest, data.OpenInterest.Average))
+	// 配置了K线周期时只输出配置的指标
+	if len(data.Timeframes) > 0 {
+		for _, tf := range data.Timeframes {
+			formatTimeframe(&sb, tf)
+		}
+		return sb.String()
 	}
 
-	sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", data.FundingRate))
-
 	if data.IntradaySeries != nil {
 		sb.WriteString("Intraday series (3‑minute intervals, oldest → latest):\n\n")
 
@@ -517,6 +502,100 @@ func Format(data *Data) string {
 	return sb.String()
 }
 
+// formatOpenInterest 输出持仓量、变化百分比和历史序列（历史数据不可得时只输出最新值）
+func formatOpenInterest(sb *strings.Builder, oi *OIData) {
+	if len(oi.Series) == 0 {
+		sb.WriteString(fmt.Sprintf("Open Interest: Latest: %.2f\n\n", oi.Latest))
+		return
+	}
+
+	sb.WriteString(fmt.Sprintf("Open Interest: Latest: %.2f Average (%d × %s): %.2f\n\n",
+		oi.Latest, len(oi.Series), oi.Period, oi.Average))
+
+	var changes []string
+	for _, w := range oiChangeWindows {
+		if change, ok := oi.Changes[w.Label]; ok {
+			changes = append(changes, fmt.Sprintf("%s: %+.2f%%", w.Label, change))
+		}
+	}
+	if len(changes) > 0 {
+		sb.WriteString(fmt.Sprintf("Open Interest change: %s\n\n", strings.Join(changes, ", ")))
+	}
+
+	series := oi.Series
+	if oi.SeriesLength > 0 && len(series) > oi.SeriesLength {
+		series = series[len(series)-oi.SeriesLength:]
+	}
+	sb.WriteString(fmt.Sprintf("Open Interest series (%s intervals, oldest → latest): %s\n\n", oi.Period, formatFloatSlice(series)))
+}
+
+// formatFunding 输出预测资金费率、下次结算倒计时、基差和已结算资金费率历史
+func formatFunding(sb *strings.Builder, f *FundingData) {
+	interval := f.Interval
+	if interval <= 0 {
+		interval = defaultFundingInterval
+	}
+
+	next := "unknown"
+	if f.NextFundingTime > 0 {
+		next = time.UnixMilli(f.NextFundingTime).UTC().Format("2006-01-02 15:04 UTC")
+	}
+	sb.WriteString(fmt.Sprintf("Funding Rate (predicted): %.4f%%, next settlement at %s (every %.0fh)\n\n",
+		f.Rate*100, next, interval.Hours()))
+
+	if f.IndexPrice > 0 {
+		sb.WriteString(fmt.Sprintf("Mark price: %.4f vs. Index price: %.4f (basis %+.3f%%)\n\n",
+			f.MarkPrice, f.IndexPrice, f.Basis()))
+	}
+
+	if len(f.History) > 0 {
+		rates := make([]string, len(f.History))
+		for i, r := range f.History {
+			rates[i] = fmt.Sprintf("%.4f%%", r*100)
+		}
+		sb.WriteString(fmt.Sprintf("Funding history (settled, oldest → latest): [%s]\n\n", strings.Join(rates, ", ")))
+	}
+}
+
+// formatPositioning 输出主动买卖量和多空账户比序列（空序列不输出）
+func formatPositioning(sb *strings.Builder, p *PositioningData) {
+	if len(p.TakerBuySellRatio) > 0 {
+		sb.WriteString(fmt.Sprintf("Taker buy/sell volume (%s intervals, oldest → latest): buy %s, sell %s, buy/sell ratio %s\n\n",
+			p.Period, formatFloatSlice(p.TakerBuyVolume), formatFloatSlice(p.TakerSellVolume), formatFloatSlice(p.TakerBuySellRatio)))
+	}
+	if len(p.TopTraderRatio) > 0 {
+		sb.WriteString(fmt.Sprintf("Top trader long/short account ratio (%s intervals, oldest → latest): %s\n\n",
+			p.Period, formatFloatSlice(p.TopTraderRatio)))
+	}
+	if len(p.GlobalRatio) > 0 {
+		sb.WriteString(fmt.Sprintf("Global long/short account ratio (%s intervals, oldest → latest): %s\n\n",
+			p.Period, formatFloatSlice(p.GlobalRatio)))
+	}
+}
+
+// formatOrderBook 输出买卖价差、±0.5%/±1%深度、深度不平衡度和参考金额的预计滑点
+func formatOrderBook(sb *strings.Builder, b *OrderBook) {
+	sb.WriteString(fmt.Sprintf("Order book: bid %.4f / ask %.4f, spread %.2f bps\n\n",
+		b.Bids[0].Price, b.Asks[0].Price, b.SpreadBps))
+	sb.WriteString(fmt.Sprintf("Depth (USDT) within ±0.5%%: bids %.0f / asks %.0f; within ±1%%: bids %.0f / asks %.0f; imbalance %+.2f\n\n",
+		b.BidDepth05, b.AskDepth05, b.BidDepth1, b.AskDepth1, b.Imbalance))
+
+	var estimates []string
+	for _, size := range orderBookReferenceSizes {
+		estimates = append(estimates, fmt.Sprintf("%.0f USDT: long %s / short %s",
+			size, formatBps(b.EstimateSlippage("long", size)), formatBps(b.EstimateSlippage("short", size))))
+	}
+	sb.WriteString(fmt.Sprintf("Estimated market-order slippage vs. mid: %s\n\n", strings.Join(estimates, "; ")))
+}
+
+// formatBps 格式化基点（盘口深度不足时输出提示）
+func formatBps(bps float64) string {
+	if math.IsInf(bps, 1) {
+		return "beyond book depth"
+	}
+	return fmt.Sprintf("%.1f bps", bps)
+}
+
 // formatFloatSlice 格式化float64切片为字符串
 func formatFloatSlice(values []float64) string {
 	strValues := make([]string, len(values))
@@ -526,15 +605,6 @@ func formatFloatSlice(values []float64) string {
 	return "[" + strings.Join(strValues, ", ") + "]"
 }
 
-// Normalize 标准化symbol,确保是USDT交易对
-func Normalize(symbol string) string {
-	symbol = strings.ToUpper(symbol)
-	if strings.HasSuffix(symbol, "USDT") {
-		return symbol
-	}
-	return symbol + "USDT"
-}
-
 // parseFloat 解析float值
 func parseFloat(v interface{}) (float64, error) {
 	switch val := v.(type) {
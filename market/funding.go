@@ -0,0 +1,163 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	fundingHistoryLength   = 10            // 输出给AI的已结算资金费率数量
+	defaultFundingInterval = 8 * time.Hour // 默认结算间隔（历史数据不足以推算时使用）
+)
+
+// FundingData 资金费率数据（来自premiumIndex和fundingRate历史）
+type FundingData struct {
+	Rate            float64       // 本期预测资金费率（下次结算时按该费率收取，随溢价实时变化）
+	NextFundingTime int64         // 下次结算时间（毫秒）
+	Interval        time.Duration // 结算间隔（由历史结算时间推算）
+	MarkPrice       float64       // 标记价格
+	IndexPrice      float64       // 现货指数价格
+	History         []float64     // 最近已结算的资金费率（oldest → latest）
+}
+
+// Basis 标记价格相对指数价格的基差百分比（正数为合约溢价）
+func (f *FundingData) Basis() float64 {
+	if f.IndexPrice <= 0 {
+		return 0
+	}
+	return (f.MarkPrice - f.IndexPrice) / f.IndexPrice * 100
+}
+
+// TimeToNext 距下次结算的时间（结算时间未知或已过时返回0）
+func (f *FundingData) TimeToNext(now time.Time) time.Duration {
+	if f.NextFundingTime <= 0 {
+		return 0
+	}
+	if d := time.UnixMilli(f.NextFundingTime).Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Settlements 从now起持仓holding时长内经历的结算次数
+func (f *FundingData) Settlements(now time.Time, holding time.Duration) int {
+	if f.NextFundingTime <= 0 || holding <= 0 {
+		return 0
+	}
+	interval := f.Interval
+	if interval <= 0 {
+		interval = defaultFundingInterval
+	}
+
+	next := time.UnixMilli(f.NextFundingTime)
+	end := now.Add(holding)
+	count := 0
+	for t := next; !t.After(end); t = t.Add(interval) {
+		if !t.Before(now) {
+			count++
+		}
+	}
+	return count
+}
+
+// ExpectedCost 按当前预测费率估算持仓holding时长内的资金费成本（占名义价值的百分比，正数为支出）
+// 资金费率为正时多头付给空头，为负时空头付给多头
+func (f *FundingData) ExpectedCost(side string, now time.Time, holding time.Duration) float64 {
+	cost := f.Rate * float64(f.Settlements(now, holding)) * 100
+	if side == "short" {
+		return -cost
+	}
+	return cost
+}
+
+// getFundingData 获取预测资金费率、下次结算时间、标记/指数价格和已结算资金费率历史（历史获取失败时不影响其他字段）
+func getFundingData(baseURL, symbol string) (*FundingData, error) {
+	data, err := getPremiumIndex(baseURL, symbol)
+	if err != nil {
+		return nil, err
+	}
+	data.History, data.Interval, _ = getFundingHistory(baseURL, symbol, fundingHistoryLength)
+	return data, nil
+}
+
+// getPremiumIndex 获取预测资金费率、下次结算时间和标记/指数价格
+func getPremiumIndex(baseURL, symbol string) (*FundingData, error) {
+	url := fmt.Sprintf("%s/fapi/v1/premiumIndex?symbol=%s", baseURL, symbol)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Symbol          string `json:"symbol"`
+		MarkPrice       string `json:"markPrice"`
+		IndexPrice      string `json:"indexPrice"`
+		LastFundingRate string `json:"lastFundingRate"`
+		NextFundingTime int64  `json:"nextFundingTime"`
+		InterestRate    string `json:"interestRate"`
+		Time            int64  `json:"time"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	data := &FundingData{NextFundingTime: result.NextFundingTime}
+	data.Rate, _ = strconv.ParseFloat(result.LastFundingRate, 64)
+	data.MarkPrice, _ = strconv.ParseFloat(result.MarkPrice, 64)
+	data.IndexPrice, _ = strconv.ParseFloat(result.IndexPrice, 64)
+	return data, nil
+}
+
+// getFundingHistory 获取最近limit次已结算的资金费率（oldest → latest）和结算间隔
+func getFundingHistory(baseURL, symbol string, limit int) ([]float64, time.Duration, error) {
+	url := fmt.Sprintf("%s/fapi/v1/fundingRate?symbol=%s&limit=%d", baseURL, symbol, limit)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var records []struct {
+		FundingRate string `json:"fundingRate"`
+		FundingTime int64  `json:"fundingTime"`
+	}
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, 0, fmt.Errorf("解析资金费率历史失败: %w, body: %s", err, string(body))
+	}
+
+	history := make([]float64, 0, len(records))
+	for _, r := range records {
+		rate, err := strconv.ParseFloat(r.FundingRate, 64)
+		if err != nil {
+			continue
+		}
+		history = append(history, rate)
+	}
+
+	// 结算间隔取最近两次结算的时间差（部分币种为4小时或1小时）
+	interval := defaultFundingInterval
+	if n := len(records); n >= 2 {
+		if d := time.Duration(records[n-1].FundingTime-records[n-2].FundingTime) * time.Millisecond; d > 0 {
+			interval = d.Round(time.Hour)
+		}
+	}
+	return history, interval, nil
+}
@@ -0,0 +1,55 @@
+package market
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"nofx/instrument"
+)
+
+// maxKlinesPerRequest Binance K线接口单次最多返回的条数
+const maxKlinesPerRequest = 1500
+
+// GetKlinesRange 获取指定时间范围内的历史K线（毫秒时间戳，包含两端）
+// 超过单次上限时自动分页拉取
+func GetKlinesRange(symbol, interval string, startTime, endTime int64) ([]Kline, error) {
+	symbol = instrument.Canonical(symbol)
+
+	var all []Kline
+	cursor := startTime
+	for cursor <= endTime {
+		url := fmt.Sprintf("%s/fapi/v1/klines?symbol=%s&interval=%s&startTime=%d&endTime=%d&limit=%d",
+			binanceBaseURL, symbol, interval, cursor, endTime, maxKlinesPerRequest)
+
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, fmt.Errorf("请求历史K线失败: %w", err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取历史K线失败: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("历史K线接口返回错误 (status %d): %s", resp.StatusCode, string(body))
+		}
+
+		klines, err := parseKlines(body)
+		if err != nil {
+			return nil, err
+		}
+		if len(klines) == 0 {
+			break
+		}
+
+		all = append(all, klines...)
+
+		// 下一页从最后一根K线之后开始
+		cursor = klines[len(klines)-1].CloseTime + 1
+		if len(klines) < maxKlinesPerRequest {
+			break
+		}
+	}
+
+	return all, nil
+}
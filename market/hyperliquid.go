@@ -0,0 +1,299 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"nofx/instrument"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	hyperliquidMainnetURL      = "https://api.hyperliquid.xyz"
+	hyperliquidTestnetURL      = "https://api.hyperliquid-testnet.xyz"
+	hyperliquidCtxTTL          = 5 * time.Second // metaAndAssetCtxs一次返回所有币种，同一周期内复用
+	hyperliquidFundingInterval = time.Hour       // Hyperliquid每小时结算资金费
+)
+
+// HyperliquidProvider Hyperliquid行情数据源（info接口）
+// Hyperliquid不提供持仓量历史和多空账户比，持仓量只有最新值
+type HyperliquidProvider struct {
+	apiURL string
+	client *http.Client
+
+	mu     sync.Mutex
+	ctxs   map[string]hyperliquidAssetCtx // 大写币种名 -> 资产上下文
+	ctxsAt time.Time
+}
+
+// hyperliquidAssetCtx 单个币种的资产上下文
+type hyperliquidAssetCtx struct {
+	Coin         string  // 交易所币种名（保留kPEPE等币种名的大小写）
+	Funding      float64 // 本小时预测资金费率
+	OpenInterest float64 // 持仓量（币）
+	MarkPrice    float64 // 标记价格
+	MidPrice     float64 // 盘口中间价（盘口为空时为0）
+	OraclePrice  float64 // 预言机价格（作为指数价格）
+}
+
+// NewHyperliquidProvider 创建Hyperliquid行情数据源
+func NewHyperliquidProvider(testnet bool) *HyperliquidProvider {
+	apiURL := hyperliquidMainnetURL
+	if testnet {
+		apiURL = hyperliquidTestnetURL
+	}
+	return &HyperliquidProvider{
+		apiURL: apiURL,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name 数据源名称
+func (p *HyperliquidProvider) Name() string {
+	return ProviderHyperliquid
+}
+
+// Price 获取盘口中间价（盘口为空时取标记价格），与资金费率等共用metaAndAssetCtxs缓存
+func (p *HyperliquidProvider) Price(symbol string) (float64, error) {
+	asset, err := p.assetCtx(symbol)
+	if err != nil {
+		return 0, err
+	}
+	if asset.MidPrice > 0 {
+		return asset.MidPrice, nil
+	}
+	return asset.MarkPrice, nil
+}
+
+// Klines 获取最近limit根K线（candleSnapshot按时间范围查询）
+func (p *HyperliquidProvider) Klines(symbol, interval string, limit int) ([]Kline, error) {
+	asset, err := p.assetCtx(symbol)
+	if err != nil {
+		return nil, err
+	}
+	duration := IntervalDuration(interval)
+	if duration <= 0 {
+		return nil, fmt.Errorf("不支持的K线周期: %s", interval)
+	}
+
+	end := time.Now()
+	start := end.Add(-duration * time.Duration(limit))
+	var candles []struct {
+		OpenTime  int64  `json:"t"`
+		CloseTime int64  `json:"T"`
+		Open      string `json:"o"`
+		High      string `json:"h"`
+		Low       string `json:"l"`
+		Close     string `json:"c"`
+		Volume    string `json:"v"`
+	}
+	payload := map[string]interface{}{
+		"type": "candleSnapshot",
+		"req": map[string]interface{}{
+			"coin":      asset.Coin,
+			"interval":  interval,
+			"startTime": start.UnixMilli(),
+			"endTime":   end.UnixMilli(),
+		},
+	}
+	if err := p.postInfo(payload, &candles); err != nil {
+		return nil, fmt.Errorf("获取Hyperliquid K线失败: %w", err)
+	}
+
+	klines := make([]Kline, 0, len(candles))
+	for _, c := range candles {
+		kline := Kline{OpenTime: c.OpenTime, CloseTime: c.CloseTime}
+		kline.Open, _ = strconv.ParseFloat(c.Open, 64)
+		kline.High, _ = strconv.ParseFloat(c.High, 64)
+		kline.Low, _ = strconv.ParseFloat(c.Low, 64)
+		kline.Close, _ = strconv.ParseFloat(c.Close, 64)
+		kline.Volume, _ = strconv.ParseFloat(c.Volume, 64)
+		klines = append(klines, kline)
+	}
+	if len(klines) > limit {
+		klines = klines[len(klines)-limit:]
+	}
+	return klines, nil
+}
+
+// OpenInterest 获取最新持仓量（Hyperliquid不提供历史序列）
+func (p *HyperliquidProvider) OpenInterest(symbol string) (*OIData, error) {
+	asset, err := p.assetCtx(symbol)
+	if err != nil {
+		return nil, err
+	}
+	return &OIData{Latest: asset.OpenInterest}, nil
+}
+
+// Funding 获取本小时预测资金费率、标记/预言机价格和已结算资金费率历史（历史获取失败时不影响其他字段）
+func (p *HyperliquidProvider) Funding(symbol string) (*FundingData, error) {
+	asset, err := p.assetCtx(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	data := &FundingData{
+		Rate:            asset.Funding,
+		NextFundingTime: now.Truncate(hyperliquidFundingInterval).Add(hyperliquidFundingInterval).UnixMilli(),
+		Interval:        hyperliquidFundingInterval,
+		MarkPrice:       asset.MarkPrice,
+		IndexPrice:      asset.OraclePrice,
+	}
+
+	var history []struct {
+		FundingRate string `json:"fundingRate"`
+		Time        int64  `json:"time"`
+	}
+	payload := map[string]interface{}{
+		"type":      "fundingHistory",
+		"coin":      asset.Coin,
+		"startTime": now.Add(-hyperliquidFundingInterval * (fundingHistoryLength + 1)).UnixMilli(),
+	}
+	if err := p.postInfo(payload, &history); err == nil {
+		for _, h := range history {
+			if rate, err := strconv.ParseFloat(h.FundingRate, 64); err == nil {
+				data.History = append(data.History, rate)
+			}
+		}
+		if len(data.History) > fundingHistoryLength {
+			data.History = data.History[len(data.History)-fundingHistoryLength:]
+		}
+	}
+	return data, nil
+}
+
+// Positioning Hyperliquid不提供主动买卖量和多空账户比
+func (p *HyperliquidProvider) Positioning(symbol string) (*PositioningData, error) {
+	return nil, fmt.Errorf("Hyperliquid不提供多空数据")
+}
+
+// OrderBook 获取盘口快照（l2Book每侧最多返回20档）
+func (p *HyperliquidProvider) OrderBook(symbol string, limit int) (*OrderBook, error) {
+	asset, err := p.assetCtx(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Levels [][]struct {
+			Price string `json:"px"`
+			Size  string `json:"sz"`
+		} `json:"levels"`
+	}
+	if err := p.postInfo(map[string]interface{}{"type": "l2Book", "coin": asset.Coin}, &result); err != nil {
+		return nil, fmt.Errorf("获取Hyperliquid盘口失败: %w", err)
+	}
+	if len(result.Levels) != 2 {
+		return nil, fmt.Errorf("%s 盘口为空", symbol)
+	}
+
+	sides := make([][][]string, 2)
+	for i, levels := range result.Levels {
+		if len(levels) > limit {
+			levels = levels[:limit]
+		}
+		for _, level := range levels {
+			sides[i] = append(sides[i], []string{level.Price, level.Size})
+		}
+	}
+	book := &OrderBook{Bids: parseBookLevels(sides[0]), Asks: parseBookLevels(sides[1])}
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return nil, fmt.Errorf("%s 盘口为空", symbol)
+	}
+	book.computeMetrics()
+	return book, nil
+}
+
+// assetCtx 获取币种的资产上下文（Hyperliquid未上线该币种时返回错误）
+func (p *HyperliquidProvider) assetCtx(symbol string) (hyperliquidAssetCtx, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ctxs == nil || time.Since(p.ctxsAt) > hyperliquidCtxTTL {
+		ctxs, err := p.loadAssetCtxs()
+		if err != nil {
+			return hyperliquidAssetCtx{}, fmt.Errorf("获取Hyperliquid行情失败: %w", err)
+		}
+		p.ctxs = ctxs
+		p.ctxsAt = time.Now()
+	}
+
+	asset, ok := p.ctxs[strings.ToUpper(instrument.Base(symbol))]
+	if !ok {
+		return hyperliquidAssetCtx{}, fmt.Errorf("Hyperliquid未上线 %s", symbol)
+	}
+	return asset, nil
+}
+
+// loadAssetCtxs 通过metaAndAssetCtxs获取所有币种的资金费率、持仓量和价格（跳过已下架币种）
+func (p *HyperliquidProvider) loadAssetCtxs() (map[string]hyperliquidAssetCtx, error) {
+	var raw []json.RawMessage
+	if err := p.postInfo(map[string]string{"type": "metaAndAssetCtxs"}, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) != 2 {
+		return nil, fmt.Errorf("metaAndAssetCtxs返回格式错误")
+	}
+
+	var meta struct {
+		Universe []struct {
+			Name       string `json:"name"`
+			IsDelisted bool   `json:"isDelisted"`
+		} `json:"universe"`
+	}
+	var assetCtxs []struct {
+		Funding      string `json:"funding"`
+		OpenInterest string `json:"openInterest"`
+		MarkPx       string `json:"markPx"`
+		MidPx        string `json:"midPx"`
+		OraclePx     string `json:"oraclePx"`
+	}
+	if err := json.Unmarshal(raw[0], &meta); err != nil {
+		return nil, fmt.Errorf("解析meta失败: %w", err)
+	}
+	if err := json.Unmarshal(raw[1], &assetCtxs); err != nil {
+		return nil, fmt.Errorf("解析assetCtxs失败: %w", err)
+	}
+
+	ctxs := make(map[string]hyperliquidAssetCtx, len(meta.Universe))
+	for i, asset := range meta.Universe {
+		if asset.IsDelisted || i >= len(assetCtxs) {
+			continue
+		}
+		c := hyperliquidAssetCtx{Coin: asset.Name}
+		c.Funding, _ = strconv.ParseFloat(assetCtxs[i].Funding, 64)
+		c.OpenInterest, _ = strconv.ParseFloat(assetCtxs[i].OpenInterest, 64)
+		c.MarkPrice, _ = strconv.ParseFloat(assetCtxs[i].MarkPx, 64)
+		c.MidPrice, _ = strconv.ParseFloat(assetCtxs[i].MidPx, 64)
+		c.OraclePrice, _ = strconv.ParseFloat(assetCtxs[i].OraclePx, 64)
+		ctxs[strings.ToUpper(asset.Name)] = c
+	}
+	return ctxs, nil
+}
+
+// postInfo 请求info接口并解析响应
+func (p *HyperliquidProvider) postInfo(payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Post(p.apiURL+"/info", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(data))
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,427 @@
+package market
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// IndicatorSpec 指标配置（如 "ema:20"、"bb:20:2"、"macd"）
+type IndicatorSpec struct {
+	Name   string
+	Params []float64
+}
+
+// IndicatorSeries 指标序列（多输出指标拆分为多个序列，如 BB20_upper/BB20_middle/BB20_lower）
+type IndicatorSeries struct {
+	Name   string
+	Values []float64 // 与K线一一对应，数据不足的位置为NaN
+}
+
+// indicatorDefaults 支持的指标及其默认参数
+var indicatorDefaults = map[string][]float64{
+	"ema":      {20},
+	"sma":      {20},
+	"macd":     {12, 26, 9},
+	"rsi":      {14},
+	"atr":      {14},
+	"bb":       {20, 2},
+	"vwap":     {},
+	"stochrsi": {14, 14, 3, 3},
+	"adx":      {14},
+	"obv":      {},
+	"donchian": {20},
+	"volume":   {},
+}
+
+// ParseIndicator 解析指标配置字符串，格式为 "名称:参数1:参数2"，省略的参数使用默认值
+func ParseIndicator(s string) (IndicatorSpec, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), ":")
+	name := parts[0]
+	defaults, ok := indicatorDefaults[name]
+	if !ok {
+		return IndicatorSpec{}, fmt.Errorf("不支持的指标: %s", s)
+	}
+	if len(parts)-1 > len(defaults) {
+		return IndicatorSpec{}, fmt.Errorf("指标%s最多%d个参数: %s", name, len(defaults), s)
+	}
+
+	params := append([]float64(nil), defaults...)
+	for i, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v <= 0 {
+			return IndicatorSpec{}, fmt.Errorf("指标参数无效: %s", s)
+		}
+		params[i] = v
+	}
+	return IndicatorSpec{Name: name, Params: params}, nil
+}
+
+// period 返回第i个参数（整数形式）
+func (s IndicatorSpec) period(i int) int {
+	return int(s.Params[i])
+}
+
+// Compute 计算指标序列
+func (s IndicatorSpec) Compute(klines []Kline) []IndicatorSeries {
+	closes := make([]float64, len(klines))
+	for i, k := range klines {
+		closes[i] = k.Close
+	}
+
+	switch s.Name {
+	case "ema":
+		return []IndicatorSeries{{Name: fmt.Sprintf("EMA%d", s.period(0)), Values: emaSeries(closes, s.period(0))}}
+	case "sma":
+		return []IndicatorSeries{{Name: fmt.Sprintf("SMA%d", s.period(0)), Values: smaSeries(closes, s.period(0))}}
+	case "macd":
+		macd, signal, hist := macdSeries(closes, s.period(0), s.period(1), s.period(2))
+		return []IndicatorSeries{
+			{Name: "MACD", Values: macd},
+			{Name: "MACD_signal", Values: signal},
+			{Name: "MACD_hist", Values: hist},
+		}
+	case "rsi":
+		return []IndicatorSeries{{Name: fmt.Sprintf("RSI%d", s.period(0)), Values: rsiSeries(closes, s.period(0))}}
+	case "atr":
+		return []IndicatorSeries{{Name: fmt.Sprintf("ATR%d", s.period(0)), Values: atrSeries(klines, s.period(0))}}
+	case "bb":
+		upper, middle, lower := bollingerSeries(closes, s.period(0), s.Params[1])
+		name := fmt.Sprintf("BB%d", s.period(0))
+		return []IndicatorSeries{
+			{Name: name + "_upper", Values: upper},
+			{Name: name + "_middle", Values: middle},
+			{Name: name + "_lower", Values: lower},
+		}
+	case "vwap":
+		return []IndicatorSeries{{Name: "VWAP", Values: vwapSeries(klines)}}
+	case "stochrsi":
+		k, d := stochRSISeries(closes, s.period(0), s.period(1), s.period(2), s.period(3))
+		return []IndicatorSeries{
+			{Name: "StochRSI_K", Values: k},
+			{Name: "StochRSI_D", Values: d},
+		}
+	case "adx":
+		adx, plusDI, minusDI := adxSeries(klines, s.period(0))
+		return []IndicatorSeries{
+			{Name: fmt.Sprintf("ADX%d", s.period(0)), Values: adx},
+			{Name: "+DI", Values: plusDI},
+			{Name: "-DI", Values: minusDI},
+		}
+	case "obv":
+		return []IndicatorSeries{{Name: "OBV", Values: obvSeries(klines)}}
+	case "donchian":
+		upper, lower := donchianSeries(klines, s.period(0))
+		name := fmt.Sprintf("Donchian%d", s.period(0))
+		return []IndicatorSeries{
+			{Name: name + "_upper", Values: upper},
+			{Name: name + "_lower", Values: lower},
+		}
+	case "volume":
+		volumes := make([]float64, len(klines))
+		for i, k := range klines {
+			volumes[i] = k.Volume
+		}
+		return []IndicatorSeries{{Name: "Volume", Values: volumes}}
+	}
+	return nil
+}
+
+// nanSeries 创建填充NaN的序列
+func nanSeries(n int) []float64 {
+	series := make([]float64, n)
+	for i := range series {
+		series[i] = math.NaN()
+	}
+	return series
+}
+
+// emaSeries EMA序列（以前period个值的SMA作为初始值，与calculateEMA一致），跳过开头的NaN
+func emaSeries(values []float64, period int) []float64 {
+	result := nanSeries(len(values))
+	start := 0
+	for start < len(values) && math.IsNaN(values[start]) {
+		start++
+	}
+	if period <= 0 || len(values)-start < period {
+		return result
+	}
+
+	sum := 0.0
+	for i := start; i < start+period; i++ {
+		sum += values[i]
+	}
+	ema := sum / float64(period)
+	result[start+period-1] = ema
+
+	multiplier := 2.0 / float64(period+1)
+	for i := start + period; i < len(values); i++ {
+		ema = (values[i]-ema)*multiplier + ema
+		result[i] = ema
+	}
+	return result
+}
+
+// smaSeries 简单移动平均序列（窗口内有NaN时结果为NaN）
+func smaSeries(values []float64, period int) []float64 {
+	result := nanSeries(len(values))
+	if period <= 0 {
+		return result
+	}
+	for i := period - 1; i < len(values); i++ {
+		sum := 0.0
+		for j := i - period + 1; j <= i; j++ {
+			sum += values[j]
+		}
+		result[i] = sum / float64(period)
+	}
+	return result
+}
+
+// macdSeries MACD线、信号线和柱状图
+func macdSeries(closes []float64, fast, slow, signalPeriod int) (macd, signal, hist []float64) {
+	fastEMA := emaSeries(closes, fast)
+	slowEMA := emaSeries(closes, slow)
+
+	macd = nanSeries(len(closes))
+	for i := range closes {
+		macd[i] = fastEMA[i] - slowEMA[i] // 任一为NaN时结果为NaN
+	}
+	signal = emaSeries(macd, signalPeriod)
+
+	hist = nanSeries(len(closes))
+	for i := range closes {
+		hist[i] = macd[i] - signal[i]
+	}
+	return macd, signal, hist
+}
+
+// rsiSeries RSI序列（Wilder平滑，与calculateRSI一致）
+func rsiSeries(closes []float64, period int) []float64 {
+	result := nanSeries(len(closes))
+	if period <= 0 || len(closes) <= period {
+		return result
+	}
+
+	gains, losses := 0.0, 0.0
+	for i := 1; i <= period; i++ {
+		change := closes[i] - closes[i-1]
+		if change > 0 {
+			gains += change
+		} else {
+			losses -= change
+		}
+	}
+	avgGain := gains / float64(period)
+	avgLoss := losses / float64(period)
+	result[period] = rsiFromAverages(avgGain, avgLoss)
+
+	for i := period + 1; i < len(closes); i++ {
+		change := closes[i] - closes[i-1]
+		gain, loss := 0.0, 0.0
+		if change > 0 {
+			gain = change
+		} else {
+			loss = -change
+		}
+		avgGain = (avgGain*float64(period-1) + gain) / float64(period)
+		avgLoss = (avgLoss*float64(period-1) + loss) / float64(period)
+		result[i] = rsiFromAverages(avgGain, avgLoss)
+	}
+	return result
+}
+
+// rsiFromAverages 根据平均涨跌幅计算RSI
+func rsiFromAverages(avgGain, avgLoss float64) float64 {
+	if avgLoss == 0 {
+		return 100
+	}
+	return 100 - 100/(1+avgGain/avgLoss)
+}
+
+// trueRanges 真实波幅序列（第一根K线为NaN）
+func trueRanges(klines []Kline) []float64 {
+	trs := nanSeries(len(klines))
+	for i := 1; i < len(klines); i++ {
+		prevClose := klines[i-1].Close
+		trs[i] = math.Max(klines[i].High-klines[i].Low,
+			math.Max(math.Abs(klines[i].High-prevClose), math.Abs(klines[i].Low-prevClose)))
+	}
+	return trs
+}
+
+// wilderSeries Wilder平滑序列（从start开始的period个值取平均作为初始值）
+func wilderSeries(values []float64, start, period int) []float64 {
+	result := nanSeries(len(values))
+	if period <= 0 || len(values)-start < period {
+		return result
+	}
+	sum := 0.0
+	for i := start; i < start+period; i++ {
+		sum += values[i]
+	}
+	avg := sum / float64(period)
+	result[start+period-1] = avg
+	for i := start + period; i < len(values); i++ {
+		avg = (avg*float64(period-1) + values[i]) / float64(period)
+		result[i] = avg
+	}
+	return result
+}
+
+// atrSeries ATR序列（Wilder平滑，与calculateATR一致）
+func atrSeries(klines []Kline, period int) []float64 {
+	return wilderSeries(trueRanges(klines), 1, period)
+}
+
+// bollingerSeries 布林带（中轨为SMA，上下轨为中轨±k倍标准差）
+func bollingerSeries(closes []float64, period int, k float64) (upper, middle, lower []float64) {
+	middle = smaSeries(closes, period)
+	upper = nanSeries(len(closes))
+	lower = nanSeries(len(closes))
+	for i := period - 1; i < len(closes); i++ {
+		if i < 0 {
+			continue
+		}
+		variance := 0.0
+		for j := i - period + 1; j <= i; j++ {
+			d := closes[j] - middle[i]
+			variance += d * d
+		}
+		std := math.Sqrt(variance / float64(period))
+		upper[i] = middle[i] + k*std
+		lower[i] = middle[i] - k*std
+	}
+	return upper, middle, lower
+}
+
+// vwapSeries 成交量加权平均价（从回看窗口第一根K线开始累计）
+func vwapSeries(klines []Kline) []float64 {
+	result := nanSeries(len(klines))
+	pv, vol := 0.0, 0.0
+	for i, k := range klines {
+		typical := (k.High + k.Low + k.Close) / 3
+		pv += typical * k.Volume
+		vol += k.Volume
+		if vol > 0 {
+			result[i] = pv / vol
+		}
+	}
+	return result
+}
+
+// stochRSISeries 随机RSI（%K为RSI在stochPeriod窗口内的位置再经kSmooth平滑，%D为%K的dSmooth均线）
+func stochRSISeries(closes []float64, rsiPeriod, stochPeriod, kSmooth, dSmooth int) (k, d []float64) {
+	rsi := rsiSeries(closes, rsiPeriod)
+	raw := nanSeries(len(closes))
+	for i := range closes {
+		if i-stochPeriod+1 < 0 {
+			continue
+		}
+		lowest, highest := math.Inf(1), math.Inf(-1)
+		valid := true
+		for j := i - stochPeriod + 1; j <= i; j++ {
+			if math.IsNaN(rsi[j]) {
+				valid = false
+				break
+			}
+			lowest = math.Min(lowest, rsi[j])
+			highest = math.Max(highest, rsi[j])
+		}
+		if !valid {
+			continue
+		}
+		if highest == lowest {
+			raw[i] = 0
+		} else {
+			raw[i] = (rsi[i] - lowest) / (highest - lowest) * 100
+		}
+	}
+	k = smaSeries(raw, kSmooth)
+	d = smaSeries(k, dSmooth)
+	return k, d
+}
+
+// adxSeries ADX及±DI（Wilder平滑）
+func adxSeries(klines []Kline, period int) (adx, plusDI, minusDI []float64) {
+	n := len(klines)
+	plusDM := nanSeries(n)
+	minusDM := nanSeries(n)
+	for i := 1; i < n; i++ {
+		up := klines[i].High - klines[i-1].High
+		down := klines[i-1].Low - klines[i].Low
+		plusDM[i], minusDM[i] = 0, 0
+		if up > down && up > 0 {
+			plusDM[i] = up
+		}
+		if down > up && down > 0 {
+			minusDM[i] = down
+		}
+	}
+
+	atr := wilderSeries(trueRanges(klines), 1, period)
+	smPlus := wilderSeries(plusDM, 1, period)
+	smMinus := wilderSeries(minusDM, 1, period)
+
+	plusDI = nanSeries(n)
+	minusDI = nanSeries(n)
+	dx := nanSeries(n)
+	firstDX := -1
+	for i := 0; i < n; i++ {
+		if math.IsNaN(atr[i]) || atr[i] == 0 {
+			continue
+		}
+		plusDI[i] = smPlus[i] / atr[i] * 100
+		minusDI[i] = smMinus[i] / atr[i] * 100
+		sum := plusDI[i] + minusDI[i]
+		if sum == 0 {
+			dx[i] = 0
+		} else {
+			dx[i] = math.Abs(plusDI[i]-minusDI[i]) / sum * 100
+		}
+		if firstDX < 0 {
+			firstDX = i
+		}
+	}
+
+	if firstDX < 0 {
+		return nanSeries(n), plusDI, minusDI
+	}
+	return wilderSeries(dx, firstDX, period), plusDI, minusDI
+}
+
+// obvSeries 能量潮（OBV）
+func obvSeries(klines []Kline) []float64 {
+	result := make([]float64, len(klines))
+	for i := 1; i < len(klines); i++ {
+		switch {
+		case klines[i].Close > klines[i-1].Close:
+			result[i] = result[i-1] + klines[i].Volume
+		case klines[i].Close < klines[i-1].Close:
+			result[i] = result[i-1] - klines[i].Volume
+		default:
+			result[i] = result[i-1]
+		}
+	}
+	return result
+}
+
+// donchianSeries 唐奇安通道（period根K线内的最高价和最低价）
+func donchianSeries(klines []Kline, period int) (upper, lower []float64) {
+	upper = nanSeries(len(klines))
+	lower = nanSeries(len(klines))
+	for i := period - 1; i < len(klines); i++ {
+		if i < 0 {
+			continue
+		}
+		high, low := math.Inf(-1), math.Inf(1)
+		for j := i - period + 1; j <= i; j++ {
+			high = math.Max(high, klines[j].High)
+			low = math.Min(low, klines[j].Low)
+		}
+		upper[i] = high
+		lower[i] = low
+	}
+	return upper, lower
+}
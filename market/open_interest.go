@@ -0,0 +1,201 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOIPeriod       = "15m" // 默认持仓量统计周期
+	defaultOILimit        = 100   // 默认拉取的数据点数量（15m×100覆盖25小时，足够计算24小时变化）
+	defaultOISeriesLength = 10    // 默认输出给AI的序列长度
+	maxOILimit            = 500   // openInterestHist单次最多返回的数据点
+)
+
+// oiPeriods openInterestHist支持的统计周期
+var oiPeriods = map[string]bool{
+	"5m": true, "15m": true, "30m": true, "1h": true, "2h": true, "4h": true, "6h": true, "12h": true, "1d": true,
+}
+
+// oiChangeWindows 持仓量变化的统计窗口（按输出顺序）
+var oiChangeWindows = []struct {
+	Label    string
+	Duration time.Duration
+}{
+	{"1h", time.Hour},
+	{"4h", 4 * time.Hour},
+	{"24h", 24 * time.Hour},
+}
+
+// OIConfig 持仓量历史配置
+type OIConfig struct {
+	Period       string // 统计周期（5m/15m/30m/1h/2h/4h/6h/12h/1d，默认15m）
+	Limit        int    // 拉取的数据点数量（默认100，最多500）
+	SeriesLength int    // 输出给AI的序列长度（默认10）
+}
+
+var (
+	oiConfig   = OIConfig{Period: defaultOIPeriod, Limit: defaultOILimit, SeriesLength: defaultOISeriesLength}
+	oiConfigMu sync.RWMutex
+)
+
+// SetOIConfig 设置持仓量历史的统计周期和长度（字段为空时使用默认值）
+func SetOIConfig(cfg OIConfig) error {
+	if cfg.Period == "" {
+		cfg.Period = defaultOIPeriod
+	}
+	if !oiPeriods[cfg.Period] {
+		return fmt.Errorf("不支持的持仓量统计周期: %q", cfg.Period)
+	}
+	if cfg.Limit <= 0 {
+		cfg.Limit = defaultOILimit
+	}
+	if cfg.Limit > maxOILimit {
+		return fmt.Errorf("持仓量数据点数量不能超过%d: %d", maxOILimit, cfg.Limit)
+	}
+	if cfg.SeriesLength <= 0 {
+		cfg.SeriesLength = defaultOISeriesLength
+	}
+
+	oiConfigMu.Lock()
+	oiConfig = cfg
+	oiConfigMu.Unlock()
+	return nil
+}
+
+// getOIConfig 获取当前的持仓量历史配置
+func getOIConfig() OIConfig {
+	oiConfigMu.RLock()
+	defer oiConfigMu.RUnlock()
+	return oiConfig
+}
+
+// OIData Open Interest数据（数量按币计）
+type OIData struct {
+	Latest       float64            // 最新持仓量
+	Average      float64            // 历史序列的平均持仓量（历史数据不可得时为0）
+	Period       string             // 历史序列的统计周期
+	Series       []float64          // 历史持仓量序列（oldest → latest）
+	SeriesLength int                // 输出给AI的序列长度
+	Changes      map[string]float64 // 持仓量变化百分比（键为 1h/4h/24h，历史数据不足的窗口不包含）
+}
+
+// Smoothed 平滑后的持仓量（优先使用历史平均值，避免单个快照的波动）
+func (o *OIData) Smoothed() float64 {
+	if o.Average > 0 {
+		return o.Average
+	}
+	return o.Latest
+}
+
+// getOpenInterestData 获取OI数据：最新持仓量和openInterestHist历史序列（历史获取失败时只返回最新值）
+func getOpenInterestData(baseURL, symbol string) (*OIData, error) {
+	latest, err := getOpenInterest(baseURL, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := getOIConfig()
+	data := &OIData{Latest: latest, Period: cfg.Period, SeriesLength: cfg.SeriesLength}
+	series, err := getOpenInterestHist(baseURL, symbol, cfg.Period, cfg.Limit)
+	if err != nil || len(series) == 0 {
+		return data, nil
+	}
+
+	sum := 0.0
+	for _, v := range series {
+		sum += v
+	}
+	data.Series = series
+	data.Average = sum / float64(len(series))
+	data.Changes = oiChanges(series, IntervalDuration(cfg.Period))
+	return data, nil
+}
+
+// oiChanges 计算持仓量序列在各窗口内的变化百分比（序列覆盖不到的窗口跳过）
+func oiChanges(series []float64, period time.Duration) map[string]float64 {
+	changes := make(map[string]float64)
+	if period <= 0 {
+		return changes
+	}
+
+	last := series[len(series)-1]
+	for _, w := range oiChangeWindows {
+		n := int(w.Duration / period)
+		if n < 1 || n >= len(series) {
+			continue
+		}
+		if prev := series[len(series)-1-n]; prev > 0 {
+			changes[w.Label] = (last - prev) / prev * 100
+		}
+	}
+	return changes
+}
+
+// getOpenInterest 获取当前持仓量快照
+func getOpenInterest(baseURL, symbol string) (float64, error) {
+	url := fmt.Sprintf("%s/fapi/v1/openInterest?symbol=%s", baseURL, symbol)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		OpenInterest string `json:"openInterest"`
+		Symbol       string `json:"symbol"`
+		Time         int64  `json:"time"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(result.OpenInterest, 64)
+}
+
+// getOpenInterestHist 获取持仓量历史序列（oldest → latest）
+func getOpenInterestHist(baseURL, symbol, period string, limit int) ([]float64, error) {
+	url := fmt.Sprintf("%s/futures/data/openInterestHist?symbol=%s&period=%s&limit=%d",
+		baseURL, symbol, period, limit)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []struct {
+		SumOpenInterest string `json:"sumOpenInterest"`
+		Timestamp       int64  `json:"timestamp"`
+	}
+	if err := json.Unmarshal(body, &points); err != nil {
+		return nil, fmt.Errorf("解析持仓量历史失败: %w, body: %s", err, string(body))
+	}
+
+	series := make([]float64, 0, len(points))
+	for _, p := range points {
+		v, err := strconv.ParseFloat(p.SumOpenInterest, 64)
+		if err != nil {
+			continue
+		}
+		series = append(series, v)
+	}
+	return series, nil
+}
@@ -0,0 +1,222 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultOrderBookLimit = 100 // 默认拉取的盘口档位数
+)
+
+// orderBookLimits depth接口支持的档位数
+var orderBookLimits = map[int]bool{5: true, 10: true, 20: true, 50: true, 100: true, 500: true, 1000: true}
+
+// orderBookReferenceSizes 输出给AI的滑点估算参考金额（USDT）
+var orderBookReferenceSizes = []float64{10000, 50000}
+
+// OrderBookConfig 盘口快照配置
+type OrderBookConfig struct {
+	Enabled bool // market.Get是否获取盘口快照（默认关闭，每个币种每次多一次请求）
+	Limit   int  // 拉取的档位数（5/10/20/50/100/500/1000，默认100）
+}
+
+var (
+	orderBookConfig   = OrderBookConfig{Limit: defaultOrderBookLimit}
+	orderBookConfigMu sync.RWMutex
+)
+
+// SetOrderBookConfig 设置盘口快照的开关和档位数（Limit为0时使用默认值）
+func SetOrderBookConfig(cfg OrderBookConfig) error {
+	if cfg.Limit == 0 {
+		cfg.Limit = defaultOrderBookLimit
+	}
+	if !orderBookLimits[cfg.Limit] {
+		return fmt.Errorf("不支持的盘口档位数: %d（可选 5/10/20/50/100/500/1000）", cfg.Limit)
+	}
+
+	orderBookConfigMu.Lock()
+	orderBookConfig = cfg
+	orderBookConfigMu.Unlock()
+	return nil
+}
+
+// getOrderBookConfig 获取当前的盘口快照配置
+func getOrderBookConfig() OrderBookConfig {
+	orderBookConfigMu.RLock()
+	defer orderBookConfigMu.RUnlock()
+	return orderBookConfig
+}
+
+// BookLevel 盘口档位
+type BookLevel struct {
+	Price    float64
+	Quantity float64
+}
+
+// OrderBook 盘口快照及流动性指标（深度按USDT名义价值计）
+type OrderBook struct {
+	Bids       []BookLevel // 买盘（价格从高到低）
+	Asks       []BookLevel // 卖盘（价格从低到高）
+	SpreadBps  float64     // 买卖价差（基点，相对中间价）
+	BidDepth05 float64     // 中间价下方0.5%以内的买盘深度
+	AskDepth05 float64     // 中间价上方0.5%以内的卖盘深度
+	BidDepth1  float64     // 中间价下方1%以内的买盘深度
+	AskDepth1  float64     // 中间价上方1%以内的卖盘深度
+	Imbalance  float64     // ±1%深度不平衡度 (买-卖)/(买+卖)，正数表示买盘更厚
+}
+
+// Mid 中间价
+func (b *OrderBook) Mid() float64 {
+	if len(b.Bids) == 0 || len(b.Asks) == 0 {
+		return 0
+	}
+	return (b.Bids[0].Price + b.Asks[0].Price) / 2
+}
+
+// EstimateSlippage 估算市价开仓notionalUSD的滑点（基点，成交均价相对中间价，含半个价差）
+// side为"long"时吃卖盘，"short"时吃买盘；盘口深度不足以成交全部金额时返回+Inf
+func (b *OrderBook) EstimateSlippage(side string, notionalUSD float64) float64 {
+	mid := b.Mid()
+	if mid <= 0 || notionalUSD <= 0 {
+		return 0
+	}
+
+	levels := b.Asks
+	if side == "short" {
+		levels = b.Bids
+	}
+
+	remaining := notionalUSD
+	var filledNotional, filledQty float64
+	for _, level := range levels {
+		levelNotional := level.Price * level.Quantity
+		take := math.Min(levelNotional, remaining)
+		filledNotional += take
+		filledQty += take / level.Price
+		remaining -= take
+		if remaining <= 0 {
+			break
+		}
+	}
+	if remaining > 0 || filledQty <= 0 {
+		return math.Inf(1)
+	}
+
+	vwap := filledNotional / filledQty
+	if side == "short" {
+		return (mid - vwap) / mid * 10000
+	}
+	return (vwap - mid) / mid * 10000
+}
+
+// MaxNotionalWithinSlippage 滑点不超过maxBps时可成交的最大名义价值（USDT）
+func (b *OrderBook) MaxNotionalWithinSlippage(side string, maxBps float64) float64 {
+	levels := b.Asks
+	if side == "short" {
+		levels = b.Bids
+	}
+	high := 0.0
+	for _, level := range levels {
+		high += level.Price * level.Quantity
+	}
+	if b.EstimateSlippage(side, high) <= maxBps {
+		return high
+	}
+
+	// 滑点随金额单调不减，二分查找
+	low := 0.0
+	for i := 0; i < 50; i++ {
+		mid := (low + high) / 2
+		if b.EstimateSlippage(side, mid) <= maxBps {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return low
+}
+
+// computeMetrics 根据盘口档位计算价差、深度和不平衡度
+func (b *OrderBook) computeMetrics() {
+	mid := b.Mid()
+	if mid <= 0 {
+		return
+	}
+	b.SpreadBps = (b.Asks[0].Price - b.Bids[0].Price) / mid * 10000
+
+	for _, level := range b.Bids {
+		distance := (mid - level.Price) / mid
+		if distance <= 0.005 {
+			b.BidDepth05 += level.Price * level.Quantity
+		}
+		if distance <= 0.01 {
+			b.BidDepth1 += level.Price * level.Quantity
+		}
+	}
+	for _, level := range b.Asks {
+		distance := (level.Price - mid) / mid
+		if distance <= 0.005 {
+			b.AskDepth05 += level.Price * level.Quantity
+		}
+		if distance <= 0.01 {
+			b.AskDepth1 += level.Price * level.Quantity
+		}
+	}
+	if total := b.BidDepth1 + b.AskDepth1; total > 0 {
+		b.Imbalance = (b.BidDepth1 - b.AskDepth1) / total
+	}
+}
+
+// getOrderBook 获取盘口快照并计算流动性指标
+func getOrderBook(baseURL, symbol string, limit int) (*OrderBook, error) {
+	url := fmt.Sprintf("%s/fapi/v1/depth?symbol=%s&limit=%d", baseURL, symbol, limit)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Bids [][]string `json:"bids"`
+		Asks [][]string `json:"asks"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析盘口数据失败: %w, body: %s", err, string(body))
+	}
+
+	book := &OrderBook{Bids: parseBookLevels(result.Bids), Asks: parseBookLevels(result.Asks)}
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return nil, fmt.Errorf("%s 盘口为空", symbol)
+	}
+	book.computeMetrics()
+	return book, nil
+}
+
+// parseBookLevels 解析 [价格, 数量] 格式的盘口档位
+func parseBookLevels(raw [][]string) []BookLevel {
+	levels := make([]BookLevel, 0, len(raw))
+	for _, r := range raw {
+		if len(r) < 2 {
+			continue
+		}
+		price, err1 := strconv.ParseFloat(r[0], 64)
+		qty, err2 := strconv.ParseFloat(r[1], 64)
+		if err1 != nil || err2 != nil || price <= 0 {
+			continue
+		}
+		levels = append(levels, BookLevel{Price: price, Quantity: qty})
+	}
+	return levels
+}
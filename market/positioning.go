@@ -0,0 +1,106 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// PositioningData 主动买卖量和多空账户比序列（来自futures/data统计接口，与持仓量历史使用相同的统计周期和序列长度，均为oldest → latest）
+type PositioningData struct {
+	Period            string    // 统计周期
+	TakerBuyVolume    []float64 // 主动买入量（币）
+	TakerSellVolume   []float64 // 主动卖出量（币）
+	TakerBuySellRatio []float64 // 主动买卖量比
+	TopTraderRatio    []float64 // 大户账户多空比
+	GlobalRatio       []float64 // 全市场账户多空比
+}
+
+// getPositioningData 获取主动买卖量和多空账户比（单个接口失败时对应序列为空，全部失败时返回错误）
+func getPositioningData(baseURL, symbol string) (*PositioningData, error) {
+	cfg := getOIConfig()
+	data := &PositioningData{Period: cfg.Period}
+
+	takerErr := data.fetchTakerVolume(baseURL, symbol, cfg.Period, cfg.SeriesLength)
+	var topErr, globalErr error
+	data.TopTraderRatio, topErr = getLongShortRatio(baseURL, "topLongShortAccountRatio", symbol, cfg.Period, cfg.SeriesLength)
+	data.GlobalRatio, globalErr = getLongShortRatio(baseURL, "globalLongShortAccountRatio", symbol, cfg.Period, cfg.SeriesLength)
+
+	if takerErr != nil && topErr != nil && globalErr != nil {
+		return nil, fmt.Errorf("获取%s多空数据失败: %w", symbol, takerErr)
+	}
+	return data, nil
+}
+
+// fetchTakerVolume 获取主动买卖量序列
+func (p *PositioningData) fetchTakerVolume(baseURL, symbol, period string, limit int) error {
+	var points []struct {
+		BuySellRatio string `json:"buySellRatio"`
+		BuyVol       string `json:"buyVol"`
+		SellVol      string `json:"sellVol"`
+		Timestamp    int64  `json:"timestamp"`
+	}
+	if err := getFuturesData(baseURL, "takerlongshortRatio", symbol, period, limit, &points); err != nil {
+		return err
+	}
+
+	for _, point := range points {
+		buy, err1 := strconv.ParseFloat(point.BuyVol, 64)
+		sell, err2 := strconv.ParseFloat(point.SellVol, 64)
+		ratio, err3 := strconv.ParseFloat(point.BuySellRatio, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		p.TakerBuyVolume = append(p.TakerBuyVolume, buy)
+		p.TakerSellVolume = append(p.TakerSellVolume, sell)
+		p.TakerBuySellRatio = append(p.TakerBuySellRatio, ratio)
+	}
+	return nil
+}
+
+// getLongShortRatio 获取账户多空比序列（endpoint为topLongShortAccountRatio或globalLongShortAccountRatio）
+func getLongShortRatio(baseURL, endpoint, symbol, period string, limit int) ([]float64, error) {
+	var points []struct {
+		LongShortRatio string `json:"longShortRatio"`
+		LongAccount    string `json:"longAccount"`
+		ShortAccount   string `json:"shortAccount"`
+		Timestamp      int64  `json:"timestamp"`
+	}
+	if err := getFuturesData(baseURL, endpoint, symbol, period, limit, &points); err != nil {
+		return nil, err
+	}
+
+	series := make([]float64, 0, len(points))
+	for _, point := range points {
+		v, err := strconv.ParseFloat(point.LongShortRatio, 64)
+		if err != nil {
+			continue
+		}
+		series = append(series, v)
+	}
+	return series, nil
+}
+
+// getFuturesData 请求futures/data统计接口并解析到result
+func getFuturesData(baseURL, endpoint, symbol, period string, limit int, result interface{}) error {
+	url := fmt.Sprintf("%s/futures/data/%s?symbol=%s&period=%s&limit=%d",
+		baseURL, endpoint, symbol, period, limit)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("解析%s失败: %w, body: %s", endpoint, err, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package market
+
+import (
+	"fmt"
+	"nofx/instrument"
+)
+
+// 行情数据源名称（与交易所名称一致）
+const (
+	ProviderBinance     = "binance"
+	ProviderHyperliquid = "hyperliquid"
+	ProviderAster       = "aster"
+)
+
+const (
+	binanceBaseURL = "https://fapi.binance.com"
+	asterBaseURL   = "https://fapi.asterdex.com"
+)
+
+// Provider 行情数据源（symbol均为标准格式，如BTCUSDT）
+// 各交易所的价格、资金费率和持仓量不同，trader应使用其实际下单交易所的数据源
+type Provider interface {
+	// Name 数据源名称
+	Name() string
+
+	// Price 获取最新价格（使用行情缓存或轻量的价格接口，供频繁轮询使用）
+	Price(symbol string) (float64, error)
+
+	// Klines 获取最近limit根K线（oldest → latest，最后一根为未收盘K线）
+	Klines(symbol, interval string, limit int) ([]Kline, error)
+
+	// OpenInterest 获取持仓量（不提供历史序列的交易所只返回最新值）
+	OpenInterest(symbol string) (*OIData, error)
+
+	// Funding 获取预测资金费率、下次结算时间、标记/指数价格和资金费率历史
+	Funding(symbol string) (*FundingData, error)
+
+	// Positioning 获取主动买卖量和多空账户比（交易所不提供时返回错误）
+	Positioning(symbol string) (*PositioningData, error)
+
+	// OrderBook 获取盘口快照（limit为档位数）
+	OrderBook(symbol string, limit int) (*OrderBook, error)
+}
+
+// cachedProvider 带本地行情缓存的数据源（命中缓存时跳过K线、OI和资金费率的REST请求）
+type cachedProvider interface {
+	cached(symbol string) (*Data, bool)
+}
+
+// ReferencePrice 其他交易所的参考价格（用于对比跨交易所价差）
+type ReferencePrice struct {
+	Venue string  // 参考数据源名称
+	Price float64 // 参考交易所的最新价格
+}
+
+// NewProvider 按名称创建行情数据源（testnet只对Hyperliquid生效）
+func NewProvider(name string, testnet bool) (Provider, error) {
+	switch name {
+	case ProviderBinance:
+		return binanceProvider, nil
+	case ProviderHyperliquid:
+		return NewHyperliquidProvider(testnet), nil
+	case ProviderAster:
+		return NewAsterProvider(), nil
+	}
+	return nil, fmt.Errorf("不支持的行情数据源: %q（可选 binance/hyperliquid/aster）", name)
+}
+
+// NewFetcher 创建市场数据获取函数：从p获取数据并计算specs中的K线周期，reference不为空时附加其参考价格
+func NewFetcher(p Provider, specs []TimeframeSpec, reference Provider) func(symbol string) (*Data, error) {
+	return func(symbol string) (*Data, error) {
+		data, err := GetWithTimeframesFrom(p, symbol, specs)
+		if err != nil {
+			return nil, err
+		}
+		if reference != nil && reference.Name() != p.Name() {
+			attachReference(data, reference)
+		}
+		return data, nil
+	}
+}
+
+// GetFrom 从指定数据源获取市场数据（OI、资金费率、多空数据和盘口获取失败不影响整体）
+func GetFrom(p Provider, symbol string) (*Data, error) {
+	// 标准化symbol
+	symbol = instrument.Canonical(symbol)
+
+	// 优先使用行情缓存
+	if c, ok := p.(cachedProvider); ok {
+		if data, ok := c.cached(symbol); ok {
+			attachOrderBook(p, data)
+			return data, nil
+		}
+	}
+
+	// 获取3分钟K线数据 (最近10个)
+	klines3m, err := p.Klines(symbol, "3m", 40) // 多获取一些用于计算
+	if err != nil {
+		return nil, fmt.Errorf("获取3分钟K线失败: %v", err)
+	}
+
+	// 获取4小时K线数据 (最近10个)
+	klines4h, err := p.Klines(symbol, "4h", 60) // 多获取用于计算指标
+	if err != nil {
+		return nil, fmt.Errorf("获取4小时K线失败: %v", err)
+	}
+
+	data, err := BuildData(symbol, klines3m, klines4h)
+	if err != nil {
+		return nil, err
+	}
+	data.Venue = p.Name()
+
+	// 获取OI数据
+	oiData, err := p.OpenInterest(symbol)
+	if err != nil {
+		// OI失败不影响整体,使用默认值
+		oiData = &OIData{Latest: 0, Average: 0}
+	}
+	data.OpenInterest = oiData
+
+	// 获取Funding Rate（预测费率、下次结算时间、基差和历史）
+	if funding, err := p.Funding(symbol); err == nil {
+		data.Funding = funding
+		data.FundingRate = funding.Rate
+	}
+
+	// 获取主动买卖量和多空账户比（失败不影响整体）
+	if positioning, err := p.Positioning(symbol); err == nil {
+		data.Positioning = positioning
+	}
+
+	attachOrderBook(p, data)
+	return data, nil
+}
+
+// GetWithTimeframesFrom 从指定数据源获取市场数据，并按配置计算额外K线周期的指标
+func GetWithTimeframesFrom(p Provider, symbol string, specs []TimeframeSpec) (*Data, error) {
+	data, err := GetFrom(p, symbol)
+	if err != nil {
+		return nil, err
+	}
+	symbol = instrument.Canonical(symbol)
+
+	for _, spec := range specs {
+		klines, err := p.Klines(symbol, spec.Interval, spec.Lookback)
+		if err != nil {
+			return nil, fmt.Errorf("获取%s K线失败: %v", spec.Interval, err)
+		}
+		data.Timeframes = append(data.Timeframes, BuildTimeframe(spec, klines))
+	}
+	return data, nil
+}
+
+// attachOrderBook 启用盘口快照时获取最新盘口（盘口变化快，不走行情缓存；获取失败不影响整体）
+func attachOrderBook(p Provider, data *Data) {
+	cfg := getOrderBookConfig()
+	if !cfg.Enabled {
+		return
+	}
+	if book, err := p.OrderBook(data.Symbol, cfg.Limit); err == nil {
+		data.OrderBook = book
+	}
+}
+
+// attachReference 附加参考交易所的最新价格（该交易所未上线此币种或获取失败时不附加）
+func attachReference(data *Data, reference Provider) {
+	price, err := reference.Price(data.Symbol)
+	if err != nil || price <= 0 {
+		return
+	}
+	data.Reference = &ReferencePrice{Venue: reference.Name(), Price: price}
+}
+
+// binanceProvider 币安行情数据源（使用全局WebSocket行情缓存）
+var binanceProvider = &BinanceProvider{name: ProviderBinance, baseURL: binanceBaseURL, useStream: true}
+
+// BinanceProvider 币安兼容REST接口的行情数据源（币安和Aster）
+type BinanceProvider struct {
+	name      string
+	baseURL   string
+	useStream bool // 是否使用全局WebSocket行情缓存（只订阅币安行情）
+}
+
+// NewAsterProvider 创建Aster行情数据源（Aster提供与币安一致的公开行情接口）
+func NewAsterProvider() *BinanceProvider {
+	return &BinanceProvider{name: ProviderAster, baseURL: asterBaseURL}
+}
+
+// Name 数据源名称
+func (p *BinanceProvider) Name() string {
+	return p.name
+}
+
+// Price 获取最新成交价（优先使用WebSocket缓存的3分钟K线收盘价，否则调用ticker/price）
+func (p *BinanceProvider) Price(symbol string) (float64, error) {
+	if p.useStream {
+		if stream := getDefaultStream(); stream != nil {
+			if klines, ok := stream.Klines(symbol, "3m", 1); ok {
+				return klines[len(klines)-1].Close, nil
+			}
+		}
+	}
+	return getTickerPrice(p.baseURL, symbol)
+}
+
+// Klines 获取K线（优先使用WebSocket缓存，否则调用REST）
+func (p *BinanceProvider) Klines(symbol, interval string, limit int) ([]Kline, error) {
+	if p.useStream {
+		if stream := getDefaultStream(); stream != nil {
+			if klines, ok := stream.Klines(symbol, interval, limit); ok {
+				return klines, nil
+			}
+		}
+	}
+	return getKlines(p.baseURL, symbol, interval, limit)
+}
+
+// OpenInterest 获取最新持仓量和openInterestHist历史序列
+func (p *BinanceProvider) OpenInterest(symbol string) (*OIData, error) {
+	return getOpenInterestData(p.baseURL, symbol)
+}
+
+// Funding 获取预测资金费率、下次结算时间、基差和历史
+func (p *BinanceProvider) Funding(symbol string) (*FundingData, error) {
+	return getFundingData(p.baseURL, symbol)
+}
+
+// Positioning 获取主动买卖量和多空账户比
+func (p *BinanceProvider) Positioning(symbol string) (*PositioningData, error) {
+	return getPositioningData(p.baseURL, symbol)
+}
+
+// OrderBook 获取盘口快照
+func (p *BinanceProvider) OrderBook(symbol string, limit int) (*OrderBook, error) {
+	return getOrderBook(p.baseURL, symbol, limit)
+}
+
+// cached 从WebSocket行情缓存构建市场数据（未订阅或数据过期时加入订阅，本次回退到REST）
+func (p *BinanceProvider) cached(symbol string) (*Data, bool) {
+	if !p.useStream {
+		return nil, false
+	}
+	stream := getDefaultStream()
+	if stream == nil {
+		return nil, false
+	}
+	if data, ok := stream.Get(symbol); ok {
+		data.Venue = p.name
+		return data, true
+	}
+	stream.Subscribe(symbol)
+	return nil, false
+}
@@ -0,0 +1,488 @@
+package market
+
+import (
+	"log"
+	"nofx/instrument"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+)
+
+const (
+	streamBufferSize     = 100              // 每个周期至少保留的K线数量（Get需要3m×40、4h×60）
+	streamBatchSize      = 100              // 每条WebSocket连接订阅的币种数
+	streamStaleAfter     = 60 * time.Second // 超过该时间未收到K线推送视为数据过期，回退到REST
+	streamSubscribeDelay = 2 * time.Second  // 合并短时间内的订阅请求，减少连接数
+	streamOIInterval     = time.Minute      // OI和资金费率历史没有WebSocket推送，定时通过REST刷新
+	streamMaxBackoff     = time.Minute      // 断线重连最大等待时间
+)
+
+var (
+	defaultStream   *Stream
+	defaultStreamMu sync.RWMutex
+)
+
+// StartStream 启动全局WebSocket行情服务，之后market.Get优先从内存缓存读取
+// timeframes为各trader配置的额外K线周期，同样通过WebSocket缓存
+func StartStream(symbols []string, timeframes []TimeframeSpec) {
+	defaultStreamMu.Lock()
+	defer defaultStreamMu.Unlock()
+	if defaultStream != nil {
+		return
+	}
+	defaultStream = NewStream(timeframes)
+	defaultStream.Subscribe(symbols...)
+	log.Printf("📡 WebSocket行情服务已启动，预订阅%d个币种，K线周期: %v", len(symbols), defaultStream.intervals)
+}
+
+// StopStream 关闭全局WebSocket行情服务（market.Get回退到REST）
+func StopStream() {
+	defaultStreamMu.Lock()
+	defer defaultStreamMu.Unlock()
+	if defaultStream != nil {
+		defaultStream.Close()
+		defaultStream = nil
+	}
+}
+
+// getDefaultStream 获取全局行情服务（未启动时返回nil）
+func getDefaultStream() *Stream {
+	defaultStreamMu.RLock()
+	defer defaultStreamMu.RUnlock()
+	return defaultStream
+}
+
+// Stream WebSocket行情服务
+// 订阅K线(3m/4h)和标记价格(含资金费率)推送，在内存中维护滚动K线缓存
+type Stream struct {
+	mu         sync.RWMutex
+	intervals  []string                // 订阅的K线周期
+	bufferSize map[string]int          // 每个周期保留的K线数量
+	symbols    map[string]*symbolCache // 已补齐数据的币种缓存
+	subscribed map[string]bool         // 已订阅（含等待建立连接）的币种
+	pending    []string                // 等待建立连接的币种
+	wake       chan struct{}
+	quit       chan struct{}
+	closeOnce  sync.Once
+}
+
+// symbolCache 单个币种的行情缓存
+type symbolCache struct {
+	klines        map[string][]Kline // interval -> K线
+	funding       *FundingData
+	fundingNext   int64 // 资金费率历史对应的下次结算时间（结算后重新拉取历史）
+	oi            *OIData
+	positioning   *PositioningData
+	positioningAt time.Time // 最近一次拉取多空数据的时间（按统计周期刷新）
+	lastUpdate    time.Time // 最近一次收到K线推送的时间
+}
+
+// NewStream 创建WebSocket行情服务（默认订阅3m和4h，另加timeframes中配置的周期）
+func NewStream(timeframes []TimeframeSpec) *Stream {
+	bufferSize := map[string]int{"3m": streamBufferSize, "4h": streamBufferSize}
+	intervals := []string{"3m", "4h"}
+	for _, tf := range timeframes {
+		size, ok := bufferSize[tf.Interval]
+		if !ok {
+			intervals = append(intervals, tf.Interval)
+			size = streamBufferSize
+		}
+		if tf.Lookback > size {
+			size = tf.Lookback
+		}
+		bufferSize[tf.Interval] = size
+	}
+
+	s := &Stream{
+		intervals:  intervals,
+		bufferSize: bufferSize,
+		symbols:    make(map[string]*symbolCache),
+		subscribed: make(map[string]bool),
+		wake:       make(chan struct{}, 1),
+		quit:       make(chan struct{}),
+	}
+	go s.subscribeLoop()
+	go s.refreshOILoop()
+	return s
+}
+
+// Close 关闭所有WebSocket连接
+func (s *Stream) Close() {
+	s.closeOnce.Do(func() { close(s.quit) })
+}
+
+// Subscribe 订阅币种（异步：先用REST补齐K线，再建立WebSocket连接）
+func (s *Stream) Subscribe(symbols ...string) {
+	s.mu.Lock()
+	added := false
+	for _, symbol := range symbols {
+		symbol = instrument.Canonical(symbol)
+		if s.subscribed[symbol] {
+			continue
+		}
+		s.subscribed[symbol] = true
+		s.pending = append(s.pending, symbol)
+		added = true
+	}
+	s.mu.Unlock()
+
+	if added {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Get 从缓存构建市场数据，未订阅或数据过期时返回false
+func (s *Stream) Get(symbol string) (*Data, bool) {
+	s.mu.RLock()
+	cache, ok := s.symbols[symbol]
+	if !ok || time.Since(cache.lastUpdate) > streamStaleAfter || len(cache.klines["3m"]) == 0 {
+		s.mu.RUnlock()
+		return nil, false
+	}
+	klines3m := copyTail(cache.klines["3m"], 40)
+	klines4h := copyTail(cache.klines["4h"], 60)
+	var funding *FundingData
+	if cache.funding != nil {
+		// 标记价格推送只修改标量字段，历史序列整体替换，浅拷贝即可
+		snapshot := *cache.funding
+		funding = &snapshot
+	}
+	oi := &OIData{Latest: 0, Average: 0}
+	if cache.oi != nil {
+		// 刷新时整体替换cache.oi，浅拷贝即可
+		snapshot := *cache.oi
+		oi = &snapshot
+	}
+	positioning := cache.positioning // 刷新时整体替换，直接共享
+	s.mu.RUnlock()
+
+	data, err := BuildData(symbol, klines3m, klines4h)
+	if err != nil {
+		return nil, false
+	}
+	data.OpenInterest = oi
+	if funding != nil {
+		data.Funding = funding
+		data.FundingRate = funding.Rate
+	}
+	data.Positioning = positioning
+	return data, true
+}
+
+// Klines 从缓存读取最近limit根K线，未订阅该周期、缓存不足或数据过期时返回false
+func (s *Stream) Klines(symbol, interval string, limit int) ([]Kline, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cache, ok := s.symbols[symbol]
+	if !ok || time.Since(cache.lastUpdate) > streamStaleAfter {
+		return nil, false
+	}
+	klines, ok := cache.klines[interval]
+	if !ok || len(klines) < limit {
+		return nil, false
+	}
+	return copyTail(klines, limit), true
+}
+
+// subscribeLoop 批量处理订阅请求
+func (s *Stream) subscribeLoop() {
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-s.wake:
+		}
+
+		// 等待一小段时间合并同一周期内的订阅请求
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(streamSubscribeDelay):
+		}
+
+		s.mu.Lock()
+		batch := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+
+		for start := 0; start < len(batch); start += streamBatchSize {
+			end := start + streamBatchSize
+			if end > len(batch) {
+				end = len(batch)
+			}
+			symbols := batch[start:end]
+			s.seed(symbols)
+			go s.serve(symbols)
+		}
+	}
+}
+
+// seed 通过REST补齐K线、OI、资金费率和多空数据（首次订阅和断线重连时调用）
+func (s *Stream) seed(symbols []string) {
+symbolLoop:
+	for _, symbol := range symbols {
+		klines := make(map[string][]Kline, len(s.intervals))
+		for _, interval := range s.intervals {
+			k, err := getKlines(binanceBaseURL, symbol, interval, s.bufferSize[interval])
+			if err != nil {
+				log.Printf("⚠️  %s %s K线补齐失败: %v", symbol, interval, err)
+				continue symbolLoop
+			}
+			klines[interval] = k
+		}
+		oi, _ := getOpenInterestData(binanceBaseURL, symbol)
+		funding, _ := getFundingData(binanceBaseURL, symbol)
+		positioning, _ := getPositioningData(binanceBaseURL, symbol)
+
+		s.mu.Lock()
+		cache, ok := s.symbols[symbol]
+		if !ok {
+			cache = &symbolCache{}
+			s.symbols[symbol] = cache
+		}
+		cache.klines = klines
+		if funding != nil {
+			cache.funding = funding
+			cache.fundingNext = funding.NextFundingTime
+		}
+		if oi != nil {
+			cache.oi = oi
+		}
+		if positioning != nil {
+			cache.positioning = positioning
+			cache.positioningAt = time.Now()
+		}
+		cache.lastUpdate = time.Now()
+		s.mu.Unlock()
+	}
+}
+
+// serve 维持一批币种的WebSocket连接，断线后补齐数据并重连
+func (s *Stream) serve(symbols []string) {
+	intervals := make(map[string][]string, len(symbols))
+	for _, symbol := range symbols {
+		intervals[symbol] = s.intervals
+	}
+	errHandler := func(err error) {
+		log.Printf("⚠️  WebSocket行情错误: %v", err)
+	}
+
+	backoff := time.Second
+	for {
+		klineDone, klineStop, err := futures.WsCombinedKlineServeMultiInterval(intervals, s.handleKline, errHandler)
+		if err == nil {
+			markDone, markStop, markErr := futures.WsCombinedMarkPriceServe(symbols, s.handleMarkPrice, errHandler)
+			if markErr == nil {
+				backoff = time.Second
+				select {
+				case <-s.quit:
+					close(klineStop)
+					close(markStop)
+					return
+				case <-klineDone:
+				case <-markDone:
+				}
+				close(klineStop)
+				close(markStop)
+				log.Printf("⚠️  WebSocket行情连接断开（%d个币种），准备重连", len(symbols))
+			} else {
+				close(klineStop)
+				err = markErr
+			}
+		}
+		if err != nil {
+			log.Printf("⚠️  WebSocket行情连接失败: %v，%v后重试", err, backoff)
+		}
+
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > streamMaxBackoff {
+			backoff = streamMaxBackoff
+		}
+
+		// 断线期间可能缺少K线，重连前用REST补齐
+		s.seed(symbols)
+	}
+}
+
+// handleKline 处理K线推送（更新当前K线或追加新K线）
+func (s *Stream) handleKline(event *futures.WsKlineEvent) {
+	kline, err := parseWsKline(&event.Kline)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cache, ok := s.symbols[event.Symbol]
+	if !ok {
+		return
+	}
+	interval := event.Kline.Interval
+	if klines, ok := cache.klines[interval]; ok {
+		cache.klines[interval] = mergeKline(klines, kline, s.bufferSize[interval])
+	}
+	cache.lastUpdate = time.Now()
+}
+
+// handleMarkPrice 处理标记价格推送（预测资金费率、下次结算时间和标记/指数价格）
+func (s *Stream) handleMarkPrice(event *futures.WsMarkPriceEvent) {
+	rate, err := strconv.ParseFloat(event.FundingRate, 64)
+	if err != nil {
+		return
+	}
+	markPrice, _ := strconv.ParseFloat(event.MarkPrice, 64)
+	indexPrice, _ := strconv.ParseFloat(event.IndexPrice, 64)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cache, ok := s.symbols[event.Symbol]
+	if !ok {
+		return
+	}
+	if cache.funding == nil {
+		cache.funding = &FundingData{}
+	}
+	cache.funding.Rate = rate
+	cache.funding.NextFundingTime = event.NextFundingTime
+	cache.funding.MarkPrice = markPrice
+	cache.funding.IndexPrice = indexPrice
+}
+
+// refreshOILoop 定时刷新已订阅币种的持仓量、资金费率历史和多空数据
+func (s *Stream) refreshOILoop() {
+	ticker := time.NewTicker(streamOIInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.RLock()
+		symbols := make([]string, 0, len(s.symbols))
+		for symbol := range s.symbols {
+			symbols = append(symbols, symbol)
+		}
+		s.mu.RUnlock()
+
+		for _, symbol := range symbols {
+			if oi, err := getOpenInterestData(binanceBaseURL, symbol); err == nil {
+				s.mu.Lock()
+				if cache, ok := s.symbols[symbol]; ok {
+					cache.oi = oi
+				}
+				s.mu.Unlock()
+			}
+			s.refreshFundingHistory(symbol)
+			s.refreshPositioning(symbol)
+		}
+	}
+}
+
+// refreshPositioning 距上次拉取超过一个统计周期时重新拉取多空数据（统计接口按周期更新，减少请求）
+func (s *Stream) refreshPositioning(symbol string) {
+	s.mu.RLock()
+	cache, ok := s.symbols[symbol]
+	stale := ok && time.Since(cache.positioningAt) >= IntervalDuration(getOIConfig().Period)
+	s.mu.RUnlock()
+	if !stale {
+		return
+	}
+
+	positioning, err := getPositioningData(binanceBaseURL, symbol)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cache, ok := s.symbols[symbol]; ok {
+		cache.positioning = positioning
+		cache.positioningAt = time.Now()
+	}
+}
+
+// refreshFundingHistory 资金费结算后（下次结算时间变化）重新拉取已结算资金费率历史
+func (s *Stream) refreshFundingHistory(symbol string) {
+	s.mu.RLock()
+	cache, ok := s.symbols[symbol]
+	stale := ok && cache.funding != nil && cache.funding.NextFundingTime != cache.fundingNext
+	s.mu.RUnlock()
+	if !stale {
+		return
+	}
+
+	history, interval, err := getFundingHistory(binanceBaseURL, symbol, fundingHistoryLength)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cache, ok := s.symbols[symbol]; ok && cache.funding != nil {
+		cache.funding.History = history
+		cache.funding.Interval = interval
+		cache.fundingNext = cache.funding.NextFundingTime
+	}
+}
+
+// parseWsKline 将WebSocket K线转换为Kline
+func parseWsKline(k *futures.WsKline) (Kline, error) {
+	kline := Kline{OpenTime: k.StartTime, CloseTime: k.EndTime}
+	var err error
+	if kline.Open, err = strconv.ParseFloat(k.Open, 64); err != nil {
+		return kline, err
+	}
+	if kline.High, err = strconv.ParseFloat(k.High, 64); err != nil {
+		return kline, err
+	}
+	if kline.Low, err = strconv.ParseFloat(k.Low, 64); err != nil {
+		return kline, err
+	}
+	if kline.Close, err = strconv.ParseFloat(k.Close, 64); err != nil {
+		return kline, err
+	}
+	if kline.Volume, err = strconv.ParseFloat(k.Volume, 64); err != nil {
+		return kline, err
+	}
+	return kline, nil
+}
+
+// mergeKline 合并推送的K线：同一根K线覆盖，新K线追加并保留最近bufferSize根
+func mergeKline(klines []Kline, kline Kline, bufferSize int) []Kline {
+	n := len(klines)
+	if n > 0 {
+		last := klines[n-1].OpenTime
+		if kline.OpenTime == last {
+			klines[n-1] = kline
+			return klines
+		}
+		if kline.OpenTime < last {
+			return klines // 过期推送
+		}
+	}
+	klines = append(klines, kline)
+	if len(klines) > bufferSize {
+		klines = append([]Kline(nil), klines[len(klines)-bufferSize:]...)
+	}
+	return klines
+}
+
+// copyTail 复制最后n根K线（避免与推送更新产生数据竞争）
+func copyTail(klines []Kline, n int) []Kline {
+	if len(klines) > n {
+		klines = klines[len(klines)-n:]
+	}
+	return append([]Kline(nil), klines...)
+}
@@ -0,0 +1,147 @@
+package market
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeframeLookback = 100 // 默认回看K线数量
+	defaultSeriesLength      = 10  // 默认输出给AI的序列长度
+	maxTimeframeLookback     = 1500
+)
+
+// supportedIntervals Binance合约支持的K线周期
+var supportedIntervals = map[string]time.Duration{
+	"1m": time.Minute, "3m": 3 * time.Minute, "5m": 5 * time.Minute, "15m": 15 * time.Minute, "30m": 30 * time.Minute,
+	"1h": time.Hour, "2h": 2 * time.Hour, "4h": 4 * time.Hour, "6h": 6 * time.Hour, "8h": 8 * time.Hour, "12h": 12 * time.Hour,
+	"1d": 24 * time.Hour, "3d": 72 * time.Hour, "1w": 7 * 24 * time.Hour,
+}
+
+// IntervalDuration 返回K线周期的时长（不支持的周期返回0）
+func IntervalDuration(interval string) time.Duration {
+	return supportedIntervals[interval]
+}
+
+// TimeframeConfig 单个K线周期的配置（来自配置文件）
+type TimeframeConfig struct {
+	Interval     string   // K线周期，如 "15m"、"1h"
+	Lookback     int      // 回看K线数量（默认100）
+	SeriesLength int      // 输出给AI的序列长度（默认10）
+	Indicators   []string // 指标列表，如 "ema:20"、"bb:20:2"、"vwap"
+}
+
+// TimeframeSpec 解析后的K线周期配置
+type TimeframeSpec struct {
+	Interval     string
+	Lookback     int
+	SeriesLength int
+	Indicators   []IndicatorSpec
+}
+
+// TimeframeData 单个K线周期的指标数据
+type TimeframeData struct {
+	Interval     string
+	SeriesLength int
+	Closes       []float64
+	Indicators   []IndicatorSeries
+}
+
+// ParseTimeframes 解析并校验K线周期配置
+func ParseTimeframes(configs []TimeframeConfig) ([]TimeframeSpec, error) {
+	specs := make([]TimeframeSpec, 0, len(configs))
+	for _, cfg := range configs {
+		if _, ok := supportedIntervals[cfg.Interval]; !ok {
+			return nil, fmt.Errorf("不支持的K线周期: %q", cfg.Interval)
+		}
+
+		spec := TimeframeSpec{
+			Interval:     cfg.Interval,
+			Lookback:     cfg.Lookback,
+			SeriesLength: cfg.SeriesLength,
+		}
+		if spec.Lookback <= 0 {
+			spec.Lookback = defaultTimeframeLookback
+		}
+		if spec.Lookback > maxTimeframeLookback {
+			return nil, fmt.Errorf("%s 回看数量不能超过%d: %d", cfg.Interval, maxTimeframeLookback, cfg.Lookback)
+		}
+		if spec.SeriesLength <= 0 {
+			spec.SeriesLength = defaultSeriesLength
+		}
+
+		for _, s := range cfg.Indicators {
+			indicator, err := ParseIndicator(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s 周期配置错误: %w", cfg.Interval, err)
+			}
+			spec.Indicators = append(spec.Indicators, indicator)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// Intervals 返回配置中用到的K线周期（去重）
+func Intervals(specs []TimeframeSpec) []string {
+	seen := make(map[string]bool)
+	var intervals []string
+	for _, spec := range specs {
+		if !seen[spec.Interval] {
+			seen[spec.Interval] = true
+			intervals = append(intervals, spec.Interval)
+		}
+	}
+	return intervals
+}
+
+// GetWithTimeframes 从币安获取市场数据，并按配置计算额外K线周期的指标
+func GetWithTimeframes(symbol string, specs []TimeframeSpec) (*Data, error) {
+	return GetWithTimeframesFrom(binanceProvider, symbol, specs)
+}
+
+// BuildTimeframe 根据K线计算配置的指标
+func BuildTimeframe(spec TimeframeSpec, klines []Kline) *TimeframeData {
+	tf := &TimeframeData{
+		Interval:     spec.Interval,
+		SeriesLength: spec.SeriesLength,
+		Closes:       make([]float64, len(klines)),
+	}
+	for i, k := range klines {
+		tf.Closes[i] = k.Close
+	}
+	for _, indicator := range spec.Indicators {
+		tf.Indicators = append(tf.Indicators, indicator.Compute(klines)...)
+	}
+	return tf
+}
+
+// formatTimeframe 格式化单个K线周期的数据（只输出最近SeriesLength个有效值）
+func formatTimeframe(sb *strings.Builder, tf *TimeframeData) {
+	sb.WriteString(fmt.Sprintf("Timeframe %s series (oldest → latest):\n\n", tf.Interval))
+	sb.WriteString(fmt.Sprintf("Close prices: %s\n\n", formatFloatSlice(lastValid(tf.Closes, tf.SeriesLength))))
+	for _, series := range tf.Indicators {
+		values := lastValid(series.Values, tf.SeriesLength)
+		if len(values) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s: %s\n\n", series.Name, formatFloatSlice(values)))
+	}
+}
+
+// lastValid 返回序列末尾最多n个非NaN值
+func lastValid(values []float64, n int) []float64 {
+	start := len(values) - n
+	if start < 0 {
+		start = 0
+	}
+	result := make([]float64, 0, n)
+	for _, v := range values[start:] {
+		if !math.IsNaN(v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
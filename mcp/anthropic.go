@@ -0,0 +1,182 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// anthropicVersion Messages API版本
+const anthropicVersion = "2023-06-01"
+
+// anthropicUsage Anthropic返回的usage字段
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicBlock 响应内容块（text / tool_use / thinking）
+type anthropicBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// callAnthropic 调用Anthropic Messages API
+// system prompt放在顶层system字段，结构化输出统一使用工具调用（没有response_format）
+func (cfg *Client) callAnthropic(systemPrompt, userPrompt string, schema *Schema, mode string) (chatMessage, Usage, error) {
+	requestBody := map[string]interface{}{
+		"model":      cfg.Model,
+		"max_tokens": cfg.MaxTokens,
+		"messages": []map[string]string{{
+			"role":    "user",
+			"content": userPrompt,
+		}},
+	}
+	if systemPrompt != "" {
+		requestBody["system"] = systemPrompt
+	}
+
+	// 开启extended thinking时：budget_tokens必须小于max_tokens，temperature只能为默认值，且不能强制调用指定工具
+	budget := reasoningBudget(cfg.ReasoningEffort)
+	if budget > 0 {
+		requestBody["thinking"] = map[string]interface{}{"type": "enabled", "budget_tokens": budget}
+		requestBody["max_tokens"] = cfg.MaxTokens + budget
+	} else {
+		requestBody["temperature"] = cfg.Temperature
+	}
+
+	if mode != OutputModeText {
+		requestBody["tools"] = []map[string]interface{}{{
+			"name":         schema.Name,
+			"description":  schema.Description,
+			"input_schema": schema.Parameters,
+		}}
+		if budget > 0 {
+			requestBody["tool_choice"] = map[string]string{"type": "auto"}
+		} else {
+			requestBody["tool_choice"] = map[string]string{"type": "tool", "name": schema.Name}
+		}
+	}
+	if cfg.Stream {
+		requestBody["stream"] = true
+	}
+
+	url := fmt.Sprintf("%s/messages", cfg.BaseURL)
+	headers := map[string]string{
+		"x-api-key":         cfg.APIKey,
+		"anthropic-version": anthropicVersion,
+	}
+
+	if !cfg.Stream {
+		body, err := cfg.send(url, requestBody, headers, nil)
+		if err != nil {
+			return chatMessage{}, Usage{}, err
+		}
+
+		var result struct {
+			Content []anthropicBlock `json:"content"`
+			Usage   anthropicUsage   `json:"usage"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return chatMessage{}, Usage{}, fmt.Errorf("解析响应失败: %w", err)
+		}
+		if len(result.Content) == 0 {
+			return chatMessage{}, Usage{}, fmt.Errorf("API返回空响应")
+		}
+
+		var message chatMessage
+		for _, block := range result.Content {
+			switch block.Type {
+			case "text":
+				message.Content += block.Text
+			case "tool_use":
+				message.appendToolCall(len(message.ToolCalls), block.Name, string(block.Input))
+			}
+		}
+		return message, anthropicUsageToUsage(result.Usage), nil
+	}
+
+	// 流式响应：按内容块累加文本和工具参数（input_json_delta）
+	var (
+		message    chatMessage
+		usage      anthropicUsage
+		toolBlocks = make(map[int]int) // 内容块index -> 工具调用序号
+		started    bool
+	)
+	_, err := cfg.send(url, requestBody, headers, func(line string) error {
+		data, ok := sseData(line)
+		if !ok {
+			return nil
+		}
+
+		var event struct {
+			Type    string `json:"type"`
+			Index   int    `json:"index"`
+			Message struct {
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			ContentBlock anthropicBlock `json:"content_block"`
+			Delta        struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+			Usage *anthropicUsage `json:"usage"`
+			Error *struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("解析流式响应失败: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			started = true
+			usage.InputTokens = event.Message.Usage.InputTokens
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				toolBlocks[event.Index] = len(message.ToolCalls)
+				message.appendToolCall(len(message.ToolCalls), event.ContentBlock.Name, "")
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				message.Content += event.Delta.Text
+			case "input_json_delta":
+				if idx, ok := toolBlocks[event.Index]; ok {
+					message.appendToolCall(idx, "", event.Delta.PartialJSON)
+				}
+			}
+		case "message_delta":
+			if event.Usage != nil {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "message_stop":
+			return errStreamDone
+		case "error":
+			if event.Error != nil {
+				return fmt.Errorf("API返回错误 (%s): %s", event.Error.Type, event.Error.Message)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return chatMessage{}, Usage{}, err
+	}
+	if !started {
+		return chatMessage{}, Usage{}, fmt.Errorf("API返回空响应")
+	}
+	return message, anthropicUsageToUsage(usage), nil
+}
+
+// anthropicUsageToUsage 转换为Usage（思考token计入output_tokens，API不单独返回）
+func anthropicUsageToUsage(u anthropicUsage) Usage {
+	return Usage{
+		PromptTokens:     u.InputTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      u.InputTokens + u.OutputTokens,
+	}
+}
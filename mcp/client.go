@@ -1,8 +1,11 @@
 package mcp
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,6 +20,19 @@ const (
 	ProviderDeepSeek Provider = "deepseek"
 	ProviderQwen     Provider = "qwen"
 	ProviderCustom   Provider = "custom"
+
+	ProviderAnthropic Provider = "anthropic" // Anthropic Messages API
+	ProviderGemini    Provider = "gemini"    // Google Gemini generateContent API
+	ProviderOllama    Provider = "ollama"    // 本地Ollama（原生 /api/chat）
+	ProviderLlamaCpp  Provider = "llamacpp"  // 本地llama.cpp server（OpenAI兼容接口，无需密钥）
+)
+
+// 结构化输出方式
+const (
+	OutputModeAuto       = "auto"        // 自动：优先函数调用，提供商不支持时回退到文本
+	OutputModeTools      = "tools"       // 强制函数调用（tools + tool_choice）
+	OutputModeJSONSchema = "json_schema" // response_format: json_schema
+	OutputModeText       = "text"        // 纯文本，由调用方从文本中提取JSON
 )
 
 // Client AI API配置
@@ -27,7 +43,80 @@ type Client struct {
 	BaseURL    string
 	Model      string
 	Timeout    time.Duration
-	UseFullURL bool // 是否使用完整URL（不添加/chat/completions）
+	UseFullURL bool   // 是否使用完整URL（不添加/chat/completions）
+	OutputMode string // 结构化输出方式（默认auto）
+	Stream     bool   // 是否使用SSE流式响应（Timeout变为两次数据之间的最长间隔）
+	Price      Price  // 模型单价（用于估算费用，未配置时费用为0）
+
+	Temperature     float64 // 采样温度（默认0.5）
+	MaxTokens       int     // 最大输出token数（默认2000，开启推理时另加推理预算）
+	ReasoningEffort string  // 推理强度: "", "low", "medium", "high"（空表示不开启）
+
+	structuredUnsupported bool // 提供商已被确认不支持结构化输出（auto模式下后续直接走文本）
+}
+
+// Response AI响应
+type Response struct {
+	Content    string // 文本内容（文本模式下为完整输出，函数调用模式下通常为思维链）
+	Structured string // 结构化JSON（函数调用参数或json_schema输出），为空表示需要从Content中提取
+	Usage      Usage  // token用量和估算费用
+}
+
+// Usage token用量和估算费用
+type Usage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"` // 含推理token
+	ReasoningTokens  int     `json:"reasoning_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// Price 模型单价（美元/百万token）
+type Price struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// Cost 按单价估算费用（推理token已包含在completion_tokens中，按输出计费）
+func (p Price) Cost(u Usage) float64 {
+	return float64(u.PromptTokens)*p.InputPerMillion/1e6 + float64(u.CompletionTokens)*p.OutputPerMillion/1e6
+}
+
+// chatMessage 响应消息（各提供商的响应统一转换为OpenAI格式，流式响应为分片累加结果）
+type chatMessage struct {
+	Content   string     `json:"content"`
+	ToolCalls []toolCall `json:"tool_calls"`
+}
+
+// toolCall 函数调用（流式响应按index分片返回arguments）
+type toolCall struct {
+	Index    int `json:"index"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// appendToolCall 累加第index个函数调用的分片（流式响应中名称只出现在第一个分片）
+func (m *chatMessage) appendToolCall(index int, name, arguments string) {
+	for len(m.ToolCalls) <= index {
+		m.ToolCalls = append(m.ToolCalls, toolCall{Index: len(m.ToolCalls)})
+	}
+	target := &m.ToolCalls[index]
+	if name != "" {
+		target.Function.Name = name
+	}
+	target.Function.Arguments += arguments
+}
+
+// apiError API返回的非200错误
+type apiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("API返回错误 (status %d): %s", e.StatusCode, e.Body)
 }
 
 func New() *Client {
@@ -37,6 +126,9 @@ func New() *Client {
 		BaseURL:  "https://api.deepseek.com/v1",
 		Model:    "deepseek-chat",
 		Timeout:  120 * time.Second, // 增加到120秒，因为AI需要分析大量数据
+
+		Temperature: 0.5, // 降低temperature以提高JSON格式稳定性
+		MaxTokens:   2000,
 	}
 	return &defaultClient
 }
@@ -76,6 +168,51 @@ func (cfg *Client) SetCustomAPI(apiURL, apiKey, modelName string) {
 	cfg.Timeout = 120 * time.Second
 }
 
+// SetAnthropicAPIKey 设置Anthropic API密钥（model为空时使用默认模型）
+func (cfg *Client) SetAnthropicAPIKey(apiKey, model string) {
+	cfg.Provider = ProviderAnthropic
+	cfg.APIKey = apiKey
+	cfg.BaseURL = "https://api.anthropic.com/v1"
+	cfg.Model = model
+	if cfg.Model == "" {
+		cfg.Model = "claude-sonnet-4-5"
+	}
+}
+
+// SetGeminiAPIKey 设置Google Gemini API密钥（model为空时使用默认模型）
+func (cfg *Client) SetGeminiAPIKey(apiKey, model string) {
+	cfg.Provider = ProviderGemini
+	cfg.APIKey = apiKey
+	cfg.BaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	cfg.Model = model
+	if cfg.Model == "" {
+		cfg.Model = "gemini-2.5-flash"
+	}
+}
+
+// SetOllama 设置本地Ollama（baseURL为空时使用 http://localhost:11434）
+func (cfg *Client) SetOllama(baseURL, model string) {
+	cfg.Provider = ProviderOllama
+	cfg.BaseURL = strings.TrimSuffix(baseURL, "/")
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost:11434"
+	}
+	cfg.Model = model
+}
+
+// SetLlamaCpp 设置本地llama.cpp server（baseURL为空时使用 http://localhost:8080/v1）
+func (cfg *Client) SetLlamaCpp(baseURL, model string) {
+	cfg.Provider = ProviderLlamaCpp
+	cfg.BaseURL = strings.TrimSuffix(baseURL, "/")
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "http://localhost:8080/v1"
+	}
+	cfg.Model = model
+	if cfg.Model == "" {
+		cfg.Model = "local" // llama.cpp server忽略模型名
+	}
+}
+
 // SetClient 设置完整的AI配置（高级用户）
 func (cfg *Client) SetClient(Client Client) {
 	if Client.Timeout == 0 {
@@ -86,8 +223,51 @@ func (cfg *Client) SetClient(Client Client) {
 
 // CallWithMessages 使用 system + user prompt 调用AI API（推荐）
 func (cfg *Client) CallWithMessages(systemPrompt, userPrompt string) (string, error) {
-	if cfg.APIKey == "" {
-		return "", fmt.Errorf("AI API密钥未设置，请先调用 SetDeepSeekAPIKey() 或 SetQwenAPIKey()")
+	resp, err := cfg.callWithRetry(systemPrompt, userPrompt, nil, OutputModeText)
+	if err != nil {
+		return "", err
+	}
+	return resp.Content, nil
+}
+
+// CallStructured 按Schema请求结构化输出
+// 提供商不支持函数调用/json_schema时自动回退到文本模式（Response.Structured为空）
+func (cfg *Client) CallStructured(systemPrompt, userPrompt string, schema *Schema) (*Response, error) {
+	mode := cfg.structuredMode()
+	resp, err := cfg.callWithRetry(systemPrompt, userPrompt, schema, mode)
+	if err == nil || mode == OutputModeText || !isUnsupportedError(err) {
+		return resp, err
+	}
+
+	// 提供商拒绝了 tools/response_format 参数，回退到文本模式
+	fmt.Printf("⚠️  AI提供商不支持%s结构化输出，回退到文本模式: %v\n", mode, err)
+	if cfg.OutputMode == "" || cfg.OutputMode == OutputModeAuto {
+		cfg.structuredUnsupported = true
+	}
+	return cfg.callWithRetry(systemPrompt, userPrompt, nil, OutputModeText)
+}
+
+// structuredMode 返回本次调用使用的结构化输出方式
+func (cfg *Client) structuredMode() string {
+	switch cfg.OutputMode {
+	case OutputModeTools, OutputModeJSONSchema, OutputModeText:
+		return cfg.OutputMode
+	}
+	if cfg.structuredUnsupported {
+		return OutputModeText
+	}
+	// 本地模型的函数调用依赖模型模板，而约束解码（json_schema）对所有模型都可用
+	if cfg.Provider == ProviderOllama || cfg.Provider == ProviderLlamaCpp {
+		return OutputModeJSONSchema
+	}
+	// DeepSeek、Qwen、Anthropic、Gemini及大多数OpenAI兼容接口都支持函数调用，json_schema支持较少
+	return OutputModeTools
+}
+
+// callWithRetry 带重试的API调用
+func (cfg *Client) callWithRetry(systemPrompt, userPrompt string, schema *Schema, mode string) (*Response, error) {
+	if cfg.APIKey == "" && cfg.Provider != ProviderOllama && cfg.Provider != ProviderLlamaCpp {
+		return nil, fmt.Errorf("AI API密钥未设置，请先调用 SetDeepSeekAPIKey() 或 SetQwenAPIKey()")
 	}
 
 	// 重试配置
@@ -99,7 +279,7 @@ func (cfg *Client) CallWithMessages(systemPrompt, userPrompt string) (string, er
 			fmt.Printf("⚠️  AI API调用失败，正在重试 (%d/%d)...\n", attempt, maxRetries)
 		}
 
-		result, err := cfg.callOnce(systemPrompt, userPrompt)
+		result, err := cfg.callOnce(systemPrompt, userPrompt, schema, mode)
 		if err == nil {
 			if attempt > 1 {
 				fmt.Printf("✓ AI API重试成功\n")
@@ -110,7 +290,7 @@ func (cfg *Client) CallWithMessages(systemPrompt, userPrompt string) (string, er
 		lastErr = err
 		// 如果不是网络错误，不重试
 		if !isRetryableError(err) {
-			return "", err
+			return nil, err
 		}
 
 		// 重试前等待
@@ -121,108 +301,176 @@ func (cfg *Client) CallWithMessages(systemPrompt, userPrompt string) (string, er
 		}
 	}
 
-	return "", fmt.Errorf("重试%d次后仍然失败: %w", maxRetries, lastErr)
+	return nil, fmt.Errorf("重试%d次后仍然失败: %w", maxRetries, lastErr)
 }
 
 // callOnce 单次调用AI API（内部使用）
-func (cfg *Client) callOnce(systemPrompt, userPrompt string) (string, error) {
-	// 构建 messages 数组
-	messages := []map[string]string{}
-
-	// 如果有 system prompt，添加 system message
-	if systemPrompt != "" {
-		messages = append(messages, map[string]string{
-			"role":    "system",
-			"content": systemPrompt,
-		})
+func (cfg *Client) callOnce(systemPrompt, userPrompt string, schema *Schema, mode string) (*Response, error) {
+	if schema == nil {
+		mode = OutputModeText
 	}
 
-	// 添加 user message
-	messages = append(messages, map[string]string{
-		"role":    "user",
-		"content": userPrompt,
-	})
+	// 各提供商的请求/响应格式不同，统一转换为 chatMessage
+	var (
+		message chatMessage
+		usage   Usage
+		err     error
+	)
+	switch cfg.Provider {
+	case ProviderAnthropic:
+		message, usage, err = cfg.callAnthropic(systemPrompt, userPrompt, schema, mode)
+	case ProviderGemini:
+		message, usage, err = cfg.callGemini(systemPrompt, userPrompt, schema, mode)
+	case ProviderOllama:
+		message, usage, err = cfg.callOllama(systemPrompt, userPrompt, schema, mode)
+	default:
+		message, usage, err = cfg.callOpenAI(systemPrompt, userPrompt, schema, mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	usage.CostUSD = cfg.Price.Cost(usage)
 
-	// 构建请求体
-	requestBody := map[string]interface{}{
-		"model":       cfg.Model,
-		"messages":    messages,
-		"temperature": 0.5, // 降低temperature以提高JSON格式稳定性
-		"max_tokens":  2000,
+	response := &Response{Content: message.Content, Usage: usage}
+	if mode == OutputModeText {
+		return response, nil
+	}
+	for _, call := range message.ToolCalls {
+		if call.Function.Name == schema.Name {
+			response.Structured = call.Function.Arguments
+			break
+		}
+	}
+	if response.Structured == "" && mode == OutputModeJSONSchema {
+		response.Structured = message.Content
 	}
+	return response, nil
+}
 
-	// 注意：response_format 参数仅 OpenAI 支持，DeepSeek/Qwen 不支持
-	// 我们通过强化 prompt 和后处理来确保 JSON 格式正确
+// errStreamDone 流式响应结束标记（如OpenAI的 data: [DONE]）
+var errStreamDone = errors.New("stream done")
 
+// send 发送POST请求
+// onLine为nil时返回完整响应体（整个请求受Timeout限制）；
+// 否则逐行回调流式响应（返回errStreamDone提前结束），Timeout为两次收到数据之间的最长间隔
+func (cfg *Client) send(url string, requestBody interface{}, headers map[string]string, onLine func(line string) error) ([]byte, error) {
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("序列化请求失败: %w", err)
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
 	}
 
-	// 创建HTTP请求
-	var url string
-	if cfg.UseFullURL {
-		// 使用完整URL，不添加/chat/completions
-		url = cfg.BaseURL
-	} else {
-		// 默认行为：添加/chat/completions
-		url = fmt.Sprintf("%s/chat/completions", cfg.BaseURL)
-	}
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %w", err)
+		return nil, fmt.Errorf("创建请求失败: %w", err)
 	}
-
 	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
 
-	// 根据不同的Provider设置认证方式
-	switch cfg.Provider {
-	case ProviderDeepSeek:
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.APIKey))
-	case ProviderQwen:
-		// 阿里云Qwen使用API-Key认证
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.APIKey))
-		// 注意：如果使用的不是兼容模式，可能需要不同的认证方式
-	default:
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.APIKey))
+	if onLine == nil {
+		client := &http.Client{Timeout: cfg.Timeout}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("发送请求失败: %w", err)
+		}
+		defer resp.Body.Close()
+
+		// 读取响应
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("读取响应失败: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		return body, nil
 	}
 
-	// 发送请求
-	client := &http.Client{Timeout: cfg.Timeout}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("发送请求失败: %w", err)
+	// 流式响应：每收到一行数据重置空闲计时器
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	idleTimeout := cfg.Timeout
+	if idleTimeout <= 0 {
+		idleTimeout = 120 * time.Second
 	}
-	defer resp.Body.Close()
+	idle := time.AfterFunc(idleTimeout, cancel)
+	defer idle.Stop()
 
-	// 读取响应
-	body, err := io.ReadAll(resp.Body)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %w", err)
+		return nil, fmt.Errorf("发送请求失败: %w", streamErr(ctx, err, idleTimeout))
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API返回错误 (status %d): %s", resp.StatusCode, string(body))
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &apiError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
-	// 解析响应
-	var result struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		idle.Reset(idleTimeout)
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := onLine(line); err != nil {
+			if errors.Is(err, errStreamDone) {
+				break
+			}
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取流式响应失败: %w", streamErr(ctx, err, idleTimeout))
 	}
+	return nil, nil
+}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+// sseData 提取SSE的data字段（空行、注释/心跳和event字段返回false）
+func sseData(line string) (string, bool) {
+	if !strings.HasPrefix(line, "data:") {
+		return "", false
 	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "data:")), true
+}
 
-	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("API返回空响应")
+// reasoningBudget 推理强度对应的思考token预算（Anthropic/Gemini）
+func reasoningBudget(effort string) int {
+	switch effort {
+	case "low":
+		return 1024
+	case "medium":
+		return 4096
+	case "high":
+		return 16384
 	}
+	return 0
+}
 
-	return result.Choices[0].Message.Content, nil
+// streamErr 空闲超时导致的取消转换为可重试的timeout错误
+func streamErr(ctx context.Context, err error, idleTimeout time.Duration) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("stream idle timeout: %v内未收到数据", idleTimeout)
+	}
+	return err
+}
+
+// isUnsupportedError 判断是否为提供商不支持结构化输出参数导致的错误
+func isUnsupportedError(err error) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusNotImplemented:
+		return true
+	}
+	return false
 }
 
 // isRetryableError 判断错误是否可重试
@@ -0,0 +1,154 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// geminiResponse generateContent响应（流式响应的每个分片格式相同）
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text         string `json:"text"`
+				Thought      bool   `json:"thought"`
+				FunctionCall *struct {
+					Name string          `json:"name"`
+					Args json.RawMessage `json:"args"`
+				} `json:"functionCall"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// callGemini 调用Google Gemini generateContent API
+// system prompt放在systemInstruction字段，函数调用使用functionDeclarations + mode ANY
+func (cfg *Client) callGemini(systemPrompt, userPrompt string, schema *Schema, mode string) (chatMessage, Usage, error) {
+	generationConfig := map[string]interface{}{
+		"temperature":     cfg.Temperature,
+		"maxOutputTokens": cfg.MaxTokens,
+	}
+	// 思考token计入maxOutputTokens，开启推理时额外增加预算
+	if budget := reasoningBudget(cfg.ReasoningEffort); budget > 0 {
+		generationConfig["thinkingConfig"] = map[string]int{"thinkingBudget": budget}
+		generationConfig["maxOutputTokens"] = cfg.MaxTokens + budget
+	}
+
+	requestBody := map[string]interface{}{
+		"contents": []map[string]interface{}{{
+			"role":  "user",
+			"parts": []map[string]string{{"text": userPrompt}},
+		}},
+		"generationConfig": generationConfig,
+	}
+	if systemPrompt != "" {
+		requestBody["systemInstruction"] = map[string]interface{}{
+			"parts": []map[string]string{{"text": systemPrompt}},
+		}
+	}
+
+	switch mode {
+	case OutputModeTools:
+		requestBody["tools"] = []map[string]interface{}{{
+			"functionDeclarations": []map[string]interface{}{{
+				"name":                 schema.Name,
+				"description":          schema.Description,
+				"parametersJsonSchema": schema.Parameters,
+			}},
+		}}
+		requestBody["toolConfig"] = map[string]interface{}{
+			"functionCallingConfig": map[string]interface{}{
+				"mode":                 "ANY",
+				"allowedFunctionNames": []string{schema.Name},
+			},
+		}
+	case OutputModeJSONSchema:
+		generationConfig["responseMimeType"] = "application/json"
+		generationConfig["responseJsonSchema"] = schema.Parameters
+	}
+
+	headers := map[string]string{"x-goog-api-key": cfg.APIKey}
+
+	if !cfg.Stream {
+		url := fmt.Sprintf("%s/models/%s:generateContent", cfg.BaseURL, cfg.Model)
+		body, err := cfg.send(url, requestBody, headers, nil)
+		if err != nil {
+			return chatMessage{}, Usage{}, err
+		}
+
+		var result geminiResponse
+		if err := json.Unmarshal(body, &result); err != nil {
+			return chatMessage{}, Usage{}, fmt.Errorf("解析响应失败: %w", err)
+		}
+		if len(result.Candidates) == 0 {
+			return chatMessage{}, Usage{}, fmt.Errorf("API返回空响应")
+		}
+
+		var message chatMessage
+		usage := result.appendTo(&message)
+		return message, usage, nil
+	}
+
+	// 流式响应：每个分片都是完整的响应结构，文本按分片累加，函数调用在单个分片中完整返回
+	url := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", cfg.BaseURL, cfg.Model)
+	var (
+		message chatMessage
+		usage   Usage
+		chunks  int
+	)
+	_, err := cfg.send(url, requestBody, headers, func(line string) error {
+		data, ok := sseData(line)
+		if !ok {
+			return nil
+		}
+
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("解析流式响应失败: %w", err)
+		}
+		chunks++
+		if chunkUsage := chunk.appendTo(&message); chunkUsage.TotalTokens > 0 {
+			usage = chunkUsage // usageMetadata为累计值，取最后一个
+		}
+		return nil
+	})
+	if err != nil {
+		return chatMessage{}, Usage{}, err
+	}
+	if chunks == 0 {
+		return chatMessage{}, Usage{}, fmt.Errorf("API返回空响应")
+	}
+	return message, usage, nil
+}
+
+// appendTo 将响应内容累加到message（跳过思考内容），返回用量
+func (r *geminiResponse) appendTo(message *chatMessage) Usage {
+	if len(r.Candidates) > 0 {
+		for _, part := range r.Candidates[0].Content.Parts {
+			if part.FunctionCall != nil {
+				message.appendToolCall(len(message.ToolCalls), part.FunctionCall.Name, string(part.FunctionCall.Args))
+				continue
+			}
+			if !part.Thought {
+				message.Content += part.Text
+			}
+		}
+	}
+
+	if r.UsageMetadata == nil {
+		return Usage{}
+	}
+	// 与OpenAI一致：输出token包含思考token
+	return Usage{
+		PromptTokens:     r.UsageMetadata.PromptTokenCount,
+		CompletionTokens: r.UsageMetadata.CandidatesTokenCount + r.UsageMetadata.ThoughtsTokenCount,
+		ReasoningTokens:  r.UsageMetadata.ThoughtsTokenCount,
+		TotalTokens:      r.UsageMetadata.TotalTokenCount,
+	}
+}
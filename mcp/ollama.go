@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ollamaResponse /api/chat响应（流式响应为每行一个JSON，最后一行done为true并带token统计）
+type ollamaResponse struct {
+	Message struct {
+		Content   string `json:"content"`
+		ToolCalls []struct {
+			Function struct {
+				Name      string          `json:"name"`
+				Arguments json.RawMessage `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+// callOllama 调用本地Ollama原生 /api/chat 接口
+// json_schema模式使用format字段约束输出；Ollama不支持tool_choice，函数调用依赖模型自行选择
+func (cfg *Client) callOllama(systemPrompt, userPrompt string, schema *Schema, mode string) (chatMessage, Usage, error) {
+	messages := []map[string]string{}
+	if systemPrompt != "" {
+		messages = append(messages, map[string]string{"role": "system", "content": systemPrompt})
+	}
+	messages = append(messages, map[string]string{"role": "user", "content": userPrompt})
+
+	requestBody := map[string]interface{}{
+		"model":    cfg.Model,
+		"messages": messages,
+		"stream":   cfg.Stream, // Ollama默认流式，需显式关闭
+		"options": map[string]interface{}{
+			"temperature": cfg.Temperature,
+			"num_predict": cfg.MaxTokens,
+		},
+	}
+	if cfg.ReasoningEffort != "" {
+		requestBody["think"] = true // 思考内容单独返回，不计入content
+	}
+
+	switch mode {
+	case OutputModeTools:
+		requestBody["tools"] = []map[string]interface{}{{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        schema.Name,
+				"description": schema.Description,
+				"parameters":  schema.Parameters,
+			},
+		}}
+	case OutputModeJSONSchema:
+		requestBody["format"] = schema.Parameters
+	}
+
+	url := fmt.Sprintf("%s/api/chat", cfg.BaseURL)
+	headers := map[string]string{}
+	if cfg.APIKey != "" {
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", cfg.APIKey) // 经反向代理访问时可能需要
+	}
+
+	var (
+		message chatMessage
+		usage   Usage
+		chunks  int
+	)
+	handle := func(data []byte) error {
+		var resp ollamaResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return fmt.Errorf("解析响应失败: %w", err)
+		}
+		if resp.Error != "" {
+			return fmt.Errorf("Ollama返回错误: %s", resp.Error)
+		}
+		chunks++
+
+		message.Content += resp.Message.Content
+		for _, call := range resp.Message.ToolCalls {
+			message.appendToolCall(len(message.ToolCalls), call.Function.Name, string(call.Function.Arguments))
+		}
+		if resp.Done {
+			usage = Usage{
+				PromptTokens:     resp.PromptEvalCount,
+				CompletionTokens: resp.EvalCount,
+				TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+			}
+			return errStreamDone
+		}
+		return nil
+	}
+
+	if cfg.Stream {
+		_, err := cfg.send(url, requestBody, headers, func(line string) error {
+			return handle([]byte(line))
+		})
+		if err != nil {
+			return chatMessage{}, Usage{}, err
+		}
+	} else {
+		body, err := cfg.send(url, requestBody, headers, nil)
+		if err != nil {
+			return chatMessage{}, Usage{}, err
+		}
+		if err := handle(body); err != nil && err != errStreamDone {
+			return chatMessage{}, Usage{}, err
+		}
+	}
+
+	if chunks == 0 {
+		return chatMessage{}, Usage{}, fmt.Errorf("API返回空响应")
+	}
+	return message, usage, nil
+}
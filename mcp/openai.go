@@ -0,0 +1,174 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// usageBlock API返回的usage字段
+type usageBlock struct {
+	PromptTokens            int `json:"prompt_tokens"`
+	CompletionTokens        int `json:"completion_tokens"`
+	TotalTokens             int `json:"total_tokens"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+}
+
+// toUsage 转换为Usage
+func (b *usageBlock) toUsage() Usage {
+	if b == nil {
+		return Usage{}
+	}
+	return Usage{
+		PromptTokens:     b.PromptTokens,
+		CompletionTokens: b.CompletionTokens,
+		ReasoningTokens:  b.CompletionTokensDetails.ReasoningTokens,
+		TotalTokens:      b.TotalTokens,
+	}
+}
+
+// callOpenAI 调用OpenAI兼容的 /chat/completions 接口（DeepSeek、Qwen、自定义API、llama.cpp）
+func (cfg *Client) callOpenAI(systemPrompt, userPrompt string, schema *Schema, mode string) (chatMessage, Usage, error) {
+	// 构建 messages 数组
+	messages := []map[string]string{}
+
+	// 如果有 system prompt，添加 system message
+	if systemPrompt != "" {
+		messages = append(messages, map[string]string{
+			"role":    "system",
+			"content": systemPrompt,
+		})
+	}
+
+	// 添加 user message
+	messages = append(messages, map[string]string{
+		"role":    "user",
+		"content": userPrompt,
+	})
+
+	// 构建请求体
+	requestBody := map[string]interface{}{
+		"model":       cfg.Model,
+		"messages":    messages,
+		"temperature": cfg.Temperature,
+		"max_tokens":  cfg.MaxTokens,
+	}
+	if cfg.ReasoningEffort != "" {
+		requestBody["reasoning_effort"] = cfg.ReasoningEffort
+	}
+	if cfg.Stream {
+		requestBody["stream"] = true
+		requestBody["stream_options"] = map[string]bool{"include_usage": true} // 最后一个分片返回usage
+	}
+
+	// 结构化输出：函数调用（强制调用指定函数）或 response_format: json_schema
+	// 文本模式下通过强化 prompt 和后处理来确保 JSON 格式正确
+	switch mode {
+	case OutputModeTools:
+		requestBody["tools"] = []map[string]interface{}{{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        schema.Name,
+				"description": schema.Description,
+				"parameters":  schema.Parameters,
+			},
+		}}
+		requestBody["tool_choice"] = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": schema.Name},
+		}
+	case OutputModeJSONSchema:
+		requestBody["response_format"] = map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":        schema.Name,
+				"description": schema.Description,
+				"schema":      schema.Parameters,
+			},
+		}
+	}
+
+	var url string
+	if cfg.UseFullURL {
+		// 使用完整URL，不添加/chat/completions
+		url = cfg.BaseURL
+	} else {
+		// 默认行为：添加/chat/completions
+		url = fmt.Sprintf("%s/chat/completions", cfg.BaseURL)
+	}
+
+	// DeepSeek、Qwen（兼容模式）和自定义API都使用Bearer认证，本地llama.cpp可不设置密钥
+	headers := map[string]string{}
+	if cfg.APIKey != "" {
+		headers["Authorization"] = fmt.Sprintf("Bearer %s", cfg.APIKey)
+	}
+
+	if !cfg.Stream {
+		body, err := cfg.send(url, requestBody, headers, nil)
+		if err != nil {
+			return chatMessage{}, Usage{}, err
+		}
+
+		var result struct {
+			Choices []struct {
+				Message chatMessage `json:"message"`
+			} `json:"choices"`
+			Usage *usageBlock `json:"usage"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return chatMessage{}, Usage{}, fmt.Errorf("解析响应失败: %w", err)
+		}
+		if len(result.Choices) == 0 {
+			return chatMessage{}, Usage{}, fmt.Errorf("API返回空响应")
+		}
+		return result.Choices[0].Message, result.Usage.toUsage(), nil
+	}
+
+	// 流式响应：按分片累加内容和函数调用参数
+	var (
+		message chatMessage
+		usage   Usage
+		chunks  int
+	)
+	_, err := cfg.send(url, requestBody, headers, func(line string) error {
+		data, ok := sseData(line)
+		if !ok {
+			return nil
+		}
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta chatMessage `json:"delta"`
+			} `json:"choices"`
+			Usage *usageBlock `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("解析流式响应失败: %w", err)
+		}
+		chunks++
+
+		if chunk.Usage != nil {
+			usage = chunk.Usage.toUsage()
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		delta := chunk.Choices[0].Delta
+		message.Content += delta.Content
+		for _, call := range delta.ToolCalls {
+			message.appendToolCall(call.Index, call.Function.Name, call.Function.Arguments)
+		}
+		return nil
+	})
+	if err != nil {
+		return chatMessage{}, Usage{}, err
+	}
+	if chunks == 0 {
+		return chatMessage{}, Usage{}, fmt.Errorf("API返回空响应")
+	}
+	return message, usage, nil
+}
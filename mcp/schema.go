@@ -0,0 +1,96 @@
+package mcp
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Schema 结构化输出定义（用于函数调用参数或 response_format: json_schema）
+type Schema struct {
+	Name        string                 // 函数/Schema名称（仅字母数字下划线）
+	Description string                 // 说明（帮助模型理解输出用途）
+	Parameters  map[string]interface{} // JSON Schema
+}
+
+// SchemaFromStruct 根据结构体的json标签生成JSON Schema
+// - 字段名取json标签，忽略 "-" 和未导出字段
+// - 带 omitempty 的字段为可选，其余为必填
+// - enum标签（逗号分隔）限定字符串取值，desc标签作为字段说明
+func SchemaFromStruct(v interface{}) map[string]interface{} {
+	return schemaForType(reflect.TypeOf(v))
+}
+
+// schemaForType 递归生成类型对应的JSON Schema
+func schemaForType(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaForType(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name, optional := jsonFieldName(field)
+			if name == "-" {
+				continue
+			}
+
+			prop := schemaForType(field.Type)
+			if enum := field.Tag.Get("enum"); enum != "" {
+				prop["enum"] = strings.Split(enum, ",")
+			}
+			if desc := field.Tag.Get("desc"); desc != "" {
+				prop["description"] = desc
+			}
+			properties[name] = prop
+			if !optional {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// jsonFieldName 解析json标签，返回字段名和是否可选
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name, false
+	}
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	optional := false
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			optional = true
+		}
+	}
+	return name, optional
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"nofx/instrument"
 	"os"
 	"path/filepath"
 	"strings"
@@ -261,7 +262,7 @@ func GetAvailableCoins() ([]string, error) {
 	for _, coin := range coins {
 		if coin.IsAvailable {
 			// 确保symbol格式正确（转为大写USDT交易对）
-			symbol := normalizeSymbol(coin.Pair)
+			symbol := instrument.Canonical(coin.Pair)
 			symbols = append(symbols, symbol)
 		}
 	}
@@ -309,59 +310,13 @@ func GetTopRatedCoins(limit int) ([]string, error) {
 
 	var symbols []string
 	for i := 0; i < maxCount; i++ {
-		symbol := normalizeSymbol(availableCoins[i].Pair)
+		symbol := instrument.Canonical(availableCoins[i].Pair)
 		symbols = append(symbols, symbol)
 	}
 
 	return symbols, nil
 }
 
-// normalizeSymbol 标准化币种符号
-func normalizeSymbol(symbol string) string {
-	// 移除空格
-	symbol = trimSpaces(symbol)
-
-	// 转为大写
-	symbol = toUpper(symbol)
-
-	// 确保以USDT结尾
-	if !endsWith(symbol, "USDT") {
-		symbol = symbol + "USDT"
-	}
-
-	return symbol
-}
-
-// 辅助函数
-func trimSpaces(s string) string {
-	result := ""
-	for i := 0; i < len(s); i++ {
-		if s[i] != ' ' {
-			result += string(s[i])
-		}
-	}
-	return result
-}
-
-func toUpper(s string) string {
-	result := ""
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if c >= 'a' && c <= 'z' {
-			c = c - 'a' + 'A'
-		}
-		result += string(c)
-	}
-	return result
-}
-
-func endsWith(s, suffix string) bool {
-	if len(s) < len(suffix) {
-		return false
-	}
-	return s[len(s)-len(suffix):] == suffix
-}
-
 // convertSymbolsToCoins 将币种符号列表转换为CoinInfo列表
 func convertSymbolsToCoins(symbols []string) []CoinInfo {
 	coins := make([]CoinInfo, 0, len(symbols))
@@ -572,7 +527,7 @@ func GetOITopSymbols() ([]string, error) {
 
 	var symbols []string
 	for _, pos := range positions {
-		symbol := normalizeSymbol(pos.Symbol)
+		symbol := instrument.Canonical(pos.Symbol)
 		symbols = append(symbols, symbol)
 	}
 
@@ -0,0 +1,144 @@
+package risk
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 风控评估结果状态
+const (
+	StatusApproved = "approved" // 通过
+	StatusResized  = "resized"  // 缩减仓位后通过
+	StatusRejected = "rejected" // 拒绝
+)
+
+// Order 待评估的开仓请求
+type Order struct {
+	Symbol      string
+	Side        string  // "long" or "short"
+	NotionalUSD float64 // 仓位名义价值
+	Leverage    int
+	Price       float64 // 预计成交价
+	Limit       bool    // 限价挂单（不吃盘口流动性）
+}
+
+// Position 当前持仓
+type Position struct {
+	Symbol     string
+	Side       string // "long" or "short"
+	Quantity   float64
+	EntryPrice float64
+	MarkPrice  float64
+	Leverage   int
+	Pending    bool // 未成交的限价开仓单（按挂单价和委托数量计入，成交后会变成持仓）
+}
+
+// Notional 持仓名义价值
+func (p Position) Notional() float64 {
+	return p.Quantity * p.MarkPrice
+}
+
+// slots 持仓和待成交挂单占用的持仓数（同币种同方向的持仓和挂单只占一个）
+func (s *Snapshot) slots() int {
+	seen := make(map[string]bool)
+	for _, pos := range s.Positions {
+		seen[pos.Symbol+"_"+pos.Side] = true
+	}
+	return len(seen)
+}
+
+// Snapshot 评估时的账户快照
+type Snapshot struct {
+	Now       time.Time
+	Equity    float64              // 账户净值
+	Positions []Position           // 当前持仓（含待成交的限价开仓单）
+	LastClose map[string]time.Time // 币种最近平仓时间（symbol -> time）
+
+	// PriceSeries 返回币种近期价格序列（相关性规则使用，不可得时返回nil）
+	PriceSeries func(symbol string) []float64
+
+	// OrderBook 返回币种盘口（滑点规则使用，不可得时返回nil）
+	OrderBook func(symbol string) OrderBook
+}
+
+// OrderBook 盘口流动性估算（滑点以基点计，成交均价相对中间价）
+type OrderBook interface {
+	// EstimateSlippage 估算市价开仓notionalUSD的滑点（盘口深度不足时返回+Inf）
+	EstimateSlippage(side string, notionalUSD float64) float64
+	// MaxNotionalWithinSlippage 滑点不超过maxBps时可成交的最大名义价值
+	MaxNotionalWithinSlippage(side string, maxBps float64) float64
+}
+
+// Rule 风控规则
+type Rule interface {
+	// Name 规则名称（记录在拒绝原因中）
+	Name() string
+	// Check 返回该规则允许的最大名义价值及原因
+	// 返回值 ≥ order.NotionalUSD 表示通过，0 表示拒绝，介于两者之间表示缩减仓位
+	Check(order Order, snap *Snapshot) (allowedNotional float64, reason string)
+}
+
+// Result 风控评估结果
+type Result struct {
+	Status      string  // approved / resized / rejected
+	NotionalUSD float64 // 最终允许的名义价值
+	Reason      string  // 缩减或拒绝的原因（多条规则以"; "分隔）
+}
+
+// Engine 开仓前风控引擎（按顺序执行所有规则，取最严格的结果）
+type Engine struct {
+	rules       []Rule
+	minNotional float64 // 缩减后低于该名义价值直接拒绝
+}
+
+// NewEngine 创建风控引擎
+func NewEngine(minNotional float64, rules ...Rule) *Engine {
+	return &Engine{
+		rules:       rules,
+		minNotional: minNotional,
+	}
+}
+
+// Rules 返回已启用的规则
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+// Evaluate 评估开仓请求
+func (e *Engine) Evaluate(order Order, snap *Snapshot) Result {
+	allowed := order.NotionalUSD
+	var reasons []string
+
+	for _, rule := range e.rules {
+		ruleAllowed, reason := rule.Check(Order{
+			Symbol:      order.Symbol,
+			Side:        order.Side,
+			NotionalUSD: allowed,
+			Leverage:    order.Leverage,
+			Price:       order.Price,
+			Limit:       order.Limit,
+		}, snap)
+
+		if ruleAllowed >= allowed {
+			continue
+		}
+
+		reasons = append(reasons, fmt.Sprintf("[%s] %s", rule.Name(), reason))
+		if ruleAllowed <= 0 {
+			return Result{Status: StatusRejected, Reason: strings.Join(reasons, "; ")}
+		}
+		allowed = ruleAllowed
+	}
+
+	if allowed >= order.NotionalUSD {
+		return Result{Status: StatusApproved, NotionalUSD: order.NotionalUSD}
+	}
+
+	if allowed < e.minNotional {
+		reasons = append(reasons, fmt.Sprintf("缩减后仓位%.2f USDT低于最小下单价值%.2f USDT", allowed, e.minNotional))
+		return Result{Status: StatusRejected, Reason: strings.Join(reasons, "; ")}
+	}
+
+	return Result{Status: StatusResized, NotionalUSD: allowed, Reason: strings.Join(reasons, "; ")}
+}
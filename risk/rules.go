@@ -0,0 +1,325 @@
+package risk
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Config 风控规则配置（数值≤0表示不启用对应规则）
+type Config struct {
+	MaxPositions           int           // 最大同时持仓数
+	MaxGrossExposure       float64       // 多空名义价值总和上限（账户净值倍数）
+	MaxNetExposure         float64       // 多空净名义价值上限（账户净值倍数）
+	MaxAltcoinNotional     float64       // 山寨币单币名义价值上限（账户净值倍数）
+	MaxBTCETHNotional      float64       // BTC/ETH单币名义价值上限（账户净值倍数）
+	MaxCorrelated          int           // 同方向高相关山寨币最多持仓数
+	CorrelationThreshold   float64       // 高相关阈值（收益率相关系数）
+	Cooldown               time.Duration // 平仓后同币种冷却时间
+	MinLiquidationDistance float64       // 入场价距强平价最小距离（百分比）
+	MaxSlippageBps         float64       // 市价开仓预计滑点上限（基点）
+	MinNotional            float64       // 缩减后最小下单价值（USDT）
+}
+
+// NewEngineFromConfig 根据配置组装风控引擎
+func NewEngineFromConfig(cfg Config) *Engine {
+	var rules []Rule
+	if cfg.MaxPositions > 0 {
+		rules = append(rules, MaxPositionsRule{Max: cfg.MaxPositions})
+	}
+	if cfg.Cooldown > 0 {
+		rules = append(rules, CooldownRule{Duration: cfg.Cooldown})
+	}
+	if cfg.MinLiquidationDistance > 0 {
+		rules = append(rules, LiquidationDistanceRule{MinDistancePct: cfg.MinLiquidationDistance})
+	}
+	if cfg.MaxCorrelated > 0 && cfg.CorrelationThreshold > 0 {
+		rules = append(rules, CorrelationRule{MaxCorrelated: cfg.MaxCorrelated, Threshold: cfg.CorrelationThreshold})
+	}
+	if cfg.MaxAltcoinNotional > 0 || cfg.MaxBTCETHNotional > 0 {
+		rules = append(rules, SymbolNotionalRule{AltcoinMultiple: cfg.MaxAltcoinNotional, BTCETHMultiple: cfg.MaxBTCETHNotional})
+	}
+	if cfg.MaxGrossExposure > 0 {
+		rules = append(rules, GrossExposureRule{MaxMultiple: cfg.MaxGrossExposure})
+	}
+	if cfg.MaxNetExposure > 0 {
+		rules = append(rules, NetExposureRule{MaxMultiple: cfg.MaxNetExposure})
+	}
+	if cfg.MaxSlippageBps > 0 {
+		rules = append(rules, SlippageRule{MaxBps: cfg.MaxSlippageBps})
+	}
+	return NewEngine(cfg.MinNotional, rules...)
+}
+
+// isBTCETH 判断是否为BTC/ETH（与山寨币使用不同的上限）
+func isBTCETH(symbol string) bool {
+	return symbol == "BTCUSDT" || symbol == "ETHUSDT"
+}
+
+// MaxPositionsRule 最大同时持仓数
+type MaxPositionsRule struct {
+	Max int
+}
+
+// Name 规则名称
+func (r MaxPositionsRule) Name() string { return "max_positions" }
+
+// Check 已有持仓数达到上限时拒绝新币种开仓
+func (r MaxPositionsRule) Check(order Order, snap *Snapshot) (float64, string) {
+	for _, pos := range snap.Positions {
+		if pos.Symbol == order.Symbol && pos.Side == order.Side {
+			return order.NotionalUSD, "" // 同币种同方向不增加持仓数
+		}
+	}
+	if slots := snap.slots(); slots >= r.Max {
+		return 0, fmt.Sprintf("已有%d个持仓（含待成交挂单），达到上限%d", slots, r.Max)
+	}
+	return order.NotionalUSD, ""
+}
+
+// GrossExposureRule 多空名义价值总和上限
+type GrossExposureRule struct {
+	MaxMultiple float64
+}
+
+// Name 规则名称
+func (r GrossExposureRule) Name() string { return "max_gross_exposure" }
+
+// Check 新仓位加入后总敞口不超过上限，超出部分缩减
+func (r GrossExposureRule) Check(order Order, snap *Snapshot) (float64, string) {
+	gross := 0.0
+	for _, pos := range snap.Positions {
+		gross += pos.Notional()
+	}
+	limit := r.MaxMultiple * snap.Equity
+	remaining := math.Max(limit-gross, 0)
+	if order.NotionalUSD <= remaining {
+		return order.NotionalUSD, ""
+	}
+	return remaining, fmt.Sprintf("总敞口%.0f + %.0f USDT超过上限%.0f USDT（%.1f倍净值）",
+		gross, order.NotionalUSD, limit, r.MaxMultiple)
+}
+
+// NetExposureRule 多空净名义价值上限
+type NetExposureRule struct {
+	MaxMultiple float64
+}
+
+// Name 规则名称
+func (r NetExposureRule) Name() string { return "max_net_exposure" }
+
+// Check 新仓位加入后净敞口（多头-空头）绝对值不超过上限，超出部分缩减
+func (r NetExposureRule) Check(order Order, snap *Snapshot) (float64, string) {
+	net := 0.0
+	for _, pos := range snap.Positions {
+		if pos.Side == "long" {
+			net += pos.Notional()
+		} else {
+			net -= pos.Notional()
+		}
+	}
+
+	// 同方向的净敞口（做空时取反）
+	sameSide := net
+	if order.Side == "short" {
+		sameSide = -net
+	}
+
+	limit := r.MaxMultiple * snap.Equity
+	remaining := math.Max(limit-sameSide, 0)
+	if order.NotionalUSD <= remaining {
+		return order.NotionalUSD, ""
+	}
+	return remaining, fmt.Sprintf("%s方向净敞口%.0f + %.0f USDT超过上限%.0f USDT（%.1f倍净值）",
+		order.Side, sameSide, order.NotionalUSD, limit, r.MaxMultiple)
+}
+
+// SymbolNotionalRule 单币种名义价值上限（BTC/ETH与山寨币分别设置）
+type SymbolNotionalRule struct {
+	AltcoinMultiple float64
+	BTCETHMultiple  float64
+}
+
+// Name 规则名称
+func (r SymbolNotionalRule) Name() string { return "max_symbol_notional" }
+
+// Check 同币种已有仓位加新仓位不超过上限，超出部分缩减
+func (r SymbolNotionalRule) Check(order Order, snap *Snapshot) (float64, string) {
+	multiple := r.AltcoinMultiple
+	if isBTCETH(order.Symbol) {
+		multiple = r.BTCETHMultiple
+	}
+	if multiple <= 0 {
+		return order.NotionalUSD, ""
+	}
+
+	existing := 0.0
+	for _, pos := range snap.Positions {
+		if pos.Symbol == order.Symbol {
+			existing += pos.Notional()
+		}
+	}
+
+	limit := multiple * snap.Equity
+	remaining := math.Max(limit-existing, 0)
+	if order.NotionalUSD <= remaining {
+		return order.NotionalUSD, ""
+	}
+	return remaining, fmt.Sprintf("%s仓位%.0f + %.0f USDT超过单币上限%.0f USDT（%.1f倍净值）",
+		order.Symbol, existing, order.NotionalUSD, limit, multiple)
+}
+
+// CorrelationRule 同方向高相关山寨币数量上限
+type CorrelationRule struct {
+	MaxCorrelated int
+	Threshold     float64
+}
+
+// Name 规则名称
+func (r CorrelationRule) Name() string { return "max_correlated" }
+
+// Check 同方向已有的高相关山寨币持仓达到上限时拒绝
+func (r CorrelationRule) Check(order Order, snap *Snapshot) (float64, string) {
+	if isBTCETH(order.Symbol) || snap.PriceSeries == nil {
+		return order.NotionalUSD, ""
+	}
+	orderSeries := snap.PriceSeries(order.Symbol)
+	if len(orderSeries) < 3 {
+		return order.NotionalUSD, ""
+	}
+
+	var correlated []string
+	counted := make(map[string]bool) // 同币种的持仓和待成交挂单只计一次
+	for _, pos := range snap.Positions {
+		if pos.Side != order.Side || pos.Symbol == order.Symbol || isBTCETH(pos.Symbol) || counted[pos.Symbol] {
+			continue
+		}
+		counted[pos.Symbol] = true
+		corr, ok := returnCorrelation(orderSeries, snap.PriceSeries(pos.Symbol))
+		if ok && corr >= r.Threshold {
+			correlated = append(correlated, fmt.Sprintf("%s(%.2f)", pos.Symbol, corr))
+		}
+	}
+
+	if len(correlated) >= r.MaxCorrelated {
+		return 0, fmt.Sprintf("已有%d个同方向高相关山寨币持仓 %v，上限%d", len(correlated), correlated, r.MaxCorrelated)
+	}
+	return order.NotionalUSD, ""
+}
+
+// returnCorrelation 计算两个价格序列收益率的皮尔逊相关系数（按末端对齐）
+func returnCorrelation(a, b []float64) (float64, bool) {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if n < 3 {
+		return 0, false
+	}
+	a, b = a[len(a)-n:], b[len(b)-n:]
+
+	ra := make([]float64, 0, n-1)
+	rb := make([]float64, 0, n-1)
+	for i := 1; i < n; i++ {
+		if a[i-1] <= 0 || b[i-1] <= 0 {
+			return 0, false
+		}
+		ra = append(ra, a[i]/a[i-1]-1)
+		rb = append(rb, b[i]/b[i-1]-1)
+	}
+
+	meanA, meanB := 0.0, 0.0
+	for i := range ra {
+		meanA += ra[i]
+		meanB += rb[i]
+	}
+	meanA /= float64(len(ra))
+	meanB /= float64(len(rb))
+
+	cov, varA, varB := 0.0, 0.0, 0.0
+	for i := range ra {
+		da, db := ra[i]-meanA, rb[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varA*varB), true
+}
+
+// CooldownRule 平仓后同币种冷却时间
+type CooldownRule struct {
+	Duration time.Duration
+}
+
+// Name 规则名称
+func (r CooldownRule) Name() string { return "cooldown" }
+
+// Check 冷却期内拒绝再次开仓
+func (r CooldownRule) Check(order Order, snap *Snapshot) (float64, string) {
+	closedAt, ok := snap.LastClose[order.Symbol]
+	if !ok {
+		return order.NotionalUSD, ""
+	}
+	if elapsed := snap.Now.Sub(closedAt); elapsed < r.Duration {
+		return 0, fmt.Sprintf("%s 在%.0f分钟前刚平仓，冷却期%.0f分钟", order.Symbol, elapsed.Minutes(), r.Duration.Minutes())
+	}
+	return order.NotionalUSD, ""
+}
+
+// LiquidationDistanceRule 入场价距强平价的最小距离
+type LiquidationDistanceRule struct {
+	MinDistancePct float64
+}
+
+// Name 规则名称
+func (r LiquidationDistanceRule) Name() string { return "min_liquidation_distance" }
+
+// maintenanceMarginRate 估算强平价使用的维持保证金率
+const maintenanceMarginRate = 0.005
+
+// Check 按杠杆估算逐仓强平距离（1/杠杆 - 维持保证金率），过近时拒绝
+func (r LiquidationDistanceRule) Check(order Order, snap *Snapshot) (float64, string) {
+	if order.Leverage <= 0 {
+		return order.NotionalUSD, ""
+	}
+	distancePct := (1/float64(order.Leverage) - maintenanceMarginRate) * 100
+	if distancePct < r.MinDistancePct {
+		return 0, fmt.Sprintf("%dx杠杆强平距离约%.2f%%，低于要求的%.2f%%", order.Leverage, distancePct, r.MinDistancePct)
+	}
+	return order.NotionalUSD, ""
+}
+
+// SlippageRule 市价开仓预计滑点上限
+type SlippageRule struct {
+	MaxBps float64
+}
+
+// Name 规则名称
+func (r SlippageRule) Name() string { return "max_slippage" }
+
+// Check 按盘口估算滑点，超过上限时缩减到盘口可承接的金额（限价挂单或无盘口数据时通过）
+func (r SlippageRule) Check(order Order, snap *Snapshot) (float64, string) {
+	if order.Limit || snap.OrderBook == nil {
+		return order.NotionalUSD, ""
+	}
+	book := snap.OrderBook(order.Symbol)
+	if book == nil {
+		return order.NotionalUSD, ""
+	}
+
+	slippage := book.EstimateSlippage(order.Side, order.NotionalUSD)
+	if slippage <= r.MaxBps {
+		return order.NotionalUSD, ""
+	}
+
+	allowed := book.MaxNotionalWithinSlippage(order.Side, r.MaxBps)
+	if math.IsInf(slippage, 1) {
+		return allowed, fmt.Sprintf("%s盘口深度不足以成交%.0f USDT，滑点%.1fbps以内可成交%.0f USDT",
+			order.Symbol, order.NotionalUSD, r.MaxBps, allowed)
+	}
+	return allowed, fmt.Sprintf("%s预计滑点%.1fbps超过上限%.1fbps，缩减到%.0f USDT",
+		order.Symbol, slippage, r.MaxBps, allowed)
+}
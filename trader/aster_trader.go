@@ -13,10 +13,10 @@ import (
 	"math/big"
 	"net/http"
 	"net/url"
+	"nofx/instrument"
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
@@ -33,9 +33,11 @@ type AsterTrader struct {
 	client     *http.Client
 	baseURL    string
 
-	// 缓存交易对精度信息
-	symbolPrecision map[string]SymbolPrecision
-	mu              sync.RWMutex
+	// 合约元数据（精度、最小下单金额）
+	instruments *instrument.Registry
+
+	// 各币种开仓使用的保证金模式
+	marginModes marginModeSettings
 }
 
 // SymbolPrecision 交易对精度信息
@@ -57,12 +59,11 @@ func NewAsterTrader(user, signer, privateKeyHex string) (*AsterTrader, error) {
 		return nil, fmt.Errorf("解析私钥失败: %w", err)
 	}
 
-	return &AsterTrader{
-		ctx:             context.Background(),
-		user:            user,
-		signer:          signer,
-		privateKey:      privKey,
-		symbolPrecision: make(map[string]SymbolPrecision),
+	t := &AsterTrader{
+		ctx:        context.Background(),
+		user:       user,
+		signer:     signer,
+		privateKey: privKey,
 		client: &http.Client{
 			Timeout: 30 * time.Second, // 增加到30秒
 			Transport: &http.Transport{
@@ -72,7 +73,9 @@ func NewAsterTrader(user, signer, privateKeyHex string) (*AsterTrader, error) {
 			},
 		},
 		baseURL: "https://fapi.asterdex.com",
-	}, nil
+	}
+	t.instruments = instrument.NewRegistry("aster", t.loadInstruments)
+	return t, nil
 }
 
 // genNonce 生成微秒时间戳
@@ -80,68 +83,65 @@ func (t *AsterTrader) genNonce() uint64 {
 	return uint64(time.Now().UnixMicro())
 }
 
-// getPrecision 获取交易对精度信息
-func (t *AsterTrader) getPrecision(symbol string) (SymbolPrecision, error) {
-	t.mu.RLock()
-	if prec, ok := t.symbolPrecision[symbol]; ok {
-		t.mu.RUnlock()
-		return prec, nil
-	}
-	t.mu.RUnlock()
-
-	// 获取交易所信息
+// loadInstruments 从exchangeInfo加载全部合约元数据
+func (t *AsterTrader) loadInstruments() ([]instrument.Instrument, error) {
 	resp, err := t.client.Get(t.baseURL + "/fapi/v3/exchangeInfo")
 	if err != nil {
-		return SymbolPrecision{}, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
 	var info struct {
 		Symbols []struct {
-			Symbol            string `json:"symbol"`
-			PricePrecision    int    `json:"pricePrecision"`
-			QuantityPrecision int    `json:"quantityPrecision"`
-			Filters           []map[string]interface{} `json:"filters"`
+			Symbol  string                   `json:"symbol"`
+			Status  string                   `json:"status"`
+			Filters []map[string]interface{} `json:"filters"`
 		} `json:"symbols"`
 	}
-
 	if err := json.Unmarshal(body, &info); err != nil {
-		return SymbolPrecision{}, err
+		return nil, err
 	}
 
-	// 缓存所有交易对的精度
-	t.mu.Lock()
+	list := make([]instrument.Instrument, 0, len(info.Symbols))
 	for _, s := range info.Symbols {
-		prec := SymbolPrecision{
-			PricePrecision:    s.PricePrecision,
-			QuantityPrecision: s.QuantityPrecision,
+		inst := instrument.Instrument{Symbol: s.Symbol, VenueSymbol: s.Symbol, Status: instrument.StatusSuspended}
+		if s.Status == "TRADING" {
+			inst.Status = instrument.StatusTrading
 		}
-
-		// 解析filters获取tickSize和stepSize
 		for _, filter := range s.Filters {
-			filterType, _ := filter["filterType"].(string)
-			switch filterType {
+			switch filter["filterType"] {
 			case "PRICE_FILTER":
-				if tickSizeStr, ok := filter["tickSize"].(string); ok {
-					prec.TickSize, _ = strconv.ParseFloat(tickSizeStr, 64)
-				}
+				inst.TickSize = parseFilterFloat(filter, "tickSize")
 			case "LOT_SIZE":
-				if stepSizeStr, ok := filter["stepSize"].(string); ok {
-					prec.StepSize, _ = strconv.ParseFloat(stepSizeStr, 64)
-				}
+				inst.StepSize = parseFilterFloat(filter, "stepSize")
+				inst.MinQty = parseFilterFloat(filter, "minQty")
+			case "MIN_NOTIONAL":
+				inst.MinNotional = parseFilterFloat(filter, "notional")
 			}
 		}
-
-		t.symbolPrecision[s.Symbol] = prec
+		list = append(list, inst)
 	}
-	t.mu.Unlock()
+	return list, nil
+}
 
-	if prec, ok := t.symbolPrecision[symbol]; ok {
-		return prec, nil
-	}
+// GetInstrument 获取交易对元数据
+func (t *AsterTrader) GetInstrument(symbol string) (*instrument.Instrument, error) {
+	return t.instruments.Get(symbol)
+}
 
-	return SymbolPrecision{}, fmt.Errorf("未找到交易对 %s 的精度信息", symbol)
+// getPrecision 获取交易对精度信息
+func (t *AsterTrader) getPrecision(symbol string) (SymbolPrecision, error) {
+	inst, err := t.instruments.Get(symbol)
+	if err != nil {
+		return SymbolPrecision{}, err
+	}
+	return SymbolPrecision{
+		PricePrecision:    inst.PricePrecision(),
+		QuantityPrecision: inst.QuantityPrecision(),
+		TickSize:          inst.TickSize,
+		StepSize:          inst.StepSize,
+	}, nil
 }
 
 // roundToTickSize 将价格/数量四舍五入到tick size/step size的整数倍
@@ -426,7 +426,7 @@ func (t *AsterTrader) doRequest(method, endpoint string, params map[string]inter
 }
 
 // GetBalance 获取账户余额
-func (t *AsterTrader) GetBalance() (map[string]interface{}, error) {
+func (t *AsterTrader) GetBalance() (*Balance, error) {
 	params := make(map[string]interface{})
 	body, err := t.request("GET", "/fapi/v3/balance", params)
 	if err != nil {
@@ -458,16 +458,15 @@ func (t *AsterTrader) GetBalance() (map[string]interface{}, error) {
 		}
 	}
 
-	// 返回与Binance相同的字段名，确保AutoTrader能正确解析
-	return map[string]interface{}{
-		"totalWalletBalance":    totalBalance,
-		"availableBalance":      availableBalance,
-		"totalUnrealizedProfit": crossUnPnl,
+	return &Balance{
+		TotalWalletBalance:    totalBalance,
+		AvailableBalance:      availableBalance,
+		TotalUnrealizedProfit: crossUnPnl,
 	}, nil
 }
 
 // GetPositions 获取持仓信息
-func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
+func (t *AsterTrader) GetPositions() ([]Position, error) {
 	params := make(map[string]interface{})
 	body, err := t.request("GET", "/fapi/v3/positionRisk", params)
 	if err != nil {
@@ -479,7 +478,7 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 		return nil, err
 	}
 
-	result := []map[string]interface{}{}
+	result := []Position{}
 	for _, pos := range positions {
 		posAmtStr, ok := pos["positionAmt"].(string)
 		if !ok {
@@ -496,6 +495,10 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 		unRealizedProfit, _ := strconv.ParseFloat(pos["unRealizedProfit"].(string), 64)
 		leverageVal, _ := strconv.ParseFloat(pos["leverage"].(string), 64)
 		liquidationPrice, _ := strconv.ParseFloat(pos["liquidationPrice"].(string), 64)
+		updateTime, _ := pos["updateTime"].(float64)
+		marginType, _ := pos["marginType"].(string)
+		isolatedWallet, _ := pos["isolatedWallet"].(string)
+		notionalStr, _ := pos["notional"].(string)
 
 		// 判断方向（与Binance一致）
 		side := "long"
@@ -504,16 +507,31 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 			posAmt = -posAmt
 		}
 
-		// 返回与Binance相同的字段名
-		result = append(result, map[string]interface{}{
-			"symbol":            pos["symbol"],
-			"side":              side,
-			"positionAmt":       posAmt,
-			"entryPrice":        entryPrice,
-			"markPrice":         markPrice,
-			"unRealizedProfit":  unRealizedProfit,
-			"leverage":          leverageVal,
-			"liquidationPrice":  liquidationPrice,
+		// 逐仓取仓位保证金，全仓按名义价值/杠杆计算初始保证金
+		marginMode := MarginModeIsolated
+		margin, _ := strconv.ParseFloat(isolatedWallet, 64)
+		if strings.EqualFold(marginType, "cross") || strings.EqualFold(marginType, "crossed") {
+			marginMode = MarginModeCross
+			notional, _ := strconv.ParseFloat(notionalStr, 64)
+			margin = 0
+			if leverageVal > 0 {
+				margin = math.Abs(notional) / leverageVal
+			}
+		}
+
+		symbol, _ := pos["symbol"].(string)
+		result = append(result, Position{
+			Symbol:           symbol,
+			Side:             side,
+			Quantity:         posAmt,
+			EntryPrice:       entryPrice,
+			MarkPrice:        markPrice,
+			UnrealizedPnL:    unRealizedProfit,
+			Leverage:         int(leverageVal),
+			LiquidationPrice: liquidationPrice,
+			MarginMode:       marginMode,
+			Margin:           margin,
+			UpdateTime:       int64(updateTime),
 		})
 	}
 
@@ -521,25 +539,51 @@ func (t *AsterTrader) GetPositions() ([]map[string]interface{}, error) {
 }
 
 // OpenLong 开多单
-func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
 	}
+	return t.open(symbol, "long", quantity, leverage)
+}
 
+// OpenShort 开空单
+func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
+	}
+	return t.open(symbol, "short", quantity, leverage)
+}
+
+// AddToPosition 市价加仓（保留该币种已有的止损止盈单和挂单）
+func (t *AsterTrader) AddToPosition(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.open(symbol, side, quantity, leverage)
+}
+
+// open 开仓（多空通用，不撤销已有挂单）
+func (t *AsterTrader) open(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
 	// 先设置杠杆
 	if err := t.SetLeverage(symbol, leverage); err != nil {
 		return nil, fmt.Errorf("设置杠杆失败: %w", err)
 	}
 
+	// 设置保证金模式
+	if err := t.applyMarginType(symbol); err != nil {
+		return nil, err
+	}
+
 	// 获取当前价格
 	price, err := t.GetMarketPrice(symbol)
 	if err != nil {
 		return nil, err
 	}
 
-	// 使用限价单模拟市价单（价格设置得稍高一些以确保成交）
-	limitPrice := price * 1.01
+	// 使用限价单模拟市价单（开多价格稍高、开空价格稍低以确保成交）
+	orderSide, limitPrice := "BUY", price*1.01
+	if side == "short" {
+		orderSide, limitPrice = "SELL", price*0.99
+	}
 
 	// 格式化价格和数量到正确精度
 	formattedPrice, err := t.formatPrice(symbol, limitPrice)
@@ -568,7 +612,7 @@ func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (m
 		"symbol":       symbol,
 		"positionSide": "BOTH",
 		"type":         "LIMIT",
-		"side":         "BUY",
+		"side":         orderSide,
 		"timeInForce":  "GTC",
 		"quantity":     qtyStr,
 		"price":        priceStr,
@@ -579,33 +623,42 @@ func (t *AsterTrader) OpenLong(symbol string, quantity float64, leverage int) (m
 		return nil, err
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	result, err := t.buildOrderResult(body, leverage)
+	if err != nil {
 		return nil, err
 	}
 
 	return result, nil
 }
 
-// OpenShort 开空单
-func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
-	// 开仓前先取消所有挂单,防止残留挂单导致仓位叠加
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消挂单失败(继续开仓): %v", err)
-	}
+// CloseLong 平多单
+func (t *AsterTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
+	// 如果数量为0，获取当前持仓数量
+	closeAll := quantity == 0
+	if closeAll {
+		positions, err := t.GetPositions()
+		if err != nil {
+			return nil, err
+		}
 
-	// 先设置杠杆
-	if err := t.SetLeverage(symbol, leverage); err != nil {
-		return nil, fmt.Errorf("设置杠杆失败: %w", err)
+		for _, pos := range positions {
+			if pos.Symbol == symbol && pos.Side == "long" {
+				quantity = pos.Quantity
+				break
+			}
+		}
+
+		if quantity == 0 {
+			return nil, fmt.Errorf("没有找到 %s 的多仓", symbol)
+		}
+		log.Printf("  📊 获取到多仓数量: %.8f", quantity)
 	}
 
-	// 获取当前价格
 	price, err := t.GetMarketPrice(symbol)
 	if err != nil {
 		return nil, err
 	}
 
-	// 使用限价单模拟市价单（价格设置得稍低一些以确保成交）
 	limitPrice := price * 0.99
 
 	// 格式化价格和数量到正确精度
@@ -646,34 +699,44 @@ func (t *AsterTrader) OpenShort(symbol string, quantity float64, leverage int) (
 		return nil, err
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	result, err := t.buildOrderResult(body, 0)
+	if err != nil {
 		return nil, err
 	}
 
+	log.Printf("✓ 平多仓成功: %s 数量: %s", symbol, qtyStr)
+
+	// 全部平仓后取消该币种的所有挂单（部分平仓时保留止损止盈单）
+	if closeAll {
+		if err := t.CancelAllOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消挂单失败: %v", err)
+		}
+	}
+
 	return result, nil
 }
 
-// CloseLong 平多单
-func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+// CloseShort 平空单
+func (t *AsterTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
-	if quantity == 0 {
+	closeAll := quantity == 0
+	if closeAll {
 		positions, err := t.GetPositions()
 		if err != nil {
 			return nil, err
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "long" {
-				quantity = pos["positionAmt"].(float64)
+			if pos.Symbol == symbol && pos.Side == "short" {
+				quantity = pos.Quantity
 				break
 			}
 		}
 
 		if quantity == 0 {
-			return nil, fmt.Errorf("没有找到 %s 的多仓", symbol)
+			return nil, fmt.Errorf("没有找到 %s 的空仓", symbol)
 		}
-		log.Printf("  📊 获取到多仓数量: %.8f", quantity)
+		log.Printf("  📊 获取到空仓数量: %.8f", quantity)
 	}
 
 	price, err := t.GetMarketPrice(symbol)
@@ -681,7 +744,7 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 		return nil, err
 	}
 
-	limitPrice := price * 0.99
+	limitPrice := price * 1.01
 
 	// 格式化价格和数量到正确精度
 	formattedPrice, err := t.formatPrice(symbol, limitPrice)
@@ -710,7 +773,7 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 		"symbol":       symbol,
 		"positionSide": "BOTH",
 		"type":         "LIMIT",
-		"side":         "SELL",
+		"side":         "BUY",
 		"timeInForce":  "GTC",
 		"quantity":     qtyStr,
 		"price":        priceStr,
@@ -721,53 +784,37 @@ func (t *AsterTrader) CloseLong(symbol string, quantity float64) (map[string]int
 		return nil, err
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	result, err := t.buildOrderResult(body, 0)
+	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("✓ 平多仓成功: %s 数量: %s", symbol, qtyStr)
+	log.Printf("✓ 平空仓成功: %s 数量: %s", symbol, qtyStr)
 
-	// 平仓后取消该币种的所有挂单(止损止盈单)
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	// 全部平仓后取消该币种的所有挂单（部分平仓时保留止损止盈单）
+	if closeAll {
+		if err := t.CancelAllOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消挂单失败: %v", err)
+		}
 	}
 
 	return result, nil
 }
 
-// CloseShort 平空单
-func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
-	// 如果数量为0，获取当前持仓数量
-	if quantity == 0 {
-		positions, err := t.GetPositions()
-		if err != nil {
-			return nil, err
-		}
-
-		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "short" {
-				// Aster的GetPositions已经将空仓数量转换为正数，直接使用
-				quantity = pos["positionAmt"].(float64)
-				break
-			}
-		}
-
-		if quantity == 0 {
-			return nil, fmt.Errorf("没有找到 %s 的空仓", symbol)
-		}
-		log.Printf("  📊 获取到空仓数量: %.8f", quantity)
+// PlaceLimitOrder 挂限价开仓单（post-only使用GTX，会立即成交时交易所返回EXPIRED状态）
+func (t *AsterTrader) PlaceLimitOrder(symbol, side string, quantity, price float64, leverage int, postOnly bool) (*OrderResult, error) {
+	// 先设置杠杆
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, fmt.Errorf("设置杠杆失败: %w", err)
 	}
 
-	price, err := t.GetMarketPrice(symbol)
-	if err != nil {
+	// 设置保证金模式
+	if err := t.applyMarginType(symbol); err != nil {
 		return nil, err
 	}
 
-	limitPrice := price * 1.01
-
 	// 格式化价格和数量到正确精度
-	formattedPrice, err := t.formatPrice(symbol, limitPrice)
+	formattedPrice, err := t.formatPrice(symbol, price)
 	if err != nil {
 		return nil, err
 	}
@@ -775,47 +822,194 @@ func (t *AsterTrader) CloseShort(symbol string, quantity float64) (map[string]in
 	if err != nil {
 		return nil, err
 	}
-
-	// 获取精度信息
 	prec, err := t.getPrecision(symbol)
 	if err != nil {
 		return nil, err
 	}
-
-	// 转换为字符串，使用正确的精度格式
 	priceStr := t.formatFloatWithPrecision(formattedPrice, prec.PricePrecision)
 	qtyStr := t.formatFloatWithPrecision(formattedQty, prec.QuantityPrecision)
 
-	log.Printf("  📏 精度处理: 价格 %.8f -> %s (精度=%d), 数量 %.8f -> %s (精度=%d)",
-		limitPrice, priceStr, prec.PricePrecision, quantity, qtyStr, prec.QuantityPrecision)
+	orderSide := "BUY"
+	if side == "short" {
+		orderSide = "SELL"
+	}
+	timeInForce := "GTC"
+	if postOnly {
+		timeInForce = "GTX"
+	}
 
 	params := map[string]interface{}{
 		"symbol":       symbol,
 		"positionSide": "BOTH",
 		"type":         "LIMIT",
-		"side":         "BUY",
-		"timeInForce":  "GTC",
+		"side":         orderSide,
+		"timeInForce":  timeInForce,
 		"quantity":     qtyStr,
 		"price":        priceStr,
 	}
 
 	body, err := t.request("POST", "/fapi/v3/order", params)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("挂限价单失败: %w", err)
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
+	var order asterOrderResponse
+	if err := json.Unmarshal(body, &order); err != nil {
+		return nil, fmt.Errorf("解析下单响应失败: %w", err)
 	}
+	log.Printf("✓ 限价单已提交: %s %s 价格: %s 数量: %s 状态: %s", symbol, side, priceStr, qtyStr, order.Status)
 
-	log.Printf("✓ 平空仓成功: %s 数量: %s", symbol, qtyStr)
+	// 未成交的挂单无需查询成交明细
+	if order.Status == "NEW" || order.Status == "EXPIRED" {
+		return &OrderResult{
+			OrderID:  order.OrderID,
+			Symbol:   order.Symbol,
+			Status:   order.Status,
+			Leverage: leverage,
+		}, nil
+	}
+	return t.buildOrderResult(body, leverage)
+}
 
-	// 平仓后取消该币种的所有挂单(止损止盈单)
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消挂单失败: %v", err)
+// asterOpenOrder 挂单信息（与Binance字段一致）
+type asterOpenOrder struct {
+	OrderID       int64  `json:"orderId"`
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`
+	PositionSide  string `json:"positionSide"`
+	Type          string `json:"type"`
+	Price         string `json:"price"`
+	StopPrice     string `json:"stopPrice"`
+	OrigQty       string `json:"origQty"`
+	ExecutedQty   string `json:"executedQty"`
+	ReduceOnly    bool   `json:"reduceOnly"`
+	ClosePosition bool   `json:"closePosition"`
+	Time          int64  `json:"time"`
+}
+
+// GetOpenOrders 获取未成交挂单（symbol为空表示所有币种）
+func (t *AsterTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	params := make(map[string]interface{})
+	if symbol != "" {
+		params["symbol"] = symbol
+	}
+	body, err := t.request("GET", "/fapi/v3/openOrders", params)
+	if err != nil {
+		return nil, fmt.Errorf("获取挂单失败: %w", err)
+	}
+
+	var orders []asterOpenOrder
+	if err := json.Unmarshal(body, &orders); err != nil {
+		return nil, fmt.Errorf("解析挂单失败: %w", err)
 	}
 
+	var result []Order
+	for _, o := range orders {
+		order := Order{
+			OrderID:      o.OrderID,
+			Symbol:       o.Symbol,
+			Side:         o.Side,
+			PositionSide: o.PositionSide,
+			Type:         o.Type,
+			ReduceOnly:   o.ReduceOnly || o.ClosePosition,
+			Time:         o.Time,
+		}
+		order.Price, _ = strconv.ParseFloat(o.Price, 64)
+		order.StopPrice, _ = strconv.ParseFloat(o.StopPrice, 64)
+		order.Quantity, _ = strconv.ParseFloat(o.OrigQty, 64)
+		order.FilledQty, _ = strconv.ParseFloat(o.ExecutedQty, 64)
+		result = append(result, order)
+	}
+	return result, nil
+}
+
+// CancelOrder 撤销指定挂单
+func (t *AsterTrader) CancelOrder(symbol string, orderID int64) error {
+	params := map[string]interface{}{
+		"symbol":  symbol,
+		"orderId": orderID,
+	}
+	if _, err := t.request("DELETE", "/fapi/v3/order", params); err != nil {
+		return fmt.Errorf("撤销订单失败: %w", err)
+	}
+
+	log.Printf("  ✓ 已撤销 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
+// asterOrderResponse 下单响应（与Binance字段一致）
+type asterOrderResponse struct {
+	OrderID     int64  `json:"orderId"`
+	Symbol      string `json:"symbol"`
+	Status      string `json:"status"`
+	AvgPrice    string `json:"avgPrice"`
+	ExecutedQty string `json:"executedQty"`
+}
+
+// asterTrade 账户成交记录
+type asterTrade struct {
+	OrderID         int64  `json:"orderId"`
+	Symbol          string `json:"symbol"`
+	Side            string `json:"side"`
+	PositionSide    string `json:"positionSide"`
+	Price           string `json:"price"`
+	Qty             string `json:"qty"`
+	Commission      string `json:"commission"`
+	CommissionAsset string `json:"commissionAsset"`
+	RealizedPnl     string `json:"realizedPnl"`
+	Time            int64  `json:"time"`
+}
+
+// buildOrderResult 解析下单响应，并按订单ID查询成交记录补充成交均价和手续费
+func (t *AsterTrader) buildOrderResult(body []byte, leverage int) (*OrderResult, error) {
+	var order asterOrderResponse
+	if err := json.Unmarshal(body, &order); err != nil {
+		return nil, fmt.Errorf("解析下单响应失败: %w", err)
+	}
+
+	result := &OrderResult{
+		OrderID:  order.OrderID,
+		Symbol:   order.Symbol,
+		Status:   order.Status,
+		Leverage: leverage,
+	}
+	result.AvgPrice, _ = strconv.ParseFloat(order.AvgPrice, 64)
+	result.FilledQty, _ = strconv.ParseFloat(order.ExecutedQty, 64)
+
+	params := map[string]interface{}{
+		"symbol":  order.Symbol,
+		"orderId": order.OrderID,
+	}
+	tradesBody, err := t.request("GET", "/fapi/v3/userTrades", params)
+	if err != nil {
+		log.Printf("  ⚠ 查询成交明细失败（手续费未记录）: %v", err)
+		return result, nil
+	}
+
+	var trades []asterTrade
+	if err := json.Unmarshal(tradesBody, &trades); err != nil {
+		log.Printf("  ⚠ 解析成交明细失败（手续费未记录）: %v", err)
+		return result, nil
+	}
+
+	for _, trade := range trades {
+		fill := Fill{
+			OrderID:  trade.OrderID,
+			Symbol:   trade.Symbol,
+			Side:     trade.Side,
+			FeeAsset: trade.CommissionAsset,
+			Time:     trade.Time,
+		}
+		fill.Price, _ = strconv.ParseFloat(trade.Price, 64)
+		fill.Quantity, _ = strconv.ParseFloat(trade.Qty, 64)
+		fill.Fee, _ = strconv.ParseFloat(trade.Commission, 64)
+		fill.RealizedPnL, _ = strconv.ParseFloat(trade.RealizedPnl, 64)
+		result.Fills = append(result.Fills, fill)
+	}
+	result.summarizeFills()
+
+	log.Printf("  💵 成交: 订单ID %d, 均价 %.4f, 数量 %.4f, 手续费 %.4f",
+		result.OrderID, result.AvgPrice, result.FilledQty, result.Fee)
 	return result, nil
 }
 
@@ -830,6 +1024,37 @@ func (t *AsterTrader) SetLeverage(symbol string, leverage int) error {
 	return err
 }
 
+// SetMarginMode 设置该币种后续开仓使用的保证金模式
+func (t *AsterTrader) SetMarginMode(symbol string, mode string) error {
+	return t.marginModes.set(symbol, mode)
+}
+
+// applyMarginType 将币种切换为设置的保证金模式（已是该模式时不算错误，与上次生效的模式相同时不调用交易所接口）
+func (t *AsterTrader) applyMarginType(symbol string) error {
+	mode, ok := t.marginModes.needsApply(symbol)
+	if !ok {
+		return nil
+	}
+	marginType := "ISOLATED"
+	if mode == MarginModeCross {
+		marginType = "CROSSED"
+	}
+
+	params := map[string]interface{}{
+		"symbol":     symbol,
+		"marginType": marginType,
+	}
+	if _, err := t.request("POST", "/fapi/v3/marginType", params); err != nil {
+		if !strings.Contains(err.Error(), "No need to change") {
+			return fmt.Errorf("设置保证金模式失败: %w", err)
+		}
+	} else {
+		log.Printf("  ✓ %s 保证金模式已切换为 %s", symbol, marginType)
+	}
+	t.marginModes.markApplied(symbol, mode)
+	return nil
+}
+
 // GetMarketPrice 获取市场价格
 func (t *AsterTrader) GetMarketPrice(symbol string) (float64, error) {
 	// 使用ticker接口获取当前价格
@@ -892,6 +1117,7 @@ func (t *AsterTrader) SetStopLoss(symbol string, positionSide string, quantity,
 		"stopPrice":    priceStr,
 		"quantity":     qtyStr,
 		"timeInForce":  "GTC",
+		"reduceOnly":   "true", // 单向持仓模式下防止部分平仓后触发反向开仓
 	}
 
 	_, err = t.request("POST", "/fapi/v3/order", params)
@@ -933,12 +1159,94 @@ func (t *AsterTrader) SetTakeProfit(symbol string, positionSide string, quantity
 		"stopPrice":    priceStr,
 		"quantity":     qtyStr,
 		"timeInForce":  "GTC",
+		"reduceOnly":   "true", // 单向持仓模式下防止部分平仓后触发反向开仓
 	}
 
 	_, err = t.request("POST", "/fapi/v3/order", params)
 	return err
 }
 
+// SetPartialTakeProfit 设置部分止盈单（止盈单本身按数量只减仓，直接复用）
+func (t *AsterTrader) SetPartialTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	return t.SetTakeProfit(symbol, positionSide, quantity, takeProfitPrice)
+}
+
+// GetFills 获取指定时间之后的成交记录
+func (t *AsterTrader) GetFills(symbol string, startTime int64) ([]Fill, error) {
+	body, err := t.request("GET", "/fapi/v3/userTrades", map[string]interface{}{
+		"symbol":    symbol,
+		"startTime": startTime,
+		"limit":     1000,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取成交记录失败: %w", err)
+	}
+
+	var trades []asterTrade
+	if err := json.Unmarshal(body, &trades); err != nil {
+		return nil, fmt.Errorf("解析成交记录失败: %w", err)
+	}
+
+	fills := make([]Fill, 0, len(trades))
+	for _, trade := range trades {
+		fill := Fill{
+			OrderID:  trade.OrderID,
+			Symbol:   trade.Symbol,
+			Side:     trade.Side,
+			FeeAsset: trade.CommissionAsset,
+			Time:     trade.Time,
+		}
+		if trade.PositionSide == "LONG" || trade.PositionSide == "SHORT" {
+			fill.PositionSide = trade.PositionSide
+		}
+		fill.Price, _ = strconv.ParseFloat(trade.Price, 64)
+		fill.Quantity, _ = strconv.ParseFloat(trade.Qty, 64)
+		fill.Fee, _ = strconv.ParseFloat(trade.Commission, 64)
+		fill.RealizedPnL, _ = strconv.ParseFloat(trade.RealizedPnl, 64)
+		fills = append(fills, fill)
+	}
+	return fills, nil
+}
+
+// GetIncomeHistory 获取指定时间之后的手续费和资金费流水
+func (t *AsterTrader) GetIncomeHistory(symbol string, startTime int64) ([]Income, error) {
+	body, err := t.request("GET", "/fapi/v3/income", map[string]interface{}{
+		"symbol":    symbol,
+		"startTime": startTime,
+		"limit":     1000,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取资金流水失败: %w", err)
+	}
+
+	var records []struct {
+		Symbol     string `json:"symbol"`
+		IncomeType string `json:"incomeType"`
+		Income     string `json:"income"`
+		Asset      string `json:"asset"`
+		Time       int64  `json:"time"`
+	}
+	if err := json.Unmarshal(body, &records); err != nil {
+		return nil, fmt.Errorf("解析资金流水失败: %w", err)
+	}
+
+	var incomes []Income
+	for _, r := range records {
+		if r.IncomeType != IncomeCommission && r.IncomeType != IncomeFunding {
+			continue
+		}
+		amount, _ := strconv.ParseFloat(r.Income, 64)
+		incomes = append(incomes, Income{
+			Symbol: r.Symbol,
+			Type:   r.IncomeType,
+			Amount: amount,
+			Asset:  r.Asset,
+			Time:   r.Time,
+		})
+	}
+	return incomes, nil
+}
+
 // CancelAllOrders 取消所有订单
 func (t *AsterTrader) CancelAllOrders(symbol string) error {
 	params := map[string]interface{}{
@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"log"
 	"nofx/decision"
+	"nofx/instrument"
 	"nofx/logger"
 	"nofx/market"
 	"nofx/mcp"
 	"nofx/pool"
+	"nofx/risk"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,10 +21,10 @@ type AutoTraderConfig struct {
 	// Trader标识
 	ID      string // Trader唯一标识（用于日志目录等）
 	Name    string // Trader显示名称
-	AIModel string // AI模型: "qwen" 或 "deepseek"
+	AIModel string // AI提供商: "qwen", "deepseek", "custom", "anthropic", "gemini", "ollama" 或 "llamacpp"
 
 	// 交易平台选择
-	Exchange string // "binance", "hyperliquid" 或 "aster"
+	Exchange string // "binance", "hyperliquid", "aster", "okx", "bybit" 或 "paper"
 
 	// 币安API配置
 	BinanceAPIKey    string
@@ -37,6 +40,22 @@ type AutoTraderConfig struct {
 	AsterSigner     string // Aster API钱包地址
 	AsterPrivateKey string // Aster API钱包私钥
 
+	// OKX配置
+	OKXAPIKey     string
+	OKXSecretKey  string
+	OKXPassphrase string
+	OKXTestnet    bool
+
+	// Bybit配置
+	BybitAPIKey    string
+	BybitSecretKey string
+	BybitTestnet   bool
+
+	// 模拟盘配置
+	PaperTakerFeeRate float64 // 吃单手续费率
+	PaperMakerFeeRate float64 // 挂单手续费率
+	PaperSlippage     float64 // 成交滑点比例
+
 	CoinPoolAPIURL string
 
 	// AI配置
@@ -49,6 +68,25 @@ type AutoTraderConfig struct {
 	CustomAPIKey    string
 	CustomModelName string
 
+	// Anthropic/Gemini/本地模型配置
+	AnthropicKey string
+	GeminiKey    string
+	OllamaURL    string
+	LlamaCppURL  string
+	AIModelName  string // 覆盖提供商默认模型（ollama必填）
+
+	// 模型参数
+	AITemperature     *float64 // 采样温度（为空时使用默认0.5）
+	AIMaxTokens       int      // 最大输出token数（为0时使用默认2000）
+	AIReasoningEffort string   // 推理强度: "", "low", "medium", "high"
+
+	// AI输出方式（auto/tools/json_schema/text）
+	AIOutputMode string
+	// 是否使用流式响应
+	AIStream bool
+	// 各模型单价（键为模型名），用于估算API费用
+	AIPricing map[string]mcp.Price
+
 	// 扫描配置
 	ScanInterval time.Duration // 扫描间隔（建议3分钟）
 
@@ -59,35 +97,58 @@ type AutoTraderConfig struct {
 	BTCETHLeverage  int // BTC和ETH的杠杆倍数
 	AltcoinLeverage int // 山寨币的杠杆倍数
 
-	// 风险控制（仅作为提示，AI可自主决定）
-	MaxDailyLoss    float64       // 最大日亏损百分比（提示）
-	MaxDrawdown     float64       // 最大回撤百分比（提示）
-	StopTradingTime time.Duration // 触发风控后暂停时长
+	// 保证金模式（MarginModeIsolated / MarginModeCross，为空时逐仓），AI可在开仓决策中覆盖
+	MarginMode string
+
+	// 持仓期间的止损管理（追踪止损、保本止损）
+	StopManagement StopManagementConfig
+
+	// 同方向加仓（MaxAdds为0时不允许加仓）
+	PositionScaling PositionScalingConfig
+
+	// 风险控制（硬性执行，触发后暂停交易）
+	MaxDailyLoss     float64       // 最大日亏损百分比（相对当日起始净值）
+	MaxDrawdown      float64       // 最大回撤百分比（相对最高净值）
+	StopTradingTime  time.Duration // 触发风控后暂停时长
+	RiskBreachAction string        // 触发风控后的处理方式: "close_all" 平掉所有持仓, "freeze" 保留持仓仅暂停交易
+
+	// 开仓前风控规则（每个开仓决策执行前检查，可拒绝或缩减仓位）
+	RiskRules risk.Config
+
+	// 自定义K线周期和指标（为空时使用默认的3分钟+4小时数据）
+	Timeframes []market.TimeframeConfig
+
+	// 行情数据源: "binance", "hyperliquid" 或 "aster"（为空时使用下单交易所的行情，OKX/Bybit/模拟盘使用币安）
+	MarketData string
+	// 参考价格数据源（为空时不输出跨交易所参考价格）
+	ReferenceMarket string
 }
 
 // AutoTrader 自动交易器
 type AutoTrader struct {
-	id                    string // Trader唯一标识
-	name                  string // Trader显示名称
-	aiModel               string // AI模型名称
-	exchange              string // 交易平台名称
-	config                AutoTraderConfig
-	trader                Trader // 使用Trader接口（支持多平台）
-	mcpClient             *mcp.Client
-	decisionLogger        *logger.DecisionLogger // 决策日志记录器
-	initialBalance        float64
-	dailyPnL              float64
-	lastResetTime         time.Time
-	stopUntil             time.Time
-	isRunning             bool
-	startTime             time.Time        // 系统启动时间
-	callCount             int              // AI调用次数
-	positionFirstSeenTime map[string]int64 // 持仓首次出现时间 (symbol_side -> timestamp毫秒)
+	id             string // Trader唯一标识
+	name           string // Trader显示名称
+	aiModel        string // AI模型名称
+	exchange       string // 交易平台名称
+	config         AutoTraderConfig
+	trader         Trader // 使用Trader接口（支持多平台）
+	mcpClient      *mcp.Client
+	decisionLogger *logger.DecisionLogger // 决策日志记录器
+	riskEngine     *risk.Engine           // 开仓前风控引擎
+	initialBalance float64
+	state          *traderState // 运行状态（启动时间、调用次数、持仓时间、风控基准等，每个周期持久化）
+	stateFile      string
+	isRunning      bool
+
+	// 回测注入点（实盘默认使用当前时间、实时行情和币种池）
+	nowFunc           func() time.Time
+	actionDelay       time.Duration // 每个动作成功执行后的等待时间（回测时为0）
+	marketDataFetcher func(symbol string) (*market.Data, error)
+	candidateSymbols  []string
 }
 
-// NewAutoTrader 创建自动交易器
-func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
-	// 设置默认值
+// setConfigDefaults 设置配置默认值
+func setConfigDefaults(config *AutoTraderConfig) {
 	if config.ID == "" {
 		config.ID = "default_trader"
 	}
@@ -101,23 +162,12 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 			config.AIModel = "deepseek"
 		}
 	}
+}
 
-	mcpClient := mcp.New()
-
-	// 初始化AI
-	if config.AIModel == "custom" {
-		// 使用自定义API
-		mcpClient.SetCustomAPI(config.CustomAPIURL, config.CustomAPIKey, config.CustomModelName)
-		log.Printf("🤖 [%s] 使用自定义AI API: %s (模型: %s)", config.Name, config.CustomAPIURL, config.CustomModelName)
-	} else if config.UseQwen || config.AIModel == "qwen" {
-		// 使用Qwen
-		mcpClient.SetQwenAPIKey(config.QwenKey, "")
-		log.Printf("🤖 [%s] 使用阿里云Qwen AI", config.Name)
-	} else {
-		// 默认使用DeepSeek
-		mcpClient.SetDeepSeekAPIKey(config.DeepSeekKey)
-		log.Printf("🤖 [%s] 使用DeepSeek AI", config.Name)
-	}
+// NewAutoTrader 创建自动交易器
+func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
+	// 设置默认值
+	setConfigDefaults(&config)
 
 	// 初始化币种池API
 	if config.CoinPoolAPIURL != "" {
@@ -149,10 +199,117 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 		if err != nil {
 			return nil, fmt.Errorf("初始化Aster交易器失败: %w", err)
 		}
+	case "okx":
+		log.Printf("🏦 [%s] 使用OKX永续合约交易", config.Name)
+		trader = NewOKXTrader(config.OKXAPIKey, config.OKXSecretKey, config.OKXPassphrase, config.OKXTestnet)
+	case "bybit":
+		log.Printf("🏦 [%s] 使用Bybit永续合约交易", config.Name)
+		bybit := NewBybitTrader(config.BybitAPIKey, config.BybitSecretKey, config.BybitTestnet)
+		// 统一账户的保证金模式为账户级别设置，使用交易员配置（决策中的margin_mode不能与之不同）
+		if err := bybit.SetAccountMarginMode(config.MarginMode); err != nil {
+			return nil, err
+		}
+		trader = bybit
+	case "paper":
+		log.Printf("🏦 [%s] 使用模拟盘交易（不产生真实订单）", config.Name)
+		stateFile := fmt.Sprintf("paper_trading/%s.json", config.ID)
+		paper, err := NewPaperTrader(config.InitialBalance, config.PaperTakerFeeRate, config.PaperSlippage, stateFile)
+		if err != nil {
+			return nil, fmt.Errorf("初始化模拟盘交易器失败: %w", err)
+		}
+		if config.PaperMakerFeeRate > 0 {
+			paper.SetMakerFeeRate(config.PaperMakerFeeRate)
+		}
+		provider, err := marketProvider(config)
+		if err != nil {
+			return nil, err
+		}
+		paper.SetPriceSource(providerPrice(provider))
+		trader = paper
 	default:
 		return nil, fmt.Errorf("不支持的交易平台: %s", config.Exchange)
 	}
 
+	return NewAutoTraderWithTrader(config, trader)
+}
+
+// NewAutoTraderWithTrader 使用已创建的交易器创建自动交易器（回测时传入模拟盘交易器）
+func NewAutoTraderWithTrader(config AutoTraderConfig, trader Trader) (*AutoTrader, error) {
+	setConfigDefaults(&config)
+
+	mcpClient := mcp.New()
+
+	// 初始化AI
+	switch {
+	case config.AIModel == "custom":
+		// 使用自定义API
+		mcpClient.SetCustomAPI(config.CustomAPIURL, config.CustomAPIKey, config.CustomModelName)
+		log.Printf("🤖 [%s] 使用自定义AI API: %s (模型: %s)", config.Name, config.CustomAPIURL, config.CustomModelName)
+	case config.AIModel == "anthropic":
+		mcpClient.SetAnthropicAPIKey(config.AnthropicKey, config.AIModelName)
+		log.Printf("🤖 [%s] 使用Anthropic AI (模型: %s)", config.Name, mcpClient.Model)
+	case config.AIModel == "gemini":
+		mcpClient.SetGeminiAPIKey(config.GeminiKey, config.AIModelName)
+		log.Printf("🤖 [%s] 使用Google Gemini AI (模型: %s)", config.Name, mcpClient.Model)
+	case config.AIModel == "ollama":
+		mcpClient.SetOllama(config.OllamaURL, config.AIModelName)
+		log.Printf("🤖 [%s] 使用本地Ollama: %s (模型: %s)", config.Name, mcpClient.BaseURL, mcpClient.Model)
+	case config.AIModel == "llamacpp":
+		mcpClient.SetLlamaCpp(config.LlamaCppURL, config.AIModelName)
+		log.Printf("🤖 [%s] 使用本地llama.cpp: %s", config.Name, mcpClient.BaseURL)
+	case config.UseQwen || config.AIModel == "qwen":
+		// 使用Qwen
+		mcpClient.SetQwenAPIKey(config.QwenKey, "")
+		log.Printf("🤖 [%s] 使用阿里云Qwen AI", config.Name)
+	default:
+		// 默认使用DeepSeek
+		mcpClient.SetDeepSeekAPIKey(config.DeepSeekKey)
+		log.Printf("🤖 [%s] 使用DeepSeek AI", config.Name)
+	}
+	if config.AIModelName != "" && (config.AIModel == "deepseek" || config.AIModel == "qwen") {
+		mcpClient.Model = config.AIModelName // 如 deepseek-reasoner、qwen-max
+	}
+	if config.AITemperature != nil {
+		mcpClient.Temperature = *config.AITemperature
+	}
+	if config.AIMaxTokens > 0 {
+		mcpClient.MaxTokens = config.AIMaxTokens
+	}
+	mcpClient.ReasoningEffort = config.AIReasoningEffort
+	mcpClient.OutputMode = config.AIOutputMode
+	mcpClient.Stream = config.AIStream
+	if price, ok := config.AIPricing[mcpClient.Model]; ok {
+		mcpClient.Price = price
+	} else if len(config.AIPricing) > 0 {
+		log.Printf("⚠️  [%s] 未配置模型 %s 的单价，API费用按0统计", config.Name, mcpClient.Model)
+	}
+
+	// 解析自定义K线周期和指标
+	timeframes, err := market.ParseTimeframes(config.Timeframes)
+	if err != nil {
+		return nil, fmt.Errorf("K线周期配置错误: %w", err)
+	}
+	if len(timeframes) > 0 {
+		log.Printf("📊 [%s] 使用自定义K线周期: %v", config.Name, market.Intervals(timeframes))
+	}
+
+	// 行情数据源（默认使用下单交易所的行情）及可选的参考价格数据源
+	provider, err := marketProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	var reference market.Provider
+	if config.ReferenceMarket != "" {
+		reference, err = market.NewProvider(config.ReferenceMarket, false)
+		if err != nil {
+			return nil, fmt.Errorf("参考价格数据源配置错误: %w", err)
+		}
+		log.Printf("📡 [%s] 行情数据源: %s，参考价格: %s", config.Name, provider.Name(), reference.Name())
+	} else {
+		log.Printf("📡 [%s] 行情数据源: %s", config.Name, provider.Name())
+	}
+	marketDataFetcher := market.NewFetcher(provider, timeframes, reference)
+
 	// 验证初始金额配置
 	if config.InitialBalance <= 0 {
 		return nil, fmt.Errorf("初始金额必须大于0，请在配置中设置InitialBalance")
@@ -162,22 +319,112 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 	logDir := fmt.Sprintf("decision_logs/%s", config.ID)
 	decisionLogger := logger.NewDecisionLogger(logDir)
 
-	return &AutoTrader{
-		id:                    config.ID,
-		name:                  config.Name,
-		aiModel:               config.AIModel,
-		exchange:              config.Exchange,
-		config:                config,
-		trader:                trader,
-		mcpClient:             mcpClient,
-		decisionLogger:        decisionLogger,
-		initialBalance:        config.InitialBalance,
-		lastResetTime:         time.Now(),
-		startTime:             time.Now(),
-		callCount:             0,
-		isRunning:             false,
-		positionFirstSeenTime: make(map[string]int64),
-	}, nil
+	// 加载运行状态（风控暂停等在重启后继续生效）
+	stateFile := fmt.Sprintf("trader_state/%s.json", config.ID)
+	state, err := loadTraderState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	at := &AutoTrader{
+		id:                config.ID,
+		name:              config.Name,
+		aiModel:           config.AIModel,
+		exchange:          config.Exchange,
+		config:            config,
+		trader:            trader,
+		mcpClient:         mcpClient,
+		decisionLogger:    decisionLogger,
+		riskEngine:        risk.NewEngineFromConfig(config.RiskRules),
+		initialBalance:    config.InitialBalance,
+		state:             state,
+		stateFile:         stateFile,
+		isRunning:         false,
+		nowFunc:           time.Now,
+		actionDelay:       1 * time.Second,
+		marketDataFetcher: marketDataFetcher,
+	}
+	if state.StartTime.IsZero() {
+		state.StartTime = at.now()
+	} else {
+		log.Printf("♻️ [%s] 已恢复运行状态: 启动于 %s，已调用AI %d次，跟踪%d个持仓",
+			config.Name, state.StartTime.Format("2006-01-02 15:04:05"), state.CallCount, len(state.PositionOpenTime))
+	}
+	if at.now().Before(state.StopUntil) {
+		log.Printf("⏸ [%s] 风控暂停中，直到 %s (%s)", config.Name, state.StopUntil.Format("2006-01-02 15:04:05"), state.LastRiskEvent)
+	}
+	return at, nil
+}
+
+// marketProvider 创建trader使用的行情数据源（未配置时使用下单交易所的行情，没有对应数据源的交易所使用币安）
+func marketProvider(config AutoTraderConfig) (market.Provider, error) {
+	name := config.MarketData
+	if name == "" {
+		name = market.ProviderBinance
+		if config.Exchange == market.ProviderHyperliquid || config.Exchange == market.ProviderAster {
+			name = config.Exchange
+		}
+	}
+	provider, err := market.NewProvider(name, config.HyperliquidTestnet)
+	if err != nil {
+		return nil, fmt.Errorf("行情数据源配置错误: %w", err)
+	}
+	return provider, nil
+}
+
+// providerPriceTTL 模拟盘价格缓存时间（同一周期内以及API轮询时复用，避免每次刷新都请求交易所）
+const providerPriceTTL = 5 * time.Second
+
+// providerPrice 以数据源的最新价格作为模拟盘价格来源（按币种缓存providerPriceTTL）
+func providerPrice(provider market.Provider) func(symbol string) (float64, error) {
+	type cachedPrice struct {
+		price float64
+		at    time.Time
+	}
+	var mu sync.Mutex
+	cache := make(map[string]cachedPrice)
+
+	return func(symbol string) (float64, error) {
+		symbol = instrument.Canonical(symbol)
+		mu.Lock()
+		defer mu.Unlock()
+		if c, ok := cache[symbol]; ok && time.Since(c.at) < providerPriceTTL {
+			return c.price, nil
+		}
+		price, err := provider.Price(symbol)
+		if err != nil {
+			return 0, err
+		}
+		cache[symbol] = cachedPrice{price: price, at: time.Now()}
+		return price, nil
+	}
+}
+
+// SetClock 设置时钟（回测时使用模拟时间，运行时长和日盈亏重置也以此为准，动作之间不再等待）
+func (at *AutoTrader) SetClock(now func() time.Time) {
+	at.nowFunc = now
+	at.actionDelay = 0
+	at.state.StartTime = now()
+}
+
+// SetMarketDataSource 设置市场数据来源（回测时使用历史K线构建的数据）
+func (at *AutoTrader) SetMarketDataSource(fetch func(symbol string) (*market.Data, error)) {
+	at.marketDataFetcher = fetch
+}
+
+// SetCandidateSymbols 固定候选币种（回测时使用，不再请求币种池）
+func (at *AutoTrader) SetCandidateSymbols(symbols []string) {
+	at.candidateSymbols = symbols
+}
+
+// RunCycle 执行单个决策周期（回测引擎按模拟时间逐周期调用）
+func (at *AutoTrader) RunCycle() error {
+	return at.runCycle()
+}
+
+// now 返回当前时间（回测时为模拟时间）
+func (at *AutoTrader) now() time.Time {
+	return at.nowFunc()
 }
 
 // Run 运行自动交易主循环
@@ -216,21 +463,26 @@ func (at *AutoTrader) Stop() {
 
 // runCycle 运行一个交易周期（使用AI全权决策）
 func (at *AutoTrader) runCycle() error {
-	at.callCount++
+	at.state.CallCount++
+	defer saveTraderState(at.stateFile, at.state) // 每个周期结束时保存运行状态
 
-	log.Printf("\n" + strings.Repeat("=", 70))
-	log.Printf("⏰ %s - AI决策周期 #%d", time.Now().Format("2006-01-02 15:04:05"), at.callCount)
-	log.Printf(strings.Repeat("=", 70))
+	log.Print("\n" + strings.Repeat("=", 70))
+	log.Printf("⏰ %s - AI决策周期 #%d", at.now().Format("2006-01-02 15:04:05"), at.state.CallCount)
+	log.Print(strings.Repeat("=", 70))
 
 	// 创建决策记录
 	record := &logger.DecisionRecord{
+		Timestamp:    at.now(),
 		ExecutionLog: []string{},
 		Success:      true,
 	}
 
+	// 检查待成交的限价开仓单（成交后设置止损止盈，过期撤单）
+	at.checkPendingEntries(record)
+
 	// 1. 检查是否需要停止交易
-	if time.Now().Before(at.stopUntil) {
-		remaining := at.stopUntil.Sub(time.Now())
+	if at.now().Before(at.state.StopUntil) {
+		remaining := at.state.StopUntil.Sub(at.now())
 		log.Printf("⏸ 风险控制：暂停交易中，剩余 %.0f 分钟", remaining.Minutes())
 		record.Success = false
 		record.ErrorMessage = fmt.Sprintf("风险控制暂停中，剩余 %.0f 分钟", remaining.Minutes())
@@ -238,14 +490,8 @@ func (at *AutoTrader) runCycle() error {
 		return nil
 	}
 
-	// 2. 重置日盈亏（每天重置）
-	if time.Since(at.lastResetTime) > 24*time.Hour {
-		at.dailyPnL = 0
-		at.lastResetTime = time.Now()
-		log.Println("📅 日盈亏已重置")
-	}
-
-	// 3. 收集交易上下文
+	// 2. 收集交易上下文
+	snapshotTime := at.now()
 	ctx, err := at.buildTradingContext()
 	if err != nil {
 		record.Success = false
@@ -285,12 +531,38 @@ func (at *AutoTrader) runCycle() error {
 	log.Printf("📊 账户净值: %.2f USDT | 可用: %.2f USDT | 持仓: %d",
 		ctx.Account.TotalEquity, ctx.Account.AvailableBalance, ctx.Account.PositionCount)
 
+	// 记录资金费结算，并与交易所对账：记录交易所侧的平仓和部分止盈成交，补挂丢失的止损止盈单
+	at.collectFunding(ctx, record)
+	at.reconcile(ctx, record, snapshotTime)
+
+	// 3. 风控检查：日亏损和最大回撤超限时按策略处理并暂停交易
+	if event := at.checkRiskLimits(ctx.Account.TotalEquity); event != nil {
+		at.handleRiskBreach(event, record)
+		at.decisionLogger.LogDecision(record)
+		return nil
+	}
+
+	// 按追踪止损和保本规则移动持仓止损
+	at.manageStops(ctx, record)
+
 	// 4. 调用AI获取完整决策
 	log.Println("🤖 正在请求AI分析并决策...")
 	decision, err := decision.GetFullDecision(ctx, at.mcpClient)
 
 	// 即使有错误，也保存思维链、决策和输入prompt（用于debug）
 	if decision != nil {
+		record.Usage = &logger.TokenUsage{
+			PromptTokens:     decision.Usage.PromptTokens,
+			CompletionTokens: decision.Usage.CompletionTokens,
+			ReasoningTokens:  decision.Usage.ReasoningTokens,
+			TotalTokens:      decision.Usage.TotalTokens,
+			CostUSD:          decision.Usage.CostUSD,
+		}
+		if decision.Usage.TotalTokens > 0 {
+			log.Printf("💰 AI调用用量: %d tokens（输入%d / 输出%d / 推理%d），估算费用 $%.4f",
+				decision.Usage.TotalTokens, decision.Usage.PromptTokens, decision.Usage.CompletionTokens,
+				decision.Usage.ReasoningTokens, decision.Usage.CostUSD)
+		}
 		record.InputPrompt = decision.UserPrompt
 		record.CoTTrace = decision.CoTTrace
 		if len(decision.Decisions) > 0 {
@@ -305,11 +577,11 @@ func (at *AutoTrader) runCycle() error {
 
 		// 打印AI思维链（即使有错误）
 		if decision != nil && decision.CoTTrace != "" {
-			log.Printf("\n" + strings.Repeat("-", 70))
+			log.Print("\n" + strings.Repeat("-", 70))
 			log.Println("💭 AI思维链分析（错误情况）:")
 			log.Println(strings.Repeat("-", 70))
 			log.Println(decision.CoTTrace)
-			log.Printf(strings.Repeat("-", 70) + "\n")
+			log.Print(strings.Repeat("-", 70) + "\n")
 		}
 
 		at.decisionLogger.LogDecision(record)
@@ -317,19 +589,22 @@ func (at *AutoTrader) runCycle() error {
 	}
 
 	// 5. 打印AI思维链
-	log.Printf("\n" + strings.Repeat("-", 70))
+	log.Print("\n" + strings.Repeat("-", 70))
 	log.Println("💭 AI思维链分析:")
 	log.Println(strings.Repeat("-", 70))
 	log.Println(decision.CoTTrace)
-	log.Printf(strings.Repeat("-", 70) + "\n")
+	log.Print(strings.Repeat("-", 70) + "\n")
 
 	// 6. 打印AI决策
 	log.Printf("📋 AI决策列表 (%d 个):\n", len(decision.Decisions))
 	for i, d := range decision.Decisions {
 		log.Printf("  [%d] %s: %s - %s", i+1, d.Symbol, d.Action, d.Reasoning)
-		if d.Action == "open_long" || d.Action == "open_short" {
+		if d.Action == "open_long" || d.Action == "open_short" || d.Action == "add_to_long" || d.Action == "add_to_short" {
 			log.Printf("      杠杆: %dx | 仓位: %.2f USDT | 止损: %.4f | 止盈: %.4f",
 				d.Leverage, d.PositionSizeUSD, d.StopLoss, d.TakeProfit)
+			if d.EntryType == "limit" || d.EntryType == "post_only" {
+				log.Printf("      入场: %s @ %.4f", d.EntryType, d.EntryPrice)
+			}
 		}
 	}
 	log.Println()
@@ -351,19 +626,34 @@ func (at *AutoTrader) runCycle() error {
 			Quantity:  0,
 			Leverage:  d.Leverage,
 			Price:     0,
-			Timestamp: time.Now(),
+			Timestamp: at.now(),
 			Success:   false,
 		}
 
+		// 开仓和加仓前风控检查（可能拒绝或缩减仓位）
+		if d.Action == "open_long" || d.Action == "open_short" || d.Action == "add_to_long" || d.Action == "add_to_short" {
+			if err := at.checkPreTradeRisk(&d, &actionRecord, ctx); err != nil {
+				log.Printf("🛡️ 风控拒绝 (%s %s): %v", d.Symbol, d.Action, err)
+				actionRecord.Error = err.Error()
+				record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🛡️ %s %s 被风控拒绝: %v", d.Symbol, d.Action, err))
+				record.Decisions = append(record.Decisions, actionRecord)
+				continue
+			}
+		}
+
 		if err := at.executeDecisionWithRecord(&d, &actionRecord); err != nil {
 			log.Printf("❌ 执行决策失败 (%s %s): %v", d.Symbol, d.Action, err)
 			actionRecord.Error = err.Error()
 			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 失败: %v", d.Symbol, d.Action, err))
 		} else {
 			actionRecord.Success = true
-			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 成功", d.Symbol, d.Action))
+			if actionRecord.Pending {
+				record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⏳ %s %s 限价单已挂出", d.Symbol, d.Action))
+			} else {
+				record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 成功", d.Symbol, d.Action))
+			}
 			// 成功执行后短暂延迟
-			time.Sleep(1 * time.Second)
+			time.Sleep(at.actionDelay)
 		}
 
 		record.Decisions = append(record.Decisions, actionRecord)
@@ -386,19 +676,9 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 	}
 
 	// 获取账户字段
-	totalWalletBalance := 0.0
-	totalUnrealizedProfit := 0.0
-	availableBalance := 0.0
-
-	if wallet, ok := balance["totalWalletBalance"].(float64); ok {
-		totalWalletBalance = wallet
-	}
-	if unrealized, ok := balance["totalUnrealizedProfit"].(float64); ok {
-		totalUnrealizedProfit = unrealized
-	}
-	if avail, ok := balance["availableBalance"].(float64); ok {
-		availableBalance = avail
-	}
+	totalWalletBalance := balance.TotalWalletBalance
+	totalUnrealizedProfit := balance.TotalUnrealizedProfit
+	availableBalance := balance.AvailableBalance
 
 	// Total Equity = 钱包余额 + 未实现盈亏
 	totalEquity := totalWalletBalance + totalUnrealizedProfit
@@ -412,27 +692,24 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 	var positionInfos []decision.PositionInfo
 	totalMarginUsed := 0.0
 
-	// 当前持仓的key集合（用于清理已平仓的记录）
-	currentPositionKeys := make(map[string]bool)
-
 	for _, pos := range positions {
-		symbol := pos["symbol"].(string)
-		side := pos["side"].(string)
-		entryPrice := pos["entryPrice"].(float64)
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
-		if quantity < 0 {
-			quantity = -quantity // 空仓数量为负，转为正数
-		}
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
-		liquidationPrice := pos["liquidationPrice"].(float64)
-
-		// 计算占用保证金（估算）
-		leverage := 10 // 默认值，实际应该从持仓信息获取
-		if lev, ok := pos["leverage"].(float64); ok {
-			leverage = int(lev)
-		}
-		marginUsed := (quantity * markPrice) / float64(leverage)
+		symbol := pos.Symbol
+		side := pos.Side
+		entryPrice := pos.EntryPrice
+		markPrice := pos.MarkPrice
+		quantity := pos.Quantity
+		unrealizedPnl := pos.UnrealizedPnL
+		liquidationPrice := pos.LiquidationPrice
+
+		leverage := 10 // 默认值，交易所未返回杠杆时使用
+		if pos.Leverage > 0 {
+			leverage = pos.Leverage
+		}
+		// 占用保证金优先使用交易所返回的实际保证金，未返回时按名义价值/杠杆估算
+		marginUsed := pos.Margin
+		if marginUsed <= 0 {
+			marginUsed = (quantity * markPrice) / float64(leverage)
+		}
 		totalMarginUsed += marginUsed
 
 		// 计算盈亏百分比
@@ -443,14 +720,19 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			pnlPct = ((entryPrice - markPrice) / entryPrice) * float64(leverage) * 100
 		}
 
-		// 跟踪持仓首次出现时间
+		// 跟踪持仓开仓时间（交易所提供开仓时间时以交易所为准）
 		posKey := symbol + "_" + side
-		currentPositionKeys[posKey] = true
-		if _, exists := at.positionFirstSeenTime[posKey]; !exists {
-			// 新持仓，记录当前时间
-			at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+		if pos.OpenTime > 0 {
+			at.state.PositionOpenTime[posKey] = pos.OpenTime
+		} else if _, exists := at.state.PositionOpenTime[posKey]; !exists {
+			// 未跟踪的持仓（如重启前已存在），优先使用交易所的最近更新时间，否则记录当前时间
+			if pos.UpdateTime > 0 {
+				at.state.PositionOpenTime[posKey] = pos.UpdateTime
+			} else {
+				at.state.PositionOpenTime[posKey] = at.now().UnixMilli()
+			}
 		}
-		updateTime := at.positionFirstSeenTime[posKey]
+		updateTime := at.state.PositionOpenTime[posKey]
 
 		positionInfos = append(positionInfos, decision.PositionInfo{
 			Symbol:           symbol,
@@ -463,41 +745,21 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			UnrealizedPnLPct: pnlPct,
 			LiquidationPrice: liquidationPrice,
 			MarginUsed:       marginUsed,
+			MarginMode:       pos.MarginMode,
 			UpdateTime:       updateTime,
 		})
-	}
-
-	// 清理已平仓的持仓记录
-	for key := range at.positionFirstSeenTime {
-		if !currentPositionKeys[key] {
-			delete(at.positionFirstSeenTime, key)
+		if ms, ok := at.state.Stops[posKey]; ok {
+			positionInfos[len(positionInfos)-1].StopLoss = ms.StopLoss
 		}
+		positionInfos[len(positionInfos)-1].Adds = at.state.Adds[posKey]
 	}
 
 	// 3. 获取合并的候选币种池（AI500 + OI Top，去重）
-	// 无论有没有持仓，都分析相同数量的币种（让AI看到所有好机会）
-	// AI会根据保证金使用率和现有持仓情况，自己决定是否要换仓
-	const ai500Limit = 20 // AI500取前20个评分最高的币种
-
-	// 获取合并后的币种池（AI500 + OI Top）
-	mergedPool, err := pool.GetMergedCoinPool(ai500Limit)
+	candidateCoins, err := at.getCandidateCoins()
 	if err != nil {
-		return nil, fmt.Errorf("获取合并币种池失败: %w", err)
+		return nil, err
 	}
 
-	// 构建候选币种列表（包含来源信息）
-	var candidateCoins []decision.CandidateCoin
-	for _, symbol := range mergedPool.AllSymbols {
-		sources := mergedPool.SymbolSources[symbol]
-		candidateCoins = append(candidateCoins, decision.CandidateCoin{
-			Symbol:  symbol,
-			Sources: sources, // "ai500" 和/或 "oi_top"
-		})
-	}
-
-	log.Printf("📋 合并币种池: AI500前%d + OI_Top20 = 总计%d个候选币种",
-		ai500Limit, len(candidateCoins))
-
 	// 4. 计算总盈亏
 	totalPnL := totalEquity - at.initialBalance
 	totalPnLPct := 0.0
@@ -521,11 +783,13 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 
 	// 6. 构建上下文
 	ctx := &decision.Context{
-		CurrentTime:     time.Now().Format("2006-01-02 15:04:05"),
-		RuntimeMinutes:  int(time.Since(at.startTime).Minutes()),
-		CallCount:       at.callCount,
+		CurrentTime:     at.now().Format("2006-01-02 15:04:05"),
+		RuntimeMinutes:  int(at.now().Sub(at.state.StartTime).Minutes()),
+		CallCount:       at.state.CallCount,
 		BTCETHLeverage:  at.config.BTCETHLeverage,  // 使用配置的杠杆倍数
 		AltcoinLeverage: at.config.AltcoinLeverage, // 使用配置的杠杆倍数
+		MaxAdds:         at.config.PositionScaling.MaxAdds,
+		ExpectedHolding: expectedHolding(performance),
 		Account: decision.AccountInfo{
 			TotalEquity:      totalEquity,
 			AvailableBalance: availableBalance,
@@ -535,14 +799,57 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			MarginUsedPct:    marginUsedPct,
 			PositionCount:    len(positionInfos),
 		},
-		Positions:      positionInfos,
-		CandidateCoins: candidateCoins,
-		Performance:    performance, // 添加历史表现分析
+		Positions:         positionInfos,
+		PendingOrders:     at.pendingOrderInfos(),
+		CandidateCoins:    candidateCoins,
+		Performance:       performance, // 添加历史表现分析
+		MarketDataFetcher: at.marketDataFetcher,
+		Now:               at.now(),
 	}
 
 	return ctx, nil
 }
 
+// getCandidateCoins 获取合并的候选币种池（AI500 + OI Top，去重）
+func (at *AutoTrader) getCandidateCoins() ([]decision.CandidateCoin, error) {
+	// 回测时使用固定的候选币种
+	if len(at.candidateSymbols) > 0 {
+		var candidateCoins []decision.CandidateCoin
+		for _, symbol := range at.candidateSymbols {
+			candidateCoins = append(candidateCoins, decision.CandidateCoin{
+				Symbol:  symbol,
+				Sources: []string{"ai500"},
+			})
+		}
+		return candidateCoins, nil
+	}
+
+	// 无论有没有持仓，都分析相同数量的币种（让AI看到所有好机会）
+	// AI会根据保证金使用率和现有持仓情况，自己决定是否要换仓
+	const ai500Limit = 20 // AI500取前20个评分最高的币种
+
+	// 获取合并后的币种池（AI500 + OI Top）
+	mergedPool, err := pool.GetMergedCoinPool(ai500Limit)
+	if err != nil {
+		return nil, fmt.Errorf("获取合并币种池失败: %w", err)
+	}
+
+	// 构建候选币种列表（包含来源信息）
+	var candidateCoins []decision.CandidateCoin
+	for _, symbol := range mergedPool.AllSymbols {
+		sources := mergedPool.SymbolSources[symbol]
+		candidateCoins = append(candidateCoins, decision.CandidateCoin{
+			Symbol:  symbol,
+			Sources: sources, // "ai500" 和/或 "oi_top"
+		})
+	}
+
+	log.Printf("📋 合并币种池: AI500前%d + OI_Top20 = 总计%d个候选币种",
+		ai500Limit, len(candidateCoins))
+
+	return candidateCoins, nil
+}
+
 // executeDecisionWithRecord 执行AI决策并记录详细信息
 func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	switch decision.Action {
@@ -554,6 +861,14 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 		return at.executeCloseLongWithRecord(decision, actionRecord)
 	case "close_short":
 		return at.executeCloseShortWithRecord(decision, actionRecord)
+	case "add_to_long":
+		return at.executeAddWithRecord(decision, "long", actionRecord)
+	case "add_to_short":
+		return at.executeAddWithRecord(decision, "short", actionRecord)
+	case "partial_close":
+		return at.executePartialCloseWithRecord(decision, actionRecord)
+	case "update_stop":
+		return at.executeUpdateStopWithRecord(decision, actionRecord)
 	case "hold", "wait":
 		// 无需执行，仅记录
 		return nil
@@ -570,14 +885,29 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 	positions, err := at.trader.GetPositions()
 	if err == nil {
 		for _, pos := range positions {
-			if pos["symbol"] == decision.Symbol && pos["side"] == "long" {
+			if pos.Symbol == decision.Symbol && pos.Side == "long" {
+				if at.config.PositionScaling.MaxAdds > 0 {
+					return fmt.Errorf("❌ %s 已有多仓，拒绝开仓。如需加仓，请使用 add_to_long 决策", decision.Symbol)
+				}
 				return fmt.Errorf("❌ %s 已有多仓，拒绝开仓以防止仓位叠加超限。如需换仓，请先给出 close_long 决策", decision.Symbol)
 			}
 		}
 	}
+	if _, pending := at.state.PendingEntries[decision.Symbol+"_long"]; pending {
+		return fmt.Errorf("❌ %s 已有等待成交的开多限价单，如需改价请先给出 close_long 决策撤单", decision.Symbol)
+	}
+
+	if err := at.applyMarginMode(decision.Symbol, decision.MarginMode); err != nil {
+		return err
+	}
+
+	// 限价/post-only入场：挂单后等待成交，成交后再设置止损止盈
+	if decision.EntryType == "limit" || decision.EntryType == "post_only" {
+		return at.placeLimitEntry(decision, "long", actionRecord)
+	}
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.marketDataFetcher(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -593,24 +923,20 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 		return err
 	}
 
-	// 记录订单ID
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
+	// 记录订单ID和实际成交（止损止盈按实际成交数量设置）
+	at.recordOrder(actionRecord, order)
+	if order.FilledQty > 0 {
+		quantity = order.FilledQty
 	}
 
-	log.Printf("  ✓ 开仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
+	log.Printf("  ✓ 开仓成功，订单ID: %d, 数量: %.4f, 成交价: %.4f", order.OrderID, quantity, actionRecord.Price)
 
 	// 记录开仓时间
 	posKey := decision.Symbol + "_long"
-	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+	at.state.PositionOpenTime[posKey] = at.now().UnixMilli()
 
 	// 设置止损止盈
-	if err := at.trader.SetStopLoss(decision.Symbol, "LONG", quantity, decision.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
-	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "LONG", quantity, decision.TakeProfit); err != nil {
-		log.Printf("  ⚠ 设置止盈失败: %v", err)
-	}
+	at.attachStops(decision.Symbol, "long", quantity, decision.StopLoss, decision.TakeProfit, decision.TakeProfitLevels)
 
 	return nil
 }
@@ -623,14 +949,29 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 	positions, err := at.trader.GetPositions()
 	if err == nil {
 		for _, pos := range positions {
-			if pos["symbol"] == decision.Symbol && pos["side"] == "short" {
+			if pos.Symbol == decision.Symbol && pos.Side == "short" {
+				if at.config.PositionScaling.MaxAdds > 0 {
+					return fmt.Errorf("❌ %s 已有空仓，拒绝开仓。如需加仓，请使用 add_to_short 决策", decision.Symbol)
+				}
 				return fmt.Errorf("❌ %s 已有空仓，拒绝开仓以防止仓位叠加超限。如需换仓，请先给出 close_short 决策", decision.Symbol)
 			}
 		}
 	}
+	if _, pending := at.state.PendingEntries[decision.Symbol+"_short"]; pending {
+		return fmt.Errorf("❌ %s 已有等待成交的开空限价单，如需改价请先给出 close_short 决策撤单", decision.Symbol)
+	}
+
+	if err := at.applyMarginMode(decision.Symbol, decision.MarginMode); err != nil {
+		return err
+	}
+
+	// 限价/post-only入场：挂单后等待成交，成交后再设置止损止盈
+	if decision.EntryType == "limit" || decision.EntryType == "post_only" {
+		return at.placeLimitEntry(decision, "short", actionRecord)
+	}
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.marketDataFetcher(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -646,25 +987,36 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 		return err
 	}
 
-	// 记录订单ID
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
+	// 记录订单ID和实际成交（止损止盈按实际成交数量设置）
+	at.recordOrder(actionRecord, order)
+	if order.FilledQty > 0 {
+		quantity = order.FilledQty
 	}
 
-	log.Printf("  ✓ 开仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
+	log.Printf("  ✓ 开仓成功，订单ID: %d, 数量: %.4f, 成交价: %.4f", order.OrderID, quantity, actionRecord.Price)
 
 	// 记录开仓时间
 	posKey := decision.Symbol + "_short"
-	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+	at.state.PositionOpenTime[posKey] = at.now().UnixMilli()
 
 	// 设置止损止盈
-	if err := at.trader.SetStopLoss(decision.Symbol, "SHORT", quantity, decision.StopLoss); err != nil {
-		log.Printf("  ⚠ 设置止损失败: %v", err)
+	at.attachStops(decision.Symbol, "short", quantity, decision.StopLoss, decision.TakeProfit, decision.TakeProfitLevels)
+
+	return nil
+}
+
+// applyMarginMode 开仓前设置保证金模式（决策未指定时使用交易员配置）
+func (at *AutoTrader) applyMarginMode(symbol, mode string) error {
+	if mode == "" {
+		mode = at.config.MarginMode
 	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "SHORT", quantity, decision.TakeProfit); err != nil {
-		log.Printf("  ⚠ 设置止盈失败: %v", err)
+	if mode == "" {
+		mode = MarginModeIsolated
 	}
-
+	if err := at.trader.SetMarginMode(symbol, mode); err != nil {
+		return fmt.Errorf("设置保证金模式失败: %w", err)
+	}
+	log.Printf("  ⚙️ %s 保证金模式: %s", symbol, mode)
 	return nil
 }
 
@@ -672,8 +1024,17 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  🔄 平多仓: %s", decision.Symbol)
 
+	// 先撤销同方向的待成交限价单；没有持仓时仅撤单即可
+	cancelled, err := at.cancelPendingEntry(decision.Symbol, "long")
+	if err != nil {
+		return err
+	}
+	if cancelled && !at.hasPosition(decision.Symbol, "long") {
+		return nil
+	}
+
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.marketDataFetcher(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -685,10 +1046,12 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 		return err
 	}
 
-	// 记录订单ID
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	// 记录订单ID和实际成交
+	at.recordOrder(actionRecord, order)
+	at.rememberOwnClose(order)
+
+	at.forgetPosition(decision.Symbol, "long")
+	at.recordClose(decision.Symbol)
 
 	log.Printf("  ✓ 平仓成功")
 	return nil
@@ -698,8 +1061,17 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  🔄 平空仓: %s", decision.Symbol)
 
+	// 先撤销同方向的待成交限价单；没有持仓时仅撤单即可
+	cancelled, err := at.cancelPendingEntry(decision.Symbol, "short")
+	if err != nil {
+		return err
+	}
+	if cancelled && !at.hasPosition(decision.Symbol, "short") {
+		return nil
+	}
+
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.marketDataFetcher(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -711,15 +1083,78 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 		return err
 	}
 
-	// 记录订单ID
-	if orderID, ok := order["orderId"].(int64); ok {
-		actionRecord.OrderID = orderID
-	}
+	// 记录订单ID和实际成交
+	at.recordOrder(actionRecord, order)
+	at.rememberOwnClose(order)
+
+	at.forgetPosition(decision.Symbol, "short")
+	at.recordClose(decision.Symbol)
 
 	log.Printf("  ✓ 平仓成功")
 	return nil
 }
 
+// findSinglePosition 查找币种的唯一持仓（未指定方向的动作使用，同时持有多空仓位时无法确定方向）
+func (at *AutoTrader) findSinglePosition(symbol string) (*Position, error) {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓失败: %w", err)
+	}
+	var matched []Position
+	for _, pos := range positions {
+		if pos.Symbol == symbol {
+			matched = append(matched, pos)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%s 没有持仓", symbol)
+	}
+	if len(matched) > 1 {
+		return nil, fmt.Errorf("%s 同时持有多空仓位，无法确定操作方向", symbol)
+	}
+	return &matched[0], nil
+}
+
+// findPosition 查找指定币种和方向的持仓（不存在时返回nil）
+func (at *AutoTrader) findPosition(symbol, side string) (*Position, error) {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓失败: %w", err)
+	}
+	for i := range positions {
+		if positions[i].Symbol == symbol && positions[i].Side == side {
+			return &positions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// hasPosition 判断是否持有指定币种和方向的仓位（查询失败时视为有持仓，交由平仓接口处理）
+func (at *AutoTrader) hasPosition(symbol, side string) bool {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return true
+	}
+	for _, pos := range positions {
+		if pos.Symbol == symbol && pos.Side == side {
+			return true
+		}
+	}
+	return false
+}
+
+// recordOrder 将订单的实际成交记录到决策动作（成交均价未知时保留下单前的市场价）
+func (at *AutoTrader) recordOrder(actionRecord *logger.DecisionAction, order *OrderResult) {
+	actionRecord.OrderID = order.OrderID
+	actionRecord.Fee = order.Fee
+	if order.AvgPrice > 0 {
+		actionRecord.Price = order.AvgPrice
+	}
+	if order.FilledQty > 0 {
+		actionRecord.Quantity = order.FilledQty
+	}
+}
+
 // GetID 获取trader ID
 func (at *AutoTrader) GetID() string {
 	return at.id
@@ -743,8 +1178,19 @@ func (at *AutoTrader) GetDecisionLogger() *logger.DecisionLogger {
 // GetStatus 获取系统状态（用于API）
 func (at *AutoTrader) GetStatus() map[string]interface{} {
 	aiProvider := "DeepSeek"
-	if at.config.UseQwen {
+	switch at.aiModel {
+	case "qwen":
 		aiProvider = "Qwen"
+	case "custom":
+		aiProvider = "Custom"
+	case "anthropic":
+		aiProvider = "Anthropic"
+	case "gemini":
+		aiProvider = "Gemini"
+	case "ollama":
+		aiProvider = "Ollama"
+	case "llamacpp":
+		aiProvider = "llama.cpp"
 	}
 
 	return map[string]interface{}{
@@ -753,13 +1199,14 @@ func (at *AutoTrader) GetStatus() map[string]interface{} {
 		"ai_model":        at.aiModel,
 		"exchange":        at.exchange,
 		"is_running":      at.isRunning,
-		"start_time":      at.startTime.Format(time.RFC3339),
-		"runtime_minutes": int(time.Since(at.startTime).Minutes()),
-		"call_count":      at.callCount,
+		"start_time":      at.state.StartTime.Format(time.RFC3339),
+		"runtime_minutes": int(at.now().Sub(at.state.StartTime).Minutes()),
+		"call_count":      at.state.CallCount,
 		"initial_balance": at.initialBalance,
 		"scan_interval":   at.config.ScanInterval.String(),
-		"stop_until":      at.stopUntil.Format(time.RFC3339),
-		"last_reset_time": at.lastResetTime.Format(time.RFC3339),
+		"stop_until":      at.state.StopUntil.Format(time.RFC3339),
+		"last_reset_time": at.state.DayStart.Format(time.RFC3339),
+		"last_risk_event": at.state.LastRiskEvent,
 		"ai_provider":     aiProvider,
 	}
 }
@@ -772,19 +1219,9 @@ func (at *AutoTrader) GetAccountInfo() (map[string]interface{}, error) {
 	}
 
 	// 获取账户字段
-	totalWalletBalance := 0.0
-	totalUnrealizedProfit := 0.0
-	availableBalance := 0.0
-
-	if wallet, ok := balance["totalWalletBalance"].(float64); ok {
-		totalWalletBalance = wallet
-	}
-	if unrealized, ok := balance["totalUnrealizedProfit"].(float64); ok {
-		totalUnrealizedProfit = unrealized
-	}
-	if avail, ok := balance["availableBalance"].(float64); ok {
-		availableBalance = avail
-	}
+	totalWalletBalance := balance.TotalWalletBalance
+	totalUnrealizedProfit := balance.TotalUnrealizedProfit
+	availableBalance := balance.AvailableBalance
 
 	// Total Equity = 钱包余额 + 未实现盈亏
 	totalEquity := totalWalletBalance + totalUnrealizedProfit
@@ -798,19 +1235,16 @@ func (at *AutoTrader) GetAccountInfo() (map[string]interface{}, error) {
 	totalMarginUsed := 0.0
 	totalUnrealizedPnL := 0.0
 	for _, pos := range positions {
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
-		if quantity < 0 {
-			quantity = -quantity
-		}
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
-		totalUnrealizedPnL += unrealizedPnl
+		totalUnrealizedPnL += pos.UnrealizedPnL
 
 		leverage := 10
-		if lev, ok := pos["leverage"].(float64); ok {
-			leverage = int(lev)
+		if pos.Leverage > 0 {
+			leverage = pos.Leverage
+		}
+		marginUsed := pos.Margin
+		if marginUsed <= 0 {
+			marginUsed = (pos.Quantity * pos.MarkPrice) / float64(leverage)
 		}
-		marginUsed := (quantity * markPrice) / float64(leverage)
 		totalMarginUsed += marginUsed
 	}
 
@@ -833,11 +1267,12 @@ func (at *AutoTrader) GetAccountInfo() (map[string]interface{}, error) {
 		"available_balance": availableBalance,      // 可用余额
 
 		// 盈亏统计
-		"total_pnl":            totalPnL,           // 总盈亏 = equity - initial
-		"total_pnl_pct":        totalPnLPct,        // 总盈亏百分比
-		"total_unrealized_pnl": totalUnrealizedPnL, // 未实现盈亏（从持仓计算）
-		"initial_balance":      at.initialBalance,  // 初始余额
-		"daily_pnl":            at.dailyPnL,        // 日盈亏
+		"total_pnl":            totalPnL,            // 总盈亏 = equity - initial
+		"total_pnl_pct":        totalPnLPct,         // 总盈亏百分比
+		"total_unrealized_pnl": totalUnrealizedPnL,  // 未实现盈亏（从持仓计算）
+		"initial_balance":      at.initialBalance,   // 初始余额
+		"daily_pnl":            at.state.DailyPnL,   // 日盈亏
+		"peak_equity":          at.state.PeakEquity, // 最高净值（回撤基准）
 
 		// 持仓信息
 		"position_count":  len(positions),  // 持仓数量
@@ -855,20 +1290,17 @@ func (at *AutoTrader) GetPositions() ([]map[string]interface{}, error) {
 
 	var result []map[string]interface{}
 	for _, pos := range positions {
-		symbol := pos["symbol"].(string)
-		side := pos["side"].(string)
-		entryPrice := pos["entryPrice"].(float64)
-		markPrice := pos["markPrice"].(float64)
-		quantity := pos["positionAmt"].(float64)
-		if quantity < 0 {
-			quantity = -quantity
-		}
-		unrealizedPnl := pos["unRealizedProfit"].(float64)
-		liquidationPrice := pos["liquidationPrice"].(float64)
+		symbol := pos.Symbol
+		side := pos.Side
+		entryPrice := pos.EntryPrice
+		markPrice := pos.MarkPrice
+		quantity := pos.Quantity
+		unrealizedPnl := pos.UnrealizedPnL
+		liquidationPrice := pos.LiquidationPrice
 
 		leverage := 10
-		if lev, ok := pos["leverage"].(float64); ok {
-			leverage = int(lev)
+		if pos.Leverage > 0 {
+			leverage = pos.Leverage
 		}
 
 		pnlPct := 0.0
@@ -878,7 +1310,10 @@ func (at *AutoTrader) GetPositions() ([]map[string]interface{}, error) {
 			pnlPct = ((entryPrice - markPrice) / entryPrice) * float64(leverage) * 100
 		}
 
-		marginUsed := (quantity * markPrice) / float64(leverage)
+		marginUsed := pos.Margin
+		if marginUsed <= 0 {
+			marginUsed = (quantity * markPrice) / float64(leverage)
+		}
 
 		result = append(result, map[string]interface{}{
 			"symbol":             symbol,
@@ -891,6 +1326,7 @@ func (at *AutoTrader) GetPositions() ([]map[string]interface{}, error) {
 			"unrealized_pnl_pct": pnlPct,
 			"liquidation_price":  liquidationPrice,
 			"margin_used":        marginUsed,
+			"margin_mode":        pos.MarginMode,
 		})
 	}
 
@@ -907,12 +1343,14 @@ func sortDecisionsByPriority(decisions []decision.Decision) []decision.Decision
 	// 定义优先级
 	getActionPriority := func(action string) int {
 		switch action {
-		case "close_long", "close_short":
+		case "close_long", "close_short", "partial_close":
 			return 1 // 最高优先级：先平仓
-		case "open_long", "open_short":
-			return 2 // 次优先级：后开仓
+		case "update_stop":
+			return 2 // 调整现有持仓的止损
+		case "open_long", "open_short", "add_to_long", "add_to_short":
+			return 3 // 再开仓
 		case "hold", "wait":
-			return 3 // 最低优先级：观望
+			return 4 // 最低优先级：观望
 		default:
 			return 999 // 未知动作放最后
 		}
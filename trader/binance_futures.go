@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math"
+	"nofx/instrument"
 	"strconv"
 	"sync"
 	"time"
@@ -16,30 +18,38 @@ type FuturesTrader struct {
 	client *futures.Client
 
 	// 余额缓存
-	cachedBalance     map[string]interface{}
+	cachedBalance     *Balance
 	balanceCacheTime  time.Time
 	balanceCacheMutex sync.RWMutex
 
 	// 持仓缓存
-	cachedPositions     []map[string]interface{}
+	cachedPositions     []Position
 	positionsCacheTime  time.Time
 	positionsCacheMutex sync.RWMutex
 
 	// 缓存有效期（15秒）
 	cacheDuration time.Duration
+
+	// 合约元数据（精度、最小下单金额、最大杠杆）
+	instruments *instrument.Registry
+
+	// 各币种开仓使用的保证金模式
+	marginModes marginModeSettings
 }
 
 // NewFuturesTrader 创建合约交易器
 func NewFuturesTrader(apiKey, secretKey string) *FuturesTrader {
 	client := futures.NewClient(apiKey, secretKey)
-	return &FuturesTrader{
+	t := &FuturesTrader{
 		client:        client,
 		cacheDuration: 15 * time.Second, // 15秒缓存
 	}
+	t.instruments = instrument.NewRegistry("binance", t.loadInstruments)
+	return t
 }
 
 // GetBalance 获取账户余额（带缓存）
-func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
+func (t *FuturesTrader) GetBalance() (*Balance, error) {
 	// 先检查缓存是否有效
 	t.balanceCacheMutex.RLock()
 	if t.cachedBalance != nil && time.Since(t.balanceCacheTime) < t.cacheDuration {
@@ -58,10 +68,10 @@ func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
 		return nil, fmt.Errorf("获取账户信息失败: %w", err)
 	}
 
-	result := make(map[string]interface{})
-	result["totalWalletBalance"], _ = strconv.ParseFloat(account.TotalWalletBalance, 64)
-	result["availableBalance"], _ = strconv.ParseFloat(account.AvailableBalance, 64)
-	result["totalUnrealizedProfit"], _ = strconv.ParseFloat(account.TotalUnrealizedProfit, 64)
+	result := &Balance{}
+	result.TotalWalletBalance, _ = strconv.ParseFloat(account.TotalWalletBalance, 64)
+	result.AvailableBalance, _ = strconv.ParseFloat(account.AvailableBalance, 64)
+	result.TotalUnrealizedProfit, _ = strconv.ParseFloat(account.TotalUnrealizedProfit, 64)
 
 	log.Printf("✓ 币安API返回: 总余额=%s, 可用=%s, 未实现盈亏=%s",
 		account.TotalWalletBalance,
@@ -78,7 +88,7 @@ func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
 }
 
 // GetPositions 获取所有持仓（带缓存）
-func (t *FuturesTrader) GetPositions() ([]map[string]interface{}, error) {
+func (t *FuturesTrader) GetPositions() ([]Position, error) {
 	// 先检查缓存是否有效
 	t.positionsCacheMutex.RLock()
 	if t.cachedPositions != nil && time.Since(t.positionsCacheTime) < t.cacheDuration {
@@ -96,30 +106,39 @@ func (t *FuturesTrader) GetPositions() ([]map[string]interface{}, error) {
 		return nil, fmt.Errorf("获取持仓失败: %w", err)
 	}
 
-	var result []map[string]interface{}
+	var result []Position
 	for _, pos := range positions {
 		posAmt, _ := strconv.ParseFloat(pos.PositionAmt, 64)
 		if posAmt == 0 {
 			continue // 跳过无持仓的
 		}
 
-		posMap := make(map[string]interface{})
-		posMap["symbol"] = pos.Symbol
-		posMap["positionAmt"], _ = strconv.ParseFloat(pos.PositionAmt, 64)
-		posMap["entryPrice"], _ = strconv.ParseFloat(pos.EntryPrice, 64)
-		posMap["markPrice"], _ = strconv.ParseFloat(pos.MarkPrice, 64)
-		posMap["unRealizedProfit"], _ = strconv.ParseFloat(pos.UnRealizedProfit, 64)
-		posMap["leverage"], _ = strconv.ParseFloat(pos.Leverage, 64)
-		posMap["liquidationPrice"], _ = strconv.ParseFloat(pos.LiquidationPrice, 64)
+		p := Position{Symbol: pos.Symbol, Quantity: posAmt}
+		p.EntryPrice, _ = strconv.ParseFloat(pos.EntryPrice, 64)
+		p.MarkPrice, _ = strconv.ParseFloat(pos.MarkPrice, 64)
+		p.UnrealizedPnL, _ = strconv.ParseFloat(pos.UnRealizedProfit, 64)
+		p.LiquidationPrice, _ = strconv.ParseFloat(pos.LiquidationPrice, 64)
+		p.Leverage, _ = strconv.Atoi(pos.Leverage)
+		if pos.MarginType == string(futures.MarginTypeCrossed) || pos.MarginType == "cross" {
+			// 全仓没有独立的仓位保证金，按名义价值/杠杆计算初始保证金
+			p.MarginMode = MarginModeCross
+			if notional, _ := strconv.ParseFloat(pos.Notional, 64); p.Leverage > 0 {
+				p.Margin = math.Abs(notional) / float64(p.Leverage)
+			}
+		} else {
+			p.MarginMode = MarginModeIsolated
+			p.Margin, _ = strconv.ParseFloat(pos.IsolatedWallet, 64)
+		}
 
-		// 判断方向
+		// 判断方向（数量统一转为正数）
 		if posAmt > 0 {
-			posMap["side"] = "long"
+			p.Side = "long"
 		} else {
-			posMap["side"] = "short"
+			p.Side = "short"
+			p.Quantity = -posAmt
 		}
 
-		result = append(result, posMap)
+		result = append(result, p)
 	}
 
 	// 更新缓存
@@ -138,11 +157,9 @@ func (t *FuturesTrader) SetLeverage(symbol string, leverage int) error {
 	positions, err := t.GetPositions()
 	if err == nil {
 		for _, pos := range positions {
-			if pos["symbol"] == symbol {
-				if lev, ok := pos["leverage"].(float64); ok {
-					currentLeverage = int(lev)
-					break
-				}
+			if pos.Symbol == symbol {
+				currentLeverage = pos.Leverage
+				break
 			}
 		}
 	}
@@ -177,6 +194,28 @@ func (t *FuturesTrader) SetLeverage(symbol string, leverage int) error {
 	return nil
 }
 
+// SetMarginMode 设置该币种后续开仓使用的保证金模式
+func (t *FuturesTrader) SetMarginMode(symbol string, mode string) error {
+	return t.marginModes.set(symbol, mode)
+}
+
+// applyMarginType 将币种切换为设置的保证金模式（与上次生效的模式相同时不调用交易所接口）
+func (t *FuturesTrader) applyMarginType(symbol string) error {
+	mode, ok := t.marginModes.needsApply(symbol)
+	if !ok {
+		return nil
+	}
+	marginType := futures.MarginTypeIsolated
+	if mode == MarginModeCross {
+		marginType = futures.MarginTypeCrossed
+	}
+	if err := t.SetMarginType(symbol, marginType); err != nil {
+		return err
+	}
+	t.marginModes.markApplied(symbol, mode)
+	return nil
+}
+
 // SetMarginType 设置保证金模式
 func (t *FuturesTrader) SetMarginType(symbol string, marginType futures.MarginType) error {
 	err := t.client.NewChangeMarginTypeService().
@@ -203,65 +242,37 @@ func (t *FuturesTrader) SetMarginType(symbol string, marginType futures.MarginTy
 }
 
 // OpenLong 开多仓
-func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 先取消该币种的所有委托单（清理旧的止损止盈单）
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
 	}
-
-	// 设置杠杆
-	if err := t.SetLeverage(symbol, leverage); err != nil {
-		return nil, err
-	}
-
-	// 设置逐仓模式
-	if err := t.SetMarginType(symbol, futures.MarginTypeIsolated); err != nil {
-		return nil, err
-	}
-
-	// 格式化数量到正确精度
-	quantityStr, err := t.FormatQuantity(symbol, quantity)
-	if err != nil {
-		return nil, err
-	}
-
-	// 创建市价买入订单
-	order, err := t.client.NewCreateOrderService().
-		Symbol(symbol).
-		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeLong).
-		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		Do(context.Background())
-
-	if err != nil {
-		return nil, fmt.Errorf("开多仓失败: %w", err)
-	}
-
-	log.Printf("✓ 开多仓成功: %s 数量: %s", symbol, quantityStr)
-	log.Printf("  订单ID: %d", order.OrderID)
-
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
-	return result, nil
+	return t.open(symbol, "long", quantity, leverage)
 }
 
 // OpenShort 开空仓
-func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 先取消该币种的所有委托单（清理旧的止损止盈单）
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
 	}
+	return t.open(symbol, "short", quantity, leverage)
+}
+
+// AddToPosition 市价加仓（保留该币种已有的止损止盈单和挂单）
+func (t *FuturesTrader) AddToPosition(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.open(symbol, side, quantity, leverage)
+}
 
+// open 市价开仓（多空通用，不撤销已有委托单）
+func (t *FuturesTrader) open(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
 	// 设置杠杆
 	if err := t.SetLeverage(symbol, leverage); err != nil {
 		return nil, err
 	}
 
-	// 设置逐仓模式
-	if err := t.SetMarginType(symbol, futures.MarginTypeIsolated); err != nil {
+	// 设置保证金模式
+	if err := t.applyMarginType(symbol); err != nil {
 		return nil, err
 	}
 
@@ -271,41 +282,43 @@ func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int)
 		return nil, err
 	}
 
-	// 创建市价卖出订单
+	// 创建市价订单（开多买入，开空卖出）
+	orderSide, positionSide := futures.SideTypeBuy, futures.PositionSideTypeLong
+	if side == "short" {
+		orderSide, positionSide = futures.SideTypeSell, futures.PositionSideTypeShort
+	}
 	order, err := t.client.NewCreateOrderService().
 		Symbol(symbol).
-		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeShort).
+		Side(orderSide).
+		PositionSide(positionSide).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
+		NewOrderResponseType(futures.NewOrderRespTypeRESULT). // 返回成交均价和成交数量
 		Do(context.Background())
 
 	if err != nil {
-		return nil, fmt.Errorf("开空仓失败: %w", err)
+		return nil, fmt.Errorf("开%s仓失败: %w", sideLabel(side), err)
 	}
 
-	log.Printf("✓ 开空仓成功: %s 数量: %s", symbol, quantityStr)
-	log.Printf("  订单ID: %d", order.OrderID)
+	log.Printf("✓ 开%s仓成功: %s 数量: %s", sideLabel(side), symbol, quantityStr)
+	log.Printf("  订单ID: %d, 成交均价: %s", order.OrderID, order.AvgPrice)
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
-	return result, nil
+	return t.buildOrderResult(order, leverage), nil
 }
 
 // CloseLong 平多仓
-func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
-	if quantity == 0 {
+	closeAll := quantity == 0
+	if closeAll {
 		positions, err := t.GetPositions()
 		if err != nil {
 			return nil, err
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "long" {
-				quantity = pos["positionAmt"].(float64)
+			if pos.Symbol == symbol && pos.Side == "long" {
+				quantity = pos.Quantity
 				break
 			}
 		}
@@ -328,6 +341,7 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 		PositionSide(futures.PositionSideTypeLong).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
+		NewOrderResponseType(futures.NewOrderRespTypeRESULT). // 返回成交均价和成交数量
 		Do(context.Background())
 
 	if err != nil {
@@ -336,30 +350,29 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 
 	log.Printf("✓ 平多仓成功: %s 数量: %s", symbol, quantityStr)
 
-	// 平仓后取消该币种的所有挂单（止损止盈单）
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	// 全部平仓后取消该币种的所有挂单（部分平仓时保留止损止盈单）
+	if closeAll {
+		if err := t.CancelAllOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消挂单失败: %v", err)
+		}
 	}
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
-	return result, nil
+	return t.buildOrderResult(order, 0), nil
 }
 
 // CloseShort 平空仓
-func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
-	if quantity == 0 {
+	closeAll := quantity == 0
+	if closeAll {
 		positions, err := t.GetPositions()
 		if err != nil {
 			return nil, err
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "short" {
-				quantity = -pos["positionAmt"].(float64) // 空仓数量是负的，取绝对值
+			if pos.Symbol == symbol && pos.Side == "short" {
+				quantity = pos.Quantity
 				break
 			}
 		}
@@ -382,6 +395,7 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 		PositionSide(futures.PositionSideTypeShort).
 		Type(futures.OrderTypeMarket).
 		Quantity(quantityStr).
+		NewOrderResponseType(futures.NewOrderRespTypeRESULT). // 返回成交均价和成交数量
 		Do(context.Background())
 
 	if err != nil {
@@ -390,18 +404,216 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 
 	log.Printf("✓ 平空仓成功: %s 数量: %s", symbol, quantityStr)
 
-	// 平仓后取消该币种的所有挂单（止损止盈单）
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	// 全部平仓后取消该币种的所有挂单（部分平仓时保留止损止盈单）
+	if closeAll {
+		if err := t.CancelAllOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消挂单失败: %v", err)
+		}
+	}
+
+	return t.buildOrderResult(order, 0), nil
+}
+
+// PlaceLimitOrder 挂限价开仓单（post-only使用GTX，会立即成交时交易所返回EXPIRED状态）
+func (t *FuturesTrader) PlaceLimitOrder(symbol, side string, quantity, price float64, leverage int, postOnly bool) (*OrderResult, error) {
+	// 设置杠杆
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	// 设置保证金模式
+	if err := t.applyMarginType(symbol); err != nil {
+		return nil, err
+	}
+
+	// 格式化数量和价格到正确精度
+	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	if err != nil {
+		return nil, err
+	}
+	priceStr, err := t.formatPrice(symbol, price)
+	if err != nil {
+		return nil, err
+	}
+
+	orderSide := futures.SideTypeBuy
+	posSide := futures.PositionSideTypeLong
+	if side == "short" {
+		orderSide = futures.SideTypeSell
+		posSide = futures.PositionSideTypeShort
+	}
+	timeInForce := futures.TimeInForceTypeGTC
+	if postOnly {
+		timeInForce = futures.TimeInForceTypeGTX
 	}
 
-	result := make(map[string]interface{})
-	result["orderId"] = order.OrderID
-	result["symbol"] = order.Symbol
-	result["status"] = order.Status
+	order, err := t.client.NewCreateOrderService().
+		Symbol(symbol).
+		Side(orderSide).
+		PositionSide(posSide).
+		Type(futures.OrderTypeLimit).
+		TimeInForce(timeInForce).
+		Price(priceStr).
+		Quantity(quantityStr).
+		NewOrderResponseType(futures.NewOrderRespTypeRESULT).
+		Do(context.Background())
+
+	if err != nil {
+		return nil, fmt.Errorf("挂限价单失败: %w", err)
+	}
+
+	log.Printf("✓ 限价单已提交: %s %s 价格: %s 数量: %s 状态: %s", symbol, side, priceStr, quantityStr, order.Status)
+
+	// 未成交的挂单无需查询成交明细
+	if order.Status == futures.OrderStatusTypeNew || order.Status == futures.OrderStatusTypeExpired {
+		return &OrderResult{
+			OrderID:  order.OrderID,
+			Symbol:   order.Symbol,
+			Status:   string(order.Status),
+			Leverage: leverage,
+		}, nil
+	}
+	return t.buildOrderResult(order, leverage), nil
+}
+
+// GetOpenOrders 获取未成交挂单（symbol为空表示所有币种）
+func (t *FuturesTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	service := t.client.NewListOpenOrdersService()
+	if symbol != "" {
+		service = service.Symbol(symbol)
+	}
+	orders, err := service.Do(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("获取挂单失败: %w", err)
+	}
+
+	var result []Order
+	for _, o := range orders {
+		order := Order{
+			OrderID:      o.OrderID,
+			Symbol:       o.Symbol,
+			Side:         string(o.Side),
+			PositionSide: string(o.PositionSide),
+			Type:         string(o.Type),
+			ReduceOnly:   o.ReduceOnly || o.ClosePosition,
+			Time:         o.Time,
+		}
+		order.Price, _ = strconv.ParseFloat(o.Price, 64)
+		order.StopPrice, _ = strconv.ParseFloat(o.StopPrice, 64)
+		order.Quantity, _ = strconv.ParseFloat(o.OrigQuantity, 64)
+		order.FilledQty, _ = strconv.ParseFloat(o.ExecutedQuantity, 64)
+		result = append(result, order)
+	}
 	return result, nil
 }
 
+// CancelOrder 撤销指定挂单
+func (t *FuturesTrader) CancelOrder(symbol string, orderID int64) error {
+	_, err := t.client.NewCancelOrderService().
+		Symbol(symbol).
+		OrderID(orderID).
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("撤销订单失败: %w", err)
+	}
+
+	log.Printf("  ✓ 已撤销 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
+// buildOrderResult 将下单响应转换为OrderResult，并查询逐笔成交补充手续费
+// 成交明细查询失败时仍返回下单响应中的成交均价和数量
+func (t *FuturesTrader) buildOrderResult(order *futures.CreateOrderResponse, leverage int) *OrderResult {
+	result := &OrderResult{
+		OrderID:  order.OrderID,
+		Symbol:   order.Symbol,
+		Status:   string(order.Status),
+		Leverage: leverage,
+	}
+	result.AvgPrice, _ = strconv.ParseFloat(order.AvgPrice, 64)
+	result.FilledQty, _ = strconv.ParseFloat(order.ExecutedQuantity, 64)
+
+	trades, err := t.client.NewListAccountTradeService().
+		Symbol(order.Symbol).
+		OrderID(order.OrderID).
+		Do(context.Background())
+	if err != nil {
+		log.Printf("  ⚠ 查询成交明细失败（手续费未记录）: %v", err)
+		return result
+	}
+
+	for _, trade := range trades {
+		fill := Fill{
+			OrderID:  trade.OrderID,
+			Symbol:   trade.Symbol,
+			Side:     string(trade.Side),
+			FeeAsset: trade.CommissionAsset,
+			Time:     trade.Time,
+		}
+		fill.Price, _ = strconv.ParseFloat(trade.Price, 64)
+		fill.Quantity, _ = strconv.ParseFloat(trade.Quantity, 64)
+		fill.Fee, _ = strconv.ParseFloat(trade.Commission, 64)
+		fill.RealizedPnL, _ = strconv.ParseFloat(trade.RealizedPnl, 64)
+		result.Fills = append(result.Fills, fill)
+	}
+	result.summarizeFills()
+
+	log.Printf("  💵 成交: 均价 %.4f, 数量 %.4f, 手续费 %.4f", result.AvgPrice, result.FilledQty, result.Fee)
+	return result
+}
+
+// GetFills 获取指定时间之后的成交记录
+func (t *FuturesTrader) GetFills(symbol string, startTime int64) ([]Fill, error) {
+	trades, err := t.client.NewListAccountTradeService().Symbol(symbol).StartTime(startTime).Limit(1000).Do(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("获取成交记录失败: %w", err)
+	}
+
+	fills := make([]Fill, 0, len(trades))
+	for _, trade := range trades {
+		fill := Fill{
+			OrderID:  trade.OrderID,
+			Symbol:   trade.Symbol,
+			Side:     string(trade.Side),
+			FeeAsset: trade.CommissionAsset,
+			Time:     trade.Time,
+		}
+		if trade.PositionSide == futures.PositionSideTypeLong || trade.PositionSide == futures.PositionSideTypeShort {
+			fill.PositionSide = string(trade.PositionSide)
+		}
+		fill.Price, _ = strconv.ParseFloat(trade.Price, 64)
+		fill.Quantity, _ = strconv.ParseFloat(trade.Quantity, 64)
+		fill.Fee, _ = strconv.ParseFloat(trade.Commission, 64)
+		fill.RealizedPnL, _ = strconv.ParseFloat(trade.RealizedPnl, 64)
+		fills = append(fills, fill)
+	}
+	return fills, nil
+}
+
+// GetIncomeHistory 获取指定时间之后的手续费和资金费流水
+func (t *FuturesTrader) GetIncomeHistory(symbol string, startTime int64) ([]Income, error) {
+	records, err := t.client.NewGetIncomeHistoryService().Symbol(symbol).StartTime(startTime).Limit(1000).Do(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("获取资金流水失败: %w", err)
+	}
+
+	var incomes []Income
+	for _, r := range records {
+		if r.IncomeType != IncomeCommission && r.IncomeType != IncomeFunding {
+			continue
+		}
+		amount, _ := strconv.ParseFloat(r.Income, 64)
+		incomes = append(incomes, Income{
+			Symbol: r.Symbol,
+			Type:   r.IncomeType,
+			Amount: amount,
+			Asset:  r.Asset,
+			Time:   r.Time,
+		})
+	}
+	return incomes, nil
+}
+
 // CancelAllOrders 取消该币种的所有挂单
 func (t *FuturesTrader) CancelAllOrders(symbol string) error {
 	err := t.client.NewCancelAllOpenOrdersService().
@@ -519,29 +731,121 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 	return nil
 }
 
-// GetSymbolPrecision 获取交易对的数量精度
-func (t *FuturesTrader) GetSymbolPrecision(symbol string) (int, error) {
+// SetPartialTakeProfit 设置部分止盈单（双向持仓模式下指定positionSide即为只减仓，不能使用closePosition）
+func (t *FuturesTrader) SetPartialTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	var side futures.SideType
+	var posSide futures.PositionSideType
+
+	if positionSide == "LONG" {
+		side = futures.SideTypeSell
+		posSide = futures.PositionSideTypeLong
+	} else {
+		side = futures.SideTypeBuy
+		posSide = futures.PositionSideTypeShort
+	}
+
+	quantityStr, err := t.FormatQuantity(symbol, quantity)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.client.NewCreateOrderService().
+		Symbol(symbol).
+		Side(side).
+		PositionSide(posSide).
+		Type(futures.OrderTypeTakeProfitMarket).
+		StopPrice(fmt.Sprintf("%.8f", takeProfitPrice)).
+		Quantity(quantityStr).
+		WorkingType(futures.WorkingTypeContractPrice).
+		Do(context.Background())
+
+	if err != nil {
+		return fmt.Errorf("设置部分止盈失败: %w", err)
+	}
+
+	log.Printf("  部分止盈设置: %.4f 数量: %s", takeProfitPrice, quantityStr)
+	return nil
+}
+
+// loadInstruments 从exchangeInfo加载全部合约元数据（最大杠杆取杠杆分层的第一档）
+func (t *FuturesTrader) loadInstruments() ([]instrument.Instrument, error) {
 	exchangeInfo, err := t.client.NewExchangeInfoService().Do(context.Background())
 	if err != nil {
-		return 0, fmt.Errorf("获取交易规则失败: %w", err)
+		return nil, fmt.Errorf("获取交易规则失败: %w", err)
 	}
 
+	maxLeverage := make(map[string]int)
+	brackets, err := t.client.NewGetLeverageBracketService().Do(context.Background())
+	if err != nil {
+		log.Printf("  ⚠ 获取杠杆分层失败（最大杠杆未知）: %v", err)
+	}
+	for _, b := range brackets {
+		if len(b.Brackets) > 0 {
+			maxLeverage[b.Symbol] = b.Brackets[0].InitialLeverage
+		}
+	}
+
+	var list []instrument.Instrument
 	for _, s := range exchangeInfo.Symbols {
-		if s.Symbol == symbol {
-			// 从LOT_SIZE filter获取精度
-			for _, filter := range s.Filters {
-				if filter["filterType"] == "LOT_SIZE" {
-					stepSize := filter["stepSize"].(string)
-					precision := calculatePrecision(stepSize)
-					log.Printf("  %s 数量精度: %d (stepSize: %s)", symbol, precision, stepSize)
-					return precision, nil
-				}
+		if s.ContractType != futures.ContractTypePerpetual || s.QuoteAsset != "USDT" {
+			continue
+		}
+		inst := instrument.Instrument{
+			Symbol:      s.Symbol,
+			VenueSymbol: s.Symbol,
+			MaxLeverage: maxLeverage[s.Symbol],
+			Status:      instrument.StatusSuspended,
+		}
+		switch s.Status {
+		case "TRADING":
+			inst.Status = instrument.StatusTrading
+		case "DELIVERING", "DELIVERED", "SETTLING", "CLOSE":
+			inst.Status = instrument.StatusDelisted
+		}
+		for _, filter := range s.Filters {
+			switch filter["filterType"] {
+			case "PRICE_FILTER":
+				inst.TickSize = parseFilterFloat(filter, "tickSize")
+			case "LOT_SIZE":
+				inst.StepSize = parseFilterFloat(filter, "stepSize")
+				inst.MinQty = parseFilterFloat(filter, "minQty")
+			case "MIN_NOTIONAL":
+				inst.MinNotional = parseFilterFloat(filter, "notional")
 			}
 		}
+		list = append(list, inst)
+	}
+	return list, nil
+}
+
+// parseFilterFloat 解析exchangeInfo filter中的数值字段
+func parseFilterFloat(filter map[string]interface{}, key string) float64 {
+	str, _ := filter[key].(string)
+	value, _ := strconv.ParseFloat(str, 64)
+	return value
+}
+
+// GetInstrument 获取交易对元数据
+func (t *FuturesTrader) GetInstrument(symbol string) (*instrument.Instrument, error) {
+	return t.instruments.Get(symbol)
+}
+
+// GetSymbolPrecision 获取交易对的数量精度
+func (t *FuturesTrader) GetSymbolPrecision(symbol string) (int, error) {
+	inst, err := t.instruments.Get(symbol)
+	if err != nil {
+		return 0, err
 	}
+	return inst.QuantityPrecision(), nil
+}
 
-	log.Printf("  ⚠ %s 未找到精度信息，使用默认精度3", symbol)
-	return 3, nil // 默认精度为3
+// formatPrice 按PRICE_FILTER的tickSize格式化价格（限价单价格必须是tickSize的整数倍）
+func (t *FuturesTrader) formatPrice(symbol string, price float64) (string, error) {
+	inst, err := t.instruments.Get(symbol)
+	if err != nil {
+		return "", err
+	}
+	return inst.FormatPrice(price), nil
 }
 
 // calculatePrecision 从stepSize计算精度
@@ -589,14 +893,13 @@ func trimTrailingZeros(s string) string {
 
 // FormatQuantity 格式化数量到正确的精度
 func (t *FuturesTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
-	precision, err := t.GetSymbolPrecision(symbol)
+	inst, err := t.instruments.Get(symbol)
 	if err != nil {
 		// 如果获取失败，使用默认格式
+		log.Printf("  ⚠ %v，使用默认精度3", err)
 		return fmt.Sprintf("%.3f", quantity), nil
 	}
-
-	format := fmt.Sprintf("%%.%df", precision)
-	return fmt.Sprintf(format, quantity), nil
+	return inst.FormatQuantity(quantity), nil
 }
 
 // 辅助函数
@@ -0,0 +1,1109 @@
+package trader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"nofx/instrument"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bybitRecvWindow 请求有效时间窗口（毫秒）
+const bybitRecvWindow = "5000"
+
+// BybitTrader Bybit USDT永续合约交易器（统一交易账户）
+type BybitTrader struct {
+	apiKey    string
+	secretKey string
+	client    *http.Client
+	baseURL   string
+	nowFunc   func() time.Time // 签名时间戳使用的时钟
+
+	// 缓存合约规格、持仓模式和订单ID映射
+	instruments *instrument.Registry
+	hedgeMode   map[string]bool         // 币种是否为双向持仓模式
+	orders      map[int64]bybitOrderRef // 未完结订单：数字订单ID -> Bybit订单（Bybit订单ID为UUID字符串，成交或撤销后移除）
+	mu          sync.RWMutex
+
+	// 交易员设置的保证金模式（统一账户为账户级别设置，所有币种相同，开仓前切换账户）
+	marginMode string
+}
+
+// bybitOrderRef Bybit订单引用
+type bybitOrderRef struct {
+	OrderID       string
+	Symbol        string
+	StopOrderType string // 持仓止损止盈为 StopLoss / TakeProfit（撤单需通过trading-stop接口）
+	PositionIdx   int
+}
+
+// NewBybitTrader 创建Bybit交易器
+// testnet: 使用测试网（需使用测试网API Key）
+func NewBybitTrader(apiKey, secretKey string, testnet bool) *BybitTrader {
+	baseURL := "https://api.bybit.com"
+	if testnet {
+		baseURL = "https://api-testnet.bybit.com"
+	}
+	t := &BybitTrader{
+		apiKey:     apiKey,
+		secretKey:  secretKey,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		baseURL:    baseURL,
+		nowFunc:    time.Now,
+		hedgeMode:  make(map[string]bool),
+		orders:     make(map[int64]bybitOrderRef),
+		marginMode: MarginModeIsolated,
+	}
+	t.instruments = instrument.NewRegistry("bybit", t.loadInstruments)
+	return t
+}
+
+// SetBaseURL 设置API地址（默认 https://api.bybit.com）
+func (t *BybitTrader) SetBaseURL(baseURL string) {
+	t.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetClock 设置签名时间戳使用的时钟
+func (t *BybitTrader) SetClock(nowFunc func() time.Time) {
+	t.nowFunc = nowFunc
+}
+
+// bybitResponse Bybit通用响应
+type bybitResponse struct {
+	RetCode int             `json:"retCode"`
+	RetMsg  string          `json:"retMsg"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// request 发送签名请求，返回result字段
+// 签名: Hex(HMAC-SHA256(secret, timestamp + apiKey + recvWindow + queryString或JSON body))
+func (t *BybitTrader) request(method, path string, params map[string]interface{}) (json.RawMessage, error) {
+	payload := ""
+	fullURL := t.baseURL + path
+	if method == "GET" {
+		query := url.Values{}
+		for k, v := range params {
+			query.Set(k, fmt.Sprintf("%v", v))
+		}
+		payload = query.Encode()
+		if payload != "" {
+			fullURL += "?" + payload
+		}
+	} else {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("序列化请求失败: %w", err)
+		}
+		payload = string(data)
+	}
+
+	timestamp := strconv.FormatInt(t.nowFunc().UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(t.secretKey))
+	mac.Write([]byte(timestamp + t.apiKey + bybitRecvWindow + payload))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	var body io.Reader
+	if method != "GET" {
+		body = strings.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, fullURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-BAPI-API-KEY", t.apiKey)
+	req.Header.Set("X-BAPI-SIGN", signature)
+	req.Header.Set("X-BAPI-TIMESTAMP", timestamp)
+	req.Header.Set("X-BAPI-RECV-WINDOW", bybitRecvWindow)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result bybitResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if result.RetCode != 0 {
+		return nil, &bybitError{Code: result.RetCode, Msg: result.RetMsg}
+	}
+	return result.Result, nil
+}
+
+// bybitError Bybit业务错误
+type bybitError struct {
+	Code int
+	Msg  string
+}
+
+func (e *bybitError) Error() string {
+	return fmt.Sprintf("Bybit错误 %d: %s", e.Code, e.Msg)
+}
+
+// bybitOrderID UUID订单ID转换为数字ID（FNV-64哈希，同一订单在进程重启后得到相同ID）
+func bybitOrderID(orderID string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(orderID))
+	return int64(h.Sum64() & math.MaxInt64)
+}
+
+// rememberOrder 记录未完结订单的映射用于撤单，返回数字订单ID
+func (t *BybitTrader) rememberOrder(ref bybitOrderRef) int64 {
+	id := bybitOrderID(ref.OrderID)
+	t.mu.Lock()
+	t.orders[id] = ref
+	t.mu.Unlock()
+	return id
+}
+
+// forgetOrder 移除已成交或已撤销订单的映射
+func (t *BybitTrader) forgetOrder(orderID int64) {
+	t.mu.Lock()
+	delete(t.orders, orderID)
+	t.mu.Unlock()
+}
+
+// syncOrders 以交易所返回的挂单替换该币种的订单映射（symbol为空表示所有币种），移除已成交或已撤销的订单
+func (t *BybitTrader) syncOrders(symbol string, open map[int64]bybitOrderRef) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, ref := range t.orders {
+		if symbol == "" || ref.Symbol == symbol {
+			delete(t.orders, id)
+		}
+	}
+	for id, ref := range open {
+		t.orders[id] = ref
+	}
+}
+
+// loadInstruments 加载全部USDT永续合约元数据（分页）
+func (t *BybitTrader) loadInstruments() ([]instrument.Instrument, error) {
+	params := map[string]interface{}{"category": "linear", "limit": 1000}
+	var list []instrument.Instrument
+	for {
+		data, err := t.request("GET", "/v5/market/instruments-info", params)
+		if err != nil {
+			return nil, fmt.Errorf("获取合约信息失败: %w", err)
+		}
+		var info struct {
+			List []struct {
+				Symbol         string `json:"symbol"`
+				Status         string `json:"status"`
+				ContractType   string `json:"contractType"`
+				SettleCoin     string `json:"settleCoin"`
+				LeverageFilter struct {
+					MaxLeverage string `json:"maxLeverage"`
+				} `json:"leverageFilter"`
+				PriceFilter struct {
+					TickSize string `json:"tickSize"`
+				} `json:"priceFilter"`
+				LotSizeFilter struct {
+					QtyStep          string `json:"qtyStep"`
+					MinOrderQty      string `json:"minOrderQty"`
+					MinNotionalValue string `json:"minNotionalValue"`
+				} `json:"lotSizeFilter"`
+			} `json:"list"`
+			NextPageCursor string `json:"nextPageCursor"`
+		}
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, fmt.Errorf("解析合约信息失败: %w", err)
+		}
+
+		for _, item := range info.List {
+			if item.ContractType != "LinearPerpetual" || item.SettleCoin != "USDT" {
+				continue
+			}
+			inst := instrument.Instrument{Symbol: item.Symbol, VenueSymbol: item.Symbol, Status: instrument.StatusSuspended}
+			switch item.Status {
+			case "Trading":
+				inst.Status = instrument.StatusTrading
+			case "Closed", "Delivering":
+				inst.Status = instrument.StatusDelisted
+			}
+			inst.TickSize, _ = strconv.ParseFloat(item.PriceFilter.TickSize, 64)
+			inst.StepSize, _ = strconv.ParseFloat(item.LotSizeFilter.QtyStep, 64)
+			inst.MinQty, _ = strconv.ParseFloat(item.LotSizeFilter.MinOrderQty, 64)
+			inst.MinNotional, _ = strconv.ParseFloat(item.LotSizeFilter.MinNotionalValue, 64)
+			maxLeverage, _ := strconv.ParseFloat(item.LeverageFilter.MaxLeverage, 64)
+			inst.MaxLeverage = int(maxLeverage)
+			list = append(list, inst)
+		}
+
+		if info.NextPageCursor == "" || len(info.List) == 0 {
+			break
+		}
+		params["cursor"] = info.NextPageCursor
+	}
+	return list, nil
+}
+
+// GetInstrument 获取交易对元数据
+func (t *BybitTrader) GetInstrument(symbol string) (*instrument.Instrument, error) {
+	return t.instruments.Get(symbol)
+}
+
+// GetSymbolPrecision 获取交易对的数量精度
+func (t *BybitTrader) GetSymbolPrecision(symbol string) (int, error) {
+	inst, err := t.instruments.Get(symbol)
+	if err != nil {
+		return 0, err
+	}
+	return inst.QuantityPrecision(), nil
+}
+
+// formatQty 按数量步进格式化下单数量
+func (t *BybitTrader) formatQty(symbol string, quantity float64) (string, error) {
+	inst, err := t.instruments.Get(symbol)
+	if err != nil {
+		return "", err
+	}
+	if inst.RoundQuantity(quantity) < inst.MinQty {
+		return "", fmt.Errorf("%s 下单数量%.8f小于最小下单量%.8f", symbol, quantity, inst.MinQty)
+	}
+	return inst.FormatQuantity(quantity), nil
+}
+
+// formatPrice 按价格步进格式化价格
+func (t *BybitTrader) formatPrice(symbol string, price float64) (string, error) {
+	inst, err := t.instruments.Get(symbol)
+	if err != nil {
+		return "", err
+	}
+	return inst.FormatPrice(price), nil
+}
+
+// positionIdx 下单使用的持仓索引（单向持仓为0，双向持仓多仓为1、空仓为2）
+// 持仓模式按币种查询持仓列表判断（双向持仓模式返回两条记录）
+func (t *BybitTrader) positionIdx(symbol, side string) (int, error) {
+	t.mu.RLock()
+	hedge, ok := t.hedgeMode[symbol]
+	t.mu.RUnlock()
+
+	if !ok {
+		data, err := t.request("GET", "/v5/position/list", map[string]interface{}{"category": "linear", "symbol": symbol})
+		if err != nil {
+			return 0, fmt.Errorf("获取持仓模式失败: %w", err)
+		}
+		var positions struct {
+			List []struct {
+				PositionIdx int `json:"positionIdx"`
+			} `json:"list"`
+		}
+		if err := json.Unmarshal(data, &positions); err != nil {
+			return 0, fmt.Errorf("解析持仓模式失败: %w", err)
+		}
+		for _, p := range positions.List {
+			if p.PositionIdx != 0 {
+				hedge = true
+			}
+		}
+
+		t.mu.Lock()
+		t.hedgeMode[symbol] = hedge
+		t.mu.Unlock()
+	}
+
+	if !hedge {
+		return 0, nil
+	}
+	if side == "short" {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+// GetBalance 获取账户余额
+func (t *BybitTrader) GetBalance() (*Balance, error) {
+	data, err := t.request("GET", "/v5/account/wallet-balance", map[string]interface{}{"accountType": "UNIFIED"})
+	if err != nil {
+		return nil, fmt.Errorf("获取账户余额失败: %w", err)
+	}
+	var wallet struct {
+		List []struct {
+			TotalAvailableBalance string `json:"totalAvailableBalance"`
+			Coin                  []struct {
+				Coin                string `json:"coin"`
+				WalletBalance       string `json:"walletBalance"`
+				UnrealisedPnl       string `json:"unrealisedPnl"`
+				AvailableToWithdraw string `json:"availableToWithdraw"`
+			} `json:"coin"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(data, &wallet); err != nil {
+		return nil, fmt.Errorf("解析账户余额失败: %w", err)
+	}
+
+	result := &Balance{}
+	for _, account := range wallet.List {
+		for _, c := range account.Coin {
+			if c.Coin != "USDT" {
+				continue
+			}
+			result.TotalWalletBalance, _ = strconv.ParseFloat(c.WalletBalance, 64)
+			result.TotalUnrealizedProfit, _ = strconv.ParseFloat(c.UnrealisedPnl, 64)
+			// 统一账户的可用余额按账户汇总（USD计价），缺失时使用币种可提余额
+			if available, err := strconv.ParseFloat(account.TotalAvailableBalance, 64); err == nil && available > 0 {
+				result.AvailableBalance = available
+			} else {
+				result.AvailableBalance, _ = strconv.ParseFloat(c.AvailableToWithdraw, 64)
+			}
+		}
+	}
+	return result, nil
+}
+
+// GetPositions 获取所有持仓
+func (t *BybitTrader) GetPositions() ([]Position, error) {
+	data, err := t.request("GET", "/v5/position/list", map[string]interface{}{"category": "linear", "settleCoin": "USDT", "limit": 200})
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓失败: %w", err)
+	}
+	var positions struct {
+		List []struct {
+			Symbol        string `json:"symbol"`
+			Side          string `json:"side"` // Buy / Sell / 空字符串（无持仓）
+			Size          string `json:"size"`
+			AvgPrice      string `json:"avgPrice"`
+			MarkPrice     string `json:"markPrice"`
+			UnrealisedPnl string `json:"unrealisedPnl"`
+			Leverage      string `json:"leverage"`
+			LiqPrice      string `json:"liqPrice"`
+			PositionIM    string `json:"positionIM"` // 仓位初始保证金
+			PositionIdx   int    `json:"positionIdx"`
+			CreatedTime   string `json:"createdTime"`
+			UpdatedTime   string `json:"updatedTime"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return nil, fmt.Errorf("解析持仓失败: %w", err)
+	}
+
+	var result []Position
+	for _, pos := range positions.List {
+		size, _ := strconv.ParseFloat(pos.Size, 64)
+		if size == 0 {
+			continue
+		}
+
+		t.mu.Lock()
+		t.hedgeMode[pos.Symbol] = pos.PositionIdx != 0
+		t.mu.Unlock()
+
+		p := Position{Symbol: pos.Symbol, Side: "long", Quantity: size}
+		if pos.Side == "Sell" {
+			p.Side = "short"
+		}
+		p.EntryPrice, _ = strconv.ParseFloat(pos.AvgPrice, 64)
+		p.MarkPrice, _ = strconv.ParseFloat(pos.MarkPrice, 64)
+		p.UnrealizedPnL, _ = strconv.ParseFloat(pos.UnrealisedPnl, 64)
+		p.LiquidationPrice, _ = strconv.ParseFloat(pos.LiqPrice, 64)
+		leverage, _ := strconv.ParseFloat(pos.Leverage, 64)
+		p.Leverage = int(leverage)
+		p.OpenTime, _ = strconv.ParseInt(pos.CreatedTime, 10, 64)
+		p.UpdateTime, _ = strconv.ParseInt(pos.UpdatedTime, 10, 64)
+		p.Margin, _ = strconv.ParseFloat(pos.PositionIM, 64)
+		result = append(result, p)
+	}
+
+	// 统一账户的保证金模式作用于全部持仓，以账户信息为准（进程重启后也能得到实际模式）
+	if len(result) > 0 {
+		mode, err := t.accountMarginMode()
+		if err != nil {
+			return nil, err
+		}
+		for i := range result {
+			result[i].MarginMode = mode
+		}
+	}
+	return result, nil
+}
+
+// placeOrder 下单，返回数字订单ID
+// side: long/short为持仓方向，reduceOnly=true时为平仓（买卖方向取反）
+func (t *BybitTrader) placeOrder(symbol, side, orderType, timeInForce string, quantity, price float64, reduceOnly bool) (int64, error) {
+	positionIdx, err := t.positionIdx(symbol, side)
+	if err != nil {
+		return 0, err
+	}
+	qty, err := t.formatQty(symbol, quantity)
+	if err != nil {
+		return 0, err
+	}
+
+	orderSide := "Buy"
+	if (side == "short") != reduceOnly {
+		orderSide = "Sell"
+	}
+	params := map[string]interface{}{
+		"category":    "linear",
+		"symbol":      symbol,
+		"side":        orderSide,
+		"orderType":   orderType,
+		"qty":         qty,
+		"positionIdx": positionIdx,
+	}
+	if reduceOnly {
+		params["reduceOnly"] = true
+	}
+	if orderType == "Limit" {
+		px, err := t.formatPrice(symbol, price)
+		if err != nil {
+			return 0, err
+		}
+		params["price"] = px
+		params["timeInForce"] = timeInForce
+	}
+
+	data, err := t.request("POST", "/v5/order/create", params)
+	if err != nil {
+		return 0, err
+	}
+	var ack struct {
+		OrderID string `json:"orderId"`
+	}
+	if err := json.Unmarshal(data, &ack); err != nil || ack.OrderID == "" {
+		return 0, fmt.Errorf("解析下单响应失败: %s", string(data))
+	}
+	return t.rememberOrder(bybitOrderRef{OrderID: ack.OrderID, Symbol: symbol, PositionIdx: positionIdx}), nil
+}
+
+// bybitOrderStatus 订单状态转换为统一状态
+func bybitOrderStatus(status string) string {
+	switch status {
+	case "New", "Untriggered", "Created":
+		return "NEW"
+	case "PartiallyFilled":
+		return "PARTIALLY_FILLED"
+	case "Filled":
+		return "FILLED"
+	case "Cancelled", "PartiallyFilledCanceled", "Deactivated":
+		return "CANCELED"
+	case "Rejected":
+		return "REJECTED"
+	}
+	return strings.ToUpper(status)
+}
+
+// buildOrderResult 查询订单状态和成交明细，补充成交均价、成交数量和手续费
+func (t *BybitTrader) buildOrderResult(symbol string, orderID int64, leverage int) (*OrderResult, error) {
+	t.mu.RLock()
+	ref := t.orders[orderID]
+	t.mu.RUnlock()
+
+	result := &OrderResult{OrderID: orderID, Symbol: symbol, Status: "NEW", Leverage: leverage}
+	params := map[string]interface{}{"category": "linear", "symbol": symbol, "orderId": ref.OrderID}
+	data, err := t.request("GET", "/v5/order/realtime", params)
+	if err != nil {
+		log.Printf("  ⚠ 查询订单状态失败: %v", err)
+		return result, nil
+	}
+	var orders struct {
+		List []struct {
+			OrderStatus string `json:"orderStatus"`
+			AvgPrice    string `json:"avgPrice"`
+			CumExecQty  string `json:"cumExecQty"`
+			CumExecFee  string `json:"cumExecFee"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(data, &orders); err != nil || len(orders.List) == 0 {
+		log.Printf("  ⚠ 解析订单状态失败: %s", string(data))
+		return result, nil
+	}
+	result.Status = bybitOrderStatus(orders.List[0].OrderStatus)
+	switch result.Status {
+	case "FILLED", "CANCELED", "REJECTED":
+		t.forgetOrder(orderID)
+	}
+	result.AvgPrice, _ = strconv.ParseFloat(orders.List[0].AvgPrice, 64)
+	result.FilledQty, _ = strconv.ParseFloat(orders.List[0].CumExecQty, 64)
+	result.Fee, _ = strconv.ParseFloat(orders.List[0].CumExecFee, 64)
+	if result.FilledQty == 0 {
+		return result, nil
+	}
+
+	// 逐笔成交明细
+	execData, err := t.request("GET", "/v5/execution/list", params)
+	if err != nil {
+		log.Printf("  ⚠ 查询成交明细失败: %v", err)
+		return result, nil
+	}
+	var executions struct {
+		List []struct {
+			Side        string `json:"side"`
+			ExecPrice   string `json:"execPrice"`
+			ExecQty     string `json:"execQty"`
+			ExecFee     string `json:"execFee"`
+			FeeCurrency string `json:"feeCurrency"`
+			ExecTime    string `json:"execTime"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(execData, &executions); err != nil {
+		log.Printf("  ⚠ 解析成交明细失败: %v", err)
+		return result, nil
+	}
+	for _, e := range executions.List {
+		fill := Fill{
+			OrderID:  orderID,
+			Symbol:   symbol,
+			Side:     strings.ToUpper(e.Side),
+			FeeAsset: e.FeeCurrency,
+		}
+		if fill.FeeAsset == "" {
+			fill.FeeAsset = "USDT"
+		}
+		fill.Price, _ = strconv.ParseFloat(e.ExecPrice, 64)
+		fill.Quantity, _ = strconv.ParseFloat(e.ExecQty, 64)
+		fill.Fee, _ = strconv.ParseFloat(e.ExecFee, 64)
+		fill.Time, _ = strconv.ParseInt(e.ExecTime, 10, 64)
+		result.Fills = append(result.Fills, fill)
+	}
+	result.summarizeFills()
+
+	log.Printf("  💵 成交: 订单ID %d, 均价 %.4f, 数量 %.4f, 手续费 %.4f",
+		result.OrderID, result.AvgPrice, result.FilledQty, result.Fee)
+	return result, nil
+}
+
+// open 市价开仓（多空通用，不撤销已有委托单）
+func (t *BybitTrader) open(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
+	if err := t.applyMarginMode(); err != nil {
+		return nil, err
+	}
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	orderID, err := t.placeOrder(symbol, side, "Market", "", quantity, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("开%s仓失败: %w", sideLabel(side), err)
+	}
+	log.Printf("✓ 开%s仓成功: %s 数量: %.8f 订单ID: %d", sideLabel(side), symbol, quantity, orderID)
+	return t.buildOrderResult(symbol, orderID, leverage)
+}
+
+// close 市价平仓（多空通用，quantity=0表示全部平仓）
+func (t *BybitTrader) close(symbol, side string, quantity float64) (*OrderResult, error) {
+	closeAll := quantity == 0
+	if closeAll {
+		positions, err := t.GetPositions()
+		if err != nil {
+			return nil, err
+		}
+		for _, pos := range positions {
+			if pos.Symbol == symbol && pos.Side == side {
+				quantity = pos.Quantity
+				break
+			}
+		}
+		if quantity == 0 {
+			return nil, fmt.Errorf("没有找到 %s 的%s仓", symbol, sideLabel(side))
+		}
+	}
+
+	orderID, err := t.placeOrder(symbol, side, "Market", "", quantity, 0, true)
+	if err != nil {
+		return nil, fmt.Errorf("平%s仓失败: %w", sideLabel(side), err)
+	}
+	log.Printf("✓ 平%s仓成功: %s 数量: %.8f", sideLabel(side), symbol, quantity)
+
+	// 全部平仓后取消该币种的所有挂单（部分平仓时保留止损止盈单）
+	if closeAll {
+		if err := t.CancelAllOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消挂单失败: %v", err)
+		}
+	}
+	return t.buildOrderResult(symbol, orderID, 0)
+}
+
+// OpenLong 开多仓
+func (t *BybitTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	// 先取消该币种的所有委托单（清理旧的止损止盈单）
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
+	}
+	return t.open(symbol, "long", quantity, leverage)
+}
+
+// OpenShort 开空仓
+func (t *BybitTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	// 先取消该币种的所有委托单（清理旧的止损止盈单）
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
+	}
+	return t.open(symbol, "short", quantity, leverage)
+}
+
+// AddToPosition 市价加仓（保留该币种已有的止损止盈单和挂单）
+func (t *BybitTrader) AddToPosition(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.open(symbol, side, quantity, leverage)
+}
+
+// CloseLong 平多仓（quantity=0表示全部平仓）
+func (t *BybitTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
+	return t.close(symbol, "long", quantity)
+}
+
+// CloseShort 平空仓（quantity=0表示全部平仓）
+func (t *BybitTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
+	return t.close(symbol, "short", quantity)
+}
+
+// PlaceLimitOrder 挂限价开仓单（postOnly使用PostOnly有效方式，会立即成交时被交易所撤销）
+func (t *BybitTrader) PlaceLimitOrder(symbol, side string, quantity, price float64, leverage int, postOnly bool) (*OrderResult, error) {
+	if err := t.applyMarginMode(); err != nil {
+		return nil, err
+	}
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	timeInForce := "GTC"
+	if postOnly {
+		timeInForce = "PostOnly"
+	}
+	orderID, err := t.placeOrder(symbol, side, "Limit", timeInForce, quantity, price, false)
+	if err != nil {
+		return nil, fmt.Errorf("挂限价单失败: %w", err)
+	}
+
+	result, err := t.buildOrderResult(symbol, orderID, leverage)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✓ 限价单已提交: %s %s 价格: %.4f 数量: %.8f 状态: %s", symbol, side, price, quantity, result.Status)
+	return result, nil
+}
+
+// GetOpenOrders 获取未成交挂单（含止损止盈单，symbol为空表示所有币种）
+func (t *BybitTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	params := map[string]interface{}{"category": "linear", "limit": 50}
+	if symbol != "" {
+		params["symbol"] = symbol
+	} else {
+		params["settleCoin"] = "USDT"
+	}
+
+	var result []Order
+	open := make(map[int64]bybitOrderRef)
+	for {
+		data, err := t.request("GET", "/v5/order/realtime", params)
+		if err != nil {
+			return nil, fmt.Errorf("获取挂单失败: %w", err)
+		}
+		var orders struct {
+			List []struct {
+				OrderID       string `json:"orderId"`
+				Symbol        string `json:"symbol"`
+				Side          string `json:"side"`
+				OrderType     string `json:"orderType"`
+				Price         string `json:"price"`
+				Qty           string `json:"qty"`
+				CumExecQty    string `json:"cumExecQty"`
+				TriggerPrice  string `json:"triggerPrice"`
+				StopOrderType string `json:"stopOrderType"`
+				ReduceOnly    bool   `json:"reduceOnly"`
+				PositionIdx   int    `json:"positionIdx"`
+				CreatedTime   string `json:"createdTime"`
+			} `json:"list"`
+			NextPageCursor string `json:"nextPageCursor"`
+		}
+		if err := json.Unmarshal(data, &orders); err != nil {
+			return nil, fmt.Errorf("解析挂单失败: %w", err)
+		}
+
+		for _, o := range orders.List {
+			ref := bybitOrderRef{OrderID: o.OrderID, Symbol: o.Symbol, StopOrderType: o.StopOrderType, PositionIdx: o.PositionIdx}
+			order := Order{
+				OrderID:    bybitOrderID(o.OrderID),
+				Symbol:     o.Symbol,
+				Side:       strings.ToUpper(o.Side),
+				Type:       strings.ToUpper(o.OrderType),
+				ReduceOnly: o.ReduceOnly,
+			}
+			switch o.StopOrderType {
+			case "StopLoss", "PartialStopLoss", "TrailingStop":
+				order.Type = "STOP_MARKET"
+				order.ReduceOnly = true
+			case "TakeProfit", "PartialTakeProfit":
+				order.Type = "TAKE_PROFIT_MARKET"
+				order.ReduceOnly = true
+			case "Stop":
+				if o.ReduceOnly {
+					order.Type = "STOP_MARKET"
+				}
+			}
+			switch o.PositionIdx {
+			case 1:
+				order.PositionSide = "LONG"
+			case 2:
+				order.PositionSide = "SHORT"
+			}
+			order.Price, _ = strconv.ParseFloat(o.Price, 64)
+			order.StopPrice, _ = strconv.ParseFloat(o.TriggerPrice, 64)
+			order.Quantity, _ = strconv.ParseFloat(o.Qty, 64)
+			order.FilledQty, _ = strconv.ParseFloat(o.CumExecQty, 64)
+			order.Time, _ = strconv.ParseInt(o.CreatedTime, 10, 64)
+			result = append(result, order)
+			open[order.OrderID] = ref
+		}
+
+		if orders.NextPageCursor == "" || len(orders.List) == 0 {
+			break
+		}
+		params["cursor"] = orders.NextPageCursor
+	}
+	t.syncOrders(symbol, open)
+	return result, nil
+}
+
+// CancelOrder 撤销指定挂单（持仓止损止盈通过trading-stop接口清除）
+func (t *BybitTrader) CancelOrder(symbol string, orderID int64) error {
+	t.mu.RLock()
+	ref, ok := t.orders[orderID]
+	t.mu.RUnlock()
+	if !ok {
+		// 进程重启前下的单没有映射：从交易所挂单中查找
+		if _, err := t.GetOpenOrders(symbol); err != nil {
+			return err
+		}
+		t.mu.RLock()
+		ref, ok = t.orders[orderID]
+		t.mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("未找到 %s 的订单 %d", symbol, orderID)
+		}
+	}
+
+	var err error
+	switch ref.StopOrderType {
+	case "StopLoss":
+		err = t.setTradingStop(symbol, ref.PositionIdx, map[string]interface{}{"tpslMode": "Full", "stopLoss": "0"})
+	case "TakeProfit":
+		err = t.setTradingStop(symbol, ref.PositionIdx, map[string]interface{}{"tpslMode": "Full", "takeProfit": "0"})
+	default:
+		_, err = t.request("POST", "/v5/order/cancel", map[string]interface{}{"category": "linear", "symbol": symbol, "orderId": ref.OrderID})
+	}
+	if err != nil {
+		return fmt.Errorf("撤销订单失败: %w", err)
+	}
+
+	t.forgetOrder(orderID)
+	log.Printf("  ✓ 已撤销 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
+// SetLeverage 设置杠杆（多空相同）
+func (t *BybitTrader) SetLeverage(symbol string, leverage int) error {
+	lever := strconv.Itoa(leverage)
+	_, err := t.request("POST", "/v5/position/set-leverage", map[string]interface{}{
+		"category":     "linear",
+		"symbol":       symbol,
+		"buyLeverage":  lever,
+		"sellLeverage": lever,
+	})
+	if err != nil {
+		// 110043: 杠杆未变化
+		if bybitErr, ok := err.(*bybitError); ok && bybitErr.Code == 110043 {
+			return nil
+		}
+		return fmt.Errorf("设置杠杆失败: %w", err)
+	}
+	log.Printf("  ✓ %s 杠杆已设置为 %dx", symbol, leverage)
+	return nil
+}
+
+// SetAccountMarginMode 设置交易员使用的保证金模式（统一账户的保证金模式为账户级别设置，所有币种共用）
+func (t *BybitTrader) SetAccountMarginMode(mode string) error {
+	if err := ValidateMarginMode(mode); err != nil {
+		return err
+	}
+	if mode == "" {
+		mode = MarginModeIsolated
+	}
+	t.marginMode = mode
+	return nil
+}
+
+// SetMarginMode 检查该币种的保证金模式（统一账户不支持按币种设置，与交易员设置不同时返回错误）
+func (t *BybitTrader) SetMarginMode(symbol string, mode string) error {
+	if err := ValidateMarginMode(mode); err != nil {
+		return err
+	}
+	if mode == "" {
+		mode = MarginModeIsolated
+	}
+	if mode != t.marginMode {
+		return fmt.Errorf("Bybit统一账户的保证金模式为账户级别设置（交易员配置为%s），不支持将 %s 单独设置为%s", t.marginMode, symbol, mode)
+	}
+	return nil
+}
+
+// accountMarginMode 从账户信息读取统一账户当前的保证金模式
+func (t *BybitTrader) accountMarginMode() (string, error) {
+	data, err := t.request("GET", "/v5/account/info", nil)
+	if err != nil {
+		return "", fmt.Errorf("获取账户保证金模式失败: %w", err)
+	}
+	var info struct {
+		MarginMode string `json:"marginMode"` // ISOLATED_MARGIN / REGULAR_MARGIN / PORTFOLIO_MARGIN
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return "", fmt.Errorf("解析账户信息失败: %w", err)
+	}
+	if info.MarginMode == "ISOLATED_MARGIN" {
+		return MarginModeIsolated, nil
+	}
+	return MarginModeCross, nil
+}
+
+// applyMarginMode 开仓前将统一账户切换为交易员设置的保证金模式
+// 统一账户的保证金模式作用于整个账户，有持仓或挂单时交易所可能拒绝切换，此时返回错误且不下单
+func (t *BybitTrader) applyMarginMode() error {
+	current, err := t.accountMarginMode()
+	if err != nil {
+		return err
+	}
+	if current == t.marginMode {
+		return nil
+	}
+
+	setMarginMode := "ISOLATED_MARGIN"
+	if t.marginMode == MarginModeCross {
+		setMarginMode = "REGULAR_MARGIN"
+	}
+	if _, err := t.request("POST", "/v5/account/set-margin-mode", map[string]interface{}{"setMarginMode": setMarginMode}); err != nil {
+		return fmt.Errorf("Bybit账户保证金模式从%s切换为%s失败: %w", current, t.marginMode, err)
+	}
+	log.Printf("  ✓ Bybit账户保证金模式已切换为 %s", t.marginMode)
+	return nil
+}
+
+// GetMarketPrice 获取市场价格
+func (t *BybitTrader) GetMarketPrice(symbol string) (float64, error) {
+	data, err := t.request("GET", "/v5/market/tickers", map[string]interface{}{"category": "linear", "symbol": symbol})
+	if err != nil {
+		return 0, fmt.Errorf("获取价格失败: %w", err)
+	}
+	var tickers struct {
+		List []struct {
+			LastPrice string `json:"lastPrice"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(data, &tickers); err != nil || len(tickers.List) == 0 {
+		return 0, fmt.Errorf("未找到 %s 的价格", symbol)
+	}
+	return strconv.ParseFloat(tickers.List[0].LastPrice, 64)
+}
+
+// setTradingStop 设置持仓止损止盈（原生TP/SL，触发后市价平仓）
+func (t *BybitTrader) setTradingStop(symbol string, positionIdx int, params map[string]interface{}) error {
+	params["category"] = "linear"
+	params["symbol"] = symbol
+	params["positionIdx"] = positionIdx
+	_, err := t.request("POST", "/v5/position/trading-stop", params)
+	return err
+}
+
+// SetStopLoss 设置止损单（全部仓位，按标记价格触发）
+func (t *BybitTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	positionIdx, err := t.positionIdx(symbol, strings.ToLower(positionSide))
+	if err != nil {
+		return err
+	}
+	px, err := t.formatPrice(symbol, stopPrice)
+	if err != nil {
+		return err
+	}
+	if err := t.setTradingStop(symbol, positionIdx, map[string]interface{}{
+		"tpslMode":    "Full",
+		"stopLoss":    px,
+		"slTriggerBy": "MarkPrice",
+		"slOrderType": "Market",
+	}); err != nil {
+		return fmt.Errorf("设置止损失败: %w", err)
+	}
+	log.Printf("  止损价设置: %s", px)
+	return nil
+}
+
+// SetTakeProfit 设置止盈单（全部仓位）
+func (t *BybitTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	positionIdx, err := t.positionIdx(symbol, strings.ToLower(positionSide))
+	if err != nil {
+		return err
+	}
+	px, err := t.formatPrice(symbol, takeProfitPrice)
+	if err != nil {
+		return err
+	}
+	if err := t.setTradingStop(symbol, positionIdx, map[string]interface{}{
+		"tpslMode":    "Full",
+		"takeProfit":  px,
+		"tpTriggerBy": "LastPrice",
+		"tpOrderType": "Market",
+	}); err != nil {
+		return fmt.Errorf("设置止盈失败: %w", err)
+	}
+	log.Printf("  止盈价设置: %s", px)
+	return nil
+}
+
+// SetPartialTakeProfit 设置部分止盈单（Partial模式，按指定数量平仓）
+func (t *BybitTrader) SetPartialTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	positionIdx, err := t.positionIdx(symbol, strings.ToLower(positionSide))
+	if err != nil {
+		return err
+	}
+	px, err := t.formatPrice(symbol, takeProfitPrice)
+	if err != nil {
+		return err
+	}
+	qty, err := t.formatQty(symbol, quantity)
+	if err != nil {
+		return err
+	}
+	if err := t.setTradingStop(symbol, positionIdx, map[string]interface{}{
+		"tpslMode":    "Partial",
+		"takeProfit":  px,
+		"tpSize":      qty,
+		"tpTriggerBy": "LastPrice",
+		"tpOrderType": "Market",
+	}); err != nil {
+		return fmt.Errorf("设置部分止盈失败: %w", err)
+	}
+	log.Printf("  部分止盈设置: %s 数量: %s", px, qty)
+	return nil
+}
+
+// GetFills 获取指定时间之后的成交记录
+func (t *BybitTrader) GetFills(symbol string, startTime int64) ([]Fill, error) {
+	params := map[string]interface{}{
+		"category":  "linear",
+		"symbol":    symbol,
+		"startTime": startTime,
+		"limit":     100,
+	}
+	data, err := t.request("GET", "/v5/execution/list", params)
+	if err != nil {
+		return nil, fmt.Errorf("获取成交记录失败: %w", err)
+	}
+	var executions struct {
+		List []struct {
+			OrderID     string `json:"orderId"`
+			Side        string `json:"side"`
+			ExecPrice   string `json:"execPrice"`
+			ExecQty     string `json:"execQty"`
+			ExecFee     string `json:"execFee"`
+			FeeCurrency string `json:"feeCurrency"`
+			ExecTime    string `json:"execTime"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(data, &executions); err != nil {
+		return nil, fmt.Errorf("解析成交记录失败: %w", err)
+	}
+
+	fills := make([]Fill, 0, len(executions.List))
+	for _, e := range executions.List {
+		fill := Fill{
+			OrderID:  bybitOrderID(e.OrderID),
+			Symbol:   symbol,
+			Side:     strings.ToUpper(e.Side),
+			FeeAsset: e.FeeCurrency,
+		}
+		if fill.FeeAsset == "" {
+			fill.FeeAsset = "USDT"
+		}
+		fill.Price, _ = strconv.ParseFloat(e.ExecPrice, 64)
+		fill.Quantity, _ = strconv.ParseFloat(e.ExecQty, 64)
+		fill.Fee, _ = strconv.ParseFloat(e.ExecFee, 64)
+		fill.Time, _ = strconv.ParseInt(e.ExecTime, 10, 64)
+		fills = append(fills, fill)
+	}
+	return fills, nil
+}
+
+// GetIncomeHistory 获取指定时间之后的手续费和资金费流水（统一账户交易日志）
+func (t *BybitTrader) GetIncomeHistory(symbol string, startTime int64) ([]Income, error) {
+	params := map[string]interface{}{
+		"accountType": "UNIFIED",
+		"category":    "linear",
+		"symbol":      symbol,
+		"startTime":   startTime,
+		"limit":       50,
+	}
+	data, err := t.request("GET", "/v5/account/transaction-log", params)
+	if err != nil {
+		return nil, fmt.Errorf("获取资金流水失败: %w", err)
+	}
+	var logs struct {
+		List []struct {
+			Type            string `json:"type"` // TRADE / SETTLEMENT
+			Fee             string `json:"fee"`
+			Funding         string `json:"funding"`
+			Currency        string `json:"currency"`
+			TransactionTime string `json:"transactionTime"`
+		} `json:"list"`
+	}
+	if err := json.Unmarshal(data, &logs); err != nil {
+		return nil, fmt.Errorf("解析资金流水失败: %w", err)
+	}
+
+	var incomes []Income
+	for _, l := range logs.List {
+		income := Income{Symbol: symbol, Asset: l.Currency}
+		income.Time, _ = strconv.ParseInt(l.TransactionTime, 10, 64)
+		// Bybit手续费和资金费为正数表示支出
+		switch l.Type {
+		case "TRADE":
+			fee, _ := strconv.ParseFloat(l.Fee, 64)
+			income.Type, income.Amount = IncomeCommission, -fee
+		case "SETTLEMENT":
+			funding, _ := strconv.ParseFloat(l.Funding, 64)
+			income.Type, income.Amount = IncomeFunding, -funding
+		default:
+			continue
+		}
+		if income.Amount != 0 {
+			incomes = append(incomes, income)
+		}
+	}
+	return incomes, nil
+}
+
+// CancelAllOrders 取消该币种的所有挂单（含条件单和止损止盈单）
+func (t *BybitTrader) CancelAllOrders(symbol string) error {
+	if _, err := t.request("POST", "/v5/order/cancel-all", map[string]interface{}{"category": "linear", "symbol": symbol}); err != nil {
+		return fmt.Errorf("取消挂单失败: %w", err)
+	}
+	t.syncOrders(symbol, nil)
+	log.Printf("  ✓ 已取消 %s 的所有挂单", symbol)
+	return nil
+}
+
+// FormatQuantity 格式化数量到正确的精度
+func (t *BybitTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
+	inst, err := t.instruments.Get(symbol)
+	if err != nil {
+		return "", err
+	}
+	return inst.FormatQuantity(quantity), nil
+}
@@ -0,0 +1,334 @@
+package trader
+
+import (
+	"math"
+	"testing"
+)
+
+// newTestBybitTrader 创建连接模拟交易所的Bybit交易器（positionList为持仓模式对应的持仓列表响应文件）
+func newTestBybitTrader(t *testing.T, positionList string) (*BybitTrader, *fakeExchange) {
+	t.Helper()
+	ex := newFakeExchange(t, map[string]string{
+		"GET /v5/market/instruments-info":  "bybit/instruments_info.json",
+		"GET /v5/position/list":            "bybit/" + positionList,
+		"GET /v5/account/wallet-balance":   "bybit/wallet_balance.json",
+		"GET /v5/account/info":             "bybit/account_info_isolated.json",
+		"POST /v5/account/set-margin-mode": "bybit/ok.json",
+		"POST /v5/position/set-leverage":   "bybit/ok.json",
+		"POST /v5/position/trading-stop":   "bybit/ok.json",
+		"POST /v5/order/create":            "bybit/order_create.json",
+		"POST /v5/order/cancel":            "bybit/order_cancel.json",
+		"POST /v5/order/cancel-all":        "bybit/ok.json",
+		"GET /v5/order/realtime":           "bybit/order_realtime_filled.json",
+		"GET /v5/execution/list":           "bybit/execution_list.json",
+	})
+	tr := NewBybitTrader("test-api-key", "test-secret", false)
+	tr.SetBaseURL(ex.URL() + "/")
+	tr.SetClock(testClock)
+	return tr, ex
+}
+
+func TestBybitRequestSignature(t *testing.T) {
+	tr, ex := newTestBybitTrader(t, "position_list_oneway.json")
+
+	balance, err := tr.GetBalance()
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if balance.TotalWalletBalance != 1011.44 || balance.AvailableBalance != 948.63 {
+		t.Errorf("余额解析错误: %+v", balance)
+	}
+
+	// GET 签名内容为查询字符串
+	get := ex.last("GET", "/v5/account/wallet-balance")
+	if get.Query.Encode() != "accountType=UNIFIED" {
+		t.Errorf("查询参数 = %q", get.Query.Encode())
+	}
+	checkBybitHeaders(t, get, "763608179e20c3f5cb9def1403e91be631556940843c8e51b93d35f22012a86b")
+
+	// POST 签名内容为JSON请求体
+	if err := tr.SetLeverage("BTCUSDT", 10); err != nil {
+		t.Fatalf("SetLeverage: %v", err)
+	}
+	post := ex.last("POST", "/v5/position/set-leverage")
+	wantBody := `{"buyLeverage":"10","category":"linear","sellLeverage":"10","symbol":"BTCUSDT"}`
+	if post.Body != wantBody {
+		t.Errorf("请求体 = %s，期望 %s", post.Body, wantBody)
+	}
+	checkBybitHeaders(t, post, "bc0eded67338237604aa0022e99ce457a222d1b63cf9efb50f010faab0b82641")
+}
+
+// checkBybitHeaders 检查签名相关请求头
+func checkBybitHeaders(t *testing.T, r recordedRequest, wantSign string) {
+	t.Helper()
+	want := map[string]string{
+		"X-BAPI-API-KEY":     "test-api-key",
+		"X-BAPI-TIMESTAMP":   "1735787045678",
+		"X-BAPI-RECV-WINDOW": "5000",
+		"X-BAPI-SIGN":        wantSign,
+	}
+	for header, value := range want {
+		if got := r.Header.Get(header); got != value {
+			t.Errorf("%s %s = %q，期望 %q", r.Path, header, got, value)
+		}
+	}
+}
+
+func TestBybitRoundsToInstrumentSteps(t *testing.T) {
+	tr, ex := newTestBybitTrader(t, "position_list_oneway.json")
+	ex.route("GET", "/v5/order/realtime", "bybit/order_realtime_new.json")
+
+	// 数量向下取整到qtyStep 0.001，价格四舍五入到tickSize 0.1
+	result, err := tr.PlaceLimitOrder("BTCUSDT", "long", 0.01239, 65000.06, 10, true)
+	if err != nil {
+		t.Fatalf("PlaceLimitOrder: %v", err)
+	}
+	if result.Status != "NEW" {
+		t.Errorf("订单状态 = %s，期望 NEW", result.Status)
+	}
+	expectFields(t, ex.last("POST", "/v5/order/create").jsonBody(t), map[string]interface{}{
+		"symbol":      "BTCUSDT",
+		"side":        "Buy",
+		"orderType":   "Limit",
+		"qty":         "0.012",
+		"price":       "65000.1",
+		"timeInForce": "PostOnly",
+		"positionIdx": float64(0),
+		"reduceOnly":  nil,
+	})
+
+	if qty, _ := tr.FormatQuantity("ETHUSDT", 1.23456); qty != "1.23" {
+		t.Errorf("ETHUSDT 数量格式化 = %s，期望 1.23", qty)
+	}
+	if precision, _ := tr.GetSymbolPrecision("BTCUSDT"); precision != 3 {
+		t.Errorf("BTCUSDT 数量精度 = %d，期望 3", precision)
+	}
+
+	// 小于最小下单量时不下单
+	ex.reset()
+	if _, err := tr.PlaceLimitOrder("BTCUSDT", "long", 0.0009, 65000, 10, false); err == nil {
+		t.Error("小于最小下单量时应返回错误")
+	}
+	if calls := ex.calls("POST", "/v5/order/create"); len(calls) != 0 {
+		t.Errorf("小于最小下单量时不应下单，实际下单%d次", len(calls))
+	}
+}
+
+func TestBybitOrderParamsByPositionMode(t *testing.T) {
+	tests := []struct {
+		name         string
+		positionList string
+		openIdx      float64 // 开空仓的positionIdx
+		closeIdx     float64 // 平多仓的positionIdx
+	}{
+		{"hedge", "position_list_hedge.json", 2, 1},
+		{"one-way", "position_list_oneway.json", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, ex := newTestBybitTrader(t, tt.positionList)
+
+			if _, err := tr.OpenShort("BTCUSDT", 0.005, 10); err != nil {
+				t.Fatalf("OpenShort: %v", err)
+			}
+			expectFields(t, ex.last("POST", "/v5/order/create").jsonBody(t), map[string]interface{}{
+				"side":        "Sell",
+				"orderType":   "Market",
+				"qty":         "0.005",
+				"positionIdx": tt.openIdx,
+				"reduceOnly":  nil,
+			})
+
+			result, err := tr.CloseLong("BTCUSDT", 0.005)
+			if err != nil {
+				t.Fatalf("CloseLong: %v", err)
+			}
+			expectFields(t, ex.last("POST", "/v5/order/create").jsonBody(t), map[string]interface{}{
+				"side":        "Sell",
+				"orderType":   "Market",
+				"qty":         "0.005",
+				"positionIdx": tt.closeIdx,
+				"reduceOnly":  true,
+			})
+
+			// 成交结果来自逐笔成交明细
+			if result.Status != "FILLED" || math.Abs(result.FilledQty-0.005) > 1e-12 {
+				t.Errorf("成交结果错误: %+v", result)
+			}
+			if math.Abs(result.AvgPrice-64302.08) > 1e-6 || math.Abs(result.Fee-0.17683) > 1e-9 {
+				t.Errorf("成交均价 %.4f 手续费 %.5f，期望 64302.08 / 0.17683", result.AvgPrice, result.Fee)
+			}
+			if len(tr.orders) != 0 {
+				t.Errorf("已成交订单的映射应被移除，剩余%d个", len(tr.orders))
+			}
+		})
+	}
+}
+
+func TestBybitAddToPositionKeepsOrders(t *testing.T) {
+	tr, ex := newTestBybitTrader(t, "position_list_hedge.json")
+
+	// 开仓前撤销该币种的所有挂单
+	if _, err := tr.OpenLong("BTCUSDT", 0.005, 10); err != nil {
+		t.Fatalf("OpenLong: %v", err)
+	}
+	if calls := ex.calls("POST", "/v5/order/cancel-all"); len(calls) != 1 {
+		t.Errorf("开仓应撤销挂单1次，实际%d次", len(calls))
+	}
+
+	// 加仓保留已有的止损止盈单和挂单
+	ex.reset()
+	if _, err := tr.AddToPosition("BTCUSDT", "long", 0.005, 10); err != nil {
+		t.Fatalf("AddToPosition: %v", err)
+	}
+	if calls := ex.calls("POST", "/v5/order/cancel-all"); len(calls) != 0 {
+		t.Errorf("加仓不应撤销挂单，实际撤销%d次", len(calls))
+	}
+	expectFields(t, ex.last("POST", "/v5/order/create").jsonBody(t), map[string]interface{}{
+		"side":        "Buy",
+		"orderType":   "Market",
+		"qty":         "0.005",
+		"positionIdx": float64(1),
+		"reduceOnly":  nil,
+	})
+}
+
+func TestBybitMarginMode(t *testing.T) {
+	tr, ex := newTestBybitTrader(t, "position_list_hedge.json")
+
+	// 持仓的保证金模式以账户信息为准
+	positions, err := tr.GetPositions()
+	if err != nil {
+		t.Fatalf("GetPositions: %v", err)
+	}
+	if len(positions) != 1 || positions[0].MarginMode != MarginModeIsolated {
+		t.Errorf("持仓 = %+v，期望1个逐仓持仓", positions)
+	}
+	ex.route("GET", "/v5/account/info", "bybit/account_info_regular.json")
+	if positions, _ = tr.GetPositions(); len(positions) != 1 || positions[0].MarginMode != MarginModeCross {
+		t.Errorf("全仓账户的持仓 = %+v，期望全仓", positions)
+	}
+
+	// 保证金模式为账户级别设置：与交易员设置不同的决策被拒绝
+	if err := tr.SetMarginMode("BTCUSDT", MarginModeIsolated); err != nil {
+		t.Errorf("与交易员设置相同的保证金模式应通过: %v", err)
+	}
+	if err := tr.SetMarginMode("BTCUSDT", MarginModeCross); err == nil {
+		t.Error("与交易员设置不同的保证金模式应返回错误")
+	}
+
+	// 账户为全仓时开仓前切换为交易员设置的逐仓
+	ex.reset()
+	if _, err := tr.OpenLong("BTCUSDT", 0.005, 10); err != nil {
+		t.Fatalf("OpenLong: %v", err)
+	}
+	expectFields(t, ex.last("POST", "/v5/account/set-margin-mode").jsonBody(t), map[string]interface{}{
+		"setMarginMode": "ISOLATED_MARGIN",
+	})
+
+	// 切换失败时返回错误且不下单
+	ex.reset()
+	ex.route("POST", "/v5/account/set-margin-mode", "bybit/set_margin_mode_rejected.json")
+	if _, err := tr.OpenLong("BTCUSDT", 0.005, 10); err == nil {
+		t.Error("保证金模式切换失败时应返回错误")
+	}
+	if calls := ex.calls("POST", "/v5/order/create"); len(calls) != 0 {
+		t.Errorf("保证金模式切换失败时不应下单，实际下单%d次", len(calls))
+	}
+
+	// 账户已是交易员设置的模式时不切换
+	ex.reset()
+	ex.route("GET", "/v5/account/info", "bybit/account_info_isolated.json")
+	if _, err := tr.OpenLong("BTCUSDT", 0.005, 10); err != nil {
+		t.Fatalf("OpenLong: %v", err)
+	}
+	if calls := ex.calls("POST", "/v5/account/set-margin-mode"); len(calls) != 0 {
+		t.Errorf("账户模式相同时不应切换，实际切换%d次", len(calls))
+	}
+}
+
+func TestBybitStopOrders(t *testing.T) {
+	tr, ex := newTestBybitTrader(t, "position_list_hedge.json")
+
+	if err := tr.SetStopLoss("BTCUSDT", "LONG", 0.01, 60000.04); err != nil {
+		t.Fatalf("SetStopLoss: %v", err)
+	}
+	expectFields(t, ex.last("POST", "/v5/position/trading-stop").jsonBody(t), map[string]interface{}{
+		"category":    "linear",
+		"symbol":      "BTCUSDT",
+		"positionIdx": float64(1),
+		"tpslMode":    "Full",
+		"stopLoss":    "60000.0",
+		"slTriggerBy": "MarkPrice",
+		"slOrderType": "Market",
+	})
+
+	if err := tr.SetPartialTakeProfit("BTCUSDT", "LONG", 0.0056, 68000); err != nil {
+		t.Fatalf("SetPartialTakeProfit: %v", err)
+	}
+	expectFields(t, ex.last("POST", "/v5/position/trading-stop").jsonBody(t), map[string]interface{}{
+		"positionIdx": float64(1),
+		"tpslMode":    "Partial",
+		"takeProfit":  "68000.0",
+		"tpSize":      "0.005",
+	})
+
+	// 挂单列表中的止损止盈映射为统一类型
+	ex.route("GET", "/v5/order/realtime", "bybit/order_realtime_open.json")
+	orders, err := tr.GetOpenOrders("BTCUSDT")
+	if err != nil {
+		t.Fatalf("GetOpenOrders: %v", err)
+	}
+	types := map[string]int{}
+	for _, o := range orders {
+		types[o.Type]++
+		if o.PositionSide != "LONG" {
+			t.Errorf("订单%d 持仓方向 = %s，期望 LONG", o.OrderID, o.PositionSide)
+		}
+	}
+	if types["LIMIT"] != 1 || types["STOP_MARKET"] != 1 || types["TAKE_PROFIT_MARKET"] != 1 {
+		t.Errorf("挂单类型 = %v", types)
+	}
+}
+
+func TestBybitCancelOrderAfterRestart(t *testing.T) {
+	tr, ex := newTestBybitTrader(t, "position_list_hedge.json")
+	ex.route("GET", "/v5/order/realtime", "bybit/order_realtime_open.json")
+
+	// 新进程没有订单映射：撤单时从交易所挂单中查找
+	stopID := bybitOrderID("9f0f1d3a-6a02-4c1e-a7f5-4bd5c7d3e611")
+	if err := tr.CancelOrder("BTCUSDT", stopID); err != nil {
+		t.Fatalf("撤销止损单: %v", err)
+	}
+	expectFields(t, ex.last("POST", "/v5/position/trading-stop").jsonBody(t), map[string]interface{}{
+		"positionIdx": float64(1),
+		"tpslMode":    "Full",
+		"stopLoss":    "0",
+	})
+
+	limitID := bybitOrderID("5cf98598-39a7-459e-97bf-76ca765ee020")
+	if err := tr.CancelOrder("BTCUSDT", limitID); err != nil {
+		t.Fatalf("撤销限价单: %v", err)
+	}
+	expectFields(t, ex.last("POST", "/v5/order/cancel").jsonBody(t), map[string]interface{}{
+		"symbol":  "BTCUSDT",
+		"orderId": "5cf98598-39a7-459e-97bf-76ca765ee020",
+	})
+	if _, ok := tr.orders[limitID]; ok {
+		t.Error("已撤销订单的映射应被移除")
+	}
+
+	// 挂单成交或被撤销后，下次获取挂单时移除映射
+	ex.route("GET", "/v5/order/realtime", "bybit/order_realtime_empty.json")
+	if _, err := tr.GetOpenOrders("BTCUSDT"); err != nil {
+		t.Fatalf("GetOpenOrders: %v", err)
+	}
+	if len(tr.orders) != 0 {
+		t.Errorf("挂单列表为空时应清除映射，剩余%d个", len(tr.orders))
+	}
+
+	// 交易所中也不存在的订单返回错误
+	if err := tr.CancelOrder("BTCUSDT", limitID); err == nil {
+		t.Error("撤销不存在的订单应返回错误")
+	}
+}
@@ -0,0 +1,151 @@
+package trader
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock 签名测试使用的固定时间（2025-01-02T03:04:05.678Z）
+var testClock = func() time.Time { return time.UnixMilli(1735787045678) }
+
+// fakeExchange 按 "METHOD /path" 回放testdata中录制的交易所响应，并记录收到的请求
+type fakeExchange struct {
+	t        *testing.T
+	server   *httptest.Server
+	mu       sync.Mutex
+	routes   map[string]string // "METHOD /path" -> testdata下的响应文件
+	requests []recordedRequest
+}
+
+// recordedRequest 交易所收到的请求
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   string
+	Header http.Header
+}
+
+// newFakeExchange 启动模拟交易所（测试结束时自动关闭）
+func newFakeExchange(t *testing.T, routes map[string]string) *fakeExchange {
+	t.Helper()
+	f := &fakeExchange{t: t, routes: make(map[string]string)}
+	for route, fixture := range routes {
+		f.routes[route] = fixture
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// URL 模拟交易所地址
+func (f *fakeExchange) URL() string {
+	return f.server.URL
+}
+
+// route 设置（或替换）接口的响应文件
+func (f *fakeExchange) route(method, path, fixture string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routes[method+" "+path] = fixture
+}
+
+// serve 记录请求并返回录制的响应（未录制的接口视为测试失败）
+func (f *fakeExchange) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	key := r.Method + " " + r.URL.Path
+
+	f.mu.Lock()
+	f.requests = append(f.requests, recordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Body:   string(body),
+		Header: r.Header.Clone(),
+	})
+	fixture, ok := f.routes[key]
+	f.mu.Unlock()
+
+	if !ok {
+		f.t.Errorf("未录制的请求: %s", key)
+		http.NotFound(w, r)
+		return
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		f.t.Errorf("读取响应文件失败: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// calls 返回指定接口收到的全部请求
+func (f *fakeExchange) calls(method, path string) []recordedRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var result []recordedRequest
+	for _, r := range f.requests {
+		if r.Method == method && r.Path == path {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// last 返回指定接口收到的最后一个请求（没有请求时测试失败）
+func (f *fakeExchange) last(method, path string) recordedRequest {
+	f.t.Helper()
+	calls := f.calls(method, path)
+	if len(calls) == 0 {
+		f.t.Fatalf("%s %s 没有收到请求", method, path)
+	}
+	return calls[len(calls)-1]
+}
+
+// reset 清空已记录的请求
+func (f *fakeExchange) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = nil
+}
+
+// jsonBody 将请求体解析为JSON对象
+func (r recordedRequest) jsonBody(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(r.Body), &body); err != nil {
+		t.Fatalf("解析 %s 请求体失败: %v (%s)", r.Path, err, r.Body)
+	}
+	return body
+}
+
+// expectFields 检查JSON请求体的字段值（期望值为nil表示该字段不应出现）
+func expectFields(t *testing.T, body map[string]interface{}, want map[string]interface{}) {
+	t.Helper()
+	for key, value := range want {
+		got, ok := body[key]
+		if value == nil {
+			if ok {
+				t.Errorf("%s 不应出现，实际为 %v", key, got)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("缺少字段 %s（期望 %v）", key, value)
+			continue
+		}
+		if got != value {
+			t.Errorf("%s = %v (%T)，期望 %v (%T)", key, got, got, value, value)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package trader
+
+import (
+	"log"
+	"nofx/decision"
+	"nofx/logger"
+	"sort"
+	"strings"
+	"time"
+)
+
+// collectFunding 查询上次查询以来持仓币种的资金费流水，记录到决策日志（绩效分析按结算时的持仓归属到每笔交易）
+// 手续费已按订单成交记录在各决策动作中，这里只记录资金费，避免重复计算
+// 需在对账清理已平仓记录之前调用，使上个周期内已平仓的持仓也能归属资金费
+// 每个币种单独记录查询起点，某个币种查询失败时下次仍从它自己的起点重新查询
+func (at *AutoTrader) collectFunding(ctx *decision.Context, record *logger.DecisionRecord) {
+	// 新出现的币种在上次查询之后才开仓，从上次查询时间开始查询
+	fallback := at.state.LastIncome
+	if fallback.IsZero() {
+		fallback = at.state.StartTime
+	}
+	queryTime := at.now()
+
+	symbolSet := make(map[string]bool)
+	for key := range at.state.PositionOpenTime {
+		symbolSet[key[:strings.LastIndex(key, "_")]] = true
+	}
+	for key := range at.state.PositionQty {
+		symbolSet[key[:strings.LastIndex(key, "_")]] = true
+	}
+	for _, pos := range ctx.Positions {
+		symbolSet[pos.Symbol] = true
+	}
+	symbols := make([]string, 0, len(symbolSet))
+	for symbol := range symbolSet {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	cursors := make(map[string]time.Time, len(symbols))
+	for _, symbol := range symbols {
+		since, ok := at.state.IncomeCursors[symbol]
+		if !ok {
+			since = fallback
+		}
+		// 查询失败时保持原起点，下次重新查询
+		cursors[symbol] = since
+
+		incomes, err := at.trader.GetIncomeHistory(symbol, since.UnixMilli())
+		if err != nil {
+			log.Printf("  ⚠ 获取 %s 资金费流水失败: %v", symbol, err)
+			continue
+		}
+		latest := since
+		for _, income := range incomes {
+			t := time.UnixMilli(income.Time)
+			if t.After(latest) {
+				latest = t
+			}
+			if income.Type != IncomeFunding || income.Amount == 0 {
+				continue
+			}
+			record.Funding = append(record.Funding, logger.FundingPayment{
+				Symbol: symbol,
+				Amount: income.Amount,
+				Time:   t,
+			})
+			log.Printf("💸 %s 资金费结算: %+.4f %s", symbol, income.Amount, income.Asset)
+		}
+
+		// 下次从最近一笔流水之后开始查询（没有新流水时保持不变，避免漏掉延迟入账的流水）
+		if latest.After(since) {
+			cursors[symbol] = latest.Add(time.Millisecond)
+		}
+	}
+
+	// 只保留仍需查询的币种（已平仓且对账清理后的币种不再查询）
+	at.state.IncomeCursors = cursors
+	at.state.LastIncome = queryTime
+}
+
+// expectedHolding 最近交易的平均持仓时长（用于估算候选币种的资金费成本，没有交易记录时返回0）
+func expectedHolding(performance *logger.PerformanceAnalysis) time.Duration {
+	if performance == nil {
+		return 0
+	}
+
+	var total time.Duration
+	count := 0
+	for _, trade := range performance.RecentTrades {
+		if d, err := time.ParseDuration(trade.Duration); err == nil && d > 0 {
+			total += d
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
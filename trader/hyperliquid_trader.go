@@ -4,8 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net/http"
+	"nofx/instrument"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/sonirico/go-hyperliquid"
@@ -16,7 +22,13 @@ type HyperliquidTrader struct {
 	exchange   *hyperliquid.Exchange
 	ctx        context.Context
 	walletAddr string
-	meta       *hyperliquid.Meta // 缓存meta信息（包含精度等）
+	apiURL     string // SDK未封装的info查询（如资金费流水）直接请求该地址
+
+	// 合约元数据（来自meta，包含数量精度和最大杠杆）
+	instruments *instrument.Registry
+
+	// 各币种开仓使用的保证金模式（随杠杆一起设置）
+	marginModes marginModeSettings
 }
 
 // NewHyperliquidTrader 创建Hyperliquid交易器
@@ -56,22 +68,59 @@ func NewHyperliquidTrader(privateKeyHex string, walletAddr string, testnet bool)
 
 	log.Printf("✓ Hyperliquid交易器初始化成功 (testnet=%v, wallet=%s)", testnet, walletAddr)
 
+	t := &HyperliquidTrader{
+		exchange:   exchange,
+		ctx:        ctx,
+		walletAddr: walletAddr,
+		apiURL:     apiURL,
+	}
+
 	// 获取meta信息（包含精度等配置）
-	meta, err := exchange.Info().Meta(ctx)
+	t.instruments = instrument.NewRegistry("hyperliquid", t.loadInstruments)
+	if err := t.instruments.Load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// hyperliquidMinNotional Hyperliquid最小下单金额（USDC）
+const hyperliquidMinNotional = 10.0
+
+// loadInstruments 从meta加载全部合约元数据
+// 价格使用5位有效数字（没有固定tick size），数量精度为szDecimals
+func (t *HyperliquidTrader) loadInstruments() ([]instrument.Instrument, error) {
+	meta, err := t.exchange.Info().Meta(t.ctx)
 	if err != nil {
 		return nil, fmt.Errorf("获取meta信息失败: %w", err)
 	}
 
-	return &HyperliquidTrader{
-		exchange:   exchange,
-		ctx:        ctx,
-		walletAddr: walletAddr,
-		meta:       meta,
-	}, nil
+	list := make([]instrument.Instrument, 0, len(meta.Universe))
+	for _, asset := range meta.Universe {
+		step := math.Pow10(-asset.SzDecimals)
+		inst := instrument.Instrument{
+			Symbol:      asset.Name + "USDT",
+			VenueSymbol: asset.Name,
+			StepSize:    step,
+			MinQty:      step,
+			MinNotional: hyperliquidMinNotional,
+			MaxLeverage: asset.MaxLeverage,
+			Status:      instrument.StatusTrading,
+		}
+		if asset.IsDelisted {
+			inst.Status = instrument.StatusDelisted
+		}
+		list = append(list, inst)
+	}
+	return list, nil
+}
+
+// GetInstrument 获取交易对元数据
+func (t *HyperliquidTrader) GetInstrument(symbol string) (*instrument.Instrument, error) {
+	return t.instruments.Get(symbol)
 }
 
 // GetBalance 获取账户余额
-func (t *HyperliquidTrader) GetBalance() (map[string]interface{}, error) {
+func (t *HyperliquidTrader) GetBalance() (*Balance, error) {
 	log.Printf("🔄 正在调用Hyperliquid API获取账户余额...")
 
 	// 获取账户状态
@@ -82,8 +131,6 @@ func (t *HyperliquidTrader) GetBalance() (map[string]interface{}, error) {
 	}
 
 	// 解析余额信息（MarginSummary字段都是string）
-	result := make(map[string]interface{})
-
 	// 🔍 调试：打印API返回的完整CrossMarginSummary结构
 	summaryJSON, _ := json.MarshalIndent(accountState.MarginSummary, "  ", "  ")
 	log.Printf("🔍 [DEBUG] Hyperliquid API CrossMarginSummary完整数据:")
@@ -107,29 +154,31 @@ func (t *HyperliquidTrader) GetBalance() (map[string]interface{}, error) {
 	// 需要返回"不包含未实现盈亏的钱包余额"
 	walletBalanceWithoutUnrealized := accountValue - totalUnrealizedPnl
 
-	result["totalWalletBalance"] = walletBalanceWithoutUnrealized // 钱包余额（不含未实现盈亏）
-	result["availableBalance"] = accountValue - totalMarginUsed   // 可用余额（总净值 - 占用保证金）
-	result["totalUnrealizedProfit"] = totalUnrealizedPnl          // 未实现盈亏
+	result := &Balance{
+		TotalWalletBalance:    walletBalanceWithoutUnrealized, // 钱包余额（不含未实现盈亏）
+		AvailableBalance:      accountValue - totalMarginUsed, // 可用余额（总净值 - 占用保证金）
+		TotalUnrealizedProfit: totalUnrealizedPnl,             // 未实现盈亏
+	}
 
 	log.Printf("✓ Hyperliquid 账户: 总净值=%.2f (钱包%.2f+未实现%.2f), 可用=%.2f, 保证金占用=%.2f",
 		accountValue,
 		walletBalanceWithoutUnrealized,
 		totalUnrealizedPnl,
-		result["availableBalance"],
+		result.AvailableBalance,
 		totalMarginUsed)
 
 	return result, nil
 }
 
 // GetPositions 获取所有持仓
-func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
+func (t *HyperliquidTrader) GetPositions() ([]Position, error) {
 	// 获取账户状态
 	accountState, err := t.exchange.Info().UserState(t.ctx, t.walletAddr)
 	if err != nil {
 		return nil, fmt.Errorf("获取持仓失败: %w", err)
 	}
 
-	var result []map[string]interface{}
+	var result []Position
 
 	// 遍历所有持仓
 	for _, assetPos := range accountState.AssetPositions {
@@ -142,19 +191,16 @@ func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
 			continue // 跳过无持仓的
 		}
 
-		posMap := make(map[string]interface{})
-
 		// 标准化symbol格式（Hyperliquid使用如"BTC"，我们转换为"BTCUSDT"）
-		symbol := position.Coin + "USDT"
-		posMap["symbol"] = symbol
+		p := Position{Symbol: instrument.Canonical(position.Coin)}
 
 		// 持仓数量和方向
 		if posAmt > 0 {
-			posMap["side"] = "long"
-			posMap["positionAmt"] = posAmt
+			p.Side = "long"
+			p.Quantity = posAmt
 		} else {
-			posMap["side"] = "short"
-			posMap["positionAmt"] = -posAmt // 转为正数
+			p.Side = "short"
+			p.Quantity = -posAmt // 转为正数
 		}
 
 		// 价格信息（EntryPx和LiquidationPx是指针类型）
@@ -175,13 +221,18 @@ func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
 			markPrice = positionValue / absFloat(posAmt)
 		}
 
-		posMap["entryPrice"] = entryPrice
-		posMap["markPrice"] = markPrice
-		posMap["unRealizedProfit"] = unrealizedPnl
-		posMap["leverage"] = float64(position.Leverage.Value)
-		posMap["liquidationPrice"] = liquidationPx
+		p.EntryPrice = entryPrice
+		p.MarkPrice = markPrice
+		p.UnrealizedPnL = unrealizedPnl
+		p.Leverage = position.Leverage.Value
+		p.LiquidationPrice = liquidationPx
+		p.MarginMode = MarginModeIsolated
+		if position.Leverage.Type == "cross" {
+			p.MarginMode = MarginModeCross
+		}
+		p.Margin, _ = strconv.ParseFloat(position.MarginUsed, 64)
 
-		result = append(result, posMap)
+		result = append(result, p)
 	}
 
 	return result, nil
@@ -190,92 +241,58 @@ func (t *HyperliquidTrader) GetPositions() ([]map[string]interface{}, error) {
 // SetLeverage 设置杠杆
 func (t *HyperliquidTrader) SetLeverage(symbol string, leverage int) error {
 	// Hyperliquid symbol格式（去掉USDT后缀）
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coin(symbol)
 
-	// 调用UpdateLeverage (leverage int, name string, isCross bool)
-	_, err := t.exchange.UpdateLeverage(t.ctx, leverage, coin, false) // false = 逐仓模式
+	// 调用UpdateLeverage (leverage int, name string, isCross bool)，保证金模式随杠杆一起设置
+	isCross := t.marginModes.isCross(symbol)
+	_, err := t.exchange.UpdateLeverage(t.ctx, leverage, coin, isCross)
 	if err != nil {
 		return fmt.Errorf("设置杠杆失败: %w", err)
 	}
 
-	log.Printf("  ✓ %s 杠杆已切换为 %dx", symbol, leverage)
+	log.Printf("  ✓ %s 杠杆已切换为 %dx（%s）", symbol, leverage, t.marginModes.get(symbol))
 	return nil
 }
 
+// SetMarginMode 设置该币种后续开仓使用的保证金模式（在开仓设置杠杆时生效）
+func (t *HyperliquidTrader) SetMarginMode(symbol string, mode string) error {
+	return t.marginModes.set(symbol, mode)
+}
+
 // OpenLong 开多仓
-func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 先取消该币种的所有委托单
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
 	}
-
-	// 设置杠杆
-	if err := t.SetLeverage(symbol, leverage); err != nil {
-		return nil, err
-	}
-
-	// Hyperliquid symbol格式
-	coin := convertSymbolToHyperliquid(symbol)
-
-	// 获取当前价格（用于市价单）
-	price, err := t.GetMarketPrice(symbol)
-	if err != nil {
-		return nil, err
-	}
-
-	// ⚠️ 关键：根据币种精度要求，四舍五入数量
-	roundedQuantity := t.roundToSzDecimals(coin, quantity)
-	log.Printf("  📏 数量精度处理: %.8f -> %.8f (szDecimals=%d)", quantity, roundedQuantity, t.getSzDecimals(coin))
-
-	// ⚠️ 关键：价格也需要处理为5位有效数字
-	aggressivePrice := t.roundPriceToSigfigs(price * 1.01)
-	log.Printf("  💰 价格精度处理: %.8f -> %.8f (5位有效数字)", price*1.01, aggressivePrice)
-
-	// 创建市价买入订单（使用IOC limit order with aggressive price）
-	order := hyperliquid.CreateOrderRequest{
-		Coin:  coin,
-		IsBuy: true,
-		Size:  roundedQuantity, // 使用四舍五入后的数量
-		Price: aggressivePrice, // 使用处理后的价格
-		OrderType: hyperliquid.OrderType{
-			Limit: &hyperliquid.LimitOrderType{
-				Tif: hyperliquid.TifIoc, // Immediate or Cancel (类似市价单)
-			},
-		},
-		ReduceOnly: false,
-	}
-
-	_, err = t.exchange.Order(t.ctx, order, nil)
-	if err != nil {
-		return nil, fmt.Errorf("开多仓失败: %w", err)
-	}
-
-	log.Printf("✓ 开多仓成功: %s 数量: %.4f", symbol, roundedQuantity)
-
-	result := make(map[string]interface{})
-	result["orderId"] = 0 // Hyperliquid没有返回order ID
-	result["symbol"] = symbol
-	result["status"] = "FILLED"
-
-	return result, nil
+	return t.open(symbol, "long", quantity, leverage)
 }
 
 // OpenShort 开空仓
-func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
 	// 先取消该币种的所有委托单
 	if err := t.CancelAllOrders(symbol); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败: %v", err)
 	}
+	return t.open(symbol, "short", quantity, leverage)
+}
+
+// AddToPosition 市价加仓（保留该币种已有的止损止盈单和挂单）
+func (t *HyperliquidTrader) AddToPosition(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.open(symbol, side, quantity, leverage)
+}
 
+// open 市价开仓（多空通用，不撤销已有委托单）
+func (t *HyperliquidTrader) open(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
 	// 设置杠杆
 	if err := t.SetLeverage(symbol, leverage); err != nil {
 		return nil, err
 	}
 
 	// Hyperliquid symbol格式
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coin(symbol)
 
-	// 获取当前价格
+	// 获取当前价格（用于市价单）
 	price, err := t.GetMarketPrice(symbol)
 	if err != nil {
 		return nil, err
@@ -285,51 +302,52 @@ func (t *HyperliquidTrader) OpenShort(symbol string, quantity float64, leverage
 	roundedQuantity := t.roundToSzDecimals(coin, quantity)
 	log.Printf("  📏 数量精度处理: %.8f -> %.8f (szDecimals=%d)", quantity, roundedQuantity, t.getSzDecimals(coin))
 
-	// ⚠️ 关键：价格也需要处理为5位有效数字
-	aggressivePrice := t.roundPriceToSigfigs(price * 0.99)
-	log.Printf("  💰 价格精度处理: %.8f -> %.8f (5位有效数字)", price*0.99, aggressivePrice)
+	// ⚠️ 关键：价格也需要处理为5位有效数字（开多价格稍高、开空价格稍低以确保成交）
+	isBuy := side == "long"
+	limitPrice := price * 1.01
+	if !isBuy {
+		limitPrice = price * 0.99
+	}
+	aggressivePrice := t.roundPriceToSigfigs(limitPrice)
+	log.Printf("  💰 价格精度处理: %.8f -> %.8f (5位有效数字)", limitPrice, aggressivePrice)
 
-	// 创建市价卖出订单
+	// 创建市价订单（使用IOC limit order with aggressive price）
 	order := hyperliquid.CreateOrderRequest{
 		Coin:  coin,
-		IsBuy: false,
+		IsBuy: isBuy,
 		Size:  roundedQuantity, // 使用四舍五入后的数量
 		Price: aggressivePrice, // 使用处理后的价格
 		OrderType: hyperliquid.OrderType{
 			Limit: &hyperliquid.LimitOrderType{
-				Tif: hyperliquid.TifIoc,
+				Tif: hyperliquid.TifIoc, // Immediate or Cancel (类似市价单)
 			},
 		},
 		ReduceOnly: false,
 	}
 
-	_, err = t.exchange.Order(t.ctx, order, nil)
+	status, err := t.exchange.Order(t.ctx, order, nil)
 	if err != nil {
-		return nil, fmt.Errorf("开空仓失败: %w", err)
+		return nil, fmt.Errorf("开%s仓失败: %w", sideLabel(side), err)
 	}
 
-	log.Printf("✓ 开空仓成功: %s 数量: %.4f", symbol, roundedQuantity)
-
-	result := make(map[string]interface{})
-	result["orderId"] = 0
-	result["symbol"] = symbol
-	result["status"] = "FILLED"
+	log.Printf("✓ 开%s仓成功: %s 数量: %.4f", sideLabel(side), symbol, roundedQuantity)
 
-	return result, nil
+	return t.buildOrderResult(symbol, status, leverage), nil
 }
 
 // CloseLong 平多仓
-func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
-	if quantity == 0 {
+	closeAll := quantity == 0
+	if closeAll {
 		positions, err := t.GetPositions()
 		if err != nil {
 			return nil, err
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "long" {
-				quantity = pos["positionAmt"].(float64)
+			if pos.Symbol == symbol && pos.Side == "long" {
+				quantity = pos.Quantity
 				break
 			}
 		}
@@ -340,7 +358,7 @@ func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[stri
 	}
 
 	// Hyperliquid symbol格式
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coin(symbol)
 
 	// 获取当前价格
 	price, err := t.GetMarketPrice(symbol)
@@ -370,38 +388,36 @@ func (t *HyperliquidTrader) CloseLong(symbol string, quantity float64) (map[stri
 		ReduceOnly: true, // 只平仓，不开新仓
 	}
 
-	_, err = t.exchange.Order(t.ctx, order, nil)
+	status, err := t.exchange.Order(t.ctx, order, nil)
 	if err != nil {
 		return nil, fmt.Errorf("平多仓失败: %w", err)
 	}
 
 	log.Printf("✓ 平多仓成功: %s 数量: %.4f", symbol, roundedQuantity)
 
-	// 平仓后取消该币种的所有挂单
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	// 全部平仓后取消该币种的所有挂单（部分平仓时保留止损止盈单）
+	if closeAll {
+		if err := t.CancelAllOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消挂单失败: %v", err)
+		}
 	}
 
-	result := make(map[string]interface{})
-	result["orderId"] = 0
-	result["symbol"] = symbol
-	result["status"] = "FILLED"
-
-	return result, nil
+	return t.buildOrderResult(symbol, status, 0), nil
 }
 
 // CloseShort 平空仓
-func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
 	// 如果数量为0，获取当前持仓数量
-	if quantity == 0 {
+	closeAll := quantity == 0
+	if closeAll {
 		positions, err := t.GetPositions()
 		if err != nil {
 			return nil, err
 		}
 
 		for _, pos := range positions {
-			if pos["symbol"] == symbol && pos["side"] == "short" {
-				quantity = pos["positionAmt"].(float64)
+			if pos.Symbol == symbol && pos.Side == "short" {
+				quantity = pos.Quantity
 				break
 			}
 		}
@@ -412,7 +428,7 @@ func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[str
 	}
 
 	// Hyperliquid symbol格式
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coin(symbol)
 
 	// 获取当前价格
 	price, err := t.GetMarketPrice(symbol)
@@ -442,29 +458,303 @@ func (t *HyperliquidTrader) CloseShort(symbol string, quantity float64) (map[str
 		ReduceOnly: true,
 	}
 
-	_, err = t.exchange.Order(t.ctx, order, nil)
+	status, err := t.exchange.Order(t.ctx, order, nil)
 	if err != nil {
 		return nil, fmt.Errorf("平空仓失败: %w", err)
 	}
 
 	log.Printf("✓ 平空仓成功: %s 数量: %.4f", symbol, roundedQuantity)
 
-	// 平仓后取消该币种的所有挂单
-	if err := t.CancelAllOrders(symbol); err != nil {
-		log.Printf("  ⚠ 取消挂单失败: %v", err)
+	// 全部平仓后取消该币种的所有挂单（部分平仓时保留止损止盈单）
+	if closeAll {
+		if err := t.CancelAllOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消挂单失败: %v", err)
+		}
+	}
+
+	return t.buildOrderResult(symbol, status, 0), nil
+}
+
+// PlaceLimitOrder 挂限价开仓单（post-only使用ALO，会立即成交时交易所拒绝下单）
+func (t *HyperliquidTrader) PlaceLimitOrder(symbol, side string, quantity, price float64, leverage int, postOnly bool) (*OrderResult, error) {
+	// 设置杠杆
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	// Hyperliquid symbol格式
+	coin := t.coin(symbol)
+
+	// 数量按币种精度四舍五入，价格处理为5位有效数字
+	roundedQuantity := t.roundToSzDecimals(coin, quantity)
+	limitPrice := t.roundPriceToSigfigs(price)
+
+	tif := hyperliquid.TifGtc
+	if postOnly {
+		tif = hyperliquid.TifAlo
+	}
+
+	order := hyperliquid.CreateOrderRequest{
+		Coin:  coin,
+		IsBuy: side == "long",
+		Size:  roundedQuantity,
+		Price: limitPrice,
+		OrderType: hyperliquid.OrderType{
+			Limit: &hyperliquid.LimitOrderType{
+				Tif: tif,
+			},
+		},
+		ReduceOnly: false,
+	}
+
+	status, err := t.exchange.Order(t.ctx, order, nil)
+	if err != nil {
+		return nil, fmt.Errorf("挂限价单失败: %w", err)
 	}
 
-	result := make(map[string]interface{})
-	result["orderId"] = 0
-	result["symbol"] = symbol
-	result["status"] = "FILLED"
+	log.Printf("✓ 限价单已提交: %s %s 价格: %.6f 数量: %.4f", symbol, side, limitPrice, roundedQuantity)
+
+	return t.buildOrderResult(symbol, status, leverage), nil
+}
+
+// GetOpenOrders 获取未成交挂单（symbol为空表示所有币种）
+func (t *HyperliquidTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	// frontendOpenOrders 包含触发单信息（止损止盈），openOrders只有限价单
+	openOrders, err := t.exchange.Info().FrontendOpenOrders(t.ctx, t.walletAddr)
+	if err != nil {
+		return nil, fmt.Errorf("获取挂单失败: %w", err)
+	}
 
+	coin := t.coin(symbol)
+	var result []Order
+	for _, o := range openOrders {
+		if symbol != "" && o.Coin != coin {
+			continue
+		}
+		order := Order{
+			OrderID:    o.Oid,
+			Symbol:     instrument.Canonical(o.Coin),
+			Side:       "BUY",
+			Type:       "LIMIT",
+			Quantity:   o.Sz, // 剩余未成交数量
+			FilledQty:  o.OrigSz - o.Sz,
+			ReduceOnly: o.ReduceOnly,
+			Time:       o.Timestamp,
+		}
+		if o.Side == hyperliquid.OrderSideAsk { // Hyperliquid: B=买入, A=卖出
+			order.Side = "SELL"
+		}
+		switch o.OrderType {
+		case "Stop Market":
+			order.Type = "STOP_MARKET"
+			order.StopPrice = o.TriggerPx
+		case "Take Profit Market":
+			order.Type = "TAKE_PROFIT_MARKET"
+			order.StopPrice = o.TriggerPx
+		default:
+			order.Price = o.LimitPx
+		}
+		// 单向持仓：只减仓单的方向与持仓相反
+		if (order.Side == "BUY") != o.ReduceOnly {
+			order.PositionSide = "LONG"
+		} else {
+			order.PositionSide = "SHORT"
+		}
+		result = append(result, order)
+	}
 	return result, nil
 }
 
+// CancelOrder 撤销指定挂单
+func (t *HyperliquidTrader) CancelOrder(symbol string, orderID int64) error {
+	coin := t.coin(symbol)
+	if _, err := t.exchange.Cancel(t.ctx, coin, orderID); err != nil {
+		return fmt.Errorf("撤销订单失败: %w", err)
+	}
+
+	log.Printf("  ✓ 已撤销 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
+// buildOrderResult 将下单返回的订单状态转换为OrderResult，并按订单ID查询逐笔成交补充手续费
+// IOC订单通常立即成交，返回filled状态（包含成交均价和成交数量）
+func (t *HyperliquidTrader) buildOrderResult(symbol string, status hyperliquid.OrderStatus, leverage int) *OrderResult {
+	result := &OrderResult{
+		Symbol:   symbol,
+		Status:   "NEW",
+		Leverage: leverage,
+	}
+	switch {
+	case status.Filled != nil:
+		result.OrderID = int64(status.Filled.Oid)
+		result.Status = "FILLED"
+		result.AvgPrice, _ = strconv.ParseFloat(status.Filled.AvgPx, 64)
+		result.FilledQty, _ = strconv.ParseFloat(status.Filled.TotalSz, 64)
+	case status.Resting != nil:
+		result.OrderID = status.Resting.Oid
+	}
+
+	if result.OrderID == 0 {
+		return result
+	}
+
+	fills, err := t.exchange.Info().UserFills(t.ctx, t.walletAddr)
+	if err != nil {
+		log.Printf("  ⚠ 查询成交明细失败（手续费未记录）: %v", err)
+		return result
+	}
+
+	for _, f := range fills {
+		if f.Oid != result.OrderID {
+			continue
+		}
+		fill := Fill{
+			OrderID:  f.Oid,
+			Symbol:   symbol,
+			Side:     "BUY",
+			FeeAsset: f.FeeToken,
+			Time:     f.Time,
+		}
+		if f.Side == "A" { // Hyperliquid: B=买入, A=卖出
+			fill.Side = "SELL"
+		}
+		fill.Price, _ = strconv.ParseFloat(f.Price, 64)
+		fill.Quantity, _ = strconv.ParseFloat(f.Size, 64)
+		fill.Fee, _ = strconv.ParseFloat(f.Fee, 64)
+		fill.RealizedPnL, _ = strconv.ParseFloat(f.ClosedPnl, 64)
+		result.Fills = append(result.Fills, fill)
+	}
+	result.summarizeFills()
+
+	log.Printf("  💵 成交: 订单ID %d, 均价 %.4f, 数量 %.4f, 手续费 %.4f",
+		result.OrderID, result.AvgPrice, result.FilledQty, result.Fee)
+	return result
+}
+
+// SetPartialTakeProfit 设置部分止盈单（止盈触发单本身为只减仓且按数量成交，直接复用）
+func (t *HyperliquidTrader) SetPartialTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	return t.SetTakeProfit(symbol, positionSide, quantity, takeProfitPrice)
+}
+
+// GetFills 获取指定时间之后的成交记录
+func (t *HyperliquidTrader) GetFills(symbol string, startTime int64) ([]Fill, error) {
+	coin := t.coin(symbol)
+
+	userFills, err := t.exchange.Info().UserFillsByTime(t.ctx, t.walletAddr, startTime, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取成交记录失败: %w", err)
+	}
+
+	var fills []Fill
+	for _, f := range userFills {
+		if f.Coin != coin {
+			continue
+		}
+		fill := Fill{
+			OrderID:  f.Oid,
+			Symbol:   symbol,
+			Side:     "BUY",
+			FeeAsset: f.FeeToken,
+			Time:     f.Time,
+		}
+		if f.Side == "A" { // Hyperliquid: B=买入, A=卖出
+			fill.Side = "SELL"
+		}
+		// Dir 形如 "Open Long" / "Close Short"
+		switch {
+		case strings.HasSuffix(f.Dir, "Long"):
+			fill.PositionSide = "LONG"
+		case strings.HasSuffix(f.Dir, "Short"):
+			fill.PositionSide = "SHORT"
+		}
+		fill.Price, _ = strconv.ParseFloat(f.Price, 64)
+		fill.Quantity, _ = strconv.ParseFloat(f.Size, 64)
+		fill.Fee, _ = strconv.ParseFloat(f.Fee, 64)
+		fill.RealizedPnL, _ = strconv.ParseFloat(f.ClosedPnl, 64)
+		fills = append(fills, fill)
+	}
+	return fills, nil
+}
+
+// GetIncomeHistory 获取指定时间之后的手续费和资金费流水（手续费来自成交记录）
+func (t *HyperliquidTrader) GetIncomeHistory(symbol string, startTime int64) ([]Income, error) {
+	fills, err := t.GetFills(symbol, startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	var incomes []Income
+	for _, fill := range fills {
+		if fill.Fee != 0 {
+			incomes = append(incomes, Income{
+				Symbol: symbol,
+				Type:   IncomeCommission,
+				Amount: -fill.Fee,
+				Asset:  fill.FeeAsset,
+				Time:   fill.Time,
+			})
+		}
+	}
+
+	// 资金费（SDK的userFunding返回结构与接口不符，直接请求info接口）
+	var funding []struct {
+		Time  int64 `json:"time"`
+		Delta struct {
+			Coin string `json:"coin"`
+			Usdc string `json:"usdc"` // 负数表示支付资金费
+		} `json:"delta"`
+	}
+	payload := map[string]interface{}{
+		"type":      "userFunding",
+		"user":      t.walletAddr,
+		"startTime": startTime,
+	}
+	if err := t.postInfo(payload, &funding); err != nil {
+		return nil, fmt.Errorf("获取资金费流水失败: %w", err)
+	}
+	coin := t.coin(symbol)
+	for _, f := range funding {
+		if f.Delta.Coin != coin {
+			continue
+		}
+		amount, _ := strconv.ParseFloat(f.Delta.Usdc, 64)
+		incomes = append(incomes, Income{
+			Symbol: symbol,
+			Type:   IncomeFunding,
+			Amount: amount,
+			Asset:  "USDC",
+			Time:   f.Time,
+		})
+	}
+	return incomes, nil
+}
+
+// postInfo 直接请求info接口并解析响应
+func (t *HyperliquidTrader) postInfo(payload interface{}, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(t.apiURL+"/info", "application/json", strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(data))
+	}
+	return json.Unmarshal(data, out)
+}
+
 // CancelAllOrders 取消该币种的所有挂单
 func (t *HyperliquidTrader) CancelAllOrders(symbol string) error {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coin(symbol)
 
 	// 获取所有挂单
 	openOrders, err := t.exchange.Info().OpenOrders(t.ctx, t.walletAddr)
@@ -488,7 +778,7 @@ func (t *HyperliquidTrader) CancelAllOrders(symbol string) error {
 
 // GetMarketPrice 获取市场价格
 func (t *HyperliquidTrader) GetMarketPrice(symbol string) (float64, error) {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coin(symbol)
 
 	// 获取所有市场价格
 	allMids, err := t.exchange.Info().AllMids(t.ctx)
@@ -510,7 +800,7 @@ func (t *HyperliquidTrader) GetMarketPrice(symbol string) (float64, error) {
 
 // SetStopLoss 设置止损单
 func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coin(symbol)
 
 	isBuy := positionSide == "SHORT" // 空仓止损=买入，多仓止损=卖出
 
@@ -547,7 +837,7 @@ func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quan
 
 // SetTakeProfit 设置止盈单
 func (t *HyperliquidTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coin(symbol)
 
 	isBuy := positionSide == "SHORT" // 空仓止盈=买入，多仓止盈=卖出
 
@@ -584,7 +874,7 @@ func (t *HyperliquidTrader) SetTakeProfit(symbol string, positionSide string, qu
 
 // FormatQuantity 格式化数量到正确的精度
 func (t *HyperliquidTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
-	coin := convertSymbolToHyperliquid(symbol)
+	coin := t.coin(symbol)
 	szDecimals := t.getSzDecimals(coin)
 
 	// 使用szDecimals格式化数量
@@ -592,22 +882,22 @@ func (t *HyperliquidTrader) FormatQuantity(symbol string, quantity float64) (str
 	return fmt.Sprintf(formatStr, quantity), nil
 }
 
+// coin 将标准symbol转换为Hyperliquid币种名（如BTCUSDT -> BTC，保留kPEPE等币种名的大小写）
+func (t *HyperliquidTrader) coin(symbol string) string {
+	if inst, err := t.instruments.Get(symbol); err == nil {
+		return inst.VenueSymbol
+	}
+	return instrument.VenueSymbol("hyperliquid", symbol)
+}
+
 // getSzDecimals 获取币种的数量精度
 func (t *HyperliquidTrader) getSzDecimals(coin string) int {
-	if t.meta == nil {
-		log.Printf("⚠️  meta信息为空，使用默认精度4")
+	inst, err := t.instruments.Get(coin)
+	if err != nil {
+		log.Printf("⚠️  未找到 %s 的精度信息，使用默认精度4", coin)
 		return 4 // 默认精度
 	}
-
-	// 在meta.Universe中查找对应的币种
-	for _, asset := range t.meta.Universe {
-		if asset.Name == coin {
-			return asset.SzDecimals
-		}
-	}
-
-	log.Printf("⚠️  未找到 %s 的精度信息，使用默认精度4", coin)
-	return 4 // 默认精度
+	return inst.QuantityPrecision()
 }
 
 // roundToSzDecimals 将数量四舍五入到正确的精度
@@ -662,16 +952,6 @@ func (t *HyperliquidTrader) roundPriceToSigfigs(price float64) float64 {
 	return rounded
 }
 
-// convertSymbolToHyperliquid 将标准symbol转换为Hyperliquid格式
-// 例如: "BTCUSDT" -> "BTC"
-func convertSymbolToHyperliquid(symbol string) string {
-	// 去掉USDT后缀
-	if len(symbol) > 4 && symbol[len(symbol)-4:] == "USDT" {
-		return symbol[:len(symbol)-4]
-	}
-	return symbol
-}
-
 // absFloat 返回浮点数的绝对值
 func absFloat(x float64) float64 {
 	if x < 0 {
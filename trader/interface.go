@@ -1,29 +1,48 @@
 package trader
 
+import "nofx/instrument"
+
 // Trader 交易器统一接口
 // 支持多个交易平台（币安、Hyperliquid等）
 type Trader interface {
 	// GetBalance 获取账户余额
-	GetBalance() (map[string]interface{}, error)
+	GetBalance() (*Balance, error)
 
 	// GetPositions 获取所有持仓
-	GetPositions() ([]map[string]interface{}, error)
+	GetPositions() ([]Position, error)
 
 	// OpenLong 开多仓
-	OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error)
+	OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error)
 
 	// OpenShort 开空仓
-	OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error)
+	OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error)
+
+	// AddToPosition 对已有持仓市价加仓（side为"long"或"short"）
+	// 与OpenLong/OpenShort不同，不撤销该币种已有的止损止盈单和挂单
+	AddToPosition(symbol, side string, quantity float64, leverage int) (*OrderResult, error)
 
 	// CloseLong 平多仓（quantity=0表示全部平仓）
-	CloseLong(symbol string, quantity float64) (map[string]interface{}, error)
+	CloseLong(symbol string, quantity float64) (*OrderResult, error)
 
 	// CloseShort 平空仓（quantity=0表示全部平仓）
-	CloseShort(symbol string, quantity float64) (map[string]interface{}, error)
+	CloseShort(symbol string, quantity float64) (*OrderResult, error)
+
+	// PlaceLimitOrder 挂限价开仓单（side为"long"或"short"）
+	// postOnly=true时只做Maker，会立即成交的订单由交易所拒绝或返回EXPIRED状态
+	PlaceLimitOrder(symbol, side string, quantity, price float64, leverage int, postOnly bool) (*OrderResult, error)
+
+	// GetOpenOrders 获取未成交挂单（symbol为空表示所有币种）
+	GetOpenOrders(symbol string) ([]Order, error)
+
+	// CancelOrder 撤销指定挂单
+	CancelOrder(symbol string, orderID int64) error
 
 	// SetLeverage 设置杠杆
 	SetLeverage(symbol string, leverage int) error
 
+	// SetMarginMode 设置该币种后续开仓使用的保证金模式（MarginModeIsolated / MarginModeCross，开仓前生效）
+	SetMarginMode(symbol string, mode string) error
+
 	// GetMarketPrice 获取市场价格
 	GetMarketPrice(symbol string) (float64, error)
 
@@ -33,9 +52,21 @@ type Trader interface {
 	// SetTakeProfit 设置止盈单
 	SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error
 
+	// SetPartialTakeProfit 设置部分止盈单（只减仓，触发后按指定数量平仓，用于分批止盈阶梯）
+	SetPartialTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error
+
+	// GetFills 获取指定时间之后的成交记录（startTime为毫秒时间戳，用于对账时识别交易所侧平仓）
+	GetFills(symbol string, startTime int64) ([]Fill, error)
+
+	// GetIncomeHistory 获取指定时间之后的手续费和资金费流水（startTime为毫秒时间戳）
+	GetIncomeHistory(symbol string, startTime int64) ([]Income, error)
+
 	// CancelAllOrders 取消该币种的所有挂单
 	CancelAllOrders(symbol string) error
 
 	// FormatQuantity 格式化数量到正确的精度
 	FormatQuantity(symbol string, quantity float64) (string, error)
+
+	// GetInstrument 获取交易对元数据（精度、最小下单金额、最大杠杆、上市状态）
+	GetInstrument(symbol string) (*instrument.Instrument, error)
 }
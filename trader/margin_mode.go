@@ -0,0 +1,79 @@
+package trader
+
+import (
+	"fmt"
+	"sync"
+)
+
+// 保证金模式
+const (
+	MarginModeIsolated = "isolated" // 逐仓
+	MarginModeCross    = "cross"    // 全仓
+)
+
+// ValidateMarginMode 检查保证金模式是否有效（空字符串表示使用默认的逐仓）
+func ValidateMarginMode(mode string) error {
+	switch mode {
+	case "", MarginModeIsolated, MarginModeCross:
+		return nil
+	}
+	return fmt.Errorf("无效的保证金模式: %s（可选 isolated / cross）", mode)
+}
+
+// marginModeSettings 各币种开仓使用的保证金模式（未设置的币种使用逐仓，零值可直接使用）
+type marginModeSettings struct {
+	modes   map[string]string
+	applied map[string]string // 各币种在交易所已生效的保证金模式
+	mu      sync.RWMutex
+}
+
+// set 记录币种的保证金模式
+func (m *marginModeSettings) set(symbol, mode string) error {
+	if err := ValidateMarginMode(mode); err != nil {
+		return err
+	}
+	if mode == "" {
+		mode = MarginModeIsolated
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.modes == nil {
+		m.modes = make(map[string]string)
+	}
+	m.modes[symbol] = mode
+	return nil
+}
+
+// get 获取币种的保证金模式
+func (m *marginModeSettings) get(symbol string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if mode, ok := m.modes[symbol]; ok {
+		return mode
+	}
+	return MarginModeIsolated
+}
+
+// isCross 币种是否使用全仓
+func (m *marginModeSettings) isCross(symbol string) bool {
+	return m.get(symbol) == MarginModeCross
+}
+
+// needsApply 币种设置的保证金模式是否尚未在交易所生效，返回设置的模式
+func (m *marginModeSettings) needsApply(symbol string) (string, bool) {
+	mode := m.get(symbol)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return mode, m.applied[symbol] != mode
+}
+
+// markApplied 记录币种在交易所已生效的保证金模式（模式不变时不再调用交易所接口）
+func (m *marginModeSettings) markApplied(symbol, mode string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.applied == nil {
+		m.applied = make(map[string]string)
+	}
+	m.applied[symbol] = mode
+}
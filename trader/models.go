@@ -0,0 +1,99 @@
+package trader
+
+// Balance 账户余额（USDT计价）
+type Balance struct {
+	TotalWalletBalance    float64 // 钱包余额（不含未实现盈亏）
+	AvailableBalance      float64 // 可用余额
+	TotalUnrealizedProfit float64 // 未实现盈亏
+}
+
+// Position 持仓信息
+type Position struct {
+	Symbol           string  // 币种，如 BTCUSDT
+	Side             string  // "long" or "short"
+	Quantity         float64 // 持仓数量（始终为正数，方向由Side表示）
+	EntryPrice       float64 // 开仓均价
+	MarkPrice        float64 // 标记价格
+	UnrealizedPnL    float64 // 未实现盈亏
+	Leverage         int     // 杠杆倍数
+	LiquidationPrice float64 // 强平价
+	MarginMode       string  // MarginModeIsolated / MarginModeCross（交易所未返回时为空）
+	Margin           float64 // 占用保证金（逐仓为仓位保证金，全仓为初始保证金；交易所未返回时为0）
+	OpenTime         int64   // 开仓时间（毫秒，交易所不提供时为0）
+	UpdateTime       int64   // 最近更新时间（毫秒，交易所不提供时为0）
+}
+
+// OrderResult 下单结果（市价单成交后返回）
+type OrderResult struct {
+	OrderID   int64   // 交易所订单ID
+	Symbol    string  // 币种
+	Status    string  // 订单状态，如 FILLED / PARTIALLY_FILLED / NEW
+	AvgPrice  float64 // 成交均价（未知时为0）
+	FilledQty float64 // 成交数量（未知时为0）
+	Fee       float64 // 手续费（USDT计价）
+	Leverage  int     // 下单时使用的杠杆（平仓为0）
+	Fills     []Fill  // 逐笔成交明细（交易所未返回时为空）
+}
+
+// Order 未成交挂单（限价开仓单或止损止盈触发单）
+type Order struct {
+	OrderID      int64   // 交易所订单ID
+	Symbol       string  // 币种
+	Side         string  // "BUY" or "SELL"
+	PositionSide string  // "LONG" or "SHORT"（单向持仓模式下由Side和ReduceOnly推断）
+	Type         string  // LIMIT / STOP_MARKET / TAKE_PROFIT_MARKET
+	Price        float64 // 限价（触发单为0）
+	StopPrice    float64 // 触发价（限价单为0）
+	Quantity     float64 // 委托数量
+	FilledQty    float64 // 已成交数量
+	ReduceOnly   bool    // 是否只减仓
+	Time         int64   // 下单时间（毫秒）
+}
+
+// Fill 逐笔成交
+type Fill struct {
+	OrderID      int64   // 所属订单ID
+	Symbol       string  // 币种
+	Side         string  // "BUY" or "SELL"
+	PositionSide string  // "LONG" or "SHORT"（交易所未返回时为空）
+	Price        float64 // 成交价格
+	Quantity     float64 // 成交数量
+	Fee          float64 // 手续费
+	FeeAsset     string  // 手续费币种
+	RealizedPnL  float64 // 已实现盈亏（平仓成交时）
+	Time         int64   // 成交时间（毫秒）
+}
+
+// 账户流水类型
+const (
+	IncomeCommission = "COMMISSION"  // 交易手续费
+	IncomeFunding    = "FUNDING_FEE" // 资金费
+)
+
+// Income 账户流水（手续费、资金费）
+type Income struct {
+	Symbol string  // 币种
+	Type   string  // IncomeCommission / IncomeFunding
+	Amount float64 // 金额（USDT，正数为收入，负数为支出）
+	Asset  string  // 结算币种
+	Time   int64   // 发生时间（毫秒）
+}
+
+// summarizeFills 根据逐笔成交汇总成交均价、成交数量和手续费
+func (r *OrderResult) summarizeFills() {
+	if len(r.Fills) == 0 {
+		return
+	}
+
+	var qty, notional, fee float64
+	for _, f := range r.Fills {
+		qty += f.Quantity
+		notional += f.Price * f.Quantity
+		fee += f.Fee
+	}
+	if qty > 0 {
+		r.FilledQty = qty
+		r.AvgPrice = notional / qty
+	}
+	r.Fee = fee
+}
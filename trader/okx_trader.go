@@ -0,0 +1,1118 @@
+package trader
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"nofx/instrument"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OKXTrader OKX永续合约交易器（USDT本位，逐仓或全仓）
+type OKXTrader struct {
+	apiKey     string
+	secretKey  string
+	passphrase string
+	testnet    bool // 模拟盘（请求头 x-simulated-trading: 1）
+	client     *http.Client
+	baseURL    string
+	nowFunc    func() time.Time // 签名时间戳使用的时钟
+
+	// 合约元数据（数量按币计）、张数步进、持仓模式和策略委托ID
+	instruments *instrument.Registry
+	lotSizes    map[string]float64 // 合约ID -> 下单数量步进（张）
+	hedgeMode   *bool              // 是否为双向持仓模式（long_short_mode）
+	algoOrders  map[int64]string   // 未完结的止损止盈策略委托ID -> 币种（撤单需走策略委托接口）
+	mu          sync.RWMutex
+
+	// 各币种的保证金模式（下单的tdMode，平仓和止损止盈需与持仓一致）
+	marginModes marginModeSettings
+}
+
+// NewOKXTrader 创建OKX交易器
+// passphrase: 创建API Key时设置的密码
+// testnet: 使用模拟盘（需使用模拟盘API Key）
+func NewOKXTrader(apiKey, secretKey, passphrase string, testnet bool) *OKXTrader {
+	t := &OKXTrader{
+		apiKey:     apiKey,
+		secretKey:  secretKey,
+		passphrase: passphrase,
+		testnet:    testnet,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		baseURL:    "https://www.okx.com",
+		nowFunc:    time.Now,
+		lotSizes:   make(map[string]float64),
+		algoOrders: make(map[int64]string),
+	}
+	t.instruments = instrument.NewRegistry("okx", t.loadInstruments)
+	return t
+}
+
+// SetBaseURL 设置API地址（默认 https://www.okx.com）
+func (t *OKXTrader) SetBaseURL(baseURL string) {
+	t.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// SetClock 设置签名时间戳使用的时钟
+func (t *OKXTrader) SetClock(nowFunc func() time.Time) {
+	t.nowFunc = nowFunc
+}
+
+// okxInstID 币种转换为OKX合约ID（BTCUSDT -> BTC-USDT-SWAP）
+func okxInstID(symbol string) string {
+	return instrument.VenueSymbol("okx", symbol)
+}
+
+// okxResponse OKX通用响应
+type okxResponse struct {
+	Code string          `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// okxOrderAck 下单/撤单结果（每个订单单独返回错误码）
+type okxOrderAck struct {
+	OrdID  string `json:"ordId"`
+	AlgoID string `json:"algoId"`
+	SCode  string `json:"sCode"`
+	SMsg   string `json:"sMsg"`
+}
+
+// request 发送签名请求，返回data字段
+// 签名: Base64(HMAC-SHA256(secret, timestamp + method + requestPath + body))
+func (t *OKXTrader) request(method, path string, query url.Values, body interface{}) (json.RawMessage, error) {
+	requestPath := path
+	if len(query) > 0 {
+		requestPath += "?" + query.Encode()
+	}
+
+	bodyStr := ""
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("序列化请求失败: %w", err)
+		}
+		bodyStr = string(data)
+	}
+
+	timestamp := t.nowFunc().UTC().Format("2006-01-02T15:04:05.000Z")
+	mac := hmac.New(sha256.New, []byte(t.secretKey))
+	mac.Write([]byte(timestamp + method + requestPath + bodyStr))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequest(method, t.baseURL+requestPath, strings.NewReader(bodyStr))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("OK-ACCESS-KEY", t.apiKey)
+	req.Header.Set("OK-ACCESS-SIGN", signature)
+	req.Header.Set("OK-ACCESS-TIMESTAMP", timestamp)
+	req.Header.Set("OK-ACCESS-PASSPHRASE", t.passphrase)
+	if t.testnet {
+		req.Header.Set("x-simulated-trading", "1")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result okxResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if result.Code != "0" {
+		// 下单类接口的具体错误在data的sCode/sMsg中
+		var acks []okxOrderAck
+		if json.Unmarshal(result.Data, &acks) == nil && len(acks) > 0 && acks[0].SMsg != "" {
+			return nil, fmt.Errorf("OKX错误 %s: %s (%s: %s)", result.Code, result.Msg, acks[0].SCode, acks[0].SMsg)
+		}
+		return nil, fmt.Errorf("OKX错误 %s: %s", result.Code, result.Msg)
+	}
+	return result.Data, nil
+}
+
+// loadInstruments 加载全部USDT本位永续合约元数据（张数按面值换算为币数量）
+func (t *OKXTrader) loadInstruments() ([]instrument.Instrument, error) {
+	data, err := t.request("GET", "/api/v5/public/instruments", url.Values{"instType": {"SWAP"}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取合约信息失败: %w", err)
+	}
+	var list []struct {
+		InstID    string `json:"instId"`
+		SettleCcy string `json:"settleCcy"`
+		CtVal     string `json:"ctVal"`
+		LotSz     string `json:"lotSz"`
+		MinSz     string `json:"minSz"`
+		TickSz    string `json:"tickSz"`
+		Lever     string `json:"lever"`
+		State     string `json:"state"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("解析合约信息失败: %w", err)
+	}
+
+	lotSizes := make(map[string]float64, len(list))
+	instruments := make([]instrument.Instrument, 0, len(list))
+	for _, item := range list {
+		if item.SettleCcy != "" && item.SettleCcy != "USDT" {
+			continue
+		}
+		ctVal, _ := strconv.ParseFloat(item.CtVal, 64)
+		if ctVal <= 0 {
+			continue
+		}
+		lotSz, _ := strconv.ParseFloat(item.LotSz, 64)
+		minSz, _ := strconv.ParseFloat(item.MinSz, 64)
+		inst := instrument.Instrument{
+			Symbol:       item.InstID,
+			VenueSymbol:  item.InstID,
+			StepSize:     ctVal * lotSz,
+			MinQty:       ctVal * minSz,
+			ContractSize: ctVal,
+			Status:       instrument.StatusSuspended,
+		}
+		inst.TickSize, _ = strconv.ParseFloat(item.TickSz, 64)
+		inst.MaxLeverage, _ = strconv.Atoi(item.Lever)
+		switch item.State {
+		case "live":
+			inst.Status = instrument.StatusTrading
+		case "expired":
+			inst.Status = instrument.StatusDelisted
+		}
+		lotSizes[item.InstID] = lotSz
+		instruments = append(instruments, inst)
+	}
+
+	t.mu.Lock()
+	t.lotSizes = lotSizes
+	t.mu.Unlock()
+	return instruments, nil
+}
+
+// getInstrument 获取合约元数据
+func (t *OKXTrader) getInstrument(symbol string) (*instrument.Instrument, error) {
+	return t.instruments.Get(symbol)
+}
+
+// GetInstrument 获取交易对元数据
+func (t *OKXTrader) GetInstrument(symbol string) (*instrument.Instrument, error) {
+	return t.instruments.Get(symbol)
+}
+
+// GetSymbolPrecision 获取交易对的数量精度（按币数量计，即面值×张数步进）
+func (t *OKXTrader) GetSymbolPrecision(symbol string) (int, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return 0, err
+	}
+	return inst.QuantityPrecision(), nil
+}
+
+// formatStep 按步进值取整并格式化为字符串
+func formatStep(value, step float64) string {
+	if step <= 0 {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	precision := calculatePrecision(strconv.FormatFloat(step, 'f', -1, 64))
+	return strconv.FormatFloat(roundToTickSize(value, step), 'f', precision, 64)
+}
+
+// contracts 币数量换算为下单张数（向下取整到张数步进，避免超出可用保证金或持仓数量）
+func (t *OKXTrader) contracts(symbol string, quantity float64) (string, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return "", err
+	}
+	t.mu.RLock()
+	lotSz := t.lotSizes[inst.VenueSymbol]
+	t.mu.RUnlock()
+
+	sz := quantity / inst.ContractSize
+	if lotSz > 0 {
+		sz = math.Floor(sz/lotSz+1e-9) * lotSz
+	}
+	if sz <= 0 || sz*inst.ContractSize < inst.MinQty*(1-1e-9) {
+		return "", fmt.Errorf("%s 下单数量%.8f小于最小下单量%.8f", symbol, quantity, inst.MinQty)
+	}
+	return formatStep(sz, lotSz), nil
+}
+
+// formatPrice 按价格步进格式化价格
+func (t *OKXTrader) formatPrice(symbol string, price float64) (string, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return "", err
+	}
+	return inst.FormatPrice(price), nil
+}
+
+// isHedgeMode 是否为双向持仓模式（带缓存）
+func (t *OKXTrader) isHedgeMode() (bool, error) {
+	t.mu.RLock()
+	if t.hedgeMode != nil {
+		hedge := *t.hedgeMode
+		t.mu.RUnlock()
+		return hedge, nil
+	}
+	t.mu.RUnlock()
+
+	data, err := t.request("GET", "/api/v5/account/config", nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("获取账户配置失败: %w", err)
+	}
+	var configs []struct {
+		PosMode string `json:"posMode"`
+	}
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return false, fmt.Errorf("解析账户配置失败: %w", err)
+	}
+	hedge := len(configs) > 0 && configs[0].PosMode == "long_short_mode"
+	if hedge {
+		log.Printf("  📐 OKX持仓模式: 双向持仓")
+	} else {
+		log.Printf("  📐 OKX持仓模式: 单向持仓")
+	}
+
+	t.mu.Lock()
+	t.hedgeMode = &hedge
+	t.mu.Unlock()
+	return hedge, nil
+}
+
+// GetBalance 获取账户余额
+func (t *OKXTrader) GetBalance() (*Balance, error) {
+	data, err := t.request("GET", "/api/v5/account/balance", url.Values{"ccy": {"USDT"}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取账户余额失败: %w", err)
+	}
+	var accounts []struct {
+		Details []struct {
+			Ccy      string `json:"ccy"`
+			CashBal  string `json:"cashBal"`
+			AvailBal string `json:"availBal"`
+			AvailEq  string `json:"availEq"`
+			Upl      string `json:"upl"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("解析账户余额失败: %w", err)
+	}
+
+	result := &Balance{}
+	for _, account := range accounts {
+		for _, d := range account.Details {
+			if d.Ccy != "USDT" {
+				continue
+			}
+			result.TotalWalletBalance, _ = strconv.ParseFloat(d.CashBal, 64)
+			result.TotalUnrealizedProfit, _ = strconv.ParseFloat(d.Upl, 64)
+			// 保证金模式账户返回availEq，简单交易模式返回availBal
+			if availEq, err := strconv.ParseFloat(d.AvailEq, 64); err == nil && availEq > 0 {
+				result.AvailableBalance = availEq
+			} else {
+				result.AvailableBalance, _ = strconv.ParseFloat(d.AvailBal, 64)
+			}
+		}
+	}
+	return result, nil
+}
+
+// GetPositions 获取所有持仓
+func (t *OKXTrader) GetPositions() ([]Position, error) {
+	data, err := t.request("GET", "/api/v5/account/positions", url.Values{"instType": {"SWAP"}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓失败: %w", err)
+	}
+	var positions []struct {
+		InstID  string `json:"instId"`
+		PosSide string `json:"posSide"` // long / short / net
+		Pos     string `json:"pos"`     // 持仓张数（单向持仓时正负表示方向）
+		AvgPx   string `json:"avgPx"`
+		MarkPx  string `json:"markPx"`
+		Upl     string `json:"upl"`
+		Lever   string `json:"lever"`
+		LiqPx   string `json:"liqPx"`
+		MgnMode string `json:"mgnMode"` // isolated / cross
+		Margin  string `json:"margin"`  // 逐仓保证金
+		Imr     string `json:"imr"`     // 全仓初始保证金
+		CTime   string `json:"cTime"`
+		UTime   string `json:"uTime"`
+	}
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return nil, fmt.Errorf("解析持仓失败: %w", err)
+	}
+
+	var result []Position
+	for _, pos := range positions {
+		if !strings.HasSuffix(pos.InstID, "-USDT-SWAP") {
+			continue
+		}
+		contracts, _ := strconv.ParseFloat(pos.Pos, 64)
+		if contracts == 0 {
+			continue
+		}
+
+		symbol := instrument.Canonical(pos.InstID)
+		inst, err := t.getInstrument(symbol)
+		if err != nil {
+			return nil, err
+		}
+
+		side := pos.PosSide
+		if side == "net" {
+			side = "long"
+			if contracts < 0 {
+				side = "short"
+			}
+		}
+
+		p := Position{
+			Symbol:   symbol,
+			Side:     side,
+			Quantity: math.Abs(contracts) * inst.ContractSize,
+		}
+		p.EntryPrice, _ = strconv.ParseFloat(pos.AvgPx, 64)
+		p.MarkPrice, _ = strconv.ParseFloat(pos.MarkPx, 64)
+		p.UnrealizedPnL, _ = strconv.ParseFloat(pos.Upl, 64)
+		p.LiquidationPrice, _ = strconv.ParseFloat(pos.LiqPx, 64)
+		lever, _ := strconv.ParseFloat(pos.Lever, 64)
+		p.Leverage = int(lever)
+		p.OpenTime, _ = strconv.ParseInt(pos.CTime, 10, 64)
+		p.UpdateTime, _ = strconv.ParseInt(pos.UTime, 10, 64)
+		if pos.MgnMode == MarginModeCross {
+			p.MarginMode = MarginModeCross
+			p.Margin, _ = strconv.ParseFloat(pos.Imr, 64)
+		} else {
+			p.MarginMode = MarginModeIsolated
+			p.Margin, _ = strconv.ParseFloat(pos.Margin, 64)
+		}
+		// 同步持仓的保证金模式（重启后平仓和止损止盈仍使用持仓的tdMode）
+		t.marginModes.set(symbol, p.MarginMode)
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// placeOrder 下单，返回订单ID
+// side: buy/sell，posSide: long/short（双向持仓模式使用，单向持仓模式平仓时改用reduceOnly）
+func (t *OKXTrader) placeOrder(symbol, side, posSide, ordType string, quantity, price float64, reduceOnly bool) (int64, error) {
+	hedge, err := t.isHedgeMode()
+	if err != nil {
+		return 0, err
+	}
+	sz, err := t.contracts(symbol, quantity)
+	if err != nil {
+		return 0, err
+	}
+
+	params := map[string]interface{}{
+		"instId":  okxInstID(symbol),
+		"tdMode":  t.marginModes.get(symbol),
+		"side":    side,
+		"ordType": ordType,
+		"sz":      sz,
+	}
+	if hedge {
+		params["posSide"] = posSide
+	} else if reduceOnly {
+		params["reduceOnly"] = true
+	}
+	if ordType != "market" {
+		px, err := t.formatPrice(symbol, price)
+		if err != nil {
+			return 0, err
+		}
+		params["px"] = px
+	}
+
+	data, err := t.request("POST", "/api/v5/trade/order", nil, params)
+	if err != nil {
+		return 0, err
+	}
+	var acks []okxOrderAck
+	if err := json.Unmarshal(data, &acks); err != nil || len(acks) == 0 {
+		return 0, fmt.Errorf("解析下单响应失败: %s", string(data))
+	}
+	if acks[0].SCode != "0" {
+		return 0, fmt.Errorf("下单失败 %s: %s", acks[0].SCode, acks[0].SMsg)
+	}
+	return strconv.ParseInt(acks[0].OrdID, 10, 64)
+}
+
+// okxOrderStatus 订单状态转换为统一状态
+func okxOrderStatus(state string) string {
+	switch state {
+	case "live":
+		return "NEW"
+	case "partially_filled":
+		return "PARTIALLY_FILLED"
+	case "filled":
+		return "FILLED"
+	case "canceled", "mmp_canceled":
+		return "CANCELED"
+	}
+	return strings.ToUpper(state)
+}
+
+// buildOrderResult 查询订单状态和成交明细，补充成交均价、成交数量和手续费
+func (t *OKXTrader) buildOrderResult(symbol string, orderID int64, leverage int) (*OrderResult, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return nil, err
+	}
+	result := &OrderResult{OrderID: orderID, Symbol: symbol, Status: "NEW", Leverage: leverage}
+
+	query := url.Values{"instId": {inst.VenueSymbol}, "ordId": {strconv.FormatInt(orderID, 10)}}
+	data, err := t.request("GET", "/api/v5/trade/order", query, nil)
+	if err != nil {
+		log.Printf("  ⚠ 查询订单状态失败: %v", err)
+		return result, nil
+	}
+	var orders []struct {
+		State     string `json:"state"`
+		AvgPx     string `json:"avgPx"`
+		AccFillSz string `json:"accFillSz"`
+		Fee       string `json:"fee"`
+	}
+	if err := json.Unmarshal(data, &orders); err != nil || len(orders) == 0 {
+		log.Printf("  ⚠ 解析订单状态失败: %s", string(data))
+		return result, nil
+	}
+	result.Status = okxOrderStatus(orders[0].State)
+	result.AvgPrice, _ = strconv.ParseFloat(orders[0].AvgPx, 64)
+	filled, _ := strconv.ParseFloat(orders[0].AccFillSz, 64)
+	result.FilledQty = filled * inst.ContractSize
+	fee, _ := strconv.ParseFloat(orders[0].Fee, 64)
+	result.Fee = -fee // OKX手续费为负数表示扣除
+	if filled == 0 {
+		return result, nil
+	}
+
+	// 逐笔成交明细
+	query.Set("instType", "SWAP")
+	fillsData, err := t.request("GET", "/api/v5/trade/fills", query, nil)
+	if err != nil {
+		log.Printf("  ⚠ 查询成交明细失败: %v", err)
+		return result, nil
+	}
+	var fills []struct {
+		OrdID   string `json:"ordId"`
+		Side    string `json:"side"`
+		FillPx  string `json:"fillPx"`
+		FillSz  string `json:"fillSz"`
+		Fee     string `json:"fee"`
+		FeeCcy  string `json:"feeCcy"`
+		FillPnl string `json:"fillPnl"`
+		Ts      string `json:"ts"`
+	}
+	if err := json.Unmarshal(fillsData, &fills); err != nil {
+		log.Printf("  ⚠ 解析成交明细失败: %v", err)
+		return result, nil
+	}
+	for _, f := range fills {
+		fill := Fill{
+			OrderID:  orderID,
+			Symbol:   symbol,
+			Side:     strings.ToUpper(f.Side),
+			FeeAsset: f.FeeCcy,
+		}
+		fill.Price, _ = strconv.ParseFloat(f.FillPx, 64)
+		sz, _ := strconv.ParseFloat(f.FillSz, 64)
+		fill.Quantity = sz * inst.ContractSize
+		fee, _ := strconv.ParseFloat(f.Fee, 64)
+		fill.Fee = -fee
+		fill.RealizedPnL, _ = strconv.ParseFloat(f.FillPnl, 64)
+		fill.Time, _ = strconv.ParseInt(f.Ts, 10, 64)
+		result.Fills = append(result.Fills, fill)
+	}
+	result.summarizeFills()
+
+	log.Printf("  💵 成交: 订单ID %d, 均价 %.4f, 数量 %.4f, 手续费 %.4f",
+		result.OrderID, result.AvgPrice, result.FilledQty, result.Fee)
+	return result, nil
+}
+
+// open 市价开仓（多空通用，不撤销已有委托单）
+func (t *OKXTrader) open(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	orderSide := "buy"
+	if side == "short" {
+		orderSide = "sell"
+	}
+	orderID, err := t.placeOrder(symbol, orderSide, side, "market", quantity, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("开%s仓失败: %w", sideLabel(side), err)
+	}
+	log.Printf("✓ 开%s仓成功: %s 数量: %.8f 订单ID: %d", sideLabel(side), symbol, quantity, orderID)
+	return t.buildOrderResult(symbol, orderID, leverage)
+}
+
+// close 市价平仓（多空通用，quantity=0表示全部平仓）
+func (t *OKXTrader) close(symbol, side string, quantity float64) (*OrderResult, error) {
+	closeAll := quantity == 0
+	if closeAll {
+		positions, err := t.GetPositions()
+		if err != nil {
+			return nil, err
+		}
+		for _, pos := range positions {
+			if pos.Symbol == symbol && pos.Side == side {
+				quantity = pos.Quantity
+				break
+			}
+		}
+		if quantity == 0 {
+			return nil, fmt.Errorf("没有找到 %s 的%s仓", symbol, sideLabel(side))
+		}
+	}
+
+	orderSide := "sell"
+	if side == "short" {
+		orderSide = "buy"
+	}
+	orderID, err := t.placeOrder(symbol, orderSide, side, "market", quantity, 0, true)
+	if err != nil {
+		return nil, fmt.Errorf("平%s仓失败: %w", sideLabel(side), err)
+	}
+	log.Printf("✓ 平%s仓成功: %s 数量: %.8f", sideLabel(side), symbol, quantity)
+
+	// 全部平仓后取消该币种的所有挂单（部分平仓时保留止损止盈单）
+	if closeAll {
+		if err := t.CancelAllOrders(symbol); err != nil {
+			log.Printf("  ⚠ 取消挂单失败: %v", err)
+		}
+	}
+	return t.buildOrderResult(symbol, orderID, 0)
+}
+
+// OpenLong 开多仓
+func (t *OKXTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	// 先取消该币种的所有委托单（清理旧的止损止盈单）
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
+	}
+	return t.open(symbol, "long", quantity, leverage)
+}
+
+// OpenShort 开空仓
+func (t *OKXTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	// 先取消该币种的所有委托单（清理旧的止损止盈单）
+	if err := t.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
+	}
+	return t.open(symbol, "short", quantity, leverage)
+}
+
+// AddToPosition 市价加仓（保留该币种已有的止损止盈单和挂单）
+func (t *OKXTrader) AddToPosition(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.open(symbol, side, quantity, leverage)
+}
+
+// CloseLong 平多仓（quantity=0表示全部平仓）
+func (t *OKXTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
+	return t.close(symbol, "long", quantity)
+}
+
+// CloseShort 平空仓（quantity=0表示全部平仓）
+func (t *OKXTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
+	return t.close(symbol, "short", quantity)
+}
+
+// PlaceLimitOrder 挂限价开仓单（postOnly使用post_only订单类型，会立即成交时被交易所撤销）
+func (t *OKXTrader) PlaceLimitOrder(symbol, side string, quantity, price float64, leverage int, postOnly bool) (*OrderResult, error) {
+	if err := t.SetLeverage(symbol, leverage); err != nil {
+		return nil, err
+	}
+
+	orderSide := "buy"
+	if side == "short" {
+		orderSide = "sell"
+	}
+	ordType := "limit"
+	if postOnly {
+		ordType = "post_only"
+	}
+	orderID, err := t.placeOrder(symbol, orderSide, side, ordType, quantity, price, false)
+	if err != nil {
+		return nil, fmt.Errorf("挂限价单失败: %w", err)
+	}
+
+	result, err := t.buildOrderResult(symbol, orderID, leverage)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✓ 限价单已提交: %s %s 价格: %.4f 数量: %.8f 状态: %s", symbol, side, price, quantity, result.Status)
+	return result, nil
+}
+
+// GetOpenOrders 获取未成交挂单（普通委托和止损止盈策略委托，symbol为空表示所有币种）
+func (t *OKXTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	query := url.Values{"instType": {"SWAP"}}
+	if symbol != "" {
+		query.Set("instId", okxInstID(symbol))
+	}
+
+	data, err := t.request("GET", "/api/v5/trade/orders-pending", query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取挂单失败: %w", err)
+	}
+	var pending []struct {
+		OrdID      string `json:"ordId"`
+		InstID     string `json:"instId"`
+		Side       string `json:"side"`
+		PosSide    string `json:"posSide"`
+		OrdType    string `json:"ordType"`
+		Px         string `json:"px"`
+		Sz         string `json:"sz"`
+		AccFillSz  string `json:"accFillSz"`
+		ReduceOnly string `json:"reduceOnly"`
+		CTime      string `json:"cTime"`
+	}
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return nil, fmt.Errorf("解析挂单失败: %w", err)
+	}
+
+	var result []Order
+	for _, o := range pending {
+		inst, err := t.getInstrument(instrument.Canonical(o.InstID))
+		if err != nil {
+			return nil, err
+		}
+		order := Order{
+			Symbol:     instrument.Canonical(o.InstID),
+			Side:       strings.ToUpper(o.Side),
+			Type:       strings.ToUpper(o.OrdType),
+			ReduceOnly: o.ReduceOnly == "true",
+		}
+		if o.PosSide == "long" || o.PosSide == "short" {
+			order.PositionSide = strings.ToUpper(o.PosSide)
+		}
+		if order.Type == "POST_ONLY" {
+			order.Type = "LIMIT"
+		}
+		order.OrderID, _ = strconv.ParseInt(o.OrdID, 10, 64)
+		order.Price, _ = strconv.ParseFloat(o.Px, 64)
+		sz, _ := strconv.ParseFloat(o.Sz, 64)
+		filled, _ := strconv.ParseFloat(o.AccFillSz, 64)
+		order.Quantity = sz * inst.ContractSize
+		order.FilledQty = filled * inst.ContractSize
+		order.Time, _ = strconv.ParseInt(o.CTime, 10, 64)
+		result = append(result, order)
+	}
+
+	// 止损止盈策略委托
+	query.Set("ordType", "conditional")
+	algoData, err := t.request("GET", "/api/v5/trade/orders-algo-pending", query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取止损止盈委托失败: %w", err)
+	}
+	var algos []struct {
+		AlgoID        string `json:"algoId"`
+		InstID        string `json:"instId"`
+		Side          string `json:"side"`
+		PosSide       string `json:"posSide"`
+		Sz            string `json:"sz"`
+		SlTriggerPx   string `json:"slTriggerPx"`
+		TpTriggerPx   string `json:"tpTriggerPx"`
+		ReduceOnly    string `json:"reduceOnly"`
+		CloseFraction string `json:"closeFraction"`
+		CTime         string `json:"cTime"`
+	}
+	if err := json.Unmarshal(algoData, &algos); err != nil {
+		return nil, fmt.Errorf("解析止损止盈委托失败: %w", err)
+	}
+
+	open := make(map[int64]string, len(algos))
+	for _, o := range algos {
+		inst, err := t.getInstrument(instrument.Canonical(o.InstID))
+		if err != nil {
+			return nil, err
+		}
+		order := Order{
+			Symbol:     instrument.Canonical(o.InstID),
+			Side:       strings.ToUpper(o.Side),
+			Type:       "STOP_MARKET",
+			ReduceOnly: true, // 止损止盈委托只用于平仓
+		}
+		if o.PosSide == "long" || o.PosSide == "short" {
+			order.PositionSide = strings.ToUpper(o.PosSide)
+		}
+		order.StopPrice, _ = strconv.ParseFloat(o.SlTriggerPx, 64)
+		if order.StopPrice == 0 {
+			order.Type = "TAKE_PROFIT_MARKET"
+			order.StopPrice, _ = strconv.ParseFloat(o.TpTriggerPx, 64)
+		}
+		order.OrderID, _ = strconv.ParseInt(o.AlgoID, 10, 64)
+		sz, _ := strconv.ParseFloat(o.Sz, 64)
+		order.Quantity = sz * inst.ContractSize
+		order.Time, _ = strconv.ParseInt(o.CTime, 10, 64)
+		result = append(result, order)
+		open[order.OrderID] = order.Symbol
+	}
+
+	// 以交易所返回的策略委托替换该币种的记录（移除已触发或已撤销的委托）
+	t.mu.Lock()
+	for id, algoSymbol := range t.algoOrders {
+		if symbol == "" || algoSymbol == symbol {
+			delete(t.algoOrders, id)
+		}
+	}
+	for id, algoSymbol := range open {
+		t.algoOrders[id] = algoSymbol
+	}
+	t.mu.Unlock()
+	return result, nil
+}
+
+// CancelOrder 撤销指定挂单（止损止盈策略委托走策略撤单接口）
+func (t *OKXTrader) CancelOrder(symbol string, orderID int64) error {
+	t.mu.RLock()
+	_, isAlgo := t.algoOrders[orderID]
+	t.mu.RUnlock()
+	if !isAlgo {
+		// 进程重启前下的策略委托没有记录：从交易所挂单中查找
+		if _, err := t.GetOpenOrders(symbol); err != nil {
+			return err
+		}
+		t.mu.RLock()
+		_, isAlgo = t.algoOrders[orderID]
+		t.mu.RUnlock()
+	}
+
+	id := strconv.FormatInt(orderID, 10)
+	var err error
+	if isAlgo {
+		_, err = t.request("POST", "/api/v5/trade/cancel-algos", nil, []map[string]string{{"instId": okxInstID(symbol), "algoId": id}})
+	} else {
+		_, err = t.request("POST", "/api/v5/trade/cancel-order", nil, map[string]string{"instId": okxInstID(symbol), "ordId": id})
+	}
+	if err != nil {
+		return fmt.Errorf("撤销订单失败: %w", err)
+	}
+
+	t.mu.Lock()
+	delete(t.algoOrders, orderID)
+	t.mu.Unlock()
+	log.Printf("  ✓ 已撤销 %s 订单 %d", symbol, orderID)
+	return nil
+}
+
+// SetLeverage 设置杠杆（逐仓双向持仓模式下多空分别设置，全仓按合约统一设置）
+func (t *OKXTrader) SetLeverage(symbol string, leverage int) error {
+	hedge, err := t.isHedgeMode()
+	if err != nil {
+		return err
+	}
+
+	mgnMode := t.marginModes.get(symbol)
+	params := map[string]string{
+		"instId":  okxInstID(symbol),
+		"lever":   strconv.Itoa(leverage),
+		"mgnMode": mgnMode,
+	}
+	posSides := []string{""}
+	if hedge && mgnMode == MarginModeIsolated {
+		posSides = []string{"long", "short"}
+	}
+	for _, posSide := range posSides {
+		if posSide != "" {
+			params["posSide"] = posSide
+		}
+		if _, err := t.request("POST", "/api/v5/account/set-leverage", nil, params); err != nil {
+			return fmt.Errorf("设置杠杆失败: %w", err)
+		}
+	}
+	log.Printf("  ✓ %s 杠杆已设置为 %dx", symbol, leverage)
+	return nil
+}
+
+// SetMarginMode 设置该币种后续开仓使用的保证金模式（OKX按下单的tdMode区分，无需单独切换）
+func (t *OKXTrader) SetMarginMode(symbol string, mode string) error {
+	return t.marginModes.set(symbol, mode)
+}
+
+// GetMarketPrice 获取市场价格
+func (t *OKXTrader) GetMarketPrice(symbol string) (float64, error) {
+	data, err := t.request("GET", "/api/v5/market/ticker", url.Values{"instId": {okxInstID(symbol)}}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("获取价格失败: %w", err)
+	}
+	var tickers []struct {
+		Last string `json:"last"`
+	}
+	if err := json.Unmarshal(data, &tickers); err != nil || len(tickers) == 0 {
+		return 0, fmt.Errorf("未找到 %s 的价格", symbol)
+	}
+	return strconv.ParseFloat(tickers[0].Last, 64)
+}
+
+// placeAlgoOrder 下止损或止盈策略委托（触发后市价平仓）
+// quantity=0 时按全部仓位平仓（closeFraction=1，加仓或部分平仓后仍覆盖整个仓位）
+func (t *OKXTrader) placeAlgoOrder(symbol, positionSide string, quantity, triggerPrice float64, stopLoss bool) error {
+	hedge, err := t.isHedgeMode()
+	if err != nil {
+		return err
+	}
+	px, err := t.formatPrice(symbol, triggerPrice)
+	if err != nil {
+		return err
+	}
+
+	posSide := strings.ToLower(positionSide)
+	side := "sell"
+	if posSide == "short" {
+		side = "buy"
+	}
+
+	params := map[string]interface{}{
+		"instId":  okxInstID(symbol),
+		"tdMode":  t.marginModes.get(symbol),
+		"side":    side,
+		"ordType": "conditional",
+	}
+	if hedge {
+		params["posSide"] = posSide
+	} else {
+		params["reduceOnly"] = true
+	}
+	if quantity > 0 {
+		sz, err := t.contracts(symbol, quantity)
+		if err != nil {
+			return err
+		}
+		params["sz"] = sz
+	} else {
+		params["closeFraction"] = "1"
+	}
+	if stopLoss {
+		params["slTriggerPx"] = px
+		params["slOrdPx"] = "-1" // -1 表示触发后市价成交
+	} else {
+		params["tpTriggerPx"] = px
+		params["tpOrdPx"] = "-1"
+	}
+
+	data, err := t.request("POST", "/api/v5/trade/order-algo", nil, params)
+	if err != nil {
+		return err
+	}
+	var acks []okxOrderAck
+	if err := json.Unmarshal(data, &acks); err != nil || len(acks) == 0 {
+		return fmt.Errorf("解析策略委托响应失败: %s", string(data))
+	}
+	if acks[0].SCode != "0" {
+		return fmt.Errorf("策略委托失败 %s: %s", acks[0].SCode, acks[0].SMsg)
+	}
+	if algoID, err := strconv.ParseInt(acks[0].AlgoID, 10, 64); err == nil {
+		t.mu.Lock()
+		t.algoOrders[algoID] = symbol
+		t.mu.Unlock()
+	}
+	return nil
+}
+
+// SetStopLoss 设置止损单（全部仓位）
+func (t *OKXTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	if err := t.placeAlgoOrder(symbol, positionSide, 0, stopPrice, true); err != nil {
+		return fmt.Errorf("设置止损失败: %w", err)
+	}
+	log.Printf("  止损价设置: %.4f", stopPrice)
+	return nil
+}
+
+// SetTakeProfit 设置止盈单（全部仓位）
+func (t *OKXTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	if err := t.placeAlgoOrder(symbol, positionSide, 0, takeProfitPrice, false); err != nil {
+		return fmt.Errorf("设置止盈失败: %w", err)
+	}
+	log.Printf("  止盈价设置: %.4f", takeProfitPrice)
+	return nil
+}
+
+// SetPartialTakeProfit 设置部分止盈单（按指定数量只减仓）
+func (t *OKXTrader) SetPartialTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	if err := t.placeAlgoOrder(symbol, positionSide, quantity, takeProfitPrice, false); err != nil {
+		return fmt.Errorf("设置部分止盈失败: %w", err)
+	}
+	log.Printf("  部分止盈设置: %.4f 数量: %.8f", takeProfitPrice, quantity)
+	return nil
+}
+
+// GetFills 获取指定时间之后的成交记录（OKX仅保留最近3天）
+func (t *OKXTrader) GetFills(symbol string, startTime int64) ([]Fill, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"instType": {"SWAP"},
+		"instId":   {inst.VenueSymbol},
+		"begin":    {strconv.FormatInt(startTime, 10)},
+	}
+	data, err := t.request("GET", "/api/v5/trade/fills", query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取成交记录失败: %w", err)
+	}
+	var okxFills []struct {
+		OrdID   string `json:"ordId"`
+		Side    string `json:"side"`
+		PosSide string `json:"posSide"`
+		FillPx  string `json:"fillPx"`
+		FillSz  string `json:"fillSz"`
+		Fee     string `json:"fee"`
+		FeeCcy  string `json:"feeCcy"`
+		FillPnl string `json:"fillPnl"`
+		Ts      string `json:"ts"`
+	}
+	if err := json.Unmarshal(data, &okxFills); err != nil {
+		return nil, fmt.Errorf("解析成交记录失败: %w", err)
+	}
+
+	fills := make([]Fill, 0, len(okxFills))
+	for _, f := range okxFills {
+		fill := Fill{
+			Symbol:   symbol,
+			Side:     strings.ToUpper(f.Side),
+			FeeAsset: f.FeeCcy,
+		}
+		if f.PosSide == "long" || f.PosSide == "short" {
+			fill.PositionSide = strings.ToUpper(f.PosSide)
+		}
+		fill.OrderID, _ = strconv.ParseInt(f.OrdID, 10, 64)
+		fill.Price, _ = strconv.ParseFloat(f.FillPx, 64)
+		sz, _ := strconv.ParseFloat(f.FillSz, 64)
+		fill.Quantity = sz * inst.ContractSize
+		fee, _ := strconv.ParseFloat(f.Fee, 64)
+		fill.Fee = -fee // OKX手续费为负数表示扣除
+		fill.RealizedPnL, _ = strconv.ParseFloat(f.FillPnl, 64)
+		fill.Time, _ = strconv.ParseInt(f.Ts, 10, 64)
+		fills = append(fills, fill)
+	}
+	return fills, nil
+}
+
+// GetIncomeHistory 获取指定时间之后的手续费和资金费流水（账单流水，OKX仅保留最近7天）
+func (t *OKXTrader) GetIncomeHistory(symbol string, startTime int64) ([]Income, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"instType": {"SWAP"},
+		"instId":   {inst.VenueSymbol},
+		"begin":    {strconv.FormatInt(startTime, 10)},
+	}
+	data, err := t.request("GET", "/api/v5/account/bills", query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("获取资金流水失败: %w", err)
+	}
+	var bills []struct {
+		Type   string `json:"type"` // 2=交易 8=资金费
+		BalChg string `json:"balChg"`
+		Fee    string `json:"fee"`
+		Ccy    string `json:"ccy"`
+		Ts     string `json:"ts"`
+	}
+	if err := json.Unmarshal(data, &bills); err != nil {
+		return nil, fmt.Errorf("解析资金流水失败: %w", err)
+	}
+
+	var incomes []Income
+	for _, b := range bills {
+		income := Income{Symbol: symbol, Asset: b.Ccy}
+		income.Time, _ = strconv.ParseInt(b.Ts, 10, 64)
+		switch b.Type {
+		case "2":
+			income.Type = IncomeCommission
+			income.Amount, _ = strconv.ParseFloat(b.Fee, 64) // 负数表示扣除
+		case "8":
+			income.Type = IncomeFunding
+			income.Amount, _ = strconv.ParseFloat(b.BalChg, 64)
+		default:
+			continue
+		}
+		if income.Amount != 0 {
+			incomes = append(incomes, income)
+		}
+	}
+	return incomes, nil
+}
+
+// CancelAllOrders 取消该币种的所有挂单（普通委托和止损止盈策略委托）
+func (t *OKXTrader) CancelAllOrders(symbol string) error {
+	orders, err := t.GetOpenOrders(symbol)
+	if err != nil {
+		return err
+	}
+
+	t.mu.RLock()
+	var regular []map[string]string
+	var algos []map[string]string
+	for _, o := range orders {
+		item := map[string]string{"instId": okxInstID(symbol)}
+		if _, isAlgo := t.algoOrders[o.OrderID]; isAlgo {
+			item["algoId"] = strconv.FormatInt(o.OrderID, 10)
+			algos = append(algos, item)
+		} else {
+			item["ordId"] = strconv.FormatInt(o.OrderID, 10)
+			regular = append(regular, item)
+		}
+	}
+	t.mu.RUnlock()
+
+	// 批量撤单接口每次最多20个
+	for start := 0; start < len(regular); start += 20 {
+		end := min(start+20, len(regular))
+		if _, err := t.request("POST", "/api/v5/trade/cancel-batch-orders", nil, regular[start:end]); err != nil {
+			return fmt.Errorf("取消挂单失败: %w", err)
+		}
+	}
+	for start := 0; start < len(algos); start += 10 {
+		end := min(start+10, len(algos))
+		if _, err := t.request("POST", "/api/v5/trade/cancel-algos", nil, algos[start:end]); err != nil {
+			return fmt.Errorf("取消止损止盈委托失败: %w", err)
+		}
+	}
+
+	if len(orders) > 0 {
+		t.mu.Lock()
+		for _, o := range orders {
+			delete(t.algoOrders, o.OrderID)
+		}
+		t.mu.Unlock()
+		log.Printf("  ✓ 已取消 %s 的所有挂单", symbol)
+	}
+	return nil
+}
+
+// FormatQuantity 格式化数量到正确的精度（按合约张数步进换算后的币数量）
+func (t *OKXTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
+	inst, err := t.getInstrument(symbol)
+	if err != nil {
+		return "", err
+	}
+	return inst.FormatQuantity(quantity), nil
+}
@@ -0,0 +1,288 @@
+package trader
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// newTestOKXTrader 创建连接模拟交易所的OKX交易器（accountConfig为持仓模式对应的账户配置响应文件）
+func newTestOKXTrader(t *testing.T, accountConfig string) (*OKXTrader, *fakeExchange) {
+	t.Helper()
+	ex := newFakeExchange(t, map[string]string{
+		"GET /api/v5/public/instruments":         "okx/instruments.json",
+		"GET /api/v5/account/config":             "okx/" + accountConfig,
+		"GET /api/v5/account/balance":            "okx/balance.json",
+		"POST /api/v5/account/set-leverage":      "okx/set_leverage.json",
+		"POST /api/v5/trade/order":               "okx/order_ack.json",
+		"GET /api/v5/trade/order":                "okx/order_filled.json",
+		"GET /api/v5/trade/fills":                "okx/fills.json",
+		"GET /api/v5/trade/orders-pending":       "okx/empty.json",
+		"GET /api/v5/trade/orders-algo-pending":  "okx/empty.json",
+		"POST /api/v5/trade/order-algo":          "okx/algo_ack.json",
+		"POST /api/v5/trade/cancel-order":        "okx/cancel_order.json",
+		"POST /api/v5/trade/cancel-algos":        "okx/cancel_algos.json",
+		"POST /api/v5/trade/cancel-batch-orders": "okx/cancel_order.json",
+	})
+	tr := NewOKXTrader("test-api-key", "test-secret", "test-passphrase", false)
+	tr.SetBaseURL(ex.URL())
+	tr.SetClock(testClock)
+	return tr, ex
+}
+
+func TestOKXRequestSignature(t *testing.T) {
+	tr, ex := newTestOKXTrader(t, "account_config_net.json")
+
+	balance, err := tr.GetBalance()
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if balance.TotalWalletBalance != 1011.44 || balance.AvailableBalance != 948.63 {
+		t.Errorf("余额解析错误: %+v", balance)
+	}
+
+	// GET 签名内容包含查询字符串，请求体为空
+	checkOKXHeaders(t, ex.last("GET", "/api/v5/account/balance"), "4HekkbPA9/QioFqB6h8J4SS4SeGtpPhB7+TBswqE69s=")
+
+	// POST 签名内容为JSON请求体
+	if err := tr.SetLeverage("BTCUSDT", 10); err != nil {
+		t.Fatalf("SetLeverage: %v", err)
+	}
+	post := ex.last("POST", "/api/v5/account/set-leverage")
+	wantBody := `{"instId":"BTC-USDT-SWAP","lever":"10","mgnMode":"isolated"}`
+	if post.Body != wantBody {
+		t.Errorf("请求体 = %s，期望 %s", post.Body, wantBody)
+	}
+	checkOKXHeaders(t, post, "Pg8MIKDUxfLKk27+eNoX9QwiUtLveSY9qqrEXraXEBs=")
+	if post.Header.Get("x-simulated-trading") != "" {
+		t.Error("实盘请求不应带 x-simulated-trading")
+	}
+}
+
+// checkOKXHeaders 检查签名相关请求头
+func checkOKXHeaders(t *testing.T, r recordedRequest, wantSign string) {
+	t.Helper()
+	want := map[string]string{
+		"OK-ACCESS-KEY":        "test-api-key",
+		"OK-ACCESS-PASSPHRASE": "test-passphrase",
+		"OK-ACCESS-TIMESTAMP":  "2025-01-02T03:04:05.678Z",
+		"OK-ACCESS-SIGN":       wantSign,
+	}
+	for header, value := range want {
+		if got := r.Header.Get(header); got != value {
+			t.Errorf("%s %s = %q，期望 %q", r.Path, header, got, value)
+		}
+	}
+}
+
+func TestOKXRoundsToInstrumentSteps(t *testing.T) {
+	tr, ex := newTestOKXTrader(t, "account_config_net.json")
+	ex.route("GET", "/api/v5/trade/order", "okx/order_live.json")
+
+	// 0.01239 BTC = 1.239张（面值0.01），向下取整到lotSz 0.01；价格四舍五入到tickSz 0.1
+	result, err := tr.PlaceLimitOrder("BTCUSDT", "long", 0.01239, 65000.16, 10, true)
+	if err != nil {
+		t.Fatalf("PlaceLimitOrder: %v", err)
+	}
+	if result.Status != "NEW" || result.OrderID != 2056823954321850368 {
+		t.Errorf("订单结果错误: %+v", result)
+	}
+	expectFields(t, ex.last("POST", "/api/v5/trade/order").jsonBody(t), map[string]interface{}{
+		"instId":  "BTC-USDT-SWAP",
+		"tdMode":  "isolated",
+		"side":    "buy",
+		"ordType": "post_only",
+		"sz":      "1.23",
+		"px":      "65000.2",
+	})
+
+	// 数量按币计：步进为面值×张数步进
+	if precision, _ := tr.GetSymbolPrecision("ETHUSDT"); precision != 3 {
+		t.Errorf("ETHUSDT 数量精度 = %d，期望 3", precision)
+	}
+	if sz, _ := tr.contracts("ETHUSDT", 0.12345); sz != "1.23" {
+		t.Errorf("ETHUSDT 0.12345 张数 = %s，期望 1.23", sz)
+	}
+
+	// 小于最小张数时不下单
+	ex.reset()
+	if _, err := tr.PlaceLimitOrder("BTCUSDT", "long", 0.00009, 65000, 10, false); err == nil {
+		t.Error("小于最小下单量时应返回错误")
+	}
+	if calls := ex.calls("POST", "/api/v5/trade/order"); len(calls) != 0 {
+		t.Errorf("小于最小下单量时不应下单，实际下单%d次", len(calls))
+	}
+}
+
+func TestOKXOrderParamsByPositionMode(t *testing.T) {
+	tests := []struct {
+		name          string
+		accountConfig string
+		openPosSide   interface{} // 开空仓的posSide（nil表示不传）
+		closePosSide  interface{} // 平多仓的posSide
+		closeReduce   interface{} // 平多仓的reduceOnly
+	}{
+		{"hedge", "account_config_hedge.json", "short", "long", nil},
+		{"one-way", "account_config_net.json", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, ex := newTestOKXTrader(t, tt.accountConfig)
+
+			if _, err := tr.OpenShort("BTCUSDT", 0.02, 10); err != nil {
+				t.Fatalf("OpenShort: %v", err)
+			}
+			expectFields(t, ex.last("POST", "/api/v5/trade/order").jsonBody(t), map[string]interface{}{
+				"side":       "sell",
+				"ordType":    "market",
+				"sz":         "2.00",
+				"posSide":    tt.openPosSide,
+				"reduceOnly": nil,
+				"px":         nil,
+			})
+
+			result, err := tr.CloseLong("BTCUSDT", 0.02)
+			if err != nil {
+				t.Fatalf("CloseLong: %v", err)
+			}
+			expectFields(t, ex.last("POST", "/api/v5/trade/order").jsonBody(t), map[string]interface{}{
+				"side":       "sell",
+				"ordType":    "market",
+				"sz":         "2.00",
+				"posSide":    tt.closePosSide,
+				"reduceOnly": tt.closeReduce,
+			})
+
+			// 成交数量由张数换算为币数量，手续费转为正数
+			if result.Status != "FILLED" || math.Abs(result.FilledQty-0.02) > 1e-12 {
+				t.Errorf("成交结果错误: %+v", result)
+			}
+			if math.Abs(result.AvgPrice-64302.08) > 1e-6 || math.Abs(result.Fee-0.643021) > 1e-9 {
+				t.Errorf("成交均价 %.4f 手续费 %.6f，期望 64302.08 / 0.643021", result.AvgPrice, result.Fee)
+			}
+		})
+	}
+}
+
+func TestOKXAddToPositionKeepsOrders(t *testing.T) {
+	tr, ex := newTestOKXTrader(t, "account_config_hedge.json")
+
+	// 开仓前查询并撤销该币种的所有挂单
+	if _, err := tr.OpenShort("BTCUSDT", 0.02, 10); err != nil {
+		t.Fatalf("OpenShort: %v", err)
+	}
+	if calls := ex.calls("GET", "/api/v5/trade/orders-pending"); len(calls) != 1 {
+		t.Errorf("开仓应查询挂单1次，实际%d次", len(calls))
+	}
+
+	// 加仓保留已有的止损止盈委托和挂单
+	ex.reset()
+	if _, err := tr.AddToPosition("BTCUSDT", "short", 0.02, 10); err != nil {
+		t.Fatalf("AddToPosition: %v", err)
+	}
+	if calls := ex.calls("GET", "/api/v5/trade/orders-pending"); len(calls) != 0 {
+		t.Errorf("加仓不应撤销挂单，实际查询挂单%d次", len(calls))
+	}
+	expectFields(t, ex.last("POST", "/api/v5/trade/order").jsonBody(t), map[string]interface{}{
+		"side":       "sell",
+		"ordType":    "market",
+		"sz":         "2.00",
+		"posSide":    "short",
+		"reduceOnly": nil,
+	})
+}
+
+func TestOKXAlgoOrders(t *testing.T) {
+	tr, ex := newTestOKXTrader(t, "account_config_hedge.json")
+
+	// 止损覆盖全部仓位（closeFraction=1），触发后市价成交
+	if err := tr.SetStopLoss("BTCUSDT", "LONG", 0.02, 60000.04); err != nil {
+		t.Fatalf("SetStopLoss: %v", err)
+	}
+	expectFields(t, ex.last("POST", "/api/v5/trade/order-algo").jsonBody(t), map[string]interface{}{
+		"instId":        "BTC-USDT-SWAP",
+		"tdMode":        "isolated",
+		"side":          "sell",
+		"posSide":       "long",
+		"ordType":       "conditional",
+		"closeFraction": "1",
+		"slTriggerPx":   "60000.0",
+		"slOrdPx":       "-1",
+		"sz":            nil,
+		"reduceOnly":    nil,
+	})
+
+	// 部分止盈按张数下单
+	if err := tr.SetPartialTakeProfit("BTCUSDT", "SHORT", 0.0157, 58000); err != nil {
+		t.Fatalf("SetPartialTakeProfit: %v", err)
+	}
+	expectFields(t, ex.last("POST", "/api/v5/trade/order-algo").jsonBody(t), map[string]interface{}{
+		"side":          "buy",
+		"posSide":       "short",
+		"sz":            "1.57",
+		"tpTriggerPx":   "58000.0",
+		"tpOrdPx":       "-1",
+		"closeFraction": nil,
+	})
+
+	// 本进程下的策略委托直接走策略撤单接口
+	ex.reset()
+	if err := tr.CancelOrder("BTCUSDT", 681096944655273984); err != nil {
+		t.Fatalf("撤销策略委托: %v", err)
+	}
+	cancel := ex.last("POST", "/api/v5/trade/cancel-algos")
+	var items []map[string]string
+	if err := json.Unmarshal([]byte(cancel.Body), &items); err != nil || len(items) != 1 {
+		t.Fatalf("撤单请求体错误: %s", cancel.Body)
+	}
+	if items[0]["algoId"] != "681096944655273984" || items[0]["instId"] != "BTC-USDT-SWAP" {
+		t.Errorf("撤单参数错误: %v", items[0])
+	}
+	if calls := ex.calls("GET", "/api/v5/trade/orders-algo-pending"); len(calls) != 0 {
+		t.Error("已记录的策略委托撤单时不应查询挂单")
+	}
+}
+
+func TestOKXCancelOrderAfterRestart(t *testing.T) {
+	tr, ex := newTestOKXTrader(t, "account_config_hedge.json")
+	ex.route("GET", "/api/v5/trade/orders-pending", "okx/orders_pending.json")
+	ex.route("GET", "/api/v5/trade/orders-algo-pending", "okx/orders_algo_pending.json")
+
+	// 新进程没有策略委托记录：撤单时从交易所挂单中识别
+	if err := tr.CancelOrder("BTCUSDT", 681090000000000001); err != nil {
+		t.Fatalf("撤销止损委托: %v", err)
+	}
+	if body := ex.last("POST", "/api/v5/trade/cancel-algos").Body; body != `[{"algoId":"681090000000000001","instId":"BTC-USDT-SWAP"}]` {
+		t.Errorf("策略撤单请求体 = %s", body)
+	}
+	if len(ex.calls("POST", "/api/v5/trade/cancel-order")) != 0 {
+		t.Error("策略委托不应走普通撤单接口")
+	}
+
+	if err := tr.CancelOrder("BTCUSDT", 2056800000000000001); err != nil {
+		t.Fatalf("撤销限价单: %v", err)
+	}
+	if body := ex.last("POST", "/api/v5/trade/cancel-order").Body; body != `{"instId":"BTC-USDT-SWAP","ordId":"2056800000000000001"}` {
+		t.Errorf("撤单请求体 = %s", body)
+	}
+
+	// 止损止盈委托映射为统一类型，已触发的委托下次获取挂单时移除
+	orders, err := tr.GetOpenOrders("BTCUSDT")
+	if err != nil {
+		t.Fatalf("GetOpenOrders: %v", err)
+	}
+	types := map[string]int{}
+	for _, o := range orders {
+		types[o.Type]++
+	}
+	if types["LIMIT"] != 1 || types["STOP_MARKET"] != 1 || types["TAKE_PROFIT_MARKET"] != 1 {
+		t.Errorf("挂单类型 = %v", types)
+	}
+	ex.route("GET", "/api/v5/trade/orders-algo-pending", "okx/empty.json")
+	if _, err := tr.GetOpenOrders("BTCUSDT"); err != nil {
+		t.Fatalf("GetOpenOrders: %v", err)
+	}
+	if len(tr.algoOrders) != 0 {
+		t.Errorf("策略委托列表为空时应清除记录，剩余%d个", len(tr.algoOrders))
+	}
+}
@@ -0,0 +1,1069 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"nofx/instrument"
+	"nofx/market"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PaperTrader 模拟盘交易器（内存模拟账户，不产生真实订单）
+// 使用价格来源的最新价格成交（默认为币安行情的缓存最新价），按配置扣除手续费和滑点，并模拟止损止盈触发和强平
+type PaperTrader struct {
+	stateFile             string
+	takerFeeRate          float64 // 吃单手续费率
+	makerFeeRate          float64 // 挂单手续费率（限价单挂单成交时使用）
+	slippage              float64 // 滑点比例（按不利方向成交）
+	maintenanceMarginRate float64 // 维持保证金率（用于计算强平价）
+
+	// 价格来源（默认币安行情的缓存最新价，实盘按trader的行情数据源替换，回测时替换为历史价格）
+	priceFunc func(symbol string) (float64, error)
+	// 时钟（默认time.Now，回测时可替换为模拟时间）
+	nowFunc func() time.Time
+
+	state paperState
+	mu    sync.Mutex
+}
+
+// paperState 模拟账户状态（持久化到磁盘，重启后继续使用同一账户）
+type paperState struct {
+	WalletBalance float64                   `json:"wallet_balance"` // 钱包余额（已实现盈亏和手续费已计入）
+	Positions     map[string]*paperPosition `json:"positions"`      // 持仓 (symbol_side -> position)
+	Orders        []*paperOrder             `json:"orders"`         // 挂单（止损/止盈）
+	Leverage      map[string]int            `json:"leverage"`       // 各币种杠杆设置
+	MarginModes   map[string]string         `json:"margin_modes"`   // 各币种开仓使用的保证金模式（未设置为逐仓）
+	NextOrderID   int64                     `json:"next_order_id"`
+	TotalFees     float64                   `json:"total_fees"`   // 累计手续费
+	RealizedPnL   float64                   `json:"realized_pnl"` // 累计已实现盈亏（不含手续费）
+	Fills         []Fill                    `json:"fills"`        // 最近成交记录（供对账查询，最多保留maxPaperFills笔）
+	UpdatedAt     time.Time                 `json:"updated_at"`
+}
+
+// maxPaperFills 模拟盘保留的成交记录数量
+const maxPaperFills = 500
+
+// paperPosition 模拟持仓
+type paperPosition struct {
+	Symbol     string  `json:"symbol"`
+	Side       string  `json:"side"` // "long" or "short"
+	Quantity   float64 `json:"quantity"`
+	EntryPrice float64 `json:"entry_price"`
+	Leverage   int     `json:"leverage"`
+	Margin     float64 `json:"margin"`                // 初始保证金（逐仓为仓位保证金）
+	MarginMode string  `json:"margin_mode,omitempty"` // 保证金模式（空为逐仓）
+	OpenTime   int64   `json:"open_time"`             // 开仓时间（毫秒）
+}
+
+// paperOrder 模拟挂单（止损/止盈触发单，或限价开仓单）
+type paperOrder struct {
+	OrderID      int64   `json:"order_id"`
+	Symbol       string  `json:"symbol"`
+	PositionSide string  `json:"position_side"` // "LONG" or "SHORT"
+	Type         string  `json:"type"`          // "STOP_MARKET", "TAKE_PROFIT_MARKET" or "LIMIT"
+	Quantity     float64 `json:"quantity"`
+	StopPrice    float64 `json:"stop_price"`
+	CreateTime   int64   `json:"create_time"`
+
+	// 限价开仓单字段
+	Price    float64 `json:"price,omitempty"`
+	Leverage int     `json:"leverage,omitempty"`
+	PostOnly bool    `json:"post_only,omitempty"`
+}
+
+// NewPaperTrader 创建模拟盘交易器
+// stateFile: 账户状态文件路径（存在则加载，重启后继续同一账户）
+func NewPaperTrader(initialBalance, takerFeeRate, slippage float64, stateFile string) (*PaperTrader, error) {
+	if takerFeeRate < 0 || slippage < 0 {
+		return nil, fmt.Errorf("手续费率和滑点不能为负数")
+	}
+
+	provider, err := market.NewProvider(market.ProviderBinance, false)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &PaperTrader{
+		stateFile:             stateFile,
+		takerFeeRate:          takerFeeRate,
+		makerFeeRate:          takerFeeRate / 2, // 默认为吃单费率的一半（与币安普通用户费率比例一致）
+		slippage:              slippage,
+		maintenanceMarginRate: 0.005, // 0.5%维持保证金率（与币安低档位一致）
+		priceFunc:             providerPrice(provider),
+		nowFunc:               time.Now,
+		state: paperState{
+			WalletBalance: initialBalance,
+			Positions:     make(map[string]*paperPosition),
+			Leverage:      make(map[string]int),
+			MarginModes:   make(map[string]string),
+			NextOrderID:   1,
+		},
+	}
+
+	if err := t.loadState(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("✓ 模拟盘交易器初始化成功 (余额=%.2f, 手续费率=%.4f%%, 滑点=%.4f%%)",
+		t.state.WalletBalance, takerFeeRate*100, slippage*100)
+	return t, nil
+}
+
+// SetMakerFeeRate 设置挂单手续费率（限价单挂单成交时使用）
+func (t *PaperTrader) SetMakerFeeRate(rate float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.makerFeeRate = rate
+}
+
+// SetPriceSource 设置价格来源（回测时使用历史价格）
+func (t *PaperTrader) SetPriceSource(priceFunc func(symbol string) (float64, error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.priceFunc = priceFunc
+}
+
+// SetClock 设置时钟（回测时使用模拟时间）
+func (t *PaperTrader) SetClock(nowFunc func() time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nowFunc = nowFunc
+}
+
+// Freeze 冻结账户（只读展示回测结果）：价格固定为当前价格，时钟停在当前时间，不再写入磁盘
+// 冻结后的查询按相同价格刷新，不会再触发止损止盈、限价成交或强平
+func (t *PaperTrader) Freeze() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prices := make(map[string]float64)
+	for _, pos := range t.state.Positions {
+		t.getPrice(pos.Symbol, prices)
+	}
+	for _, order := range t.state.Orders {
+		t.getPrice(order.Symbol, prices)
+	}
+	frozenAt := t.nowFunc()
+
+	t.priceFunc = func(symbol string) (float64, error) {
+		if price, ok := prices[symbol]; ok {
+			return price, nil
+		}
+		return 0, fmt.Errorf("%s 没有冻结价格", symbol)
+	}
+	t.nowFunc = func() time.Time { return frozenAt }
+	t.stateFile = ""
+}
+
+// loadState 从磁盘加载账户状态
+func (t *PaperTrader) loadState() error {
+	if t.stateFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(t.stateFile)
+	if os.IsNotExist(err) {
+		return nil // 首次运行，使用初始余额
+	}
+	if err != nil {
+		return fmt.Errorf("读取模拟盘状态失败: %w", err)
+	}
+
+	var state paperState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("解析模拟盘状态失败: %w", err)
+	}
+	if state.Positions == nil {
+		state.Positions = make(map[string]*paperPosition)
+	}
+	if state.Leverage == nil {
+		state.Leverage = make(map[string]int)
+	}
+	if state.MarginModes == nil {
+		state.MarginModes = make(map[string]string)
+	}
+	if state.NextOrderID <= 0 {
+		state.NextOrderID = 1
+	}
+
+	t.state = state
+	log.Printf("📂 已加载模拟盘状态: 余额=%.2f, 持仓%d个, 挂单%d个 (更新于 %s)",
+		state.WalletBalance, len(state.Positions), len(state.Orders), state.UpdatedAt.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// saveState 保存账户状态到磁盘（调用方需持有锁）
+func (t *PaperTrader) saveState() {
+	if t.stateFile == "" {
+		return
+	}
+
+	t.state.UpdatedAt = t.nowFunc()
+	data, err := json.MarshalIndent(t.state, "", "  ")
+	if err != nil {
+		log.Printf("⚠ 序列化模拟盘状态失败: %v", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.stateFile), 0755); err != nil {
+		log.Printf("⚠ 创建模拟盘状态目录失败: %v", err)
+		return
+	}
+	if err := ioutil.WriteFile(t.stateFile, data, 0644); err != nil {
+		log.Printf("⚠ 写入模拟盘状态失败: %v", err)
+	}
+}
+
+// getPrice 获取价格（同一次刷新内对同一币种只查询一次）
+func (t *PaperTrader) getPrice(symbol string, cache map[string]float64) (float64, error) {
+	if price, ok := cache[symbol]; ok {
+		return price, nil
+	}
+	price, err := t.priceFunc(symbol)
+	if err != nil {
+		return 0, err
+	}
+	if price <= 0 {
+		return 0, fmt.Errorf("%s 价格无效: %.8f", symbol, price)
+	}
+	cache[symbol] = price
+	return price, nil
+}
+
+// refresh 按最新价格处理止损止盈触发和强平（调用方需持有锁）
+func (t *PaperTrader) refresh(prices map[string]float64) {
+	changed := false
+
+	// 1. 检查止损止盈挂单和限价开仓单
+	remaining := t.state.Orders[:0]
+	for _, order := range t.state.Orders {
+		price, err := t.getPrice(order.Symbol, prices)
+		if err != nil {
+			log.Printf("  ⚠ 模拟盘获取 %s 价格失败，跳过挂单检查: %v", order.Symbol, err)
+			remaining = append(remaining, order)
+			continue
+		}
+
+		if order.Type == "LIMIT" {
+			if t.fillLimitOrderLocked(order, price, prices) {
+				changed = true
+			} else {
+				remaining = append(remaining, order)
+			}
+			continue
+		}
+
+		side := "long"
+		if order.PositionSide == "SHORT" {
+			side = "short"
+		}
+		pos, exists := t.state.Positions[order.Symbol+"_"+side]
+		if !exists {
+			// 持仓已不存在，挂单失效
+			changed = true
+			continue
+		}
+
+		if !orderTriggered(order, price) {
+			remaining = append(remaining, order)
+			continue
+		}
+
+		// 以触发价成交（再叠加不利方向滑点），止损在价格跳空越过触发价时按更差的当前价格成交
+		basePrice := order.StopPrice
+		if order.Type == "STOP_MARKET" {
+			if side == "long" {
+				basePrice = math.Min(basePrice, price)
+			} else {
+				basePrice = math.Max(basePrice, price)
+			}
+		}
+		fillPrice := t.applySlippage(basePrice, side == "short")
+		quantity := math.Min(order.Quantity, pos.Quantity)
+		if quantity <= 0 {
+			quantity = pos.Quantity
+		}
+		fee := quantity * fillPrice * t.takerFeeRate
+		pnl := t.closePositionLocked(pos, quantity, fillPrice)
+		t.recordFillLocked(order.OrderID, order.Symbol, side, false, fillPrice, quantity, fee, pnl)
+		changed = true
+
+		label := "止损"
+		if order.Type == "TAKE_PROFIT_MARKET" {
+			label = "止盈"
+		}
+		log.Printf("  🎯 模拟盘%s触发: %s %s 触发价%.4f 成交价%.4f 数量%.4f 盈亏%+.2f",
+			label, order.Symbol, side, order.StopPrice, fillPrice, quantity, pnl)
+	}
+	t.state.Orders = remaining
+
+	// 持仓平掉后清理对应挂单
+	if changed {
+		t.cleanupOrphanOrdersLocked()
+	}
+
+	// 2. 检查强平（逐仓按仓位强平价，全仓按账户权益）
+	for key, pos := range t.state.Positions {
+		if pos.isCross() {
+			continue
+		}
+		price, err := t.getPrice(pos.Symbol, prices)
+		if err != nil {
+			continue
+		}
+
+		liqPrice := t.liquidationPrice(pos)
+		if (pos.Side == "long" && price <= liqPrice) || (pos.Side == "short" && price >= liqPrice) {
+			// 强平：损失全部逐仓保证金
+			t.state.WalletBalance -= pos.Margin
+			t.state.RealizedPnL -= pos.Margin
+			delete(t.state.Positions, key)
+			t.recordFillLocked(t.state.NextOrderID, pos.Symbol, pos.Side, false, liqPrice, pos.Quantity, 0, -pos.Margin)
+			t.state.NextOrderID++
+			changed = true
+			log.Printf("  💥 模拟盘强平: %s %s 强平价%.4f 当前价%.4f 损失保证金%.2f",
+				pos.Symbol, pos.Side, liqPrice, price, pos.Margin)
+		}
+	}
+
+	if t.liquidateCrossLocked(prices) {
+		changed = true
+	}
+
+	if changed {
+		t.cleanupOrphanOrdersLocked()
+		t.saveState()
+	}
+}
+
+// crossAccountLocked 计算全仓权益（钱包余额扣除逐仓保证金，加上全仓持仓未实现盈亏）和全仓维持保证金（调用方需持有锁）
+func (t *PaperTrader) crossAccountLocked(prices map[string]float64) (equity, maintenance float64) {
+	equity = t.state.WalletBalance
+	for _, pos := range t.state.Positions {
+		if !pos.isCross() {
+			equity -= pos.Margin
+			continue
+		}
+		price, err := t.getPrice(pos.Symbol, prices)
+		if err != nil {
+			price = pos.EntryPrice
+		}
+		equity += unrealizedPnL(pos, price)
+		maintenance += pos.Quantity * price * t.maintenanceMarginRate
+	}
+	return equity, maintenance
+}
+
+// liquidateCrossLocked 全仓权益低于维持保证金时按当前价强平全部全仓持仓，返回是否发生强平（调用方需持有锁）
+func (t *PaperTrader) liquidateCrossLocked(prices map[string]float64) bool {
+	equity, maintenance := t.crossAccountLocked(prices)
+	if maintenance <= 0 || equity > maintenance {
+		return false
+	}
+
+	for key, pos := range t.state.Positions {
+		if !pos.isCross() {
+			continue
+		}
+		price, err := t.getPrice(pos.Symbol, prices)
+		if err != nil {
+			price = pos.EntryPrice
+		}
+		pnl := unrealizedPnL(pos, price)
+		t.state.WalletBalance += pnl
+		t.state.RealizedPnL += pnl
+		delete(t.state.Positions, key)
+		t.recordFillLocked(t.state.NextOrderID, pos.Symbol, pos.Side, false, price, pos.Quantity, 0, pnl)
+		t.state.NextOrderID++
+		log.Printf("  💥 模拟盘全仓强平: %s %s 当前价%.4f 盈亏%+.2f（全仓权益%.2f ≤ 维持保证金%.2f）",
+			pos.Symbol, pos.Side, price, pnl, equity, maintenance)
+	}
+	return true
+}
+
+// orderTriggered 判断挂单是否被当前价格触发
+func orderTriggered(order *paperOrder, price float64) bool {
+	isLong := order.PositionSide == "LONG"
+	switch order.Type {
+	case "STOP_MARKET":
+		if isLong {
+			return price <= order.StopPrice
+		}
+		return price >= order.StopPrice
+	case "TAKE_PROFIT_MARKET":
+		if isLong {
+			return price >= order.StopPrice
+		}
+		return price <= order.StopPrice
+	}
+	return false
+}
+
+// fillLimitOrderLocked 价格触及限价时按限价成交（挂单成交收取Maker费率，无滑点），返回挂单是否已结束（调用方需持有锁）
+// 模拟盘不为挂单冻结保证金，成交时保证金不足则撤单
+func (t *PaperTrader) fillLimitOrderLocked(order *paperOrder, price float64, prices map[string]float64) bool {
+	side := "long"
+	if order.PositionSide == "SHORT" {
+		side = "short"
+	}
+	if (side == "long" && price > order.Price) || (side == "short" && price < order.Price) {
+		return false
+	}
+
+	fee, err := t.addPositionLocked(order.Symbol, side, order.Quantity, order.Leverage, order.Price, t.makerFeeRate, prices)
+	if err != nil {
+		log.Printf("  ⚠ 模拟盘限价单成交失败，已撤单: %s %s 订单%d: %v", order.Symbol, side, order.OrderID, err)
+		return true
+	}
+	t.state.Leverage[order.Symbol] = order.Leverage
+	t.recordFillLocked(order.OrderID, order.Symbol, side, true, order.Price, order.Quantity, fee, 0)
+
+	log.Printf("  🎯 模拟盘限价单成交: %s %s 订单%d 成交价%.4f 数量%.4f 手续费%.4f",
+		order.Symbol, side, order.OrderID, order.Price, order.Quantity, fee)
+	return true
+}
+
+// cleanupOrphanOrdersLocked 清理已无对应持仓的挂单（调用方需持有锁）
+func (t *PaperTrader) cleanupOrphanOrdersLocked() {
+	remaining := t.state.Orders[:0]
+	for _, order := range t.state.Orders {
+		if order.Type == "LIMIT" {
+			remaining = append(remaining, order) // 限价开仓单不依赖持仓
+			continue
+		}
+		side := "long"
+		if order.PositionSide == "SHORT" {
+			side = "short"
+		}
+		if _, exists := t.state.Positions[order.Symbol+"_"+side]; exists {
+			remaining = append(remaining, order)
+		}
+	}
+	t.state.Orders = remaining
+}
+
+// applySlippage 按不利方向叠加滑点（买入价格更高，卖出价格更低）
+func (t *PaperTrader) applySlippage(price float64, isBuy bool) float64 {
+	if isBuy {
+		return price * (1 + t.slippage)
+	}
+	return price * (1 - t.slippage)
+}
+
+// isCross 是否为全仓持仓
+func (pos *paperPosition) isCross() bool {
+	return pos.MarginMode == MarginModeCross
+}
+
+// crossLiquidationPrice 估算全仓持仓的强平价（假设其他持仓价格不变，全仓剩余权益全部由该持仓亏损耗尽）
+func (t *PaperTrader) crossLiquidationPrice(pos *paperPosition, markPrice float64, prices map[string]float64) float64 {
+	equity, maintenance := t.crossAccountLocked(prices)
+	distance := (equity - maintenance) / pos.Quantity
+	if pos.Side == "long" {
+		return math.Max(markPrice-distance, 0)
+	}
+	return markPrice + distance
+}
+
+// liquidationPrice 根据杠杆和维持保证金率计算强平价（逐仓）
+func (t *PaperTrader) liquidationPrice(pos *paperPosition) float64 {
+	if pos.Leverage <= 0 {
+		return 0
+	}
+	if pos.Side == "long" {
+		return pos.EntryPrice * (1 - 1/float64(pos.Leverage) + t.maintenanceMarginRate)
+	}
+	return pos.EntryPrice * (1 + 1/float64(pos.Leverage) - t.maintenanceMarginRate)
+}
+
+// unrealizedPnL 计算持仓未实现盈亏
+func unrealizedPnL(pos *paperPosition, markPrice float64) float64 {
+	if pos.Side == "long" {
+		return pos.Quantity * (markPrice - pos.EntryPrice)
+	}
+	return pos.Quantity * (pos.EntryPrice - markPrice)
+}
+
+// closePositionLocked 按成交价平掉部分或全部持仓，返回已实现盈亏（调用方需持有锁）
+func (t *PaperTrader) closePositionLocked(pos *paperPosition, quantity, fillPrice float64) float64 {
+	if quantity > pos.Quantity {
+		quantity = pos.Quantity
+	}
+
+	var pnl float64
+	if pos.Side == "long" {
+		pnl = quantity * (fillPrice - pos.EntryPrice)
+	} else {
+		pnl = quantity * (pos.EntryPrice - fillPrice)
+	}
+	fee := quantity * fillPrice * t.takerFeeRate
+
+	t.state.WalletBalance += pnl - fee
+	t.state.RealizedPnL += pnl
+	t.state.TotalFees += fee
+
+	// 按比例释放保证金
+	releasedMargin := pos.Margin * quantity / pos.Quantity
+	pos.Margin -= releasedMargin
+	pos.Quantity -= quantity
+
+	if pos.Quantity <= 1e-12 {
+		delete(t.state.Positions, pos.Symbol+"_"+pos.Side)
+	}
+	return pnl
+}
+
+// totals 计算总保证金和总未实现盈亏（调用方需持有锁）
+func (t *PaperTrader) totals(prices map[string]float64) (totalMargin, totalUnrealized float64) {
+	for _, pos := range t.state.Positions {
+		totalMargin += pos.Margin
+		if price, err := t.getPrice(pos.Symbol, prices); err == nil {
+			totalUnrealized += unrealizedPnL(pos, price)
+		}
+	}
+	return totalMargin, totalUnrealized
+}
+
+// GetBalance 获取账户余额
+func (t *PaperTrader) GetBalance() (*Balance, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prices := make(map[string]float64)
+	t.refresh(prices)
+
+	totalMargin, totalUnrealized := t.totals(prices)
+	availableBalance := t.state.WalletBalance - totalMargin + math.Min(totalUnrealized, 0)
+	if availableBalance < 0 {
+		availableBalance = 0
+	}
+
+	return &Balance{
+		TotalWalletBalance:    t.state.WalletBalance,
+		AvailableBalance:      availableBalance,
+		TotalUnrealizedProfit: totalUnrealized,
+	}, nil
+}
+
+// GetPositions 获取所有持仓
+func (t *PaperTrader) GetPositions() ([]Position, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prices := make(map[string]float64)
+	t.refresh(prices)
+
+	result := []Position{}
+	for _, pos := range t.state.Positions {
+		markPrice, err := t.getPrice(pos.Symbol, prices)
+		if err != nil {
+			markPrice = pos.EntryPrice
+		}
+
+		marginMode, liqPrice := MarginModeIsolated, t.liquidationPrice(pos)
+		if pos.isCross() {
+			marginMode, liqPrice = MarginModeCross, t.crossLiquidationPrice(pos, markPrice, prices)
+		}
+
+		result = append(result, Position{
+			Symbol:           pos.Symbol,
+			Side:             pos.Side,
+			Quantity:         pos.Quantity,
+			EntryPrice:       pos.EntryPrice,
+			MarkPrice:        markPrice,
+			UnrealizedPnL:    unrealizedPnL(pos, markPrice),
+			Leverage:         pos.Leverage,
+			LiquidationPrice: liqPrice,
+			MarginMode:       marginMode,
+			Margin:           pos.Margin,
+			OpenTime:         pos.OpenTime,
+		})
+	}
+
+	return result, nil
+}
+
+// openPosition 开仓（多空通用，cancelOrders为true时先取消该币种的所有委托单）
+func (t *PaperTrader) openPosition(symbol, side string, quantity float64, leverage int, cancelOrders bool) (*OrderResult, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("开仓数量必须大于0: %.8f", quantity)
+	}
+	if leverage <= 0 {
+		return nil, fmt.Errorf("杠杆必须大于0: %d", leverage)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prices := make(map[string]float64)
+	t.refresh(prices)
+
+	// 与真实交易所一致：开仓前先取消该币种的所有委托单（加仓时保留）
+	if cancelOrders {
+		t.cancelOrdersLocked(symbol)
+	}
+	t.state.Leverage[symbol] = leverage
+
+	price, err := t.getPrice(symbol, prices)
+	if err != nil {
+		return nil, fmt.Errorf("获取价格失败: %w", err)
+	}
+
+	fillPrice := t.applySlippage(price, side == "long")
+	fee, err := t.addPositionLocked(symbol, side, quantity, leverage, fillPrice, t.takerFeeRate, prices)
+	if err != nil {
+		return nil, err
+	}
+
+	orderID := t.state.NextOrderID
+	t.state.NextOrderID++
+	fill := t.recordFillLocked(orderID, symbol, side, true, fillPrice, quantity, fee, 0)
+	t.saveState()
+
+	log.Printf("✓ 模拟盘开%s仓成功: %s 数量: %.4f 成交价: %.4f 手续费: %.4f",
+		sideLabel(side), symbol, quantity, fillPrice, fee)
+
+	return paperOrderResult(fill, leverage), nil
+}
+
+// addPositionLocked 按成交价开仓或同方向加仓，扣除手续费，返回手续费（调用方需持有锁）
+func (t *PaperTrader) addPositionLocked(symbol, side string, quantity float64, leverage int, fillPrice, feeRate float64, prices map[string]float64) (float64, error) {
+	notional := quantity * fillPrice
+	margin := notional / float64(leverage)
+	fee := notional * feeRate
+
+	// 检查可用保证金
+	totalMargin, totalUnrealized := t.totals(prices)
+	available := t.state.WalletBalance - totalMargin + math.Min(totalUnrealized, 0)
+	if margin+fee > available {
+		return 0, fmt.Errorf("可用保证金不足: 需要%.2f (保证金%.2f+手续费%.2f)，可用%.2f",
+			margin+fee, margin, fee, available)
+	}
+
+	key := symbol + "_" + side
+	if pos, exists := t.state.Positions[key]; exists {
+		// 同方向加仓：按数量加权计算新的开仓均价
+		totalQty := pos.Quantity + quantity
+		pos.EntryPrice = (pos.EntryPrice*pos.Quantity + fillPrice*quantity) / totalQty
+		pos.Quantity = totalQty
+		pos.Margin += margin
+		pos.Leverage = leverage
+	} else {
+		t.state.Positions[key] = &paperPosition{
+			Symbol:     symbol,
+			Side:       side,
+			Quantity:   quantity,
+			EntryPrice: fillPrice,
+			Leverage:   leverage,
+			Margin:     margin,
+			MarginMode: t.state.MarginModes[symbol],
+			OpenTime:   t.nowFunc().UnixMilli(),
+		}
+	}
+
+	t.state.WalletBalance -= fee
+	t.state.TotalFees += fee
+	return fee, nil
+}
+
+// closeSide 平仓（多空通用，quantity=0表示全部平仓）
+func (t *PaperTrader) closeSide(symbol, side string, quantity float64) (*OrderResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prices := make(map[string]float64)
+	t.refresh(prices)
+
+	pos, exists := t.state.Positions[symbol+"_"+side]
+	if !exists {
+		return nil, fmt.Errorf("没有找到 %s 的%s仓", symbol, sideLabel(side))
+	}
+	if quantity <= 0 || quantity > pos.Quantity {
+		quantity = pos.Quantity
+	}
+
+	price, err := t.getPrice(symbol, prices)
+	if err != nil {
+		return nil, fmt.Errorf("获取价格失败: %w", err)
+	}
+
+	// 平多=卖出，平空=买入
+	fillPrice := t.applySlippage(price, side == "short")
+	fee := quantity * fillPrice * t.takerFeeRate
+	pnl := t.closePositionLocked(pos, quantity, fillPrice)
+
+	// 与真实交易所一致：全部平仓后取消该币种的所有挂单
+	if _, stillOpen := t.state.Positions[symbol+"_"+side]; !stillOpen {
+		t.cancelOrdersLocked(symbol)
+	}
+
+	orderID := t.state.NextOrderID
+	t.state.NextOrderID++
+	fill := t.recordFillLocked(orderID, symbol, side, false, fillPrice, quantity, fee, pnl)
+	t.saveState()
+
+	log.Printf("✓ 模拟盘平%s仓成功: %s 数量: %.4f 成交价: %.4f 盈亏: %+.2f",
+		sideLabel(side), symbol, quantity, fillPrice, pnl)
+
+	return paperOrderResult(fill, 0), nil
+}
+
+// paperOrderResult 构造模拟成交的OrderResult（一笔订单对应一笔成交）
+func paperOrderResult(fill Fill, leverage int) *OrderResult {
+	return &OrderResult{
+		OrderID:   fill.OrderID,
+		Symbol:    fill.Symbol,
+		Status:    "FILLED",
+		AvgPrice:  fill.Price,
+		FilledQty: fill.Quantity,
+		Fee:       fill.Fee,
+		Leverage:  leverage,
+		Fills:     []Fill{fill},
+	}
+}
+
+// recordFillLocked 记录一笔模拟成交并返回（调用方需持有锁）
+func (t *PaperTrader) recordFillLocked(orderID int64, symbol, side string, open bool, price, quantity, fee, pnl float64) Fill {
+	fill := Fill{
+		OrderID:      orderID,
+		Symbol:       symbol,
+		Side:         paperFillSide(side, open),
+		PositionSide: strings.ToUpper(side),
+		Price:        price,
+		Quantity:     quantity,
+		Fee:          fee,
+		FeeAsset:     "USDT",
+		RealizedPnL:  pnl,
+		Time:         t.nowFunc().UnixMilli(),
+	}
+	t.state.Fills = append(t.state.Fills, fill)
+	if len(t.state.Fills) > maxPaperFills {
+		t.state.Fills = t.state.Fills[len(t.state.Fills)-maxPaperFills:]
+	}
+	return fill
+}
+
+// paperFillSide 根据持仓方向和开平仓判断成交方向（开多/平空为买入，开空/平多为卖出）
+func paperFillSide(side string, open bool) string {
+	if (side == "long") == open {
+		return "BUY"
+	}
+	return "SELL"
+}
+
+// OpenLong 开多仓
+func (t *PaperTrader) OpenLong(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.openPosition(symbol, "long", quantity, leverage, true)
+}
+
+// OpenShort 开空仓
+func (t *PaperTrader) OpenShort(symbol string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.openPosition(symbol, "short", quantity, leverage, true)
+}
+
+// AddToPosition 市价加仓（保留该币种已有的止损止盈单和挂单）
+func (t *PaperTrader) AddToPosition(symbol, side string, quantity float64, leverage int) (*OrderResult, error) {
+	return t.openPosition(symbol, side, quantity, leverage, false)
+}
+
+// CloseLong 平多仓（quantity=0表示全部平仓）
+func (t *PaperTrader) CloseLong(symbol string, quantity float64) (*OrderResult, error) {
+	return t.closeSide(symbol, "long", quantity)
+}
+
+// CloseShort 平空仓（quantity=0表示全部平仓）
+func (t *PaperTrader) CloseShort(symbol string, quantity float64) (*OrderResult, error) {
+	return t.closeSide(symbol, "short", quantity)
+}
+
+// PlaceLimitOrder 挂限价开仓单
+// 价格已可成交时：post-only单被拒绝，普通限价单按市价立即成交
+func (t *PaperTrader) PlaceLimitOrder(symbol, side string, quantity, price float64, leverage int, postOnly bool) (*OrderResult, error) {
+	if quantity <= 0 || price <= 0 {
+		return nil, fmt.Errorf("限价单数量和价格必须大于0: 数量%.8f 价格%.8f", quantity, price)
+	}
+	if leverage <= 0 {
+		return nil, fmt.Errorf("杠杆必须大于0: %d", leverage)
+	}
+
+	t.mu.Lock()
+	prices := make(map[string]float64)
+	t.refresh(prices)
+	current, err := t.getPrice(symbol, prices)
+	if err != nil {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("获取价格失败: %w", err)
+	}
+
+	marketable := (side == "long" && price >= current) || (side == "short" && price <= current)
+	if marketable && postOnly {
+		t.mu.Unlock()
+		return &OrderResult{Symbol: symbol, Status: "EXPIRED", Leverage: leverage}, nil
+	}
+	if !marketable {
+		positionSide := "LONG"
+		if side == "short" {
+			positionSide = "SHORT"
+		}
+		orderID := t.state.NextOrderID
+		t.state.NextOrderID++
+		t.state.Orders = append(t.state.Orders, &paperOrder{
+			OrderID:      orderID,
+			Symbol:       symbol,
+			PositionSide: positionSide,
+			Type:         "LIMIT",
+			Quantity:     quantity,
+			CreateTime:   t.nowFunc().UnixMilli(),
+			Price:        price,
+			Leverage:     leverage,
+			PostOnly:     postOnly,
+		})
+		t.saveState()
+		t.mu.Unlock()
+
+		log.Printf("✓ 模拟盘限价单已挂出: %s %s 价格: %.4f 数量: %.4f (当前价%.4f)",
+			symbol, side, price, quantity, current)
+		return &OrderResult{OrderID: orderID, Symbol: symbol, Status: "NEW", Leverage: leverage}, nil
+	}
+	t.mu.Unlock()
+
+	// 可立即成交的普通限价单按吃单成交（与真实交易所一致，不撤销其他挂单）
+	return t.openPosition(symbol, side, quantity, leverage, false)
+}
+
+// GetOpenOrders 获取未成交挂单（symbol为空表示所有币种）
+func (t *PaperTrader) GetOpenOrders(symbol string) ([]Order, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prices := make(map[string]float64)
+	t.refresh(prices)
+
+	result := []Order{}
+	for _, o := range t.state.Orders {
+		if symbol != "" && o.Symbol != symbol {
+			continue
+		}
+		order := Order{
+			OrderID:      o.OrderID,
+			Symbol:       o.Symbol,
+			PositionSide: o.PositionSide,
+			Type:         o.Type,
+			Price:        o.Price,
+			StopPrice:    o.StopPrice,
+			Quantity:     o.Quantity,
+			ReduceOnly:   o.Type != "LIMIT",
+			Time:         o.CreateTime,
+		}
+		// 开多/平空为买入，开空/平多为卖出
+		order.Side = paperFillSide(strings.ToLower(o.PositionSide), o.Type == "LIMIT")
+		result = append(result, order)
+	}
+	return result, nil
+}
+
+// CancelOrder 撤销指定挂单
+func (t *PaperTrader) CancelOrder(symbol string, orderID int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, order := range t.state.Orders {
+		if order.OrderID == orderID && order.Symbol == symbol {
+			t.state.Orders = append(t.state.Orders[:i], t.state.Orders[i+1:]...)
+			t.saveState()
+			log.Printf("  ✓ 已撤销 %s 订单 %d", symbol, orderID)
+			return nil
+		}
+	}
+	return fmt.Errorf("订单不存在: %s %d", symbol, orderID)
+}
+
+// SetLeverage 设置杠杆
+func (t *PaperTrader) SetLeverage(symbol string, leverage int) error {
+	if leverage <= 0 {
+		return fmt.Errorf("杠杆必须大于0: %d", leverage)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.state.Leverage[symbol] = leverage
+	t.saveState()
+	return nil
+}
+
+// SetMarginMode 设置该币种后续开仓使用的保证金模式（已有持仓保持开仓时的模式）
+func (t *PaperTrader) SetMarginMode(symbol string, mode string) error {
+	if err := ValidateMarginMode(mode); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if mode == "" || mode == MarginModeIsolated {
+		delete(t.state.MarginModes, symbol)
+	} else {
+		t.state.MarginModes[symbol] = mode
+	}
+	t.saveState()
+	return nil
+}
+
+// GetMarketPrice 获取市场价格
+func (t *PaperTrader) GetMarketPrice(symbol string) (float64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prices := make(map[string]float64)
+	t.refresh(prices)
+	return t.getPrice(symbol, prices)
+}
+
+// placeTriggerOrder 挂止损/止盈触发单
+func (t *PaperTrader) placeTriggerOrder(symbol, positionSide, orderType string, quantity, stopPrice float64) error {
+	if stopPrice <= 0 {
+		return fmt.Errorf("触发价必须大于0: %.8f", stopPrice)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	side := "long"
+	if positionSide == "SHORT" {
+		side = "short"
+	}
+	if _, exists := t.state.Positions[symbol+"_"+side]; !exists {
+		return fmt.Errorf("没有找到 %s 的%s仓", symbol, sideLabel(side))
+	}
+
+	t.state.Orders = append(t.state.Orders, &paperOrder{
+		OrderID:      t.state.NextOrderID,
+		Symbol:       symbol,
+		PositionSide: positionSide,
+		Type:         orderType,
+		Quantity:     quantity,
+		StopPrice:    stopPrice,
+		CreateTime:   t.nowFunc().UnixMilli(),
+	})
+	t.state.NextOrderID++
+	t.saveState()
+	return nil
+}
+
+// SetStopLoss 设置止损单
+func (t *PaperTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+	if err := t.placeTriggerOrder(symbol, positionSide, "STOP_MARKET", quantity, stopPrice); err != nil {
+		return fmt.Errorf("设置止损失败: %w", err)
+	}
+	log.Printf("  止损价设置: %.4f", stopPrice)
+	return nil
+}
+
+// SetTakeProfit 设置止盈单
+func (t *PaperTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	if err := t.placeTriggerOrder(symbol, positionSide, "TAKE_PROFIT_MARKET", quantity, takeProfitPrice); err != nil {
+		return fmt.Errorf("设置止盈失败: %w", err)
+	}
+	log.Printf("  止盈价设置: %.4f", takeProfitPrice)
+	return nil
+}
+
+// cancelOrdersLocked 取消该币种的所有挂单（调用方需持有锁）
+func (t *PaperTrader) cancelOrdersLocked(symbol string) {
+	remaining := t.state.Orders[:0]
+	for _, order := range t.state.Orders {
+		if order.Symbol != symbol {
+			remaining = append(remaining, order)
+		}
+	}
+	t.state.Orders = remaining
+}
+
+// SetPartialTakeProfit 设置部分止盈单（模拟盘止盈单按数量成交，直接复用）
+func (t *PaperTrader) SetPartialTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+	return t.SetTakeProfit(symbol, positionSide, quantity, takeProfitPrice)
+}
+
+// GetFills 获取指定时间之后的成交记录
+func (t *PaperTrader) GetFills(symbol string, startTime int64) ([]Fill, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refresh(make(map[string]float64))
+
+	var fills []Fill
+	for _, fill := range t.state.Fills {
+		if fill.Symbol == symbol && fill.Time >= startTime {
+			fills = append(fills, fill)
+		}
+	}
+	return fills, nil
+}
+
+// GetIncomeHistory 获取指定时间之后的手续费流水（模拟盘不模拟资金费）
+func (t *PaperTrader) GetIncomeHistory(symbol string, startTime int64) ([]Income, error) {
+	fills, err := t.GetFills(symbol, startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	var incomes []Income
+	for _, fill := range fills {
+		if fill.Fee == 0 {
+			continue
+		}
+		incomes = append(incomes, Income{
+			Symbol: symbol,
+			Type:   IncomeCommission,
+			Amount: -fill.Fee,
+			Asset:  fill.FeeAsset,
+			Time:   fill.Time,
+		})
+	}
+	return incomes, nil
+}
+
+// CancelAllOrders 取消该币种的所有挂单
+func (t *PaperTrader) CancelAllOrders(symbol string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cancelOrdersLocked(symbol)
+	t.saveState()
+	log.Printf("  ✓ 已取消 %s 的所有挂单", symbol)
+	return nil
+}
+
+// FormatQuantity 格式化数量到正确的精度（模拟盘不限制精度，统一保留8位小数）
+func (t *PaperTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
+	return fmt.Sprintf("%.8f", quantity), nil
+}
+
+// GetInstrument 获取交易对元数据（模拟盘不限制最小下单量和杠杆）
+func (t *PaperTrader) GetInstrument(symbol string) (*instrument.Instrument, error) {
+	symbol = instrument.Canonical(symbol)
+	return &instrument.Instrument{
+		Symbol:       symbol,
+		VenueSymbol:  symbol,
+		Exchange:     "paper",
+		StepSize:     1e-8,
+		ContractSize: 1,
+		Status:       instrument.StatusTrading,
+	}, nil
+}
+
+// sideLabel 持仓方向的中文标签
+func sideLabel(side string) string {
+	if side == "short" {
+		return "空"
+	}
+	return "多"
+}
@@ -0,0 +1,219 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"nofx/decision"
+	"nofx/logger"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ladderLevel 分批止盈档位（已换算为下单数量）
+type ladderLevel struct {
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"quantity"`
+}
+
+// attachStops 为持仓设置止损和止盈（失败只记录日志，下个周期对账时补挂）
+// 指定止盈阶梯时按各档位比例挂部分止盈单，剩余仓位挂在最终止盈价
+func (at *AutoTrader) attachStops(symbol, side string, quantity, stopLoss, takeProfit float64, levels []decision.TakeProfitLevel) {
+	positionSide := strings.ToUpper(side)
+	key := symbol + "_" + side
+
+	ms := &managedStop{StopLoss: stopLoss, TakeProfit: takeProfit}
+	if err := at.trader.SetStopLoss(symbol, positionSide, quantity, stopLoss); err != nil {
+		log.Printf("  ⚠ 设置止损失败: %v", err)
+	}
+
+	// 每档数量向下取整到数量步进（不足一个步进的档位跳过）
+	remaining := quantity
+	ladderPct := 0.0
+	for _, level := range levels {
+		ladderPct += level.SizePct
+		qty := at.floorQuantity(symbol, quantity*level.SizePct/100)
+		if qty <= 0 {
+			log.Printf("  ⚠ 分批止盈 %.4f × %.0f%% 数量不足一个步进，跳过", level.Price, level.SizePct)
+			continue
+		}
+		remaining -= qty
+		ms.Ladder = append(ms.Ladder, ladderLevel{Price: level.Price, Quantity: qty})
+	}
+	sort.Slice(ms.Ladder, func(i, j int) bool {
+		if side == "short" {
+			return ms.Ladder[i].Price > ms.Ladder[j].Price
+		}
+		return ms.Ladder[i].Price < ms.Ladder[j].Price
+	})
+	// 阶梯覆盖全部仓位时，取整剩余的数量并入最后一档
+	if len(ms.Ladder) > 0 && ladderPct >= 100-1e-6 && remaining > 0 {
+		ms.Ladder[len(ms.Ladder)-1].Quantity += remaining
+		remaining = 0
+	}
+	for _, level := range ms.Ladder {
+		if err := at.trader.SetPartialTakeProfit(symbol, positionSide, level.Quantity, level.Price); err != nil {
+			log.Printf("  ⚠ 设置分批止盈失败 (%.4f × %.4f): %v", level.Price, level.Quantity, err)
+		}
+	}
+	if remaining > quantity*1e-6 && takeProfit > 0 {
+		if len(ms.Ladder) > 0 {
+			// 最后一档止盈剩余仓位，同样只减仓，避免与已挂的阶梯单重复平仓
+			if err := at.trader.SetPartialTakeProfit(symbol, positionSide, remaining, takeProfit); err != nil {
+				log.Printf("  ⚠ 设置止盈失败: %v", err)
+			}
+		} else if err := at.trader.SetTakeProfit(symbol, positionSide, quantity, takeProfit); err != nil {
+			log.Printf("  ⚠ 设置止盈失败: %v", err)
+		}
+	}
+
+	if ms.StopLoss > 0 || ms.TakeProfit > 0 || len(ms.Ladder) > 0 {
+		at.state.Stops[key] = ms
+	}
+	at.state.PositionQty[key] = quantity
+	saveTraderState(at.stateFile, at.state)
+}
+
+// floorQuantity 将数量向下取整到交易所的数量步进（按FormatQuantity的精度，四舍五入后变大时按合约步进向下取整）
+func (at *AutoTrader) floorQuantity(symbol string, quantity float64) float64 {
+	formatted, err := at.trader.FormatQuantity(symbol, quantity)
+	if err != nil {
+		log.Printf("  ⚠ 格式化 %s 数量失败，按原数量下单: %v", symbol, err)
+		return quantity
+	}
+	rounded, err := strconv.ParseFloat(formatted, 64)
+	if err != nil {
+		return quantity
+	}
+	if rounded > quantity {
+		if inst, err := at.trader.GetInstrument(symbol); err == nil && inst.StepSize > 0 {
+			rounded = inst.RoundQuantity(quantity)
+		}
+	}
+	return rounded
+}
+
+// executePartialCloseWithRecord 按比例部分平仓（保留止损止盈单）
+func (at *AutoTrader) executePartialCloseWithRecord(d *decision.Decision, actionRecord *logger.DecisionAction) error {
+	pos, err := at.findSinglePosition(d.Symbol)
+	if err != nil {
+		return err
+	}
+
+	// 平仓比例达到100%时按全部平仓处理
+	if d.ClosePct >= 100 {
+		actionRecord.Action = "close_" + pos.Side
+		if pos.Side == "long" {
+			return at.executeCloseLongWithRecord(d, actionRecord)
+		}
+		return at.executeCloseShortWithRecord(d, actionRecord)
+	}
+
+	quantity := pos.Quantity * d.ClosePct / 100
+	log.Printf("  ✂️ 部分平仓: %s %s %.0f%% (数量%.4f)", d.Symbol, pos.Side, d.ClosePct, quantity)
+
+	actionRecord.Action = "close_" + pos.Side
+	actionRecord.Partial = true
+	actionRecord.Quantity = quantity
+
+	marketData, err := at.marketDataFetcher(d.Symbol)
+	if err != nil {
+		return err
+	}
+	actionRecord.Price = marketData.CurrentPrice
+
+	var order *OrderResult
+	if pos.Side == "long" {
+		order, err = at.trader.CloseLong(d.Symbol, quantity)
+	} else {
+		order, err = at.trader.CloseShort(d.Symbol, quantity)
+	}
+	if err != nil {
+		return err
+	}
+	at.recordOrder(actionRecord, order)
+	at.rememberOwnClose(order)
+
+	// 记录减仓后的数量，避免下个周期被识别为交易所侧减仓
+	at.state.PositionQty[d.Symbol+"_"+pos.Side] = math.Max(pos.Quantity-actionRecord.Quantity, 0)
+	saveTraderState(at.stateFile, at.state)
+
+	log.Printf("  ✓ 部分平仓成功")
+	return nil
+}
+
+// trackPositionSizes 识别交易所侧的部分减仓（分批止盈成交），记录为部分平仓动作（用于绩效统计）
+// since 为上次对账时间，用于查询期间的实际成交
+func (at *AutoTrader) trackPositionSizes(ctx *decision.Context, record *logger.DecisionRecord, since time.Time) {
+	changed := false
+	for _, pos := range ctx.Positions {
+		key := pos.Symbol + "_" + pos.Side
+		tracked, exists := at.state.PositionQty[key]
+		if !exists || pos.Quantity > tracked {
+			// 首次见到或加仓：只更新记录
+			if !exists || pos.Quantity != tracked {
+				at.state.PositionQty[key] = pos.Quantity
+				changed = true
+			}
+			continue
+		}
+
+		reduced := tracked - pos.Quantity
+		if reduced <= tracked*1e-6 {
+			continue
+		}
+
+		// 成交价优先取交易所实际成交，其次取已成交的止盈档位价格，否则使用标记价格
+		price := pos.MarkPrice
+		if ms, ok := at.state.Stops[key]; ok {
+			price = ms.popFilledLevels(reduced, price)
+		}
+		actionRecord := logger.DecisionAction{
+			Action:     "close_" + pos.Side,
+			Symbol:     pos.Symbol,
+			Quantity:   reduced,
+			Timestamp:  at.now(),
+			Success:    true,
+			Partial:    true,
+			Reconciled: true,
+		}
+		if !since.IsZero() {
+			if fills, err := at.closingFills(pos.Symbol, pos.Side, since.UnixMilli()); err != nil {
+				log.Printf("  ⚠ 查询 %s 成交记录失败，部分止盈成交价按估算记录: %v", pos.Symbol, err)
+			} else if summary, ok := summarizeFills(fills, reduced); ok {
+				// 只取与减仓数量相符的最新成交
+				price = summary.Price
+				actionRecord.Fee = summary.Fee
+				actionRecord.OrderID = summary.OrderID
+			}
+		}
+		actionRecord.Price = price
+
+		log.Printf("🎯 %s %s 检测到部分止盈成交: 数量%.4f 约%.4f (剩余%.4f)", pos.Symbol, pos.Side, reduced, price, pos.Quantity)
+		record.Decisions = append(record.Decisions, actionRecord)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🎯 %s %s 部分止盈成交 %.4f @ %.4f", pos.Symbol, pos.Side, reduced, price))
+		at.state.PositionQty[key] = pos.Quantity
+		changed = true
+	}
+	if changed {
+		saveTraderState(at.stateFile, at.state)
+	}
+}
+
+// popFilledLevels 按由近到远的顺序取出与减仓数量相符的止盈档位，返回按数量加权的成交价（没有匹配档位时返回fallback）
+func (ms *managedStop) popFilledLevels(reduced, fallback float64) float64 {
+	filled, notional := 0.0, 0.0
+	for len(ms.Ladder) > 0 && filled+ms.Ladder[0].Quantity <= reduced*1.001 {
+		level := ms.Ladder[0]
+		ms.Ladder = ms.Ladder[1:]
+		filled += level.Quantity
+		notional += level.Quantity * level.Price
+	}
+	if filled == 0 {
+		return fallback
+	}
+	// 超出档位数量的部分（如手动减仓）按fallback价格计
+	return (notional + (reduced-math.Min(filled, reduced))*fallback) / math.Max(filled, reduced)
+}
@@ -0,0 +1,239 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/decision"
+	"nofx/logger"
+	"sort"
+	"time"
+)
+
+// defaultEntryExpiry 限价开仓单默认过期时间
+const defaultEntryExpiry = 30 * time.Minute
+
+// pendingEntry 等待成交的限价开仓单（成交后才设置止损止盈）
+type pendingEntry struct {
+	OrderID    int64   `json:"order_id"`
+	Symbol     string  `json:"symbol"`
+	Side       string  `json:"side"`       // "long" or "short"
+	EntryType  string  `json:"entry_type"` // "limit" or "post_only"
+	Price      float64 `json:"price"`
+	Quantity   float64 `json:"quantity"`
+	Leverage   int     `json:"leverage"`
+	StopLoss   float64 `json:"stop_loss"`
+	TakeProfit float64 `json:"take_profit"`
+	PlacedAt   int64   `json:"placed_at"` // 挂单时间（毫秒）
+	ExpireAt   int64   `json:"expire_at"` // 过期时间（毫秒）
+
+	TakeProfitLevels []decision.TakeProfitLevel `json:"take_profit_levels,omitempty"` // 分批止盈阶梯
+}
+
+// placeLimitEntry 挂限价开仓单，立即成交时直接设置止损止盈，否则记录为待成交挂单
+func (at *AutoTrader) placeLimitEntry(d *decision.Decision, side string, actionRecord *logger.DecisionAction) error {
+	quantity := d.PositionSizeUSD / d.EntryPrice
+	actionRecord.Quantity = quantity
+	actionRecord.Price = d.EntryPrice
+
+	order, err := at.trader.PlaceLimitOrder(d.Symbol, side, quantity, d.EntryPrice, d.Leverage, d.EntryType == "post_only")
+	if err != nil {
+		return err
+	}
+
+	switch order.Status {
+	case "EXPIRED", "CANCELED", "REJECTED":
+		return fmt.Errorf("限价单未被接受（状态%s），post-only单的价格可能会立即成交", order.Status)
+	case "FILLED":
+		// 可立即成交的普通限价单：与市价开仓相同处理
+		at.recordOrder(actionRecord, order)
+		if order.FilledQty > 0 {
+			quantity = order.FilledQty
+		}
+		log.Printf("  ✓ 限价单立即成交，订单ID: %d, 数量: %.4f, 成交价: %.4f", order.OrderID, quantity, actionRecord.Price)
+		at.state.PositionOpenTime[d.Symbol+"_"+side] = at.now().UnixMilli()
+		at.attachStops(d.Symbol, side, quantity, d.StopLoss, d.TakeProfit, d.TakeProfitLevels)
+		return nil
+	}
+
+	expiry := defaultEntryExpiry
+	if d.ExpiryMinutes > 0 {
+		expiry = time.Duration(d.ExpiryMinutes) * time.Minute
+	}
+	at.state.PendingEntries[d.Symbol+"_"+side] = &pendingEntry{
+		OrderID:    order.OrderID,
+		Symbol:     d.Symbol,
+		Side:       side,
+		EntryType:  d.EntryType,
+		Price:      d.EntryPrice,
+		Quantity:   quantity,
+		Leverage:   d.Leverage,
+		StopLoss:   d.StopLoss,
+		TakeProfit: d.TakeProfit,
+		PlacedAt:   at.now().UnixMilli(),
+		ExpireAt:   at.now().Add(expiry).UnixMilli(),
+
+		TakeProfitLevels: d.TakeProfitLevels,
+	}
+	saveTraderState(at.stateFile, at.state)
+
+	actionRecord.OrderID = order.OrderID
+	actionRecord.Pending = true
+	log.Printf("  ⏳ 限价单已挂出，订单ID: %d, 价格: %.4f, 数量: %.4f, %.0f分钟后过期",
+		order.OrderID, d.EntryPrice, quantity, expiry.Minutes())
+	return nil
+}
+
+// checkPendingEntries 检查待成交的限价开仓单：成交后设置止损止盈并记录开仓，过期则撤单
+func (at *AutoTrader) checkPendingEntries(record *logger.DecisionRecord) {
+	if len(at.state.PendingEntries) == 0 {
+		return
+	}
+
+	orders, err := at.trader.GetOpenOrders("")
+	if err != nil {
+		log.Printf("⚠ 获取挂单失败，跳过限价单检查: %v", err)
+		return
+	}
+	openOrders := make(map[int64]bool)
+	for _, o := range orders {
+		openOrders[o.OrderID] = true
+	}
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		log.Printf("⚠ 获取持仓失败，跳过限价单检查: %v", err)
+		return
+	}
+	findPosition := func(symbol, side string) *Position {
+		for i := range positions {
+			if positions[i].Symbol == symbol && positions[i].Side == side {
+				return &positions[i]
+			}
+		}
+		return nil
+	}
+
+	for _, key := range sortedPendingKeys(at.state.PendingEntries) {
+		entry := at.state.PendingEntries[key]
+
+		if openOrders[entry.OrderID] {
+			if at.now().UnixMilli() < entry.ExpireAt {
+				continue // 仍在挂单中
+			}
+			// 过期撤单（部分成交的仓位保留并设置止损止盈）
+			if err := at.trader.CancelOrder(entry.Symbol, entry.OrderID); err != nil {
+				log.Printf("⚠ 撤销过期限价单失败 (%s %s 订单%d): %v", entry.Symbol, entry.Side, entry.OrderID, err)
+				continue
+			}
+			log.Printf("⌛ 限价单过期已撤销: %s %s 订单%d", entry.Symbol, entry.Side, entry.OrderID)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⌛ %s %s 限价单过期已撤销", entry.Symbol, entry.Side))
+			if pos := findPosition(entry.Symbol, entry.Side); pos != nil {
+				at.fillPendingEntry(entry, pos, record)
+			}
+			delete(at.state.PendingEntries, key)
+			continue
+		}
+
+		// 挂单已不在：有对应持仓说明已成交，否则为被撤销（交易所或手动撤单）
+		if pos := findPosition(entry.Symbol, entry.Side); pos != nil {
+			at.fillPendingEntry(entry, pos, record)
+		} else {
+			log.Printf("⚠ 限价单已被撤销且未成交: %s %s 订单%d", entry.Symbol, entry.Side, entry.OrderID)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠ %s %s 限价单已被撤销且未成交", entry.Symbol, entry.Side))
+		}
+		delete(at.state.PendingEntries, key)
+	}
+
+	saveTraderState(at.stateFile, at.state)
+}
+
+// fillPendingEntry 限价单成交后设置止损止盈，并记录一条开仓动作（用于绩效统计）
+func (at *AutoTrader) fillPendingEntry(entry *pendingEntry, pos *Position, record *logger.DecisionRecord) {
+	log.Printf("✅ 限价单已成交: %s %s 订单%d 成交均价%.4f 数量%.4f",
+		entry.Symbol, entry.Side, entry.OrderID, pos.EntryPrice, pos.Quantity)
+
+	at.state.PositionOpenTime[entry.Symbol+"_"+entry.Side] = at.now().UnixMilli()
+	at.attachStops(entry.Symbol, entry.Side, pos.Quantity, entry.StopLoss, entry.TakeProfit, entry.TakeProfitLevels)
+
+	actionRecord := logger.DecisionAction{
+		Action:    "open_" + entry.Side,
+		Symbol:    entry.Symbol,
+		Quantity:  pos.Quantity,
+		Leverage:  entry.Leverage,
+		Price:     pos.EntryPrice,
+		OrderID:   entry.OrderID,
+		Timestamp: at.now(),
+		Success:   true,
+	}
+	// 成交均价、数量和手续费以该订单的成交记录为准（与市价开仓相同），查询失败时按持仓记录
+	if fills, err := at.entryFills(entry); err != nil {
+		log.Printf("  ⚠ 获取限价单%d成交记录失败，手续费按0记录: %v", entry.OrderID, err)
+	} else if len(fills) > 0 {
+		order := &OrderResult{OrderID: entry.OrderID, Fills: fills}
+		order.summarizeFills()
+		at.recordOrder(&actionRecord, order)
+	}
+	record.Decisions = append(record.Decisions, actionRecord)
+	record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 限价单成交", entry.Symbol, entry.Side))
+}
+
+// cancelPendingEntry 撤销指定币种和方向的待成交限价单，返回是否存在挂单
+func (at *AutoTrader) cancelPendingEntry(symbol, side string) (bool, error) {
+	key := symbol + "_" + side
+	entry, exists := at.state.PendingEntries[key]
+	if !exists {
+		return false, nil
+	}
+	if err := at.trader.CancelOrder(symbol, entry.OrderID); err != nil {
+		return true, fmt.Errorf("撤销限价单失败: %w", err)
+	}
+	delete(at.state.PendingEntries, key)
+	saveTraderState(at.stateFile, at.state)
+	log.Printf("  ✓ 已撤销 %s %s 限价单 %d", symbol, side, entry.OrderID)
+	return true, nil
+}
+
+// pendingOrderInfos 待成交限价单列表（传给AI决策）
+func (at *AutoTrader) pendingOrderInfos() []decision.PendingOrderInfo {
+	var infos []decision.PendingOrderInfo
+	for _, key := range sortedPendingKeys(at.state.PendingEntries) {
+		entry := at.state.PendingEntries[key]
+		infos = append(infos, decision.PendingOrderInfo{
+			Symbol:     entry.Symbol,
+			Side:       entry.Side,
+			EntryType:  entry.EntryType,
+			Price:      entry.Price,
+			Quantity:   entry.Quantity,
+			StopLoss:   entry.StopLoss,
+			TakeProfit: entry.TakeProfit,
+			PlacedAt:   entry.PlacedAt,
+			ExpireAt:   entry.ExpireAt,
+		})
+	}
+	return infos
+}
+
+// entryFills 查询限价开仓单挂出以来的成交记录
+func (at *AutoTrader) entryFills(entry *pendingEntry) ([]Fill, error) {
+	fills, err := at.trader.GetFills(entry.Symbol, entry.PlacedAt)
+	if err != nil {
+		return nil, err
+	}
+	var result []Fill
+	for _, f := range fills {
+		if f.OrderID == entry.OrderID {
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
+
+// sortedPendingKeys 按key排序（保证处理顺序稳定）
+func sortedPendingKeys(entries map[string]*pendingEntry) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,116 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/decision"
+	"nofx/logger"
+	"nofx/risk"
+	"strings"
+)
+
+// PositionScalingConfig 加仓配置（MaxAdds为0时不允许加仓）
+type PositionScalingConfig struct {
+	MaxAdds        int     // 每笔持仓最多加仓次数
+	MaxNotionalUSD float64 // 加仓后单币种同方向持仓名义价值上限（USDT）
+}
+
+// executeAddWithRecord 对已有同方向持仓市价加仓，并按加仓后的全部仓位重新设置止损止盈
+func (at *AutoTrader) executeAddWithRecord(d *decision.Decision, side string, actionRecord *logger.DecisionAction) error {
+	log.Printf("  ➕ 加%s仓: %s", sideLabel(side), d.Symbol)
+
+	cfg := at.config.PositionScaling
+	if cfg.MaxAdds <= 0 {
+		return fmt.Errorf("未启用加仓（position_scaling.max_adds为0）")
+	}
+
+	key := d.Symbol + "_" + side
+	if at.state.Adds[key] >= cfg.MaxAdds {
+		return fmt.Errorf("%s %s 已加仓%d次，达到上限%d", d.Symbol, side, at.state.Adds[key], cfg.MaxAdds)
+	}
+
+	pos, err := at.findPosition(d.Symbol, side)
+	if err != nil {
+		return err
+	}
+	if pos == nil {
+		return fmt.Errorf("%s 没有%s仓，无法加仓，请使用open_%s", d.Symbol, sideLabel(side), side)
+	}
+
+	// 加仓沿用持仓的保证金模式（忽略决策中的margin_mode）
+	if err := at.applyMarginMode(d.Symbol, pos.MarginMode); err != nil {
+		return err
+	}
+
+	marketData, err := at.marketDataFetcher(d.Symbol)
+	if err != nil {
+		return err
+	}
+	price := marketData.CurrentPrice
+
+	// 单币种名义价值上限：超出部分缩减加仓金额
+	remaining := cfg.MaxNotionalUSD - pos.Quantity*price
+	if remaining <= 0 {
+		return fmt.Errorf("%s %s 持仓%.0f USDT已达到加仓上限%.0f USDT", d.Symbol, side, pos.Quantity*price, cfg.MaxNotionalUSD)
+	}
+	if d.PositionSizeUSD > remaining {
+		reason := fmt.Sprintf("加仓后持仓超过上限%.0f USDT", cfg.MaxNotionalUSD)
+		log.Printf("  🛡️ 缩减加仓金额 %s: %.2f → %.2f USDT (%s)", d.Symbol, d.PositionSizeUSD, remaining, reason)
+		d.PositionSizeUSD = remaining
+		actionRecord.RiskStatus = risk.StatusResized
+		if actionRecord.RiskReason != "" {
+			reason = actionRecord.RiskReason + "; " + reason
+		}
+		actionRecord.RiskReason = reason
+		if err := at.checkInstrumentLimits(d.Symbol, d.PositionSizeUSD, price, d.Leverage); err != nil {
+			return fmt.Errorf("缩减后加仓金额不满足交易所限制: %w", err)
+		}
+	}
+
+	quantity := d.PositionSizeUSD / price
+	actionRecord.Quantity = quantity
+	actionRecord.Price = price
+
+	// 加仓不撤销已有挂单（另一方向的止损止盈和限价开仓单保持不变）
+	order, err := at.trader.AddToPosition(d.Symbol, side, quantity, d.Leverage)
+	if err != nil {
+		return err
+	}
+	at.recordOrder(actionRecord, order)
+
+	at.state.Adds[key]++
+
+	// 以交易所返回的持仓为准（数量和开仓均价），获取失败时按成交数据估算
+	totalQty := pos.Quantity + actionRecord.Quantity
+	entryPrice := (pos.EntryPrice*pos.Quantity + actionRecord.Price*actionRecord.Quantity) / totalQty
+	if updated, err := at.findPosition(d.Symbol, side); err == nil && updated != nil {
+		totalQty, entryPrice = updated.Quantity, updated.EntryPrice
+	}
+	log.Printf("  ✓ 加仓成功，订单ID: %d, 数量: %.4f → %.4f, 开仓均价: %.4f (第%d次加仓)",
+		order.OrderID, pos.Quantity, totalQty, entryPrice, at.state.Adds[key])
+
+	// 撤销本方向原有的止损止盈后按全部仓位重新设置
+	if err := at.cancelProtectiveOrders(d.Symbol, side); err != nil {
+		log.Printf("  ⚠ 撤销原止损止盈失败: %v", err)
+	}
+	at.attachStops(d.Symbol, side, totalQty, d.StopLoss, d.TakeProfit, d.TakeProfitLevels)
+	return nil
+}
+
+// cancelProtectiveOrders 撤销指定持仓方向的止损和止盈单
+func (at *AutoTrader) cancelProtectiveOrders(symbol, side string) error {
+	orders, err := at.trader.GetOpenOrders(symbol)
+	if err != nil {
+		return fmt.Errorf("获取挂单失败: %w", err)
+	}
+	positionSide := strings.ToUpper(side)
+	for _, o := range orders {
+		if (o.Type != "STOP_MARKET" && o.Type != "TAKE_PROFIT_MARKET") || orderPositionSide(o) != positionSide {
+			continue
+		}
+		if err := at.trader.CancelOrder(symbol, o.OrderID); err != nil {
+			return fmt.Errorf("撤销挂单%d失败: %w", o.OrderID, err)
+		}
+	}
+	return nil
+}
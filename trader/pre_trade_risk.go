@@ -0,0 +1,143 @@
+package trader
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"nofx/decision"
+	"nofx/instrument"
+	"nofx/logger"
+	"nofx/risk"
+	"strings"
+)
+
+// checkPreTradeRisk 开仓前风控检查：拒绝时返回错误，缩减时直接修改决策中的仓位大小
+// 只影响当前决策，同一周期的其他决策照常执行
+func (at *AutoTrader) checkPreTradeRisk(d *decision.Decision, actionRecord *logger.DecisionAction, ctx *decision.Context) error {
+	price := 0.0
+	if data, ok := ctx.MarketDataMap[d.Symbol]; ok {
+		price = data.CurrentPrice
+	}
+
+	// 交易所限制（上市状态、最大杠杆、最小下单量和最小下单金额）：挂单按挂单价折算数量
+	orderPrice := price
+	if (d.EntryType == "limit" || d.EntryType == "post_only") && d.EntryPrice > 0 {
+		orderPrice = d.EntryPrice
+	}
+	if err := at.checkInstrumentLimits(d.Symbol, d.PositionSizeUSD, orderPrice, d.Leverage); err != nil {
+		actionRecord.RiskStatus = risk.StatusRejected
+		actionRecord.RiskReason = err.Error()
+		return fmt.Errorf("不满足交易所限制: %w", err)
+	}
+
+	snap, err := at.buildRiskSnapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := at.riskEngine.Evaluate(risk.Order{
+		Symbol:      d.Symbol,
+		Side:        strings.TrimPrefix(strings.TrimPrefix(d.Action, "open_"), "add_to_"),
+		NotionalUSD: d.PositionSizeUSD,
+		Leverage:    d.Leverage,
+		Price:       price,
+		Limit:       d.EntryType == "limit" || d.EntryType == "post_only",
+	}, snap)
+
+	actionRecord.RiskStatus = result.Status
+	actionRecord.RiskReason = result.Reason
+
+	switch result.Status {
+	case risk.StatusRejected:
+		return errors.New(result.Reason)
+	case risk.StatusResized:
+		log.Printf("  🛡️ 风控缩减仓位 %s: %.2f → %.2f USDT (%s)", d.Symbol, d.PositionSizeUSD, result.NotionalUSD, result.Reason)
+		d.PositionSizeUSD = result.NotionalUSD
+		if err := at.checkInstrumentLimits(d.Symbol, d.PositionSizeUSD, orderPrice, d.Leverage); err != nil {
+			actionRecord.RiskStatus = risk.StatusRejected
+			actionRecord.RiskReason = result.Reason + "; 缩减后" + err.Error()
+			return fmt.Errorf("缩减后仓位不满足交易所限制: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkInstrumentLimits 检查下单是否满足交易所限制：上市状态、最大杠杆、最小下单量和最小下单金额
+// 交易所没有该交易对时拒绝；元数据加载失败（网络等）时不检查，由交易所最终校验
+func (at *AutoTrader) checkInstrumentLimits(symbol string, notionalUSD, price float64, leverage int) error {
+	inst, err := at.trader.GetInstrument(symbol)
+	if err != nil {
+		if errors.Is(err, instrument.ErrUnknownSymbol) {
+			return err
+		}
+		log.Printf("  ⚠ 获取%s合约信息失败，跳过交易所限制检查: %v", symbol, err)
+		return nil
+	}
+	if inst.MaxLeverage > 0 && leverage > inst.MaxLeverage {
+		return fmt.Errorf("%s 杠杆%d倍超过交易所上限%d倍", symbol, leverage, inst.MaxLeverage)
+	}
+	if price <= 0 {
+		if !inst.Tradable() {
+			return fmt.Errorf("%s 当前状态为%s，不可交易", symbol, inst.Status)
+		}
+		return nil
+	}
+	return inst.CheckOrder(notionalUSD/price, price)
+}
+
+// buildRiskSnapshot 构建风控快照（重新获取持仓，包含本周期已执行的平仓/开仓）
+// 待成交的限价开仓单按挂单价和委托数量计入，避免多个挂单成交后超出持仓数和敞口上限
+func (at *AutoTrader) buildRiskSnapshot(ctx *decision.Context) (*risk.Snapshot, error) {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return nil, fmt.Errorf("获取持仓失败: %w", err)
+	}
+
+	snap := &risk.Snapshot{
+		Now:       at.now(),
+		Equity:    ctx.Account.TotalEquity,
+		LastClose: at.state.LastClose,
+		PriceSeries: func(symbol string) []float64 {
+			if data, ok := ctx.MarketDataMap[symbol]; ok && data.IntradaySeries != nil {
+				return data.IntradaySeries.MidPrices
+			}
+			return nil
+		},
+		OrderBook: func(symbol string) risk.OrderBook {
+			if data, ok := ctx.MarketDataMap[symbol]; ok && data.OrderBook != nil {
+				return data.OrderBook
+			}
+			return nil
+		},
+	}
+
+	for _, pos := range positions {
+		snap.Positions = append(snap.Positions, risk.Position{
+			Symbol:     pos.Symbol,
+			Side:       pos.Side,
+			Quantity:   pos.Quantity,
+			EntryPrice: pos.EntryPrice,
+			MarkPrice:  pos.MarkPrice,
+			Leverage:   pos.Leverage,
+		})
+	}
+	for _, entry := range at.state.PendingEntries {
+		snap.Positions = append(snap.Positions, risk.Position{
+			Symbol:     entry.Symbol,
+			Side:       entry.Side,
+			Quantity:   entry.Quantity,
+			EntryPrice: entry.Price,
+			MarkPrice:  entry.Price,
+			Leverage:   entry.Leverage,
+			Pending:    true,
+		})
+	}
+
+	return snap, nil
+}
+
+// recordClose 记录币种平仓时间（冷却规则使用）并持久化
+func (at *AutoTrader) recordClose(symbol string) {
+	at.state.LastClose[symbol] = at.now()
+	saveTraderState(at.stateFile, at.state)
+}
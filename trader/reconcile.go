@@ -0,0 +1,323 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"nofx/decision"
+	"nofx/logger"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reconcileMatchPct 成交均价与止损/止盈价的偏差在该比例内时认定为对应触发单成交
+const reconcileMatchPct = 0.01
+
+// reconcile 每个周期将本地记录的持仓和保护单与交易所实际状态对账
+// 1. 识别交易所侧的平仓（止损止盈触发、强平或手动平仓），按实际成交记录为平仓动作
+// 2. 识别交易所侧的部分减仓（分批止盈成交）
+// 3. 补挂丢失的止损止盈单，对没有止损保护的持仓发出告警
+// snapshotTime 为本周期查询持仓前的时间，作为下次查询成交记录的起点
+func (at *AutoTrader) reconcile(ctx *decision.Context, record *logger.DecisionRecord, snapshotTime time.Time) {
+	since := at.state.LastReconcile
+
+	live := make(map[string]*decision.PositionInfo, len(ctx.Positions))
+	for i := range ctx.Positions {
+		pos := &ctx.Positions[i]
+		live[pos.Symbol+"_"+pos.Side] = pos
+	}
+
+	// 1. 本地记录中存在、交易所已不存在的持仓（含开仓后未到下个周期即被平掉的持仓）
+	closed := make(map[string]bool)
+	for key := range at.state.PositionOpenTime {
+		if live[key] == nil {
+			closed[key] = true
+		}
+	}
+	for key := range at.state.PositionQty {
+		if live[key] == nil {
+			closed[key] = true
+		}
+	}
+	keys := make([]string, 0, len(closed))
+	for key := range closed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		at.reconcileClosedPosition(key, since, record)
+	}
+
+	// 2. 部分减仓
+	at.trackPositionSizes(ctx, record, since)
+
+	// 3. 保护单检查
+	at.reconcileProtectiveOrders(ctx, record)
+
+	at.pruneOwnCloses(since)
+	at.state.LastReconcile = snapshotTime
+	saveTraderState(at.stateFile, at.state)
+}
+
+// reconcileClosedPosition 记录一笔交易所侧的平仓（成交价取实际成交均价）并清理持仓记录
+func (at *AutoTrader) reconcileClosedPosition(key string, since time.Time, record *logger.DecisionRecord) {
+	idx := strings.LastIndex(key, "_")
+	symbol, side := key[:idx], key[idx+1:]
+	ms := at.state.Stops[key]
+
+	// 首次对账（如升级后）从开仓时间开始查询成交记录
+	startTime := since.UnixMilli()
+	if since.IsZero() {
+		startTime = at.state.PositionOpenTime[key]
+	}
+
+	actionRecord := logger.DecisionAction{
+		Action:     "close_" + side,
+		Symbol:     symbol,
+		Quantity:   at.state.PositionQty[key],
+		Timestamp:  at.now(),
+		Success:    true,
+		Reconciled: true,
+	}
+
+	fills, err := at.closingFills(symbol, side, startTime)
+	if err != nil {
+		log.Printf("  ⚠ 查询 %s 成交记录失败，平仓价按估算记录: %v", symbol, err)
+	}
+	// 成交数量不超过记录的持仓数量（查询窗口内可能包含同方向更早持仓的平仓成交）
+	limit := math.Inf(1)
+	if tracked := at.state.PositionQty[key]; tracked > 0 {
+		limit = tracked
+	}
+	if summary, ok := summarizeFills(fills, limit); ok {
+		actionRecord.Quantity = summary.Quantity
+		actionRecord.Price = summary.Price
+		actionRecord.Fee = summary.Fee
+		actionRecord.OrderID = summary.OrderID
+	} else if price, err := at.trader.GetMarketPrice(symbol); err == nil {
+		actionRecord.Price = price
+	}
+
+	reason := closeReason(side, actionRecord.Price, ms)
+	log.Printf("🔁 对账: %s %s 已在交易所侧平仓（%s）: 数量%.4f 成交价%.4f 手续费%.4f",
+		symbol, side, reason, actionRecord.Quantity, actionRecord.Price, actionRecord.Fee)
+	record.Decisions = append(record.Decisions, actionRecord)
+	record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🔁 %s %s 交易所侧平仓（%s）@ %.4f", symbol, side, reason, actionRecord.Price))
+
+	// 清理残留的止损止盈单（如止损成交后未撤销的止盈单）
+	if err := at.cancelProtectiveOrders(symbol, side); err != nil {
+		log.Printf("  ⚠ 撤销 %s %s 残留止损止盈单失败: %v", symbol, side, err)
+	}
+
+	at.forgetPosition(symbol, side)
+	at.recordClose(symbol)
+}
+
+// closingFills 查询指定时间之后该持仓方向的交易所侧平仓成交（平多为卖出，平空为买入；排除本程序主动下的平仓单）
+func (at *AutoTrader) closingFills(symbol, side string, startTime int64) ([]Fill, error) {
+	fills, err := at.trader.GetFills(symbol, startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	closeSide := "SELL"
+	if side == "short" {
+		closeSide = "BUY"
+	}
+	positionSide := strings.ToUpper(side)
+
+	var result []Fill
+	for _, f := range fills {
+		if f.Side != closeSide || f.Quantity <= 0 {
+			continue
+		}
+		if f.PositionSide != "" && f.PositionSide != positionSide {
+			continue
+		}
+		if _, own := at.state.OwnCloses[f.OrderID]; own {
+			continue
+		}
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Time < result[j].Time })
+	return result, nil
+}
+
+// fillSummary 一组成交的汇总
+type fillSummary struct {
+	Quantity float64
+	Price    float64 // 按数量加权的成交均价
+	Fee      float64
+	OrderID  int64 // 最新一笔成交的订单ID
+}
+
+// summarizeFills 从最新的成交开始向前汇总，数量达到limit为止（最早计入的一笔按比例计入数量和手续费）
+// fills需按时间升序排列；没有成交时返回false
+func summarizeFills(fills []Fill, limit float64) (fillSummary, bool) {
+	var summary fillSummary
+	var notional float64
+	for i := len(fills) - 1; i >= 0 && summary.Quantity < limit*(1-1e-9); i-- {
+		f := fills[i]
+		take := math.Min(f.Quantity, limit-summary.Quantity)
+		if summary.OrderID == 0 {
+			summary.OrderID = f.OrderID
+		}
+		summary.Quantity += take
+		notional += f.Price * take
+		summary.Fee += f.Fee * take / f.Quantity
+	}
+	if summary.Quantity <= 0 {
+		return fillSummary{}, false
+	}
+	summary.Price = notional / summary.Quantity
+	return summary, true
+}
+
+// rememberOwnClose 记录本程序主动下的平仓单，对账时不再将其成交识别为交易所侧平仓
+func (at *AutoTrader) rememberOwnClose(order *OrderResult) {
+	if order == nil || order.OrderID == 0 {
+		return
+	}
+	at.state.OwnCloses[order.OrderID] = at.now().UnixMilli()
+}
+
+// pruneOwnCloses 清理早于before的平仓单记录（其成交已不在下次对账的查询窗口内）
+func (at *AutoTrader) pruneOwnCloses(before time.Time) {
+	for orderID, placedAt := range at.state.OwnCloses {
+		if placedAt < before.UnixMilli() {
+			delete(at.state.OwnCloses, orderID)
+		}
+	}
+}
+
+// closeReason 根据成交价判断平仓原因（取与成交价最接近的止损或止盈价，偏差超过reconcileMatchPct时视为手动平仓或强平）
+func closeReason(side string, price float64, ms *managedStop) string {
+	if ms == nil || price <= 0 {
+		return "手动平仓或强平"
+	}
+	// 成交价越过止损价（滑点）也视为止损
+	if ms.StopLoss > 0 && ((side == "long" && price < ms.StopLoss) || (side == "short" && price > ms.StopLoss)) {
+		return "止损"
+	}
+
+	reason, best := "手动平仓或强平", reconcileMatchPct
+	match := func(target float64, label string) {
+		if target <= 0 {
+			return
+		}
+		if diff := math.Abs(price-target) / target; diff <= best {
+			reason, best = label, diff
+		}
+	}
+	match(ms.StopLoss, "止损")
+	match(ms.TakeProfit, "止盈")
+	for _, level := range ms.Ladder {
+		match(level.Price, "止盈")
+	}
+	return reason
+}
+
+// reconcileProtectiveOrders 检查持仓的止损止盈单是否仍在交易所，缺失时按记录的价格补挂
+func (at *AutoTrader) reconcileProtectiveOrders(ctx *decision.Context, record *logger.DecisionRecord) {
+	ordersBySymbol := make(map[string][]Order)
+	for _, pos := range ctx.Positions {
+		orders, ok := ordersBySymbol[pos.Symbol]
+		if !ok {
+			var err error
+			if orders, err = at.trader.GetOpenOrders(pos.Symbol); err != nil {
+				log.Printf("  ⚠ 获取 %s 挂单失败，跳过保护单检查: %v", pos.Symbol, err)
+				continue
+			}
+			ordersBySymbol[pos.Symbol] = orders
+		}
+
+		positionSide := strings.ToUpper(pos.Side)
+		hasStop, hasTakeProfit := false, false
+		for _, o := range orders {
+			if orderPositionSide(o) != positionSide {
+				continue
+			}
+			switch o.Type {
+			case "STOP_MARKET":
+				hasStop = true
+			case "TAKE_PROFIT_MARKET":
+				hasTakeProfit = true
+			}
+		}
+
+		key := pos.Symbol + "_" + pos.Side
+		ms := at.state.Stops[key]
+		if ms == nil || ms.StopLoss <= 0 {
+			if !hasStop {
+				log.Printf("🚨 %s %s 持仓没有止损保护（数量%.4f，未找到止损单和止损记录）", pos.Symbol, pos.Side, pos.Quantity)
+				record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🚨 %s %s 持仓没有止损保护", pos.Symbol, pos.Side))
+			}
+		} else if !hasStop {
+			at.restoreStopLoss(&pos, ms, record)
+		}
+
+		if ms != nil && !hasTakeProfit && (ms.TakeProfit > 0 || len(ms.Ladder) > 0) {
+			at.restoreTakeProfits(&pos, ms, record)
+		}
+	}
+}
+
+// restoreStopLoss 补挂丢失的止损单（止损价已被穿越时只告警，交由AI或风控处理）
+func (at *AutoTrader) restoreStopLoss(pos *decision.PositionInfo, ms *managedStop, record *logger.DecisionRecord) {
+	if (pos.Side == "long" && pos.MarkPrice <= ms.StopLoss) || (pos.Side == "short" && pos.MarkPrice >= ms.StopLoss) {
+		log.Printf("🚨 %s %s 止损单缺失且价格%.4f已越过止损价%.4f，无法补挂", pos.Symbol, pos.Side, pos.MarkPrice, ms.StopLoss)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🚨 %s %s 止损单缺失且已越过止损价%.4f", pos.Symbol, pos.Side, ms.StopLoss))
+		return
+	}
+
+	if err := at.trader.SetStopLoss(pos.Symbol, strings.ToUpper(pos.Side), pos.Quantity, ms.StopLoss); err != nil {
+		log.Printf("🚨 %s %s 止损单缺失，补挂失败: %v", pos.Symbol, pos.Side, err)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🚨 %s %s 补挂止损失败: %v", pos.Symbol, pos.Side, err))
+		return
+	}
+	log.Printf("🛠️ 对账: %s %s 止损单缺失，已补挂 @ %.4f", pos.Symbol, pos.Side, ms.StopLoss)
+	record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🛠️ %s %s 补挂止损 @ %.4f", pos.Symbol, pos.Side, ms.StopLoss))
+}
+
+// restoreTakeProfits 补挂丢失的止盈单（未成交的阶梯档位和最终止盈）
+func (at *AutoTrader) restoreTakeProfits(pos *decision.PositionInfo, ms *managedStop, record *logger.DecisionRecord) {
+	positionSide := strings.ToUpper(pos.Side)
+	remaining := pos.Quantity
+	for _, level := range ms.Ladder {
+		qty := math.Min(level.Quantity, remaining)
+		if qty <= 0 {
+			break
+		}
+		if err := at.trader.SetPartialTakeProfit(pos.Symbol, positionSide, qty, level.Price); err != nil {
+			log.Printf("  ⚠ %s %s 补挂分批止盈失败 (%.4f): %v", pos.Symbol, pos.Side, level.Price, err)
+			continue
+		}
+		remaining -= qty
+	}
+
+	if remaining > pos.Quantity*1e-6 && ms.TakeProfit > 0 {
+		var err error
+		if len(ms.Ladder) > 0 {
+			err = at.trader.SetPartialTakeProfit(pos.Symbol, positionSide, remaining, ms.TakeProfit)
+		} else {
+			err = at.trader.SetTakeProfit(pos.Symbol, positionSide, pos.Quantity, ms.TakeProfit)
+		}
+		if err != nil {
+			log.Printf("  ⚠ %s %s 补挂止盈失败: %v", pos.Symbol, pos.Side, err)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("⚠ %s %s 补挂止盈失败: %v", pos.Symbol, pos.Side, err))
+			return
+		}
+	}
+	log.Printf("🛠️ 对账: %s %s 止盈单缺失，已补挂", pos.Symbol, pos.Side)
+	record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🛠️ %s %s 补挂止盈", pos.Symbol, pos.Side))
+}
+
+// forgetPosition 清除持仓的本地跟踪记录（主动平仓或对账确认平仓后调用）
+func (at *AutoTrader) forgetPosition(symbol, side string) {
+	key := symbol + "_" + side
+	delete(at.state.PositionOpenTime, key)
+	delete(at.state.Stops, key)
+	delete(at.state.PositionQty, key)
+	delete(at.state.Adds, key)
+}
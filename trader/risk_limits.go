@@ -0,0 +1,142 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/decision"
+	"nofx/logger"
+	"time"
+)
+
+// checkRiskLimits 更新日盈亏基准和最高净值，检查日亏损和最大回撤是否超限
+// 超限时返回风控事件（由handleRiskBreach处理），否则返回nil
+func (at *AutoTrader) checkRiskLimits(equity float64) *logger.RiskEvent {
+	now := at.now().UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	changed := false
+
+	// 每个UTC日以首次观察到的净值作为日盈亏基准
+	if !at.state.DayStart.Equal(dayStart) || at.state.DayStartEquity <= 0 {
+		at.state.DayStart = dayStart
+		at.state.DayStartEquity = equity
+		changed = true
+		log.Printf("📅 日盈亏基准已重置: %.2f USDT", equity)
+	}
+	if equity > at.state.PeakEquity {
+		at.state.PeakEquity = equity
+		changed = true
+	}
+	if changed {
+		saveTraderState(at.stateFile, at.state)
+	}
+
+	at.state.DailyPnL = equity - at.state.DayStartEquity
+
+	if at.state.DayStartEquity > 0 && at.config.MaxDailyLoss > 0 {
+		lossPct := -at.state.DailyPnL / at.state.DayStartEquity * 100
+		if lossPct >= at.config.MaxDailyLoss {
+			return &logger.RiskEvent{
+				Type:     "daily_loss",
+				Equity:   equity,
+				Baseline: at.state.DayStartEquity,
+				LossPct:  lossPct,
+				LimitPct: at.config.MaxDailyLoss,
+			}
+		}
+	}
+
+	if at.state.PeakEquity > 0 && at.config.MaxDrawdown > 0 {
+		drawdownPct := (at.state.PeakEquity - equity) / at.state.PeakEquity * 100
+		if drawdownPct >= at.config.MaxDrawdown {
+			return &logger.RiskEvent{
+				Type:     "max_drawdown",
+				Equity:   equity,
+				Baseline: at.state.PeakEquity,
+				LossPct:  drawdownPct,
+				LimitPct: at.config.MaxDrawdown,
+			}
+		}
+	}
+
+	return nil
+}
+
+// handleRiskBreach 处理风控触发：按策略平仓或冻结，设置暂停时间并持久化，记录到决策日志
+func (at *AutoTrader) handleRiskBreach(event *logger.RiskEvent, record *logger.DecisionRecord) {
+	event.Action = at.config.RiskBreachAction
+	stopUntil := at.now().Add(at.config.StopTradingTime)
+
+	var message string
+	switch event.Type {
+	case "daily_loss":
+		// 日亏损超限：至少暂停到下一个UTC日（届时重置日盈亏基准）
+		if nextDay := at.state.DayStart.Add(24 * time.Hour); nextDay.After(stopUntil) {
+			stopUntil = nextDay
+		}
+		message = fmt.Sprintf("日亏损%.2f%%超过限制%.2f%%（当日起始净值%.2f → 当前%.2f）",
+			event.LossPct, event.LimitPct, event.Baseline, event.Equity)
+	case "max_drawdown":
+		// 回撤超限：保留原最高净值，净值恢复到限制以内之前暂停结束后会再次触发
+		// 需要以当前净值重新开始时，停止trader后手动修改状态文件中的peak_equity
+		message = fmt.Sprintf("回撤%.2f%%超过限制%.2f%%（最高净值%.2f → 当前%.2f）",
+			event.LossPct, event.LimitPct, event.Baseline, event.Equity)
+	}
+	event.StopUntil = stopUntil
+
+	log.Printf("🚨 风控触发: %s，处理方式: %s，暂停交易至 %s",
+		message, event.Action, stopUntil.Format("2006-01-02 15:04:05"))
+
+	if event.Action == "close_all" {
+		at.closeAllPositions(record)
+	}
+
+	at.state.StopUntil = stopUntil
+	at.state.LastRiskEvent = message
+	saveTraderState(at.stateFile, at.state)
+
+	record.RiskEvent = event
+	record.Success = false
+	record.ErrorMessage = "触发风控: " + message
+}
+
+// closeAllPositions 平掉所有持仓并记录到决策日志（风控触发时使用）
+func (at *AutoTrader) closeAllPositions(record *logger.DecisionRecord) {
+	// 先撤销所有待成交的限价开仓单，避免平仓后再成交
+	for _, key := range sortedPendingKeys(at.state.PendingEntries) {
+		entry := at.state.PendingEntries[key]
+		if _, err := at.cancelPendingEntry(entry.Symbol, entry.Side); err != nil {
+			log.Printf("❌ 风控撤销限价单失败 (%s %s): %v", entry.Symbol, entry.Side, err)
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 撤销限价单失败: %v", entry.Symbol, entry.Side, err))
+		}
+	}
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		log.Printf("❌ 风控平仓获取持仓失败: %v", err)
+		record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ 风控平仓获取持仓失败: %v", err))
+		return
+	}
+
+	for _, pos := range positions {
+		d := decision.Decision{
+			Symbol:    pos.Symbol,
+			Action:    "close_" + pos.Side,
+			Reasoning: "风控触发强制平仓",
+		}
+		actionRecord := logger.DecisionAction{
+			Action:    d.Action,
+			Symbol:    d.Symbol,
+			Timestamp: at.now(),
+		}
+
+		if err := at.executeDecisionWithRecord(&d, &actionRecord); err != nil {
+			log.Printf("❌ 风控平仓失败 (%s %s): %v", d.Symbol, d.Action, err)
+			actionRecord.Error = err.Error()
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 失败: %v", d.Symbol, d.Action, err))
+		} else {
+			actionRecord.Success = true
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("✓ %s %s 成功", d.Symbol, d.Action))
+		}
+		record.Decisions = append(record.Decisions, actionRecord)
+	}
+}
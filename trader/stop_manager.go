@@ -0,0 +1,196 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"nofx/decision"
+	"nofx/logger"
+	"strings"
+)
+
+// minStopStep 止损每次移动的最小幅度（相对当前价格），避免每个周期频繁撤单重挂
+const minStopStep = 0.001
+
+// StopManagementConfig 止损管理配置（字段为0时不启用）
+type StopManagementConfig struct {
+	TrailingPct        float64 // 百分比追踪止损：止损价保持在最优价格回撤该百分比处
+	TrailingATR        float64 // ATR追踪止损：止损距离为4小时ATR14的倍数
+	BreakEvenPct       float64 // 浮盈达到该百分比后将止损移至开仓价
+	BreakEvenOffsetPct float64 // 保本止损相对开仓价向有利方向的偏移百分比
+}
+
+// enabled 是否启用了任一止损管理规则
+func (c StopManagementConfig) enabled() bool {
+	return c.TrailingPct > 0 || c.TrailingATR > 0 || c.BreakEvenPct > 0
+}
+
+// managedStop 持仓的止损跟踪状态
+type managedStop struct {
+	StopLoss  float64 `json:"stop_loss"`  // 当前止损价（下单失败时也记录，对账时补挂）
+	BestPrice float64 `json:"best_price"` // 持仓期间的最优价格（多仓最高价，空仓最低价）
+	BreakEven bool    `json:"break_even"` // 是否已移至保本
+
+	TakeProfit float64       `json:"take_profit,omitempty"` // 最终止盈价（阶梯档位之外的剩余仓位）
+	Ladder     []ladderLevel `json:"ladder,omitempty"`      // 尚未成交的分批止盈档位（按价格由近到远）
+}
+
+// manageStops 按追踪止损和保本规则移动持仓止损（只向有利方向移动）
+func (at *AutoTrader) manageStops(ctx *decision.Context, record *logger.DecisionRecord) {
+	cfg := at.config.StopManagement
+	if !cfg.enabled() {
+		return
+	}
+
+	for _, pos := range ctx.Positions {
+		key := pos.Symbol + "_" + pos.Side
+		ms, exists := at.state.Stops[key]
+		if !exists || ms.StopLoss <= 0 {
+			continue // 没有已知止损的持仓（如手动开仓）不做管理
+		}
+
+		price := pos.MarkPrice
+		isLong := pos.Side == "long"
+		if ms.BestPrice == 0 || (isLong && price > ms.BestPrice) || (!isLong && price < ms.BestPrice) {
+			ms.BestPrice = price
+		}
+
+		newStop, reason := ms.StopLoss, ""
+		better := func(candidate float64, why string) {
+			if candidate <= 0 {
+				return
+			}
+			if (isLong && candidate > newStop) || (!isLong && candidate < newStop) {
+				newStop, reason = candidate, why
+			}
+		}
+
+		// 1. 百分比追踪
+		if cfg.TrailingPct > 0 {
+			if isLong {
+				better(ms.BestPrice*(1-cfg.TrailingPct/100), fmt.Sprintf("追踪止损%.2f%%", cfg.TrailingPct))
+			} else {
+				better(ms.BestPrice*(1+cfg.TrailingPct/100), fmt.Sprintf("追踪止损%.2f%%", cfg.TrailingPct))
+			}
+		}
+
+		// 2. ATR追踪
+		if cfg.TrailingATR > 0 {
+			if data, err := at.marketDataFetcher(pos.Symbol); err != nil {
+				log.Printf("  ⚠ 获取 %s 市场数据失败，跳过ATR追踪止损: %v", pos.Symbol, err)
+			} else if data.LongerTermContext != nil && data.LongerTermContext.ATR14 > 0 {
+				distance := data.LongerTermContext.ATR14 * cfg.TrailingATR
+				if isLong {
+					better(ms.BestPrice-distance, fmt.Sprintf("ATR追踪止损%.1f×ATR", cfg.TrailingATR))
+				} else {
+					better(ms.BestPrice+distance, fmt.Sprintf("ATR追踪止损%.1f×ATR", cfg.TrailingATR))
+				}
+			}
+		}
+
+		// 3. 保本（止损移动成功后才标记，失败时下个周期重试）
+		breakEven := false
+		if cfg.BreakEvenPct > 0 && !ms.BreakEven {
+			if isLong && price >= pos.EntryPrice*(1+cfg.BreakEvenPct/100) {
+				better(pos.EntryPrice*(1+cfg.BreakEvenOffsetPct/100), "保本止损")
+				breakEven = true
+			} else if !isLong && price <= pos.EntryPrice*(1-cfg.BreakEvenPct/100) {
+				better(pos.EntryPrice*(1-cfg.BreakEvenOffsetPct/100), "保本止损")
+				breakEven = true
+			}
+		}
+
+		// 变动过小或止损已越过当前价时不调整
+		if math.Abs(newStop-ms.StopLoss) < price*minStopStep ||
+			(isLong && newStop >= price) || (!isLong && newStop <= price) {
+			continue
+		}
+
+		actionRecord := logger.DecisionAction{
+			Action:    "update_stop",
+			Symbol:    pos.Symbol,
+			Quantity:  pos.Quantity,
+			Price:     newStop,
+			Timestamp: at.now(),
+		}
+		if err := at.replaceStopLoss(pos.Symbol, pos.Side, pos.Quantity, newStop); err != nil {
+			log.Printf("❌ 移动止损失败 (%s %s): %v", pos.Symbol, pos.Side, err)
+			actionRecord.Error = err.Error()
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 移动止损失败: %v", pos.Symbol, pos.Side, err))
+		} else {
+			log.Printf("🔒 %s %s %s: 止损 → %.4f (当前价%.4f)", pos.Symbol, pos.Side, reason, newStop, price)
+			actionRecord.Success = true
+			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("🔒 %s %s %s: 止损 → %.4f", pos.Symbol, pos.Side, reason, newStop))
+			ms.BreakEven = ms.BreakEven || breakEven
+		}
+		record.Decisions = append(record.Decisions, actionRecord)
+	}
+}
+
+// executeUpdateStopWithRecord 执行AI的移动止损决策
+func (at *AutoTrader) executeUpdateStopWithRecord(d *decision.Decision, actionRecord *logger.DecisionAction) error {
+	log.Printf("  🔒 移动止损: %s → %.4f", d.Symbol, d.StopLoss)
+
+	pos, err := at.findSinglePosition(d.Symbol)
+	if err != nil {
+		return err
+	}
+
+	// 止损价必须在当前价格的亏损一侧，否则会立即触发
+	if (pos.Side == "long" && d.StopLoss >= pos.MarkPrice) || (pos.Side == "short" && d.StopLoss <= pos.MarkPrice) {
+		return fmt.Errorf("%s %s 止损价%.4f无效（当前价%.4f）", d.Symbol, pos.Side, d.StopLoss, pos.MarkPrice)
+	}
+
+	actionRecord.Quantity = pos.Quantity
+	actionRecord.Price = d.StopLoss
+	return at.replaceStopLoss(pos.Symbol, pos.Side, pos.Quantity, d.StopLoss)
+}
+
+// replaceStopLoss 撤销持仓当前的止损单并按新价格重挂（只替换止损单，不影响止盈和其他挂单）
+// 部分交易所同方向只允许一个全仓止损单，因此先撤后挂；重挂失败时尝试恢复原止损
+func (at *AutoTrader) replaceStopLoss(symbol, side string, quantity, stopPrice float64) error {
+	positionSide := strings.ToUpper(side)
+
+	orders, err := at.trader.GetOpenOrders(symbol)
+	if err != nil {
+		return fmt.Errorf("获取挂单失败: %w", err)
+	}
+	for _, o := range orders {
+		if o.Type != "STOP_MARKET" || orderPositionSide(o) != positionSide {
+			continue
+		}
+		if err := at.trader.CancelOrder(symbol, o.OrderID); err != nil {
+			return fmt.Errorf("撤销原止损单失败: %w", err)
+		}
+	}
+
+	key := symbol + "_" + side
+	if err := at.trader.SetStopLoss(symbol, positionSide, quantity, stopPrice); err != nil {
+		if ms, exists := at.state.Stops[key]; exists && ms.StopLoss > 0 {
+			if restoreErr := at.trader.SetStopLoss(symbol, positionSide, quantity, ms.StopLoss); restoreErr != nil {
+				log.Printf("  ⚠ 恢复原止损失败，%s %s 当前没有止损保护: %v", symbol, side, restoreErr)
+			}
+		}
+		return err
+	}
+
+	if ms, exists := at.state.Stops[key]; exists {
+		ms.StopLoss = stopPrice
+	} else {
+		at.state.Stops[key] = &managedStop{StopLoss: stopPrice}
+	}
+	saveTraderState(at.stateFile, at.state)
+	return nil
+}
+
+// orderPositionSide 挂单所属的持仓方向（单向持仓模式下根据买卖方向推断）
+func orderPositionSide(o Order) string {
+	if o.PositionSide == "LONG" || o.PositionSide == "SHORT" {
+		return o.PositionSide
+	}
+	closing := o.ReduceOnly || o.Type == "STOP_MARKET" || o.Type == "TAKE_PROFIT_MARKET"
+	if (o.Side == "SELL") == closing {
+		return "LONG"
+	}
+	return "SHORT"
+}
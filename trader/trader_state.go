@@ -0,0 +1,101 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// traderState AutoTrader运行状态（持久化到磁盘，进程重启后恢复）
+type traderState struct {
+	StartTime        time.Time        `json:"start_time"`         // 首次启动时间（运行时长以此计算）
+	CallCount        int              `json:"call_count"`         // AI调用次数
+	PositionOpenTime map[string]int64 `json:"position_open_time"` // 持仓开仓时间 (symbol_side -> timestamp毫秒)
+	DailyPnL         float64          `json:"daily_pnl"`          // 当日盈亏（含未实现盈亏）
+
+	DayStart       time.Time `json:"day_start"`        // 当日起始时间（UTC零点）
+	DayStartEquity float64   `json:"day_start_equity"` // 当日起始净值（日盈亏基准）
+	PeakEquity     float64   `json:"peak_equity"`      // 最高净值（回撤基准）
+	StopUntil      time.Time `json:"stop_until"`       // 风控暂停交易截止时间
+	LastRiskEvent  string    `json:"last_risk_event"`  // 最近一次风控触发说明
+
+	LastClose map[string]time.Time `json:"last_close"` // 币种最近平仓时间（冷却规则使用）
+
+	PendingEntries map[string]*pendingEntry `json:"pending_entries"` // 等待成交的限价开仓单 (symbol_side -> 挂单)
+	Stops          map[string]*managedStop  `json:"stops"`           // 持仓当前止损、止盈阶梯及追踪状态 (symbol_side -> 止损)
+	PositionQty    map[string]float64       `json:"position_qty"`    // 上个周期的持仓数量（识别止盈阶梯成交等交易所侧减仓）
+	Adds           map[string]int           `json:"adds"`            // 持仓已加仓次数 (symbol_side -> 次数)
+	LastReconcile  time.Time                `json:"last_reconcile"`  // 上次对账时间（查询交易所成交记录的起点）
+	LastIncome     time.Time                `json:"last_income"`     // 上次查询资金费流水的时间（新出现币种的查询起点）
+	IncomeCursors  map[string]time.Time     `json:"income_cursors"`  // 各币种资金费流水查询起点 (symbol -> 时间)
+	OwnCloses      map[int64]int64          `json:"own_closes"`      // 本程序主动下的平仓单（订单ID -> 下单时间毫秒，对账时排除这些成交）
+}
+
+// loadTraderState 从磁盘加载运行状态（文件不存在时返回空状态，文件损坏时备份后返回空状态）
+func loadTraderState(path string) (*traderState, error) {
+	state := &traderState{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取trader状态失败: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			backup := path + ".corrupt"
+			log.Printf("⚠ 解析trader状态失败，已备份到 %s 并使用空状态启动: %v", backup, err)
+			if err := os.Rename(path, backup); err != nil {
+				log.Printf("⚠ 备份损坏的trader状态失败: %v", err)
+			}
+			state = &traderState{}
+		}
+	}
+	if state.PositionOpenTime == nil {
+		state.PositionOpenTime = make(map[string]int64)
+	}
+	if state.LastClose == nil {
+		state.LastClose = make(map[string]time.Time)
+	}
+	if state.PendingEntries == nil {
+		state.PendingEntries = make(map[string]*pendingEntry)
+	}
+	if state.Stops == nil {
+		state.Stops = make(map[string]*managedStop)
+	}
+	if state.PositionQty == nil {
+		state.PositionQty = make(map[string]float64)
+	}
+	if state.Adds == nil {
+		state.Adds = make(map[string]int)
+	}
+	if state.OwnCloses == nil {
+		state.OwnCloses = make(map[int64]int64)
+	}
+	if state.IncomeCursors == nil {
+		state.IncomeCursors = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+// saveTraderState 保存运行状态到磁盘（先写临时文件再重命名，写入中断时不会损坏原文件）
+func saveTraderState(path string, state *traderState) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("⚠ 创建trader状态目录失败: %v", err)
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		log.Printf("⚠ 序列化trader状态失败: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("⚠ 写入trader状态失败: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		log.Printf("⚠ 写入trader状态失败: %v", err)
+	}
+}
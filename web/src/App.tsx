@@ -486,7 +486,10 @@ function TraderDetailsPage({
                     <td className="py-3 font-mono font-bold" style={{ color: '#EAECEF' }}>
                       {(pos.quantity * pos.mark_price).toFixed(2)} USDT
                     </td>
-                    <td className="py-3 font-mono" style={{ color: '#F0B90B' }}>{pos.leverage}x</td>
+                    <td className="py-3 font-mono" style={{ color: '#F0B90B' }}>
+                      {pos.leverage}x
+                      {pos.margin_mode && <span className="ml-1 text-xs" style={{ color: '#848E9C' }}>{pos.margin_mode}</span>}
+                    </td>
                     <td className="py-3 font-mono">
                       <span
                         style={{ color: pos.unrealized_pnl >= 0 ? '#0ECB81' : '#F6465D', fontWeight: 'bold' }}
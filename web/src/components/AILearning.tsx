@@ -14,10 +14,15 @@ interface TradeOutcome {
   margin_used: number;
   pn_l: number;
   pn_l_pct: number;
+  gross_pnl?: number;
+  fees?: number;
+  funding?: number;
   duration: string;
   open_time: string;
   close_time: string;
   was_stop_loss: boolean;
+  exits?: number;
+  entries?: number;
 }
 
 interface SymbolPerformance {
@@ -28,6 +33,9 @@ interface SymbolPerformance {
   win_rate: number;
   total_pn_l: number;
   avg_pn_l: number;
+  gross_pnl?: number;
+  fees?: number;
+  funding?: number;
 }
 
 interface PerformanceAnalysis {
@@ -39,6 +47,10 @@ interface PerformanceAnalysis {
   avg_loss: number;
   profit_factor: number;
   sharpe_ratio: number;
+  gross_pnl?: number;
+  total_fees?: number;
+  total_funding?: number;
+  net_pnl?: number;
   recent_trades: TradeOutcome[];
   symbol_stats: { [key: string]: SymbolPerformance };
   best_symbol: string;
@@ -552,12 +564,14 @@ export default function AILearning({ traderId }: AILearningProps) {
                         <div style={{ color: '#94A3B8' }}>{t('entry', language)}</div>
                         <div className="font-mono font-semibold" style={{ color: '#CBD5E1' }}>
                           {trade.open_price.toFixed(4)}
+                          {trade.entries && trade.entries > 1 ? ` (×${trade.entries})` : ''}
                         </div>
                       </div>
                       <div className="text-right">
                         <div style={{ color: '#94A3B8' }}>{t('exit', language)}</div>
                         <div className="font-mono font-semibold" style={{ color: '#CBD5E1' }}>
                           {trade.close_price.toFixed(4)}
+                          {trade.exits && trade.exits > 1 ? ` (×${trade.exits})` : ''}
                         </div>
                       </div>
                     </div>
@@ -601,6 +615,13 @@ export default function AILearning({ traderId }: AILearningProps) {
                           {isProfitable ? '+' : ''}{trade.pn_l.toFixed(2)} USDT
                         </span>
                       </div>
+                      {(trade.fees || trade.funding) ? (
+                        <div className="flex items-center justify-between text-xs mt-1 font-mono" style={{ color: '#94A3B8' }}>
+                          <span>Gross {(trade.gross_pnl || 0) >= 0 ? '+' : ''}{(trade.gross_pnl || 0).toFixed(2)}</span>
+                          <span>Fees -{(trade.fees || 0).toFixed(2)}</span>
+                          <span>Funding {(trade.funding || 0) >= 0 ? '+' : ''}{(trade.funding || 0).toFixed(2)}</span>
+                        </div>
+                      ) : null}
                     </div>
 
                     <div className="flex items-center justify-between text-xs" style={{ color: '#94A3B8' }}>
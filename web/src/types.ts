@@ -48,9 +48,13 @@ export interface DecisionAction {
   leverage: number;
   price: number;
   order_id: number;
+  fee?: number;
   timestamp: string;
   success: boolean;
   error?: string;
+  pending?: boolean;
+  partial?: boolean;
+  reconciled?: boolean;
 }
 
 export interface AccountSnapshot {
@@ -82,6 +86,18 @@ export interface Statistics {
   failed_cycles: number;
   total_open_positions: number;
   total_close_positions: number;
+  usage?: TokenUsage;
+  usage_by_day?: Record<string, TokenUsage>;
+  avg_cost_per_cycle?: number;
+}
+
+// AI调用token用量和估算费用
+export interface TokenUsage {
+  prompt_tokens: number;
+  completion_tokens: number;
+  reasoning_tokens: number;
+  total_tokens: number;
+  cost_usd: number;
 }
 
 // 新增：竞赛相关类型
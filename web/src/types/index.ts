@@ -37,6 +37,7 @@ export interface Position {
   unrealized_pnl_pct: number;
   liquidation_price: number;
   margin_used: number;
+  margin_mode?: 'isolated' | 'cross';
 }
 
 // 决策动作
@@ -47,9 +48,13 @@ export interface DecisionAction {
   leverage: number;
   price: number;
   order_id: number;
+  fee?: number;
   timestamp: string;
   success: boolean;
   error: string;
+  pending?: boolean;
+  partial?: boolean;
+  reconciled?: boolean;
 }
 
 // 决策记录
@@ -90,4 +95,16 @@ export interface Statistics {
   failed_cycles: number;
   total_open_positions: number;
   total_close_positions: number;
+  usage?: TokenUsage;
+  usage_by_day?: Record<string, TokenUsage>;
+  avg_cost_per_cycle?: number;
+}
+
+// AI调用token用量和估算费用
+export interface TokenUsage {
+  prompt_tokens: number;
+  completion_tokens: number;
+  reasoning_tokens: number;
+  total_tokens: number;
+  cost_usd: number;
 }